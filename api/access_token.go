@@ -0,0 +1,199 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const defaultAccessTokenExpiration = 30 * 24 * time.Hour
+
+// title: create access token
+// path: /users/tokens
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Token created
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   409: Token already exists
+func createAccessToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	email := t.GetUserName()
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	expiresAt, scopes, err := accessTokenParams(r)
+	if err != nil {
+		return err
+	}
+	if parent, ok := t.(*auth.AccessToken); ok {
+		if len(parent.Scopes) > 0 {
+			err = checkScopesAllowed(t, scopes)
+			if err != nil {
+				return err
+			}
+		}
+		if r.FormValue("expires_at") == "" && expiresAt.After(parent.ExpiresAt) {
+			expiresAt = parent.ExpiresAt
+		}
+		if expiresAt.After(parent.ExpiresAt) {
+			return &errors.HTTP{
+				Code:    http.StatusForbidden,
+				Message: "Tokens created using an access token must not expire after it.",
+			}
+		}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	token, err := auth.CreateAccessToken(u, r.FormValue("name"), expiresAt, scopes)
+	if err == auth.ErrAccessTokenAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(token)
+}
+
+// accessTokenParams reads the expiration and the scopes of a new access token
+// from the request form.
+func accessTokenParams(r *http.Request) (time.Time, []auth.AccessTokenScope, error) {
+	expiration := defaultAccessTokenExpiration
+	if maxExpiration := auth.AccessTokenMaxExpiration(); maxExpiration < expiration {
+		expiration = maxExpiration
+	}
+	expiresAt := time.Now().Add(expiration)
+	if v := r.FormValue("expires_at"); v != "" {
+		var err error
+		expiresAt, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			msg := `Parameter "expires_at" must be a RFC3339 timestamp.`
+			return expiresAt, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	scopes := make([]auth.AccessTokenScope, 0, len(r.Form["scope"]))
+	for _, v := range r.Form["scope"] {
+		scope, err := auth.ParseAccessTokenScope(v)
+		if err != nil {
+			return expiresAt, nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return expiresAt, scopes, nil
+}
+
+// checkScopesAllowed ensures that tokens created using a scoped access token
+// do not grant more than the token itself.
+func checkScopesAllowed(t auth.Token, scopes []auth.AccessTokenScope) error {
+	if len(scopes) == 0 {
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: "Tokens created using a scoped access token must have scopes.",
+		}
+	}
+	perms, err := t.Permissions()
+	if err != nil {
+		return err
+	}
+	for _, s := range scopes {
+		p, err := s.Permission()
+		if err != nil {
+			return err
+		}
+		if !permission.CheckFromPermList(perms, p.Scheme, p.Context) {
+			return &errors.HTTP{
+				Code:    http.StatusForbidden,
+				Message: fmt.Sprintf("Scope %q is not granted by the current access token.", s),
+			}
+		}
+	}
+	return nil
+}
+
+// title: list access tokens
+// path: /users/tokens
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func listAccessTokens(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	tokens, err := auth.ListAccessTokens(t.GetUserName())
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// title: revoke access token
+// path: /users/tokens/{name}
+// method: DELETE
+// responses:
+//   200: Token revoked
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Token not found
+func revokeAccessToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	email := t.GetUserName()
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	name := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RevokeAccessToken(email, name)
+	if err == auth.ErrAccessTokenNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *AuthSuite) createAccessTokenRequest(c *check.C, token string, form url.Values) *httptest.ResponseRecorder {
+	request, err := http.NewRequest("POST", "/1.6/users/tokens", strings.NewReader(form.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) TestCreateAccessToken(c *check.C) {
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	recorder := s.createAccessTokenRequest(c, s.token.GetValue(), url.Values{
+		"name":       {"ci"},
+		"expires_at": {expires.Format(time.RFC3339)},
+		"scope":      {"app.deploy:app:myapp", "app.read"},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var token auth.AccessToken
+	err := json.NewDecoder(recorder.Body).Decode(&token)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.Token, check.Not(check.Equals), "")
+	c.Assert(token.Name, check.Equals, "ci")
+	c.Assert(token.UserEmail, check.Equals, s.user.Email)
+	c.Assert(token.ExpiresAt.Equal(expires), check.Equals, true)
+	c.Assert(token.Scopes, check.DeepEquals, []auth.AccessTokenScope{
+		{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"},
+		{Scheme: "app.read"},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(s.user.Email),
+		Owner:  s.user.Email,
+		Kind:   "user.update.token",
+	}, eventtest.HasEvent)
+	request, err := http.NewRequest("GET", "/1.6/users/tokens", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var tokens []auth.AccessToken
+	err = json.NewDecoder(recorder.Body).Decode(&tokens)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+	c.Assert(tokens[0].Token, check.Equals, "")
+	c.Assert(tokens[0].LastUsedAt.IsZero(), check.Equals, false)
+}
+
+func (s *AuthSuite) TestCreateAccessTokenInvalid(c *check.C) {
+	tests := []url.Values{
+		{"expires_at": {time.Now().Add(time.Hour).Format(time.RFC3339)}},
+		{"name": {"ci"}, "expires_at": {"tomorrow"}},
+		{"name": {"ci"}, "expires_at": {time.Now().Add(-time.Hour).Format(time.RFC3339)}},
+		{"name": {"ci"}, "expires_at": {time.Now().Add(400 * 24 * time.Hour).Format(time.RFC3339)}},
+		{"name": {"ci"}, "scope": {"app.invalid"}},
+		{"name": {"ci"}, "scope": {"app.deploy:pool"}},
+	}
+	for _, form := range tests {
+		recorder := s.createAccessTokenRequest(c, s.token.GetValue(), form)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("form: %v", form))
+	}
+}
+
+func (s *AuthSuite) TestCreateAccessTokenDuplicated(c *check.C) {
+	recorder := s.createAccessTokenRequest(c, s.token.GetValue(), url.Values{"name": {"ci"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	recorder = s.createAccessTokenRequest(c, s.token.GetValue(), url.Values{"name": {"ci"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *AuthSuite) TestCreateAccessTokenFromScopedToken(c *check.C) {
+	parent, err := auth.CreateAccessToken(s.user, "parent", time.Now().Add(time.Hour), []auth.AccessTokenScope{
+		{Scheme: "user.update.token"},
+		{Scheme: "app.read"},
+	})
+	c.Assert(err, check.IsNil)
+	recorder := s.createAccessTokenRequest(c, parent.Token, url.Values{"name": {"unscoped"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.createAccessTokenRequest(c, parent.Token, url.Values{"name": {"wider"}, "scope": {"app.deploy"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.createAccessTokenRequest(c, parent.Token, url.Values{"name": {"narrower"}, "scope": {"app.read:app:myapp"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+}
+
+func (s *AuthSuite) TestCreateAccessTokenFromAccessTokenExpiration(c *check.C) {
+	parent, err := auth.CreateAccessToken(s.user, "parent", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	recorder := s.createAccessTokenRequest(c, parent.Token, url.Values{
+		"name":       {"later"},
+		"expires_at": {time.Now().Add(2 * time.Hour).Format(time.RFC3339)},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.createAccessTokenRequest(c, parent.Token, url.Values{"name": {"default"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var token auth.AccessToken
+	err = json.NewDecoder(recorder.Body).Decode(&token)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.ExpiresAt.After(parent.ExpiresAt), check.Equals, false)
+}
+
+func (s *AuthSuite) TestCreateAccessTokenScopedWithoutPermission(c *check.C) {
+	parent, err := auth.CreateAccessToken(s.user, "parent", time.Now().Add(time.Hour), []auth.AccessTokenScope{
+		{Scheme: "app.read"},
+	})
+	c.Assert(err, check.IsNil)
+	recorder := s.createAccessTokenRequest(c, parent.Token, url.Values{"name": {"other"}, "scope": {"app.read"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestAPIKeyWithAccessToken(c *check.C) {
+	token, err := auth.CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), []auth.AccessTokenScope{
+		{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	for _, method := range []string{"GET", "POST"} {
+		request, err := http.NewRequest(method, "/users/api-key", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+token.Token)
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	}
+	u, err := auth.GetUserByEmail(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.APIKey, check.Equals, s.user.APIKey)
+}
+
+func (s *AuthSuite) TestListAccessTokensEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/1.6/users/tokens", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *AuthSuite) TestRevokeAccessToken(c *check.C) {
+	token, err := auth.CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/1.6/users/tokens/ci", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = auth.AccessTokenAuth("bearer " + token.Token)
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(s.user.Email),
+		Owner:  s.user.Email,
+		Kind:   "user.update.token",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "ci"},
+		},
+	}, eventtest.HasEvent)
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -351,6 +351,9 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 				Message: "In order to create an app, you should be member of at least one team",
 			}
 		}
+		if e, ok := err.(*quota.TeamQuotaExceededError); ok {
+			return &errors.HTTP{Code: http.StatusForbidden, Message: e.Error()}
+		}
 		if e, ok := err.(*app.AppCreationError); ok {
 			if e.Err == app.ErrAppAlreadyExists {
 				return &errors.HTTP{Code: http.StatusConflict, Message: e.Error()}
@@ -486,6 +489,9 @@ func updateApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 	if err == appTypes.ErrPlanNotFound {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
+	if e, ok := err.(*quota.TeamQuotaExceededError); ok {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: e.Error()}
+	}
 	if _, ok := err.(*router.ErrRouterNotFound); ok {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
@@ -1112,11 +1118,42 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
-	source := r.URL.Query().Get("source")
-	unit := r.URL.Query().Get("unit")
 	follow := r.URL.Query().Get("follow")
 	appName := r.URL.Query().Get(":app")
-	filterLog := app.Applog{Source: source, Unit: unit}
+	filter := app.LogFilter{
+		Source: r.URL.Query().Get("source"),
+		Unit:   r.URL.Query().Get("unit"),
+		Grep:   r.URL.Query().Get("grep"),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := r.URL.Query().Get(param.name); v != "" {
+			*param.value, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				msg := fmt.Sprintf(`Parameter %q must be a RFC3339 timestamp.`, param.name)
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+			}
+		}
+	}
+	if v := r.URL.Query().Get("invert"); v != "" {
+		filter.Invert, err = strconv.ParseBool(v)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "invert" must be a boolean.`}
+		}
+	}
+	for _, field := range r.URL.Query()["field"] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "field" must be in the form <name>=<value>.`}
+		}
+		if filter.Fields == nil {
+			filter.Fields = map[string]string{}
+		}
+		filter.Fields[parts[0]] = parts[1]
+	}
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1127,10 +1164,13 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	logs, cursor, err := a.LastLogsPage(lines, filter)
 	if err != nil {
 		return err
 	}
+	if cursor != "" {
+		w.Header().Set("X-Tsuru-Log-Cursor", cursor)
+	}
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(logs)
 	if err != nil {
@@ -1145,7 +1185,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
+	l, err := app.NewLogListener(&a, filter)
 	if err != nil {
 		return err
 	}
@@ -1449,6 +1489,47 @@ func addLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// title: app log rate limit
+// path: /apps/{app}/log-rate-limit
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppLogRateLimit(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppAdminLogRateLimit, contextsForApp(&a)...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid limit",
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppAdminLogRateLimit,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return a.SetLogRateLimit(limit)
+}
+
 // title: app swap
 // path: /swap
 // method: POST
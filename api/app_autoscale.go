@@ -0,0 +1,133 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/autoscale"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+)
+
+// title: list app autoscale rules
+// path: /apps/{app}/autoscale
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appAutoScaleListRules(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppRead, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	rules, err := autoscale.ListAppRules(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&rules)
+}
+
+// title: set app autoscale rule
+// path: /apps/{app}/autoscale
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appAutoScaleSetRule(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppUpdateAutoscaleSet, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	var rule autoscale.AppRule
+	dec := form.NewDecoder(nil)
+	dec.IgnoreCase(true)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&rule, r.Form)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	rule.AppName = a.Name
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleSet,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = rule.Update()
+	if err != nil && rule.Error != "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: delete app autoscale rule
+// path: /apps/{app}/autoscale/{process}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Not found
+func appAutoScaleDeleteRule(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	appName := r.URL.Query().Get(":app")
+	process := r.URL.Query().Get(":process")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	if !permission.Check(t, permission.PermAppUpdateAutoscaleUnset, contextsForApp(&a)...) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleUnset,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.DeleteAppRule(a.Name, process)
+	if err == mgo.ErrNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: "rule not found"}
+	}
+	return err
+}
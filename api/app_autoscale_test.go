@@ -0,0 +1,139 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/autoscale"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppAutoScaleListRules(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	rule := autoscale.AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/myapp/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var rules []autoscale.AppRule
+	err = json.NewDecoder(recorder.Body).Decode(&rules)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []autoscale.AppRule{rule})
+}
+
+func (s *S) TestAppAutoScaleListRulesEmpty(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps/myapp/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAppAutoScaleSetRule(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("Process=web&MinUnits=2&MaxUnits=10&TargetRequestsPerUnit=100&Enabled=true")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/myapp/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := autoscale.ListAppRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []autoscale.AppRule{
+		{AppName: "myapp", Process: "web", MinUnits: 2, MaxUnits: 10, TargetRequestsPerUnit: 100, Enabled: true},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Process", "value": "web"},
+			{"name": "MinUnits", "value": "2"},
+			{"name": "MaxUnits", "value": "10"},
+			{"name": "TargetRequestsPerUnit", "value": "100"},
+			{"name": "Enabled", "value": "true"},
+			{"name": ":app", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAutoScaleSetRuleInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("Process=web&MinUnits=2&MaxUnits=10&TargetCPU=50&TargetMemory=50")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/myapp/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, "invalid rule, exactly one of cpu, memory or requests per unit target must be set\n")
+	c.Assert(eventtest.EventDesc{
+		Target:       appTarget("myapp"),
+		Owner:        s.token.GetUserName(),
+		Kind:         "app.update.autoscale.set",
+		ErrorMatches: `invalid rule, exactly one of.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAutoScaleDeleteRule(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	rule := autoscale.AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/apps/myapp/autoscale/web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := autoscale.ListAppRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.unset",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAutoScaleDeleteRuleNotFound(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/apps/myapp/autoscale/web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, "rule not found\n")
+}
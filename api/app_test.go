@@ -4031,6 +4031,169 @@ func (s *S) TestAppLogSelectByUnit(c *check.C) {
 	c.Assert(logs[0].Unit, check.Equals, "caliban")
 }
 
+func (s *S) TestAppLogSelectByGrepAndTime(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	a.Log("mars error", "mars", "")
+	a.Log("earth log", "earth", "")
+	a.Log("earth error", "earth", "")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	anHourAgo := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&grep=^earth&lines=10&since=%s", a.Name, a.Name, anHourAgo)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "earth log")
+	c.Assert(logs[1].Message, check.Equals, "earth error")
+	url = fmt.Sprintf("/apps/%s/log/?:app=%s&grep=error&invert=1&lines=10", a.Name, a.Name)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs = []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "earth log")
+	url = fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&until=%s", a.Name, a.Name, anHourAgo)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Body.String(), check.Equals, "[]\n")
+}
+
+func (s *S) TestAppLogCursor(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 5; i++ {
+		a.Log(fmt.Sprintf("log %d", i), "tsuru", "")
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=3", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "log 2")
+	cursor := recorder.Header().Get("X-Tsuru-Log-Cursor")
+	c.Assert(cursor, check.Not(check.Equals), "")
+	url = fmt.Sprintf("/apps/%s/log/?:app=%s&lines=3&cursor=%s", a.Name, a.Name, cursor)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs = []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "log 0")
+	c.Assert(logs[1].Message, check.Equals, "log 1")
+	c.Assert(recorder.Header().Get("X-Tsuru-Log-Cursor"), check.Equals, "")
+}
+
+func (s *S) TestAppLogReturnsBadRequestIfSinceIsInvalid(c *check.C) {
+	url := "/apps/something/log/?:app=doesntmatter&lines=10&since=yesterday"
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, `Parameter "since" must be a RFC3339 timestamp.`)
+}
+
+func (s *S) TestAppLogReturnsBadRequestIfGrepIsInvalid(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/lost/log?lines=10&grep=(", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, `invalid grep expression "\(": .*\n`)
+}
+
+func (s *S) TestAppLogSelectByField(c *check.C) {
+	config.Set("app-log:parse-json", true)
+	defer config.Unset("app-log:parse-json")
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	a.Log(`{"level": "error", "request_id": "abc", "status": 500}`, "web", "")
+	a.Log(`{"level": "info", "request_id": "abc", "status": 200}`, "web", "")
+	a.Log(`{"level": "error", "request_id": "def", "status": 500}`, "web", "")
+	a.Log("plain error", "web", "")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&field=level=error&field=status=500", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	logs := []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]interface{}{"level": "error", "request_id": "abc", "status": 500.0})
+	c.Assert(logs[1].Fields["request_id"], check.Equals, "def")
+	url = fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&field=request_id=abc&field=level=info", a.Name, a.Name)
+	request, err = http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	logs = []app.Applog{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Fields["status"], check.Equals, 200.0)
+}
+
+func (s *S) TestAppLogReturnsBadRequestIfFieldIsInvalid(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/lost/log?lines=10&field=level", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Parameter \"field\" must be in the form <name>=<value>.\n")
+}
+
 func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -5090,7 +5253,7 @@ func (s *S) TestAddLog(c *check.C) {
 		"mysource",
 		"mysource",
 	}
-	logs, err := a.LastLogs(5, app.Applog{})
+	logs, err := a.LastLogs(5, app.LogFilter{})
 	c.Assert(err, check.IsNil)
 	got := make([]string, len(logs))
 	gotSource := make([]string, len(logs))
@@ -5116,6 +5279,65 @@ func (s *S) TestGetApp(c *check.C) {
 	c.Assert(app, check.DeepEquals, *expected)
 }
 
+func (s *S) TestSetAppLogRateLimit(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("limit=100")
+	request, err := http.NewRequest("PUT", "/apps/myapp/log-rate-limit", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogRateLimit, check.Equals, 100)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.admin.log-rate-limit",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": "limit", "value": "100"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetAppLogRateLimitInvalidLimit(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("limit=a lot")
+	request, err := http.NewRequest("PUT", "/apps/myapp/log-rate-limit", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid limit\n")
+}
+
+func (s *S) TestSetAppLogRateLimitRequiresAdmin(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("limit=-1")
+	request, err := http.NewRequest("PUT", "/apps/myapp/log-rate-limit", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestSwap(c *check.C) {
 	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&app1, s.user)
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/config"
@@ -29,10 +30,26 @@ import (
 const (
 	nonManagedSchemeMsg = "Authentication scheme does not allow this operation."
 	createDisabledMsg   = "User registration is disabled for non-admin users."
+
+	// twoFactorHeader is set in login responses when the user must provide a
+	// two-factor authentication code in the otp parameter.
+	twoFactorHeader = "X-Tsuru-Two-Factor"
 )
 
 var createDisabledErr = &errors.HTTP{Code: http.StatusUnauthorized, Message: createDisabledMsg}
 
+// checkAPIKeyAllowed refuses access tokens in the API key handlers, the key
+// has every permission of the user and never expires, unlike the tokens.
+func checkAPIKeyAllowed(t auth.Token) error {
+	if _, ok := t.(*auth.AccessToken); ok {
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: "The API key can't be accessed using access tokens.",
+		}
+	}
+	return nil
+}
+
 func handleAuthError(err error) error {
 	if err == auth.ErrUserNotFound {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
@@ -46,6 +63,8 @@ func handleAuthError(err error) error {
 		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
 	case auth.AuthenticationFailure:
 		return &errors.HTTP{Code: http.StatusUnauthorized, Message: err.Error()}
+	case *auth.ErrLoginLocked:
+		return &errors.HTTP{Code: http.StatusTooManyRequests, Message: err.Error()}
 	default:
 		return err
 	}
@@ -118,6 +137,7 @@ func createUser(w http.ResponseWriter, r *http.Request) error {
 //   401: Unauthorized
 //   403: Forbidden
 //   404: Not found
+//   429: Too many failed login attempts
 func login(w http.ResponseWriter, r *http.Request) (err error) {
 	params := map[string]string{
 		"email": r.URL.Query().Get(":email"),
@@ -129,8 +149,15 @@ func login(w http.ResponseWriter, r *http.Request) (err error) {
 	for key := range r.Form {
 		params[key] = r.FormValue(key)
 	}
+	params["ip"] = clientIP(r)
 	token, err := app.AuthScheme.Login(params)
 	if err != nil {
+		if err == auth.ErrTwoFactorCodeRequired {
+			w.Header().Set(twoFactorHeader, "required")
+		}
+		if locked, ok := err.(*auth.ErrLoginLocked); ok {
+			w.Header().Set("Retry-After", retryAfter(locked.Until))
+		}
 		return handleAuthError(err)
 	}
 	return json.NewEncoder(w).Encode(map[string]string{"token": token.GetValue()})
@@ -160,6 +187,9 @@ func changePassword(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	if !ok {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: nonManagedSchemeMsg}
 	}
+	if err = auth.CheckTwoFactorPending(t); err != nil {
+		return handleAuthError(err)
+	}
 	evt, err := event.New(&event.Opts{
 		Target:  userTarget(t.GetUserName()),
 		Kind:    permission.PermUserUpdatePassword,
@@ -239,6 +269,8 @@ var teamRenameFns = []func(oldName, newName string) error{
 	service.RenameServiceInstanceTeam,
 	volume.RenameTeam,
 	pool.RenamePoolTeam,
+	auth.RenameTeamQuota,
+	auth.RenameServiceAccountTeam,
 }
 
 // title: team update
@@ -524,11 +556,16 @@ func teamInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 			}
 		}
 	}
+	quotaInUse, err := app.TeamQuotaInUse(team.Name)
+	if err != nil {
+		return err
+	}
 	result := map[string]interface{}{
 		"name":  team.Name,
 		"users": includedUsers,
 		"pools": pools,
 		"apps":  apps,
+		"quota": teamQuota{Limit: team.Quota, InUse: quotaInUse},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(result)
@@ -641,7 +678,11 @@ func removeKeyFromUser(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 //   200: OK
 //   400: Invalid data
 //   401: Unauthorized
+//   403: Forbidden
 func listKeys(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if err := auth.CheckTwoFactorPending(t); err != nil {
+		return handleAuthError(err)
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
@@ -733,9 +774,13 @@ func authScheme(w http.ResponseWriter, r *http.Request) error {
 // responses:
 //   200: OK
 //   401: Unauthorized
+//   403: Forbidden
 //   404: User not found
 func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	r.ParseForm()
+	if err = checkAPIKeyAllowed(t); err != nil {
+		return err
+	}
 	email := r.URL.Query().Get("user")
 	if email == "" {
 		email = t.GetUserName()
@@ -763,7 +808,7 @@ func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (e
 	}
 	apiKey, err := u.RegenerateAPIKey()
 	if err != nil {
-		return err
+		return handleAuthError(err)
 	}
 	w.Header().Add("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(apiKey)
@@ -776,12 +821,22 @@ func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (e
 // responses:
 //   200: OK
 //   401: Unauthorized
+//   403: Forbidden
 //   404: User not found
 func showAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if err := checkAPIKeyAllowed(t); err != nil {
+		return err
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, u.Email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
 	email := r.URL.Query().Get("user")
 	if email != "" {
 		if !permission.Check(t, permission.PermUserUpdateToken) {
@@ -794,7 +849,7 @@ func showAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	apiKey, err := u.ShowAPIKey()
 	if err != nil {
-		return err
+		return handleAuthError(err)
 	}
 	w.Header().Add("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(apiKey)
@@ -804,6 +859,7 @@ type rolePermissionData struct {
 	Name         string
 	ContextType  string
 	ContextValue string
+	ExpiresAt    *time.Time `json:",omitempty"`
 }
 
 type apiUser struct {
@@ -820,6 +876,9 @@ func createAPIUser(perms []permission.Permission, user *auth.User, roleMap map[s
 	}
 	allGlobal := true
 	for _, userRole := range user.Roles {
+		if userRole.Expired() {
+			continue
+		}
 		role := roleMap[userRole.Name]
 		if role == nil {
 			r, err := permission.FindRole(userRole.Name)
@@ -849,11 +908,16 @@ func createAPIUser(perms []permission.Permission, user *auth.User, roleMap map[s
 		if !allPermsMatch {
 			continue
 		}
-		roleData = append(roleData, rolePermissionData{
+		data := rolePermissionData{
 			Name:         userRole.Name,
 			ContextType:  string(role.ContextType),
 			ContextValue: userRole.ContextValue,
-		})
+		}
+		if !userRole.ExpiresAt.IsZero() {
+			expiresAt := userRole.ExpiresAt
+			data.ExpiresAt = &expiresAt
+		}
+		roleData = append(roleData, data)
 		permData = append(permData, rolePerms...)
 		if role.ContextType != permission.CtxGlobal {
 			allGlobal = false
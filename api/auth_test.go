@@ -642,6 +642,28 @@ func (s *AuthSuite) TestTeamInfoReturns200Success(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusOK)
 }
 
+func (s *AuthSuite) TestTeamInfoReturnsQuota(c *check.C) {
+	teamName := "team-test"
+	err := auth.CreateTeam(teamName, s.user)
+	c.Assert(err, check.IsNil)
+	err = auth.SetTeamQuota(teamName, authTypes.TeamQuota{ServiceInstances: 3, Volumes: 2})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", fmt.Sprintf("/teams/%v", teamName), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result struct {
+		Quota teamQuota
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Quota, check.DeepEquals, teamQuota{
+		Limit: authTypes.TeamQuota{ServiceInstances: 3, Volumes: 2},
+	})
+}
+
 func (s *AuthSuite) TestAddKeyToUser(c *check.C) {
 	b := strings.NewReader("name=the-key&key=my-key")
 	request, err := http.NewRequest("POST", "/users/keys", b)
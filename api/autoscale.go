@@ -174,6 +174,9 @@ func autoScaleHistoryHandler(w http.ResponseWriter, r *http.Request, t auth.Toke
 //   401: Unauthorized
 func autoScaleRunHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	r.ParseForm()
+	if dry, _ := strconv.ParseBool(r.FormValue("dry")); dry {
+		return autoScaleRunDry(w, r, t)
+	}
 	if !permission.Check(t, permission.PermNodeAutoscaleUpdateRun) {
 		return permission.ErrUnauthorized
 	}
@@ -198,3 +201,15 @@ func autoScaleRunHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (
 	}
 	return autoscale.RunOnce(writer)
 }
+
+func autoScaleRunDry(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscaleRead) {
+		return permission.ErrUnauthorized
+	}
+	results, err := autoscale.RunOnceDry(nil)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(results)
+}
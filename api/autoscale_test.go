@@ -109,6 +109,35 @@ func (s *S) TestAutoScaleRunHandler(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAutoScaleRunHandlerDry(c *check.C) {
+	s.provisioner.AddNode(provision.AddNodeOptions{
+		Address: "localhost:1999",
+		Pool:    "pool1",
+	})
+	config.Set("docker:auto-scale:enabled", true)
+	defer config.Unset("docker:auto-scale:enabled")
+	config.Set("docker:auto-scale:max-container-count", 2)
+	defer config.Unset("docker:auto-scale:max-container-count")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/node/autoscale/run", strings.NewReader("dry=true"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var results map[string]autoscale.ScalerResult
+	err = json.Unmarshal(recorder.Body.Bytes(), &results)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.DeepEquals, map[string]autoscale.ScalerResult{
+		"pool1": {ToRebalance: true},
+	})
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
 func (s *S) TestAutoScaleConfigHandler(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
@@ -9,8 +9,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ajg/form"
+	"github.com/gorilla/websocket"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
@@ -26,9 +28,26 @@ import (
 //   200: OK
 //   204: No content
 func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	events, err := event.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+func eventFilterFromRequest(r *http.Request, t auth.Token) (*event.Filter, error) {
 	err := r.ParseForm()
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	var filter *event.Filter
 	dec := form.NewDecoder(nil)
@@ -36,24 +55,118 @@ func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	dec.IgnoreCase(true)
 	err = dec.DecodeValues(&filter, r.Form)
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	filter.LoadKindNames(r.Form)
 	filter.PruneUserValues()
 	filter.Permissions, err = t.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+var eventStreamKeepAlive = 30 * time.Second
+
+// title: event stream
+// path: /events/stream
+// method: GET
+// produce: text/event-stream
+// responses:
+//   101: Switch Protocol to websocket
+//   200: OK
+//   400: Invalid filter
+//   401: Unauthorized
+func eventStream(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilterFromRequest(r, t)
 	if err != nil {
 		return err
 	}
-	events, err := event.List(filter)
+	sub, err := event.Subscribe(filter)
 	if err != nil {
 		return err
 	}
-	if len(events) == 0 {
-		w.WriteHeader(http.StatusNoContent)
+	defer sub.Close()
+	if websocket.IsWebSocketUpgrade(r) {
+		return eventStreamWebsocket(w, r, sub)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	for {
+		select {
+		case <-closeChan:
+			return nil
+		case <-time.After(eventStreamKeepAlive):
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				if err = sub.Err(); err != nil {
+					data, _ := json.Marshal(map[string]string{"Error": err.Error()})
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				}
+				return nil
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return nil
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func eventStreamWebsocket(w http.ResponseWriter, r *http.Request, sub *event.Subscription) error {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
 		return nil
 	}
-	w.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(events)
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ping.C:
+			ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(2*time.Second))
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				code, reason := websocket.CloseNormalClosure, ""
+				if err = sub.Err(); err != nil {
+					code, reason = websocket.CloseTryAgainLater, err.Error()
+				}
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return nil
+			}
+			if err = ws.WriteJSON(msg); err != nil {
+				return nil
+			}
+		}
+	}
 }
 
 // title: kind list
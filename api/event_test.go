@@ -5,15 +5,18 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ajg/form"
+	"github.com/gorilla/websocket"
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -688,3 +691,132 @@ func addBlocks(c *check.C) []*event.Block {
 	}
 	return blocks
 }
+
+func (s *EventSuite) TestEventStreamSSE(c *check.C) {
+	server := httptest.NewServer(RunServer(true))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/1.6/events/stream?target.type=app", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rsp, err := http.DefaultClient.Do(request)
+	c.Assert(err, check.IsNil)
+	defer rsp.Body.Close()
+	c.Assert(rsp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(rsp.Header.Get("Content-Type"), check.Equals, "text/event-stream")
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("deploying")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	reader := bufio.NewReader(rsp.Body)
+	var types []string
+	var msgs []event.StreamMessage
+	for len(msgs) < 3 {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, check.IsNil)
+		if strings.HasPrefix(line, "event: ") {
+			types = append(types, strings.TrimSpace(strings.TrimPrefix(line, "event: ")))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var msg event.StreamMessage
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg)
+			c.Assert(err, check.IsNil)
+			msgs = append(msgs, msg)
+		}
+	}
+	c.Assert(types, check.DeepEquals, []string{"start", "log", "finish"})
+	c.Assert(msgs[0].EventID, check.Equals, evt.UniqueID.Hex())
+	c.Assert(msgs[1].Log, check.Equals, "deploying\n")
+	c.Assert(msgs[2].Event.Running, check.Equals, false)
+}
+
+func (s *EventSuite) TestEventStreamWebsocket(c *check.C) {
+	server := httptest.NewServer(RunServer(true))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/1.6/events/stream"
+	header := http.Header{"Authorization": []string{"bearer " + s.token.GetValue()}}
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	c.Assert(err, check.IsNil)
+	defer ws.Close()
+	forbidden, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: "otherapp"},
+		InternalKind: "healer",
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "other-team")),
+	})
+	c.Assert(err, check.IsNil)
+	err = forbidden.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		InternalKind: "healer",
+		Allowed:      event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	var msg event.StreamMessage
+	err = ws.ReadJSON(&msg)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg.Type, check.Equals, event.StreamMessageStart)
+	c.Assert(msg.EventID, check.Equals, evt.UniqueID.Hex())
+	err = ws.ReadJSON(&msg)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg.Type, check.Equals, event.StreamMessageFinish)
+	c.Assert(msg.EventID, check.Equals, evt.UniqueID.Hex())
+}
+
+func (s *EventSuite) TestEventBlockAddRecurring(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventBlockAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	start := time.Date(2018, time.October, 19, 18, 0, 0, 0, time.UTC)
+	block := &event.Block{
+		KindName:   "app.deploy",
+		Reason:     "weekend freeze",
+		StartTime:  start,
+		EndTime:    start.Add(62 * time.Hour),
+		Recurrence: event.BlockRecurrenceWeekly,
+	}
+	values, err := form.EncodeToValues(block)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/events/blocks", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	blocks, err := event.ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(blocks), check.Equals, 1)
+	c.Assert(blocks[0].Recurrence, check.Equals, event.BlockRecurrenceWeekly)
+	c.Assert(blocks[0].StartTime.Equal(start), check.Equals, true)
+	c.Assert(blocks[0].EndTime.Equal(start.Add(62*time.Hour)), check.Equals, true)
+	c.Assert(blocks[0].NextStart.After(time.Now().Add(-62*time.Hour)), check.Equals, true)
+}
+
+func (s *EventSuite) TestEventBlockAddInvalidRecurrence(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermEventBlockAdd,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	block := &event.Block{KindName: "app.deploy", Reason: "freeze", Recurrence: event.BlockRecurrenceDaily}
+	values, err := form.EncodeToValues(block)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/events/blocks", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "end time is required for recurring blocks\n")
+}
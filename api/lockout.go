@@ -0,0 +1,152 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// clientIP returns the address of the client logging in, used to lock out
+// clients trying too many passwords. The header configured in
+// auth:lockout:client-ip-header is only trusted when set, as it's meant for
+// deployments behind a proxy. Proxies append addresses to the header, so the
+// client address is taken counting auth:lockout:trusted-proxies entries from
+// the right, the ones on its left being sent by the client itself.
+func clientIP(r *http.Request) string {
+	if header, _ := config.GetString("auth:lockout:client-ip-header"); header != "" {
+		var addrs []string
+		for _, value := range r.Header[http.CanonicalHeaderKey(header)] {
+			for _, addr := range strings.Split(value, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) > 0 {
+			hops, err := config.GetInt("auth:lockout:trusted-proxies")
+			if err != nil || hops < 1 {
+				hops = 1
+			}
+			if hops > len(addrs) {
+				hops = len(addrs)
+			}
+			return addrs[len(addrs)-hops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func retryAfter(until time.Time) string {
+	seconds := int(time.Until(until).Seconds() + 1)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+func lockoutScheme() (auth.LockoutScheme, error) {
+	scheme, ok := app.AuthScheme.(auth.LockoutScheme)
+	if !ok {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: nonManagedSchemeMsg}
+	}
+	return scheme, nil
+}
+
+func lockoutContext(kind, value string) permission.PermissionContext {
+	if kind == auth.LockoutKindEmail {
+		return permission.Context(permission.CtxUser, value)
+	}
+	return permission.Context(permission.CtxGlobal, "")
+}
+
+// title: lockout list
+// path: /auth/lockouts
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+func listLockouts(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	scheme, err := lockoutScheme()
+	if err != nil {
+		return err
+	}
+	contexts := permission.ContextsForPermission(t, permission.PermUserUpdateUnlock)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	lockouts, err := scheme.ListLockouts()
+	if err != nil {
+		return err
+	}
+	var result []auth.Lockout
+	for _, l := range lockouts {
+		if permission.Check(t, permission.PermUserUpdateUnlock, lockoutContext(l.Kind, l.Value)) {
+			result = append(result, l)
+		}
+	}
+	if len(result) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
+// title: unlock login
+// path: /auth/lockouts/{kind}/{value}
+// method: DELETE
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Not found
+func unlockLogin(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := lockoutScheme()
+	if err != nil {
+		return err
+	}
+	kind := r.URL.Query().Get(":kind")
+	value := r.URL.Query().Get(":value")
+	ctx := lockoutContext(kind, value)
+	if !permission.Check(t, permission.PermUserUpdateUnlock, ctx) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeLockout, Value: kind + ":" + value},
+		Kind:    permission.PermUserUpdateUnlock,
+		Owner:   t,
+		Allowed: event.Allowed(permission.PermUserReadEvents, ctx),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = scheme.Unlock(kind, value)
+	if err == auth.ErrLockoutNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return handleAuthError(err)
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *AuthSuite) lockUser(c *check.C, email string) {
+	config.Set("auth:lockout:max-attempts", 2)
+	for i := 0; i < 2; i++ {
+		recorder := s.twoFactorRequest(c, "POST", "/users/"+email+"/tokens", "", url.Values{"password": {"wrong1"}})
+		c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	}
+}
+
+func (s *AuthSuite) TestLoginLockedOut(c *check.C) {
+	defer config.Unset("auth:lockout:max-attempts")
+	u := &auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	s.lockUser(c, u.Email)
+	recorder := s.twoFactorRequest(c, "POST", "/users/nobody@globo.com/tokens", "", url.Values{"password": {"123456"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusTooManyRequests)
+	retry, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	c.Assert(err, check.IsNil)
+	c.Assert(retry > 0, check.Equals, true)
+}
+
+func (s *AuthSuite) TestClientIP(c *check.C) {
+	request, err := http.NewRequest("POST", "/users/x@x.com/tokens", nil)
+	c.Assert(err, check.IsNil)
+	request.RemoteAddr = "10.0.0.1:4242"
+	request.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.2")
+	c.Assert(clientIP(request), check.Equals, "10.0.0.1")
+	config.Set("auth:lockout:client-ip-header", "X-Forwarded-For")
+	defer config.Unset("auth:lockout:client-ip-header")
+	c.Assert(clientIP(request), check.Equals, "10.0.0.2")
+	request.Header.Add("X-Forwarded-For", "10.0.0.3")
+	c.Assert(clientIP(request), check.Equals, "10.0.0.3")
+	config.Set("auth:lockout:trusted-proxies", 2)
+	defer config.Unset("auth:lockout:trusted-proxies")
+	c.Assert(clientIP(request), check.Equals, "10.0.0.2")
+	config.Set("auth:lockout:trusted-proxies", 5)
+	c.Assert(clientIP(request), check.Equals, "192.168.0.1")
+}
+
+func (s *AuthSuite) TestListAndUnlockLockouts(c *check.C) {
+	defer config.Unset("auth:lockout:max-attempts")
+	u := &auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	s.lockUser(c, u.Email)
+	recorder := s.twoFactorRequest(c, "GET", "/1.6/auth/lockouts", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var lockouts []auth.Lockout
+	err = json.NewDecoder(recorder.Body).Decode(&lockouts)
+	c.Assert(err, check.IsNil)
+	c.Assert(lockouts, check.HasLen, 1)
+	c.Assert(lockouts[0].Kind, check.Equals, auth.LockoutKindEmail)
+	c.Assert(lockouts[0].Value, check.Equals, u.Email)
+	recorder = s.twoFactorRequest(c, "DELETE", "/1.6/auth/lockouts/email/nobody@globo.com", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeLockout, Value: "email:" + u.Email},
+		Owner:  s.token.GetUserName(),
+		Kind:   "user.update.unlock",
+	}, eventtest.HasEvent)
+	recorder = s.twoFactorRequest(c, "POST", "/users/nobody@globo.com/tokens", "", url.Values{"password": {"123456"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "DELETE", "/1.6/auth/lockouts/email/nobody@globo.com", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	recorder = s.twoFactorRequest(c, "GET", "/1.6/auth/lockouts", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *AuthSuite) TestUnlockLockoutUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermUserUpdateUnlock,
+		Context: permission.Context(permission.CtxUser, "nobody@globo.com"),
+	})
+	recorder := s.twoFactorRequest(c, "DELETE", "/1.6/auth/lockouts/ip/10.0.0.1", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "DELETE", "/1.6/auth/lockouts/email/other@globo.com", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "DELETE", "/1.6/auth/lockouts/email/nobody@globo.com", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -75,6 +75,9 @@ func scanLogs(stream io.Reader) error {
 		if entry.Date.IsZero() || entry.AppName == "" || entry.Message == "" {
 			continue
 		}
+		// Fields are only parsed from the message, never taken from clients.
+		entry.Fields = nil
+		entry.ParseFields()
 		err = dispatcher.Send(&entry)
 		if err != nil {
 			return err
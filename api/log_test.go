@@ -139,9 +139,9 @@ loop:
 			logs1 []app.Applog
 			logs2 []app.Applog
 		)
-		logs1, err = a1.LastLogs(3, app.Applog{})
+		logs1, err = a1.LastLogs(3, app.LogFilter{})
 		c.Assert(err, check.IsNil)
-		logs2, err = a2.LastLogs(2, app.Applog{})
+		logs2, err = a2.LastLogs(2, app.LogFilter{})
 		c.Assert(err, check.IsNil)
 		if len(logs1) == 3 && len(logs2) == 2 {
 			break
@@ -153,7 +153,7 @@ loop:
 		default:
 		}
 	}
-	logs, err := a1.LastLogs(3, app.Applog{})
+	logs, err := a1.LastLogs(3, app.LogFilter{})
 	c.Assert(err, check.IsNil)
 	sort.Sort(LogList(logs))
 	compareLogs(c, logs, []app.Applog{
@@ -161,7 +161,7 @@ loop:
 		{Date: baseTime.Add(2 * time.Second), Message: "msg3", Source: "web", AppName: "myapp1", Unit: "unit3"},
 		{Date: baseTime.Add(4 * time.Second), Message: "msg5", Source: "worker", AppName: "myapp1", Unit: "unit3"},
 	})
-	logs, err = a2.LastLogs(2, app.Applog{})
+	logs, err = a2.LastLogs(2, app.LogFilter{})
 	c.Assert(err, check.IsNil)
 	sort.Sort(LogList(logs))
 	compareLogs(c, logs, []app.Applog{
@@ -212,7 +212,7 @@ func (s *S) TestAddLogsHandlerConcurrent(c *check.C) {
 loop:
 	for {
 		var logs1 []app.Applog
-		logs1, err = a1.LastLogs(nConcurrency, app.Applog{})
+		logs1, err = a1.LastLogs(nConcurrency, app.LogFilter{})
 		c.Assert(err, check.IsNil)
 		if len(logs1) == nConcurrency {
 			break
@@ -224,13 +224,35 @@ loop:
 		default:
 		}
 	}
-	logs, err := a1.LastLogs(1, app.Applog{})
+	logs, err := a1.LastLogs(1, app.LogFilter{})
 	c.Assert(err, check.IsNil)
 	compareLogs(c, logs, []app.Applog{
 		{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp1", Unit: "unit1"},
 	})
 }
 
+func (s *S) TestScanLogsIgnoresClientFields(c *check.C) {
+	a := app.App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := `{"date": "2015-06-16T15:00:00.000Z", "message": "msg1", "source": "web", "appname": "myapp1", "unit": "unit1", "fields": {"a.b": 1, "$where": "x"}}`
+	err = scanLogs(strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	timeout := time.After(5 * time.Second)
+	var logs []app.Applog
+	for len(logs) == 0 {
+		logs, err = a.LastLogs(1, app.LogFilter{})
+		c.Assert(err, check.IsNil)
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for logs")
+		default:
+		}
+	}
+	c.Assert(logs[0].Message, check.Equals, "msg1")
+	c.Assert(logs[0].Fields, check.IsNil)
+}
+
 func (s *S) TestAddLogsHandlerInvalidToken(c *check.C) {
 	srv := httptest.NewServer(s.testServer)
 	defer srv.Close()
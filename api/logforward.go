@@ -0,0 +1,292 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func logForwarderTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeLogForwarder, Value: name}
+}
+
+func logForwarderFromForm(r *http.Request) (app.LogForwarder, error) {
+	var f app.LogForwarder
+	err := r.ParseForm()
+	if err != nil {
+		return f, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	err = dec.DecodeValues(&f, r.Form)
+	if err != nil {
+		return f, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse log forwarder: %s", err)}
+	}
+	return f, nil
+}
+
+// logForwarderCustomData returns the form as event custom data, with header
+// values redacted.
+func logForwarderCustomData(values url.Values) []map[string]interface{} {
+	return event.FormToCustomData(redactFormHeaders(values, app.LogForwarderRedactedValue))
+}
+
+// contextsForLogForwarder returns the permission contexts of each app and
+// pool the forwarder is restricted to. Apps that no longer exist only have
+// the app context.
+func contextsForLogForwarder(f *app.LogForwarder) ([][]permission.PermissionContext, error) {
+	var contexts [][]permission.PermissionContext
+	for _, appName := range f.Apps {
+		a, err := app.GetByName(appName)
+		if err == app.ErrAppNotFound {
+			contexts = append(contexts, []permission.PermissionContext{permission.Context(permission.CtxApp, appName)})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, contextsForApp(a))
+	}
+	for _, pool := range f.Pools {
+		contexts = append(contexts, []permission.PermissionContext{permission.Context(permission.CtxPool, pool)})
+	}
+	return contexts, nil
+}
+
+// canUseLogForwarder returns whether the token has the permission for every
+// app and pool the forwarder is restricted to. Forwarders receiving the logs
+// of all apps require the global permission.
+func canUseLogForwarder(t auth.Token, perm *permission.PermissionScheme, f *app.LogForwarder) (bool, error) {
+	contexts, err := contextsForLogForwarder(f)
+	if err != nil {
+		return false, err
+	}
+	if len(contexts) == 0 {
+		return permission.Check(t, perm), nil
+	}
+	for _, ctxs := range contexts {
+		if !permission.Check(t, perm, ctxs...) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// logForwarderEventContexts returns the contexts allowed to read the events
+// of the forwarder.
+func logForwarderEventContexts(f *app.LogForwarder) ([]permission.PermissionContext, error) {
+	contexts, err := contextsForLogForwarder(f)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []permission.PermissionContext
+	for _, ctxs := range contexts {
+		allowed = append(allowed, ctxs...)
+	}
+	return allowed, nil
+}
+
+func logForwarderHTTPError(err error) error {
+	switch err {
+	case app.ErrLogForwarderNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case app.ErrLogForwarderAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+// title: log forwarder list
+// path: /log-forwarders
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func logForwarderList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if len(permission.ContextsForPermission(t, permission.PermLogForwarderRead)) == 0 {
+		return permission.ErrUnauthorized
+	}
+	forwarders, err := app.ListLogForwarders()
+	if err != nil {
+		return err
+	}
+	var allowed []app.LogForwarder
+	for i := range forwarders {
+		canRead, err := canUseLogForwarder(t, permission.PermLogForwarderRead, &forwarders[i])
+		if err != nil {
+			return err
+		}
+		if canRead {
+			allowed = append(allowed, forwarders[i].Redacted())
+		}
+	}
+	if len(allowed) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(allowed)
+}
+
+// title: log forwarder info
+// path: /log-forwarders/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func logForwarderInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	f, err := app.GetLogForwarder(r.URL.Query().Get(":name"))
+	if err != nil {
+		return logForwarderHTTPError(err)
+	}
+	canRead, err := canUseLogForwarder(t, permission.PermLogForwarderRead, f)
+	if err != nil {
+		return err
+	}
+	if !canRead {
+		return permission.ErrUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(f.Redacted())
+}
+
+// title: log forwarder create
+// path: /log-forwarders
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Log forwarder created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Log forwarder already exists
+func logForwarderCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	f, err := logForwarderFromForm(r)
+	if err != nil {
+		return err
+	}
+	canCreate, err := canUseLogForwarder(t, permission.PermLogForwarderCreate, &f)
+	if err != nil {
+		return err
+	}
+	if !canCreate {
+		return permission.ErrUnauthorized
+	}
+	allowed, err := logForwarderEventContexts(&f)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     logForwarderTarget(f.Name),
+		Kind:       permission.PermLogForwarderCreate,
+		Owner:      t,
+		CustomData: logForwarderCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermLogForwarderReadEvents, allowed...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return logForwarderHTTPError(app.CreateLogForwarder(f))
+}
+
+// title: log forwarder update
+// path: /log-forwarders/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Log forwarder updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func logForwarderUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	f, err := logForwarderFromForm(r)
+	if err != nil {
+		return err
+	}
+	f.Name = r.URL.Query().Get(":name")
+	current, err := app.GetLogForwarder(f.Name)
+	if err != nil {
+		return logForwarderHTTPError(err)
+	}
+	for _, forwarder := range []*app.LogForwarder{current, &f} {
+		canUpdate, err := canUseLogForwarder(t, permission.PermLogForwarderUpdate, forwarder)
+		if err != nil {
+			return err
+		}
+		if !canUpdate {
+			return permission.ErrUnauthorized
+		}
+	}
+	allowed, err := logForwarderEventContexts(&f)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     logForwarderTarget(f.Name),
+		Kind:       permission.PermLogForwarderUpdate,
+		Owner:      t,
+		CustomData: logForwarderCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermLogForwarderReadEvents, allowed...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return logForwarderHTTPError(app.UpdateLogForwarder(f))
+}
+
+// title: log forwarder delete
+// path: /log-forwarders/{name}
+// method: DELETE
+// responses:
+//   200: Log forwarder removed
+//   401: Unauthorized
+//   404: Not found
+func logForwarderDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	f, err := app.GetLogForwarder(name)
+	if err != nil {
+		return logForwarderHTTPError(err)
+	}
+	canDelete, err := canUseLogForwarder(t, permission.PermLogForwarderDelete, f)
+	if err != nil {
+		return err
+	}
+	if !canDelete {
+		return permission.ErrUnauthorized
+	}
+	allowed, err := logForwarderEventContexts(f)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     logForwarderTarget(name),
+		Kind:       permission.PermLogForwarderDelete,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermLogForwarderReadEvents, allowed...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return logForwarderHTTPError(app.RemoveLogForwarder(name))
+}
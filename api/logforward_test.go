@@ -0,0 +1,318 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogForwarderList(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermLogForwarderRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	err = app.CreateLogForwarder(app.LogForwarder{
+		Name:    "http1",
+		Type:    "http",
+		URL:     "http://logs.example.com/batch",
+		Headers: http.Header{"Authorization": []string{"Bearer abc"}},
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/log-forwarders", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var forwarders []app.LogForwarder
+	err = json.NewDecoder(recorder.Body).Decode(&forwarders)
+	c.Assert(err, check.IsNil)
+	c.Assert(forwarders, check.DeepEquals, []app.LogForwarder{
+		{Name: "http1", Type: "http", URL: "http://logs.example.com/batch", Headers: http.Header{"Authorization": []string{app.LogForwarderRedactedValue}}},
+		{Name: "syslog1", Type: "syslog", Network: "udp", Address: "localhost:514"},
+	})
+}
+
+func (s *S) TestLogForwarderListEmpty(c *check.C) {
+	request, err := http.NewRequest("GET", "/log-forwarders", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestLogForwarderListWithoutPermission(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/log-forwarders", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestLogForwarderInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/log-forwarders/unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestLogForwarderCreate(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermLogForwarderCreate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	values := url.Values{
+		"name":                    []string{"collector"},
+		"type":                    []string{"http"},
+		"url":                     []string{"http://logs.example.com/batch"},
+		"apps":                    []string{"myapp"},
+		"pools":                   []string{"pool1"},
+		"headers.Authorization.0": []string{"Bearer abc"},
+	}
+	request, err := http.NewRequest("POST", "/log-forwarders", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	f, err := app.GetLogForwarder("collector")
+	c.Assert(err, check.IsNil)
+	c.Assert(f, check.DeepEquals, &app.LogForwarder{
+		Name:    "collector",
+		Type:    "http",
+		URL:     "http://logs.example.com/batch",
+		Headers: http.Header{"Authorization": []string{"Bearer abc"}},
+		Apps:    []string{"myapp"},
+		Pools:   []string{"pool1"},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeLogForwarder, Value: "collector"},
+		Owner:  token.GetUserName(),
+		Kind:   "log-forwarder.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "collector"},
+			{"name": "type", "value": "http"},
+			{"name": "url", "value": "http://logs.example.com/batch"},
+			{"name": "apps", "value": "myapp"},
+			{"name": "pools", "value": "pool1"},
+			{"name": "headers.Authorization.0", "value": app.LogForwarderRedactedValue},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestLogForwarderCreateInvalid(c *check.C) {
+	body := strings.NewReader("name=syslog1&type=syslog&network=sctp&address=localhost:514")
+	request, err := http.NewRequest("POST", "/log-forwarders", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid syslog network \"sctp\", must be udp or tcp\n")
+}
+
+func (s *S) TestLogForwarderCreateAlreadyExists(c *check.C) {
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=syslog1&type=syslog&address=localhost:1514")
+	request, err := http.NewRequest("POST", "/log-forwarders", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestLogForwarderUpdate(c *check.C) {
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("type=syslog&network=tcp&address=localhost:1514&apps=myapp")
+	request, err := http.NewRequest("PUT", "/log-forwarders/syslog1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	f, err := app.GetLogForwarder("syslog1")
+	c.Assert(err, check.IsNil)
+	c.Assert(f, check.DeepEquals, &app.LogForwarder{
+		Name:    "syslog1",
+		Type:    "syslog",
+		Network: "tcp",
+		Address: "localhost:1514",
+		Apps:    []string{"myapp"},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeLogForwarder, Value: "syslog1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "log-forwarder.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": "type", "value": "syslog"},
+			{"name": "network", "value": "tcp"},
+			{"name": "address", "value": "localhost:1514"},
+			{"name": "apps", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestLogForwarderUpdateNotFound(c *check.C) {
+	body := strings.NewReader("type=syslog&address=localhost:514")
+	request, err := http.NewRequest("PUT", "/log-forwarders/syslog1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestLogForwarderDelete(c *check.C) {
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/log-forwarders/syslog1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = app.GetLogForwarder("syslog1")
+	c.Assert(err, check.Equals, app.ErrLogForwarderNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeLogForwarder, Value: "syslog1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "log-forwarder.delete",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestLogForwarderListFilteredByPermission(c *check.C) {
+	a := app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermLogForwarderRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	err = app.CreateLogForwarder(app.LogForwarder{Name: "all", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	err = app.CreateLogForwarder(app.LogForwarder{Name: "mine", Type: "syslog", Address: "localhost:514", Apps: []string{"myapp"}})
+	c.Assert(err, check.IsNil)
+	err = app.CreateLogForwarder(app.LogForwarder{Name: "mixed", Type: "syslog", Address: "localhost:514", Apps: []string{"myapp", "otherapp"}})
+	c.Assert(err, check.IsNil)
+	err = app.CreateLogForwarder(app.LogForwarder{Name: "pool", Type: "syslog", Address: "localhost:514", Pools: []string{"otherpool"}})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/log-forwarders", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var forwarders []app.LogForwarder
+	err = json.NewDecoder(recorder.Body).Decode(&forwarders)
+	c.Assert(err, check.IsNil)
+	c.Assert(forwarders, check.HasLen, 1)
+	c.Assert(forwarders[0].Name, check.Equals, "mine")
+}
+
+func (s *S) TestLogForwarderInfoWithoutPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermLogForwarderRead,
+		Context: permission.Context(permission.CtxPool, "mypool"),
+	})
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514", Pools: []string{"otherpool"}})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/log-forwarders/syslog1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestLogForwarderCreateWithPoolPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermLogForwarderCreate,
+		Context: permission.Context(permission.CtxPool, "mypool"),
+	})
+	body := strings.NewReader("name=syslog1&type=syslog&address=localhost:514&pools=mypool")
+	request, err := http.NewRequest("POST", "/log-forwarders", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	body = strings.NewReader("name=syslog2&type=syslog&address=localhost:514")
+	request, err = http.NewRequest("POST", "/log-forwarders", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = app.GetLogForwarder("syslog2")
+	c.Assert(err, check.Equals, app.ErrLogForwarderNotFound)
+}
+
+func (s *S) TestLogForwarderUpdateWithoutPermissionForCurrentApps(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermLogForwarderUpdate,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514", Apps: []string{"otherapp"}})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("type=syslog&address=localhost:514&apps=myapp")
+	request, err := http.NewRequest("PUT", "/log-forwarders/syslog1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	f, err := app.GetLogForwarder("syslog1")
+	c.Assert(err, check.IsNil)
+	c.Assert(f.Apps, check.DeepEquals, []string{"otherapp"})
+}
+
+func (s *S) TestLogForwarderDeleteWithoutPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermLogForwarderDelete,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	err := app.CreateLogForwarder(app.LogForwarder{Name: "syslog1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/log-forwarders/syslog1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = app.GetLogForwarder("syslog1")
+	c.Assert(err, check.IsNil)
+}
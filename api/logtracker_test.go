@@ -23,7 +23,7 @@ func (s *S) TestLogStreamTrackerAddRemove(c *check.C) {
 }
 
 func (s *S) TestLogStreamTrackerShutdown(c *check.C) {
-	l, err := app.NewLogListener(&app.App{Name: "myapp"}, app.Applog{})
+	l, err := app.NewLogListener(&app.App{Name: "myapp"}, app.LogFilter{})
 	c.Assert(err, check.IsNil)
 	logTracker.add(l)
 	logTracker.Shutdown(context.Background())
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -363,6 +365,47 @@ func removePermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	return err
 }
 
+// title: set role two-factor requirement
+// path: /roles/{name}/two-factor
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Role not found
+func setRoleTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateTwoFactor) {
+		return permission.ErrUnauthorized
+	}
+	required, err := strconv.ParseBool(r.FormValue("required"))
+	if err != nil {
+		msg := `Parameter "required" must be a boolean.`
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateTwoFactor,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermRoleReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	return role.SetTwoFactorRequired(required)
+}
+
 func canUseRole(t auth.Token, roleName, contextValue string) error {
 	role, err := permission.FindRole(roleName)
 	if err != nil {
@@ -399,6 +442,7 @@ func canUseRole(t auth.Token, roleName, contextValue string) error {
 //   400: Invalid data
 //   401: Unauthorized
 //   404: Role not found
+//   409: Role already assigned without expiration
 func assignRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	r.ParseForm()
 	if !permission.Check(t, permission.PermRoleUpdateAssign) {
@@ -415,9 +459,24 @@ func assignRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 	if err != nil {
 		return err
 	}
-	defer func() { evt.Done(err) }()
+	var expiresAt time.Time
+	defer func() {
+		if expiresAt.IsZero() {
+			evt.Done(err)
+			return
+		}
+		evt.DoneCustomData(err, map[string]interface{}{"expires_at": expiresAt})
+	}()
 	email := r.FormValue("email")
 	contextValue := r.FormValue("context")
+	if expires := r.FormValue("expires"); expires != "" {
+		duration, parseErr := time.ParseDuration(expires)
+		if parseErr != nil || duration <= 0 {
+			msg := `Parameter "expires" must be a positive duration, like "4h".`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+		expiresAt = time.Now().Add(duration)
+	}
 	user, err := auth.GetUserByEmail(email)
 	if err != nil {
 		return err
@@ -427,8 +486,14 @@ func assignRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 		return err
 	}
 	err = runWithPermSync([]auth.User{*user}, func() error {
-		return user.AddRole(roleName, contextValue)
+		if expiresAt.IsZero() {
+			return user.AddRole(roleName, contextValue)
+		}
+		return user.AddRoleWithExpiration(roleName, contextValue, expiresAt)
 	})
+	if err == auth.ErrRoleAssignedWithoutExpiration {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
 	return err
 }
 
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"time"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -442,6 +443,86 @@ func (s *S) TestAssignRole(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAssignRoleWithExpiration(c *check.C) {
+	role, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.create")
+	c.Assert(err, check.IsNil)
+	_, emptyToken := permissiontest.CustomUserWithPermission(c, nativeScheme, "user2")
+	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam&expires=4h", emptyToken.GetUserName()))
+	req, err := http.NewRequest("POST", "/roles/test/user", roleBody)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	emptyUser, err := emptyToken.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(emptyUser.Roles, check.HasLen, 1)
+	expiresAt := emptyUser.Roles[0].ExpiresAt
+	c.Assert(expiresAt.After(time.Now().Add(3*time.Hour)), check.Equals, true)
+	c.Assert(expiresAt.Before(time.Now().Add(5*time.Hour)), check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "test"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "role.update.assign",
+		StartCustomData: []map[string]interface{}{
+			{"name": "email", "value": emptyToken.GetUserName()},
+			{"name": "context", "value": "myteam"},
+			{"name": "expires", "value": "4h"},
+		},
+	}, eventtest.HasEvent)
+	req, err = http.NewRequest("GET", "/users/info", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+emptyToken.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var info apiUser
+	err = json.NewDecoder(recorder.Body).Decode(&info)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Roles, check.HasLen, 1)
+	c.Assert(info.Roles[0].ExpiresAt, check.NotNil)
+	c.Assert(info.Roles[0].ExpiresAt.Equal(expiresAt), check.Equals, true)
+	c.Assert(info.Permissions[0].ExpiresAt, check.IsNil)
+}
+
+func (s *S) TestAssignRoleWithInvalidExpiration(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	_, emptyToken := permissiontest.CustomUserWithPermission(c, nativeScheme, "user2")
+	for _, expires := range []string{"tomorrow", "-1h", "0s"} {
+		roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam&expires=%s", emptyToken.GetUserName(), expires))
+		req, err := http.NewRequest("POST", "/roles/test/user", roleBody)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		server := RunServer(true)
+		server.ServeHTTP(recorder, req)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestAssignRoleWithExpirationAlreadyAssigned(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	emptyUser, emptyToken := permissiontest.CustomUserWithPermission(c, nativeScheme, "user2")
+	err = emptyUser.AddRole("test", "myteam")
+	c.Assert(err, check.IsNil)
+	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam&expires=1h", emptyToken.GetUserName()))
+	req, err := http.NewRequest("POST", "/roles/test/user", roleBody)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
 func (s *S) TestAssignRoleNotFound(c *check.C) {
 	_, emptyToken := permissiontest.CustomUserWithPermission(c, nativeScheme, "user2")
 	roleBody := bytes.NewBufferString(fmt.Sprintf("email=%s&context=myteam", emptyToken.GetUserName()))
@@ -29,14 +29,24 @@ import (
 func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	cpuShare, _ := strconv.Atoi(r.FormValue("cpushare"))
 	isDefault, _ := strconv.ParseBool(r.FormValue("default"))
+	logRateLimit, _ := strconv.Atoi(r.FormValue("logratelimit"))
+	var cost float64
+	if costStr := r.FormValue("cost"); costStr != "" {
+		cost, err = strconv.ParseFloat(costStr, 64)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid cost"}
+		}
+	}
 	memory := getSize(r.FormValue("memory"))
 	swap := getSize(r.FormValue("swap"))
 	plan := appTypes.Plan{
-		Name:     r.FormValue("name"),
-		Memory:   memory,
-		Swap:     swap,
-		CpuShare: cpuShare,
-		Default:  isDefault,
+		Name:         r.FormValue("name"),
+		Memory:       memory,
+		Swap:         swap,
+		CpuShare:     cpuShare,
+		Default:      isDefault,
+		LogRateLimit: logRateLimit,
+		Cost:         cost,
 	}
 	allowed := permission.Check(t, permission.PermPlanCreate)
 	if !allowed {
@@ -60,7 +70,7 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 			Message: err.Error(),
 		}
 	}
-	if err == appTypes.ErrLimitOfMemory || err == appTypes.ErrLimitOfCpuShare {
+	if _, ok := err.(appTypes.PlanValidationError); ok || err == appTypes.ErrLimitOfMemory || err == appTypes.ErrLimitOfCpuShare {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
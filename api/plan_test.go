@@ -45,6 +45,35 @@ func (s *S) TestPlanAdd(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestPlanAddWithCost(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&cpushare=100&cost=0.25")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	plans, err := app.PlanService().FindAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []appTypes.Plan{
+		{Name: "xyz", Memory: 536870912, CpuShare: 100, Cost: 0.25},
+	})
+}
+
+func (s *S) TestPlanAddInvalidCost(c *check.C) {
+	for _, cost := range []string{"abc", "-1"} {
+		recorder := httptest.NewRecorder()
+		body := strings.NewReader("name=xyz&memory=512M&cpushare=100&cost=" + cost)
+		request, err := http.NewRequest("POST", "/plans", body)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
 func (s *S) TestPlanAddWithMegabyteAsMemoryUnit(c *check.C) {
 	recorder := httptest.NewRecorder()
 	body := strings.NewReader("name=xyz&memory=512M&swap=1024&cpushare=100")
@@ -6,14 +6,19 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/service"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/mgo.v2"
 )
 
 // title: user quota
@@ -151,3 +156,143 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+type teamQuota struct {
+	Limit authTypes.TeamQuota `json:"limit"`
+	InUse app.TeamQuotaUsage  `json:"inuse"`
+}
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamRead, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == authTypes.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	inUse, err := app.TeamQuotaInUse(team.Name)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(teamQuota{Limit: team.Quota, InUse: inUse})
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamAdminQuota, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == authTypes.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	} else if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamAdminQuota,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	quota := team.Quota
+	if v := r.FormValue("memory"); v != "" {
+		quota.Memory = getSize(v)
+		if quota.Memory == 0 && v != "0" {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid memory",
+			}
+		}
+	}
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{
+		{"cpushare", &quota.CpuShare},
+		{"serviceinstances", &quota.ServiceInstances},
+		{"volumes", &quota.Volumes},
+	} {
+		if v := r.FormValue(limit.name); v != "" {
+			*limit.value, err = strconv.Atoi(v)
+			if err != nil {
+				return &errors.HTTP{
+					Code:    http.StatusBadRequest,
+					Message: "Invalid " + limit.name,
+				}
+			}
+		}
+	}
+	if serviceLimits := r.Form["service"]; len(serviceLimits) > 0 {
+		services := map[string]int{}
+		for k, v := range quota.Services {
+			services[k] = v
+		}
+		for _, v := range serviceLimits {
+			parts := strings.SplitN(v, "=", 2)
+			var serviceLimit int
+			if len(parts) == 2 {
+				serviceLimit, err = strconv.Atoi(parts[1])
+			}
+			if len(parts) != 2 || parts[0] == "" || err != nil {
+				return &errors.HTTP{
+					Code:    http.StatusBadRequest,
+					Message: "Invalid service limit, it must be in the form <service>=<limit>",
+				}
+			}
+			if serviceLimit == 0 {
+				delete(services, parts[0])
+				continue
+			}
+			svc := service.Service{Name: parts[0]}
+			err = svc.Get()
+			if err == mgo.ErrNotFound {
+				return &errors.HTTP{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("Invalid service limit, service %q not found", parts[0]),
+				}
+			}
+			if err != nil {
+				return err
+			}
+			services[parts[0]] = serviceLimit
+		}
+		quota.Services = services
+	}
+	return auth.SetTeamQuota(team.Name, quota)
+}
@@ -7,8 +7,10 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -23,6 +25,7 @@ import (
 	"github.com/tsuru/tsuru/permission/permissiontest"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository/repositorytest"
+	"github.com/tsuru/tsuru/service"
 	_ "github.com/tsuru/tsuru/storage/mongodb"
 	authTypes "github.com/tsuru/tsuru/types/auth"
 	"gopkg.in/check.v1"
@@ -402,3 +405,166 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	err := auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{Memory: 1024, CpuShare: 200})
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamreader", permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result teamQuota
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, teamQuota{
+		Limit: authTypes.TeamQuota{Memory: 1024, CpuShare: 200},
+	})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaTeamNotFound(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamreader", permission.Permission{
+		Scheme:  permission.PermTeamRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, _ := http.NewRequest("GET", "/teams/unknown/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaRequiresPermission(c *check.C) {
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamadmin", permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := bytes.NewBufferString("memory=512M&cpushare=400")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, authTypes.TeamQuota{Memory: 512 * 1024 * 1024, CpuShare: 400})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeTeam, Value: s.team.Name},
+		Owner:  token.GetUserName(),
+		Kind:   "team.admin.quota",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "memory", "value": "512M"},
+			{"name": "cpushare", "value": "400"},
+		},
+	}, eventtest.HasEvent)
+	body = bytes.NewBufferString("cpushare=0")
+	request, _ = http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err = auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, authTypes.TeamQuota{Memory: 512 * 1024 * 1024})
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaInvalidValues(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamadmin", permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	for body, expected := range map[string]string{
+		"memory=lots":  "Invalid memory\n",
+		"cpushare=a":   "Invalid cpushare\n",
+		"cpushare=-10": "quota limits must not be negative\n",
+	} {
+		request, _ := http.NewRequest("PUT", "/teams/superteam/quota", bytes.NewBufferString(body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+token.GetValue())
+		recorder := httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("body %q", body))
+		c.Assert(recorder.Body.String(), check.Equals, expected)
+	}
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresAdmin(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teammember", permission.Permission{
+		Scheme:  permission.PermTeamUpdate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("memory=512M")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaServiceLimits(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	for _, name := range []string{"mysql", "mongodb"} {
+		err = conn.Services().Insert(service.Service{Name: name})
+		c.Assert(err, check.IsNil)
+	}
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{Services: map[string]int{"mysql": 2, "redis": 1}})
+	c.Assert(err, check.IsNil)
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "teamadmin", permission.Permission{
+		Scheme:  permission.PermTeamAdminQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := bytes.NewBufferString("serviceinstances=10&volumes=3&service=mysql=5&service=redis=0&service=mongodb=1")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, authTypes.TeamQuota{
+		ServiceInstances: 10,
+		Volumes:          3,
+		Services:         map[string]int{"mysql": 5, "mongodb": 1},
+	})
+	body = bytes.NewBufferString("service=mysql")
+	request, _ = http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid service limit, it must be in the form <service>=<limit>\n")
+	for _, name := range []string{"unknown", "my.sql", "$mysql"} {
+		body = bytes.NewBufferString(url.Values{"service": {name + "=1"}}.Encode())
+		request, _ = http.NewRequest("PUT", "/teams/superteam/quota", body)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+token.GetValue())
+		recorder = httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf("Invalid service limit, service %q not found\n", name))
+	}
+	team, err = auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota.Services, check.DeepEquals, map[string]int{"mysql": 5, "mongodb": 1})
+}
@@ -25,12 +25,16 @@ import (
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/app/image/gc"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/expiration"
+	"github.com/tsuru/tsuru/auth/ldap"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
+	_ "github.com/tsuru/tsuru/auth/oidc"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
 	"github.com/tsuru/tsuru/healer"
 	"github.com/tsuru/tsuru/log"
@@ -40,6 +44,7 @@ import (
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/service"
 	"github.com/tsuru/tsuru/storage"
+	"github.com/tsuru/tsuru/usage"
 	"golang.org/x/net/websocket"
 )
 
@@ -159,6 +164,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/log", AuthorizationRequiredHandler(appLog))
 	logPostHandler := AuthorizationRequiredHandler(addLog)
 	m.Add("1.0", "Post", "/apps/{app}/log", logPostHandler)
+	m.Add("1.6", "Put", "/apps/{app}/log-rate-limit", AuthorizationRequiredHandler(setAppLogRateLimit))
 	m.Add("1.0", "Post", "/apps/{appname}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
 	m.Add("1.4", "Put", "/apps/{appname}/deploy/rollback/update", AuthorizationRequiredHandler(deployRollbackUpdate))
 	m.Add("1.3", "Post", "/apps/{appname}/deploy/rebuild", AuthorizationRequiredHandler(deployRebuild))
@@ -173,6 +179,10 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.5", "Delete", "/apps/{app}/routers/{router}", AuthorizationRequiredHandler(removeAppRouter))
 	m.Add("1.5", "Get", "/apps/{app}/routers", AuthorizationRequiredHandler(listAppRouters))
 
+	m.Add("1.6", "Get", "/apps/{app}/autoscale", AuthorizationRequiredHandler(appAutoScaleListRules))
+	m.Add("1.6", "Post", "/apps/{app}/autoscale", AuthorizationRequiredHandler(appAutoScaleSetRule))
+	m.Add("1.6", "Delete", "/apps/{app}/autoscale/{process}", AuthorizationRequiredHandler(appAutoScaleDeleteRule))
+
 	m.Add("1.0", "Post", "/node/status", AuthorizationRequiredHandler(setNodeStatus))
 
 	m.Add("1.0", "Get", "/deploys", AuthorizationRequiredHandler(deploysList))
@@ -182,6 +192,13 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.3", "Get", "/events/blocks", AuthorizationRequiredHandler(eventBlockList))
 	m.Add("1.3", "Post", "/events/blocks", AuthorizationRequiredHandler(eventBlockAdd))
 	m.Add("1.3", "Delete", "/events/blocks/{uuid}", AuthorizationRequiredHandler(eventBlockRemove))
+	m.Add("1.6", "Get", "/events/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.6", "Post", "/events/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.6", "Get", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.6", "Put", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.6", "Delete", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.6", "Get", "/events/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
+	m.Add("1.6", "Get", "/events/stream", AuthorizationRequiredHandler(eventStream))
 	m.Add("1.1", "Get", "/events/kinds", AuthorizationRequiredHandler(kindList))
 	m.Add("1.1", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
 	m.Add("1.1", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
@@ -225,14 +242,37 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/users/keys/{key}", AuthorizationRequiredHandler(removeKeyFromUser))
 	m.Add("1.0", "Get", "/users/api-key", AuthorizationRequiredHandler(showAPIToken))
 	m.Add("1.0", "Post", "/users/api-key", AuthorizationRequiredHandler(regenerateAPIToken))
+	m.Add("1.6", "Get", "/users/tokens", AuthorizationRequiredHandler(listAccessTokens))
+	m.Add("1.6", "Post", "/users/tokens", AuthorizationRequiredHandler(createAccessToken))
+	m.Add("1.6", "Delete", "/users/tokens/{name}", AuthorizationRequiredHandler(revokeAccessToken))
+	m.Add("1.6", "Post", "/users/two-factor", AuthorizationRequiredHandler(enrollTwoFactor))
+	m.Add("1.6", "Post", "/users/two-factor/confirm", AuthorizationRequiredHandler(confirmTwoFactor))
+	m.Add("1.6", "Delete", "/users/two-factor", AuthorizationRequiredHandler(disableTwoFactor))
+	m.Add("1.6", "Get", "/auth/lockouts", AuthorizationRequiredHandler(listLockouts))
+	m.Add("1.6", "Delete", "/auth/lockouts/{kind}/{value}", AuthorizationRequiredHandler(unlockLogin))
 
 	m.Add("1.0", "Get", "/logs", websocket.Handler(addLogs))
+	m.Add("1.6", "Get", "/log-forwarders", AuthorizationRequiredHandler(logForwarderList))
+	m.Add("1.6", "Post", "/log-forwarders", AuthorizationRequiredHandler(logForwarderCreate))
+	m.Add("1.6", "Get", "/log-forwarders/{name}", AuthorizationRequiredHandler(logForwarderInfo))
+	m.Add("1.6", "Put", "/log-forwarders/{name}", AuthorizationRequiredHandler(logForwarderUpdate))
+	m.Add("1.6", "Delete", "/log-forwarders/{name}", AuthorizationRequiredHandler(logForwarderDelete))
 
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
 	m.Add("1.4", "Post", "/teams/{name}", AuthorizationRequiredHandler(updateTeam))
 	m.Add("1.4", "Get", "/teams/{name}", AuthorizationRequiredHandler(teamInfo))
+	m.Add("1.6", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.6", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
+	m.Add("1.6", "Get", "/service-accounts", AuthorizationRequiredHandler(listServiceAccounts))
+	m.Add("1.6", "Post", "/teams/{name}/service-accounts", AuthorizationRequiredHandler(createServiceAccount))
+	m.Add("1.6", "Delete", "/teams/{name}/service-accounts/{account}", AuthorizationRequiredHandler(removeServiceAccount))
+	m.Add("1.6", "Post", "/teams/{name}/service-accounts/{account}/roles", AuthorizationRequiredHandler(assignServiceAccountRole))
+	m.Add("1.6", "Delete", "/teams/{name}/service-accounts/{account}/roles/{role}", AuthorizationRequiredHandler(dissociateServiceAccountRole))
+	m.Add("1.6", "Get", "/teams/{name}/service-accounts/{account}/tokens", AuthorizationRequiredHandler(listServiceAccountTokens))
+	m.Add("1.6", "Post", "/teams/{name}/service-accounts/{account}/tokens", AuthorizationRequiredHandler(createServiceAccountToken))
+	m.Add("1.6", "Delete", "/teams/{name}/service-accounts/{account}/tokens/{token}", AuthorizationRequiredHandler(revokeServiceAccountToken))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -250,6 +290,8 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/plans", AuthorizationRequiredHandler(addPlan))
 	m.Add("1.0", "Delete", "/plans/{planname}", AuthorizationRequiredHandler(removePlan))
 
+	m.Add("1.6", "Get", "/usage", AuthorizationRequiredHandler(usageReport))
+
 	m.Add("1.0", "Get", "/pools", AuthorizationRequiredHandler(poolList))
 	m.Add("1.0", "Post", "/pools", AuthorizationRequiredHandler(addPoolHandler))
 	m.Add("1.0", "Delete", "/pools/{name}", AuthorizationRequiredHandler(removePoolHandler))
@@ -267,6 +309,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/roles/{name}", AuthorizationRequiredHandler(removeRole))
 	m.Add("1.0", "Post", "/roles/{name}/permissions", AuthorizationRequiredHandler(addPermissions))
 	m.Add("1.0", "Delete", "/roles/{name}/permissions/{permission}", AuthorizationRequiredHandler(removePermissions))
+	m.Add("1.6", "Put", "/roles/{name}/two-factor", AuthorizationRequiredHandler(setRoleTwoFactor))
 	m.Add("1.0", "Post", "/roles/{name}/user", AuthorizationRequiredHandler(assignRole))
 	m.Add("1.0", "Delete", "/roles/{name}/user/{email}", AuthorizationRequiredHandler(dissociateRole))
 	m.Add("1.0", "Get", "/role/default", AuthorizationRequiredHandler(listDefaultRoles))
@@ -519,10 +562,32 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	err = autoscale.InitializeAppScaler()
+	if err != nil {
+		fatal(errors.Wrap(err, "unable to initialize app autoscale"))
+	}
+	err = usage.InitializeSampler()
+	if err != nil {
+		fatal(errors.Wrap(err, "unable to initialize usage sampler"))
+	}
+	err = ldap.InitializeResync()
+	if err != nil {
+		fatal(errors.Wrap(err, "unable to initialize ldap group resync"))
+	}
+	err = expiration.Initialize(func(u *auth.User, callback func() error) error {
+		return runWithPermSync([]auth.User{*u}, callback)
+	})
+	if err != nil {
+		fatal(errors.Wrap(err, "unable to initialize role expiration"))
+	}
 	err = event.Initialize()
 	if err != nil {
 		fatal(errors.Wrap(err, "unable to load events throttling config"))
 	}
+	err = webhook.Initialize()
+	if err != nil {
+		fatal(errors.Wrap(err, "unable to initialize event webhooks"))
+	}
 	err = gc.Initialize()
 	if err != nil {
 		fatal(errors.Wrap(err, "unable to initialize old image gc"))
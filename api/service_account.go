@@ -0,0 +1,355 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/repository"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+)
+
+type apiServiceAccount struct {
+	Name        string
+	Team        string
+	Description string
+	CreatedBy   string
+	Email       string
+	Roles       []rolePermissionData
+}
+
+func serviceAccountTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeServiceAccount, Value: name}
+}
+
+func createAPIServiceAccount(u *auth.User, roleMap map[string]*permission.Role) (*apiServiceAccount, error) {
+	userData, err := createAPIUser(nil, u, roleMap, true)
+	if err != nil {
+		return nil, err
+	}
+	return &apiServiceAccount{
+		Name:        u.ServiceAccount.Name,
+		Team:        u.ServiceAccount.Team,
+		Description: u.ServiceAccount.Description,
+		CreatedBy:   u.ServiceAccount.CreatedBy,
+		Email:       u.Email,
+		Roles:       userData.Roles,
+	}, nil
+}
+
+// serviceAccountFromRequest returns the service account in the request path,
+// checking that the token is allowed to manage the service accounts of its
+// team.
+func serviceAccountFromRequest(r *http.Request, t auth.Token) (*auth.User, error) {
+	teamName := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamServiceAccount,
+		permission.Context(permission.CtxTeam, teamName),
+	)
+	if !allowed {
+		return nil, permission.ErrUnauthorized
+	}
+	u, err := auth.GetServiceAccount(teamName, r.URL.Query().Get(":account"))
+	if err == auth.ErrServiceAccountNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return u, err
+}
+
+func newServiceAccountEvent(r *http.Request, t auth.Token, teamName, name string) (*event.Event, error) {
+	return event.New(&event.Opts{
+		Target:     serviceAccountTarget(name),
+		Kind:       permission.PermTeamServiceAccount,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, teamName)),
+	})
+}
+
+// title: service account list
+// path: /service-accounts
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func listServiceAccounts(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermTeamServiceAccount)
+	if len(contexts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var teams []string
+	for _, c := range contexts {
+		if c.CtxType == permission.CtxGlobal {
+			teams = nil
+			break
+		}
+		teams = append(teams, c.Value)
+	}
+	if teamName := r.URL.Query().Get("team"); teamName != "" {
+		if !permission.Check(t, permission.PermTeamServiceAccount, permission.Context(permission.CtxTeam, teamName)) {
+			return permission.ErrUnauthorized
+		}
+		teams = []string{teamName}
+	}
+	users, err := auth.ListServiceAccounts(teams)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	roleMap := make(map[string]*permission.Role)
+	result := make([]apiServiceAccount, len(users))
+	for i := range users {
+		sa, err := createAPIServiceAccount(&users[i], roleMap)
+		if err != nil {
+			return err
+		}
+		result[i] = *sa
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
+// title: create service account
+// path: /teams/{name}/service-accounts
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Service account created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+//   409: Service account already exists
+func createServiceAccount(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	teamName := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamServiceAccount,
+		permission.Context(permission.CtxTeam, teamName),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	name := r.FormValue("name")
+	evt, err := newServiceAccountEvent(r, t, teamName, name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := auth.CreateServiceAccount(auth.ServiceAccount{
+		Name:        name,
+		Team:        teamName,
+		Description: r.FormValue("description"),
+		CreatedBy:   t.GetUserName(),
+	})
+	switch err {
+	case nil:
+	case authTypes.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case auth.ErrServiceAccountAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	sa, err := createAPIServiceAccount(u, nil)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(sa)
+}
+
+// title: remove service account
+// path: /teams/{name}/service-accounts/{account}
+// method: DELETE
+// responses:
+//   200: Service account removed
+//   401: Unauthorized
+//   404: Service account not found
+func removeServiceAccount(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	evt, err := newServiceAccountEvent(r, t, u.ServiceAccount.Team, u.ServiceAccount.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	appNames, err := deployableApps(u, make(map[string]*permission.Role))
+	if err != nil {
+		return err
+	}
+	manager := repository.Manager()
+	for _, name := range appNames {
+		manager.RevokeAccess(name, u.Email)
+	}
+	if err := manager.RemoveUser(u.Email); err != nil {
+		log.Errorf("Failed to remove service account from repository manager: %s", err)
+	}
+	return u.Delete()
+}
+
+// title: assign role to service account
+// path: /teams/{name}/service-accounts/{account}/roles
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Role or service account not found
+func assignServiceAccountRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	roleName := r.FormValue("role")
+	contextValue := r.FormValue("context")
+	err = canUseRole(t, roleName, contextValue)
+	if err != nil {
+		return err
+	}
+	evt, err := newServiceAccountEvent(r, t, u.ServiceAccount.Team, u.ServiceAccount.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return runWithPermSync([]auth.User{*u}, func() error {
+		return u.AddRole(roleName, contextValue)
+	})
+}
+
+// title: dissociate role from service account
+// path: /teams/{name}/service-accounts/{account}/roles/{role}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Role or service account not found
+func dissociateServiceAccountRole(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	roleName := r.URL.Query().Get(":role")
+	contextValue := r.URL.Query().Get("context")
+	err = canUseRole(t, roleName, contextValue)
+	if err != nil {
+		return err
+	}
+	evt, err := newServiceAccountEvent(r, t, u.ServiceAccount.Team, u.ServiceAccount.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return runWithPermSync([]auth.User{*u}, func() error {
+		return u.RemoveRole(roleName, contextValue)
+	})
+}
+
+// title: create service account token
+// path: /teams/{name}/service-accounts/{account}/tokens
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Token created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Service account not found
+//   409: Token already exists
+func createServiceAccountToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	expiresAt, scopes, err := accessTokenParams(r)
+	if err != nil {
+		return err
+	}
+	evt, err := newServiceAccountEvent(r, t, u.ServiceAccount.Team, u.ServiceAccount.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	token, err := auth.CreateAccessToken(u, r.FormValue("name"), expiresAt, scopes)
+	if err == auth.ErrAccessTokenAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(token)
+}
+
+// title: list service account tokens
+// path: /teams/{name}/service-accounts/{account}/tokens
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service account not found
+func listServiceAccountTokens(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	tokens, err := auth.ListAccessTokens(u.Email)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// title: revoke service account token
+// path: /teams/{name}/service-accounts/{account}/tokens/{token}
+// method: DELETE
+// responses:
+//   200: Token revoked
+//   401: Unauthorized
+//   404: Service account or token not found
+func revokeServiceAccountToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	u, err := serviceAccountFromRequest(r, t)
+	if err != nil {
+		return err
+	}
+	evt, err := newServiceAccountEvent(r, t, u.ServiceAccount.Team, u.ServiceAccount.Name)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RevokeAccessToken(u.Email, r.URL.Query().Get(":token"))
+	if err == auth.ErrAccessTokenNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *AuthSuite) serviceAccountRequest(c *check.C, method, path, token string, form url.Values) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, "/1.6"+path, strings.NewReader(form.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) TestCreateServiceAccount(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamServiceAccount,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts", token.GetValue(), url.Values{
+		"name":        {"ci"},
+		"description": {"continuous integration"},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated, check.Commentf("body: %s", recorder.Body.String()))
+	var sa apiServiceAccount
+	err := json.NewDecoder(recorder.Body).Decode(&sa)
+	c.Assert(err, check.IsNil)
+	c.Assert(sa.Name, check.Equals, "ci")
+	c.Assert(sa.Team, check.Equals, s.team.Name)
+	c.Assert(sa.Description, check.Equals, "continuous integration")
+	c.Assert(sa.CreatedBy, check.Equals, token.GetUserName())
+	c.Assert(sa.Email, check.Equals, auth.ServiceAccountEmail("ci"))
+	c.Assert(eventtest.EventDesc{
+		Target: serviceAccountTarget("ci"),
+		Owner:  token.GetUserName(),
+		Kind:   "team.service-account",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "name", "value": "ci"},
+			{"name": "description", "value": "continuous integration"},
+		},
+	}, eventtest.HasEvent)
+	recorder = s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts", token.GetValue(), url.Values{"name": {"ci"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *AuthSuite) TestCreateServiceAccountOtherTeam(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamServiceAccount,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam2/service-accounts", token.GetValue(), url.Values{"name": {"ci"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestCreateServiceAccountInvalidName(c *check.C) {
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts", s.token.GetValue(), url.Values{"name": {"Invalid Name"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *AuthSuite) TestListServiceAccounts(c *check.C) {
+	_, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	_, err = auth.CreateServiceAccount(auth.ServiceAccount{Name: "deployer", Team: s.team2.Name})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamServiceAccount,
+		Context: permission.Context(permission.CtxTeam, s.team2.Name),
+	})
+	recorder := s.serviceAccountRequest(c, "GET", "/service-accounts", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []apiServiceAccount
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].Name, check.Equals, "deployer")
+	recorder = s.serviceAccountRequest(c, "GET", "/service-accounts", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 2)
+	recorder = s.serviceAccountRequest(c, "GET", "/service-accounts?team=tsuruteam", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestRemoveServiceAccount(c *check.C) {
+	u, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	_, err = auth.CreateAccessToken(u, "deploy", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	recorder := s.serviceAccountRequest(c, "DELETE", "/teams/tsuruteam/service-accounts/ci", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = auth.GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.Equals, auth.ErrServiceAccountNotFound)
+	tokens, err := auth.ListAccessTokens(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+	recorder = s.serviceAccountRequest(c, "DELETE", "/teams/tsuruteam/service-accounts/ci", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestAssignServiceAccountRole(c *check.C) {
+	_, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts/ci/roles", s.token.GetValue(), url.Values{
+		"role":    {"deployer"},
+		"context": {s.team.Name},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	u, err := auth.GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "deployer", ContextValue: s.team.Name}})
+	recorder = s.serviceAccountRequest(c, "DELETE", "/teams/tsuruteam/service-accounts/ci/roles/deployer?context=tsuruteam", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	u, err = auth.GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 0)
+}
+
+func (s *AuthSuite) TestAssignServiceAccountRoleNotAllowed(c *check.C) {
+	_, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamServiceAccount,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts/ci/roles", token.GetValue(), url.Values{
+		"role": {"admin"},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestServiceAccountTokens(c *check.C) {
+	_, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	recorder := s.serviceAccountRequest(c, "POST", "/teams/tsuruteam/service-accounts/ci/tokens", s.token.GetValue(), url.Values{
+		"name":  {"deploy"},
+		"scope": {"app.read"},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated, check.Commentf("body: %s", recorder.Body.String()))
+	var token auth.AccessToken
+	err = json.NewDecoder(recorder.Body).Decode(&token)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.UserEmail, check.Equals, auth.ServiceAccountEmail("ci"))
+	c.Assert(token.Token, check.Not(check.Equals), "")
+	recorder = s.serviceAccountRequest(c, "GET", "/teams/tsuruteam/service-accounts/ci/tokens", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var tokens []auth.AccessToken
+	err = json.NewDecoder(recorder.Body).Decode(&tokens)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(tokens[0].Name, check.Equals, "deploy")
+	recorder = s.serviceAccountRequest(c, "DELETE", "/teams/tsuruteam/service-accounts/ci/tokens/deploy", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = auth.AccessTokenAuth("bearer " + token.Token)
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	recorder = s.serviceAccountRequest(c, "DELETE", "/teams/tsuruteam/service-accounts/ci/tokens/deploy", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestServiceAccountSelfManagement(c *check.C) {
+	u, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	token, err := auth.CreateAccessToken(u, "deploy", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/users", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.Token)
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = auth.GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.IsNil)
+	for _, method := range []string{"GET", "POST"} {
+		request, err = http.NewRequest(method, "/users/api-key?user="+u.Email, nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder = httptest.NewRecorder()
+		s.testServer.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/service"
 )
 
@@ -42,6 +43,7 @@ func serviceIntancePermName(serviceName, instanceName string) string {
 //   201: Service created
 //   400: Invalid data
 //   401: Unauthorized
+//   403: Quota exceeded
 //   409: Service already exists
 func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	serviceName := r.URL.Query().Get(":service")
@@ -112,6 +114,12 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 			Message: err.Error(),
 		}
 	}
+	if _, ok := err.(*quota.TeamQuotaExceededError); ok {
+		return &tsuruErrors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: err.Error(),
+		}
+	}
 	if err == nil {
 		w.WriteHeader(http.StatusCreated)
 	}
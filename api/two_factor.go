@@ -0,0 +1,137 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// twoFactorScheme returns the current auth scheme when it supports two-factor
+// authentication. Two-factor settings may only be changed using login
+// sessions, never with app or access tokens.
+func twoFactorScheme(t auth.Token) (auth.TwoFactorScheme, error) {
+	scheme, ok := app.AuthScheme.(auth.TwoFactorScheme)
+	if !ok {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: nonManagedSchemeMsg}
+	}
+	if _, ok := t.(*auth.AccessToken); ok || t.IsAppToken() {
+		return nil, &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: "Two-factor authentication settings can't be changed using this token.",
+		}
+	}
+	return scheme, nil
+}
+
+func newTwoFactorEvent(r *http.Request, t auth.Token) (*event.Event, error) {
+	email := t.GetUserName()
+	return event.New(&event.Opts{
+		Target:  userTarget(email),
+		Kind:    permission.PermUserUpdateTwoFactor,
+		Owner:   t,
+		Allowed: event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+}
+
+// title: enroll in two-factor authentication
+// path: /users/two-factor
+// method: POST
+// produce: application/json
+// responses:
+//   200: Enrollment started
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   409: Two-factor authentication already enabled
+func enrollTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme(t)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := newTwoFactorEvent(r, t)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	uri, err := scheme.EnrollTwoFactor(u)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]string{"uri": uri})
+}
+
+// title: confirm two-factor authentication
+// path: /users/two-factor/confirm
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: Two-factor authentication enabled
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   409: Two-factor authentication already enabled
+func confirmTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme(t)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := newTwoFactorEvent(r, t)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	codes, err := scheme.ConfirmTwoFactor(u, r.FormValue("code"))
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// title: disable two-factor authentication
+// path: /users/two-factor
+// method: DELETE
+// responses:
+//   200: Two-factor authentication disabled
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+func disableTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme(t)
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := newTwoFactorEvent(r, t)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = scheme.DisableTwoFactor(u, r.URL.Query().Get("code"))
+	if err != nil {
+		return handleAuthError(err)
+	}
+	return nil
+}
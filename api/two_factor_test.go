@@ -0,0 +1,168 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func currentTOTPCode(c *check.C, uri string) string {
+	u, err := url.Parse(uri)
+	c.Assert(err, check.IsNil)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(u.Query().Get("secret"))
+	c.Assert(err, check.IsNil)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func (s *AuthSuite) twoFactorRequest(c *check.C, method, path, token string, form url.Values) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		request.Header.Set("Authorization", "bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) TestEnrollAndConfirmTwoFactor(c *check.C) {
+	u := &auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err := nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.Login(map[string]string{"email": u.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	recorder := s.twoFactorRequest(c, "POST", "/1.6/users/two-factor", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	var enrollment map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&enrollment)
+	c.Assert(err, check.IsNil)
+	c.Assert(enrollment["uri"], check.Matches, "otpauth://totp/.*")
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(u.Email),
+		Owner:  u.Email,
+		Kind:   "user.update.two-factor",
+	}, eventtest.HasEvent)
+	recorder = s.twoFactorRequest(c, "POST", "/1.6/users/two-factor/confirm", token.GetValue(), url.Values{"code": {"000000x"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	recorder = s.twoFactorRequest(c, "POST", "/1.6/users/two-factor/confirm", token.GetValue(), url.Values{
+		"code": {currentTOTPCode(c, enrollment["uri"])},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	var confirmation map[string][]string
+	err = json.NewDecoder(recorder.Body).Decode(&confirmation)
+	c.Assert(err, check.IsNil)
+	c.Assert(confirmation["recovery_codes"], check.HasLen, 10)
+	recorder = s.twoFactorRequest(c, "POST", "/users/nobody@globo.com/tokens", "", url.Values{"password": {"123456"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Header().Get(twoFactorHeader), check.Equals, "required")
+	recorder = s.twoFactorRequest(c, "POST", "/users/nobody@globo.com/tokens", "", url.Values{
+		"password": {"123456"},
+		"otp":      {confirmation["recovery_codes"][0]},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "DELETE", "/1.6/users/two-factor?code="+confirmation["recovery_codes"][1], token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "POST", "/users/nobody@globo.com/tokens", "", url.Values{"password": {"123456"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *AuthSuite) TestTwoFactorPendingToken(c *check.C) {
+	role, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = role.SetTwoFactorRequired(true)
+	c.Assert(err, check.IsNil)
+	u := &auth.User{Email: "nobody@globo.com", Password: "123456"}
+	_, err = nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.Login(map[string]string{"email": u.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	recorder := s.twoFactorRequest(c, "GET", "/users/api-key", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "POST", "/users/api-key", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "GET", "/users/keys", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "PUT", "/users/password", token.GetValue(), url.Values{
+		"old": {"123456"},
+		"new": {"654321"},
+	})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.APIKey, check.Equals, "")
+	recorder = s.twoFactorRequest(c, "POST", "/1.6/users/two-factor", token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *AuthSuite) TestEnrollTwoFactorWithAccessToken(c *check.C) {
+	token, err := auth.CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	recorder := s.twoFactorRequest(c, "POST", "/1.6/users/two-factor", token.Token, nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestDisableTwoFactorNotEnabled(c *check.C) {
+	recorder := s.twoFactorRequest(c, "DELETE", "/1.6/users/two-factor?code=123456", s.token.GetValue(), nil)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *AuthSuite) TestSetRoleTwoFactor(c *check.C) {
+	_, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	recorder := s.twoFactorRequest(c, "PUT", "/1.6/roles/admin/two-factor", s.token.GetValue(), url.Values{"required": {"true"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	role, err := permission.FindRole("admin")
+	c.Assert(err, check.IsNil)
+	c.Assert(role.TwoFactorRequired, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "admin"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "role.update.two-factor",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "admin"},
+			{"name": "required", "value": "true"},
+		},
+	}, eventtest.HasEvent)
+	recorder = s.twoFactorRequest(c, "PUT", "/1.6/roles/admin/two-factor", s.token.GetValue(), url.Values{"required": {"maybe"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	recorder = s.twoFactorRequest(c, "PUT", "/1.6/roles/unknown/two-factor", s.token.GetValue(), url.Values{"required": {"true"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestSetRoleTwoFactorUnauthorized(c *check.C) {
+	_, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c)
+	recorder := s.twoFactorRequest(c, "PUT", "/1.6/roles/admin/two-factor", token.GetValue(), url.Values{"required": {"true"}})
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
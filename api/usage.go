@@ -0,0 +1,100 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/usage"
+)
+
+// title: usage report
+// path: /usage
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+func usageReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teams, err := permission.ListContextValues(t, permission.PermUsageRead, true)
+	if err != nil {
+		return err
+	}
+	if team := r.URL.Query().Get("team"); team != "" {
+		if !permission.Check(t, permission.PermUsageRead, permission.Context(permission.CtxTeam, team)) {
+			return permission.ErrUnauthorized
+		}
+		teams = []string{team}
+	}
+	filter := usage.Filter{
+		Teams: teams,
+		Pool:  r.URL.Query().Get("pool"),
+		To:    time.Now(),
+	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := r.URL.Query().Get(param.name); v != "" {
+			*param.value, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				msg := fmt.Sprintf(`Parameter %q must be a RFC3339 timestamp.`, param.name)
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+			}
+		}
+	}
+	if r.URL.Query().Get("from") == "" {
+		filter.From = filter.To.AddDate(0, 0, -30)
+	}
+	report, err := usage.Report(filter)
+	if err != nil {
+		return err
+	}
+	if r.URL.Query().Get("format") == "csv" || r.Header.Get("Accept") == "text/csv" {
+		return writeUsageCSV(w, report)
+	}
+	if len(report) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
+func writeUsageCSV(w http.ResponseWriter, report []usage.Usage) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"team", "pool", "plan", "unit_hours", "memory_gb_hours", "cost"})
+	if err != nil {
+		return err
+	}
+	for _, u := range report {
+		err = writer.Write([]string{
+			u.Team,
+			u.Pool,
+			u.Plan,
+			strconv.FormatFloat(u.UnitHours, 'f', 4, 64),
+			strconv.FormatFloat(u.MemoryGBHours, 'f', 4, 64),
+			strconv.FormatFloat(u.Cost, 'f', 2, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/usage"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertUsageRecords(c *check.C, hour time.Time) {
+	for _, r := range []bson.M{
+		{"_id": "1", "hour": hour, "team": "team1", "pool": "pool1", "plan": "small", "unithours": 2.0, "memorygbhours": 1.0, "cost": 0.5},
+		{"_id": "2", "hour": hour.Add(time.Hour), "team": "team1", "pool": "pool1", "plan": "small", "unithours": 1.0, "memorygbhours": 0.5, "cost": 0.25},
+		{"_id": "3", "hour": hour, "team": "team2", "pool": "pool1", "plan": "large", "unithours": 1.0, "memorygbhours": 2.0, "cost": 1.0},
+	} {
+		err := s.conn.Collection("usage").Insert(r)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *S) TestUsageReport(c *check.C) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	s.insertUsageRecords(c, hour)
+	request, err := http.NewRequest("GET", "/1.6/usage", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []usage.Usage
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []usage.Usage{
+		{Team: "team1", Pool: "pool1", Plan: "small", UnitHours: 3, MemoryGBHours: 1.5, Cost: 0.75},
+		{Team: "team2", Pool: "pool1", Plan: "large", UnitHours: 1, MemoryGBHours: 2, Cost: 1},
+	})
+}
+
+func (s *S) TestUsageReportTimeRange(c *check.C) {
+	hour := time.Date(2018, 5, 10, 10, 0, 0, 0, time.UTC)
+	s.insertUsageRecords(c, hour)
+	request, err := http.NewRequest("GET", "/1.6/usage?team=team1&from=2018-05-10T11:00:00Z&to=2018-05-10T12:00:00Z", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []usage.Usage
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []usage.Usage{
+		{Team: "team1", Pool: "pool1", Plan: "small", UnitHours: 1, MemoryGBHours: 0.5, Cost: 0.25},
+	})
+}
+
+func (s *S) TestUsageReportCSV(c *check.C) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	s.insertUsageRecords(c, hour)
+	request, err := http.NewRequest("GET", "/1.6/usage?format=csv", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/csv")
+	c.Assert(recorder.Body.String(), check.Equals, `team,pool,plan,unit_hours,memory_gb_hours,cost
+team1,pool1,small,3.0000,1.5000,0.75
+team2,pool1,large,1.0000,2.0000,1.00
+`)
+}
+
+func (s *S) TestUsageReportTeamPermission(c *check.C) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	s.insertUsageRecords(c, hour)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermUsageRead,
+		Context: permission.Context(permission.CtxTeam, "team2"),
+	})
+	request, err := http.NewRequest("GET", "/1.6/usage", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []usage.Usage
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []usage.Usage{
+		{Team: "team2", Pool: "pool1", Plan: "large", UnitHours: 1, MemoryGBHours: 2, Cost: 1},
+	})
+	request, err = http.NewRequest("GET", "/1.6/usage?team=team1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUsageReportWithoutPermission(c *check.C) {
+	token := userWithPermission(c)
+	request, err := http.NewRequest("GET", "/1.6/usage", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUsageReportInvalidTime(c *check.C) {
+	request, err := http.NewRequest("GET", "/1.6/usage?from=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.testServer.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Parameter \"from\" must be a RFC3339 timestamp.\n")
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/volume"
 )
 
@@ -102,6 +103,7 @@ func volumeInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 // responses:
 //   201: Volume created
 //   401: Unauthorized
+//   403: Quota exceeded
 //   409: Volume already exists
 func volumeCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	err = r.ParseForm()
@@ -138,6 +140,9 @@ func volumeCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err err
 		return &errors.HTTP{Code: http.StatusConflict, Message: "volume already exists"}
 	}
 	err = inputVolume.Save()
+	if _, ok := err.(*quota.TeamQuotaExceededError); ok {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,261 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func webhookTarget(name string) event.Target {
+	return event.Target{Type: event.TargetTypeWebhook, Value: name}
+}
+
+func webhookFromForm(r *http.Request) (webhook.Webhook, error) {
+	var w webhook.Webhook
+	err := r.ParseForm()
+	if err != nil {
+		return w, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	err = dec.DecodeValues(&w, r.Form)
+	if err != nil {
+		return w, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse webhook: %s", err)}
+	}
+	return w, nil
+}
+
+// webhookCustomData returns the form as event custom data, without the
+// webhook secret and with header values redacted.
+func webhookCustomData(values url.Values) []map[string]interface{} {
+	filtered := url.Values{}
+	for k, v := range values {
+		if strings.ToLower(k) != "secret" {
+			filtered[k] = v
+		}
+	}
+	return event.FormToCustomData(redactFormHeaders(filtered, webhook.RedactedValue))
+}
+
+// redactFormHeaders returns a copy of the form with the values of headers
+// fields replaced by redacted.
+func redactFormHeaders(values url.Values, redacted string) url.Values {
+	filtered := url.Values{}
+	for k, v := range values {
+		if !strings.HasPrefix(strings.ToLower(k), "headers") {
+			filtered[k] = v
+			continue
+		}
+		for range v {
+			filtered[k] = append(filtered[k], redacted)
+		}
+	}
+	return filtered
+}
+
+// hasFormKey reports whether key was sent in the form, regardless of its
+// value and case.
+func hasFormKey(values url.Values, key string) bool {
+	for k := range values {
+		if strings.ToLower(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookHTTPError(err error) error {
+	switch err {
+	case webhook.ErrWebhookNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case webhook.ErrWebhookAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+// title: webhook list
+// path: /events/webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermWebhookRead) {
+		return permission.ErrUnauthorized
+	}
+	webhooks, err := webhook.List()
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	for i := range webhooks {
+		webhooks[i] = webhooks[i].Redacted()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(webhooks)
+}
+
+// title: webhook info
+// path: /events/webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermWebhookRead) {
+		return permission.ErrUnauthorized
+	}
+	hook, err := webhook.Find(r.URL.Query().Get(":name"))
+	if err != nil {
+		return webhookHTTPError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hook.Redacted())
+}
+
+// title: webhook create
+// path: /events/webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermWebhookCreate) {
+		return permission.ErrUnauthorized
+	}
+	hook, err := webhookFromForm(r)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(hook.Name),
+		Kind:       permission.PermWebhookCreate,
+		Owner:      t,
+		CustomData: webhookCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookHTTPError(webhook.Create(hook))
+}
+
+// title: webhook update
+// path: /events/webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermWebhookUpdate) {
+		return permission.ErrUnauthorized
+	}
+	hook, err := webhookFromForm(r)
+	if err != nil {
+		return err
+	}
+	hook.Name = r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(hook.Name),
+		Kind:       permission.PermWebhookUpdate,
+		Owner:      t,
+		CustomData: webhookCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookHTTPError(webhook.Update(hook, hasFormKey(r.Form, "secret")))
+}
+
+// title: webhook delete
+// path: /events/webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook removed
+//   401: Unauthorized
+//   404: Not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	if !permission.Check(t, permission.PermWebhookDelete) {
+		return permission.ErrUnauthorized
+	}
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     webhookTarget(name),
+		Kind:       permission.PermWebhookDelete,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookHTTPError(webhook.Delete(name))
+}
+
+// title: webhook deliveries
+// path: /events/webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermWebhookRead) {
+		return permission.ErrUnauthorized
+	}
+	name := r.URL.Query().Get(":name")
+	_, err := webhook.Find(name)
+	if err != nil {
+		return webhookHTTPError(err)
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	deliveries, err := webhook.ListDeliveries(name, limit)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
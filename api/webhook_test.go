@@ -0,0 +1,305 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/permission/permissiontest"
+	"gopkg.in/check.v1"
+)
+
+func (s *EventSuite) TestWebhookList(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com", Secret: "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Not(check.Matches), "(?s).*s3cr3t.*")
+	var hooks []webhook.Webhook
+	err = json.NewDecoder(recorder.Body).Decode(&hooks)
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks, check.DeepEquals, []webhook.Webhook{{Name: "hook1", URL: "http://example.com"}})
+}
+
+func (s *EventSuite) TestWebhookListEmpty(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *EventSuite) TestWebhookListWithoutPermission(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *EventSuite) TestWebhookCreate(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	values := url.Values{
+		"name":                    []string{"hook1"},
+		"url":                     []string{"http://example.com/hook"},
+		"secret":                  []string{"s3cr3t"},
+		"eventfilter.targettypes": []string{"app"},
+	}
+	request, err := http.NewRequest("POST", "/events/webhooks", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	hook, err := webhook.Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &webhook.Webhook{
+		Name:        "hook1",
+		URL:         "http://example.com/hook",
+		Secret:      "s3cr3t",
+		EventFilter: webhook.EventFilter{TargetTypes: []string{"app"}},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "hook1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "hook1"},
+			{"name": "url", "value": "http://example.com/hook"},
+			{"name": "eventfilter.targettypes", "value": "app"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *EventSuite) TestWebhookCreateAlreadyExists(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=hook1&url=http://example.com/other")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *EventSuite) TestWebhookCreateInvalid(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	body := strings.NewReader("name=hook1&url=ftp://example.com")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid webhook url \"ftp://example.com\"\n")
+}
+
+func (s *EventSuite) TestWebhookUpdate(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookUpdate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("url=http://example.com/new&eventfilter.erroronly=true")
+	request, err := http.NewRequest("PUT", "/events/webhooks/hook1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	hook, err := webhook.Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &webhook.Webhook{
+		Name:        "hook1",
+		URL:         "http://example.com/new",
+		EventFilter: webhook.EventFilter{ErrorOnly: true},
+	})
+}
+
+func (s *EventSuite) TestWebhookUpdateKeepsSecret(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookUpdate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com", Secret: "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	values := url.Values{
+		"url":               []string{"http://example.com/new"},
+		"headers.X-Token.0": []string{"abc"},
+	}
+	request, err := http.NewRequest("PUT", "/events/webhooks/hook1", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	hook, err := webhook.Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &webhook.Webhook{
+		Name:    "hook1",
+		URL:     "http://example.com/new",
+		Headers: http.Header{"X-Token": []string{"abc"}},
+		Secret:  "s3cr3t",
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "hook1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": "url", "value": "http://example.com/new"},
+			{"name": "headers.X-Token.0", "value": webhook.RedactedValue},
+		},
+	}, eventtest.HasEvent)
+	request, err = http.NewRequest("PUT", "/events/webhooks/hook1", strings.NewReader("url=http://example.com/new&secret="))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	hook, err = webhook.Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook.Secret, check.Equals, "")
+}
+
+func (s *EventSuite) TestWebhookInfoRedactsHeaders(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{
+		Name:    "hook1",
+		URL:     "http://example.com",
+		Headers: http.Header{"Authorization": []string{"bearer abc"}},
+	})
+	c.Assert(err, check.IsNil)
+	server := RunServer(true)
+	for _, path := range []string{"/events/webhooks", "/events/webhooks/hook1"} {
+		request, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+token.GetValue())
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusOK)
+		c.Assert(recorder.Body.String(), check.Not(check.Matches), "(?s).*bearer abc.*")
+		c.Assert(recorder.Body.String(), check.Matches, "(?s).*Authorization.*")
+	}
+}
+
+func (s *EventSuite) TestWebhookUpdateNotFound(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookUpdate,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	body := strings.NewReader("url=http://example.com/new")
+	request, err := http.NewRequest("PUT", "/events/webhooks/hook1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *EventSuite) TestWebhookDelete(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookDelete,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/events/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Find("hook1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "hook1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.delete",
+	}, eventtest.HasEvent)
+}
+
+func (s *EventSuite) TestWebhookDeleteNotFound(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookDelete,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	request, err := http.NewRequest("DELETE", "/events/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *EventSuite) TestWebhookDeliveriesEmpty(c *check.C) {
+	_, token := permissiontest.CustomUserWithPermission(c, nativeScheme, "myuser", permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.PermissionContext{CtxType: permission.CtxGlobal},
+	})
+	err := webhook.Create(webhook.Webhook{Name: "hook1", URL: "http://example.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/webhooks/hook1/deliveries", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
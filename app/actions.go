@@ -320,7 +320,7 @@ var reserveUnitsToAdd = action.Action{
 		if err != nil {
 			return nil, ErrAppNotFound
 		}
-		err = reserveUnits(app, n)
+		err = reserveTeamUnits(app, n)
 		if err != nil {
 			return nil, err
 		}
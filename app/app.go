@@ -150,6 +150,7 @@ type App struct {
 	Tags           []string
 	Error          string
 	Routers        []appTypes.AppRouter
+	LogRateLimit   int
 
 	quota.Quota
 	builder     builder.Builder
@@ -260,6 +261,9 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["lock"] = app.Lock
 	result["tags"] = app.Tags
 	result["routers"] = routers
+	if app.LogRateLimit != 0 {
+		result["logratelimit"] = app.LogRateLimit
+	}
 	if len(errMsgs) > 0 {
 		result["error"] = strings.Join(errMsgs, "\n")
 	}
@@ -274,6 +278,7 @@ type Applog struct {
 	Source  string
 	AppName string
 	Unit    string
+	Fields  map[string]interface{} `bson:",omitempty" json:",omitempty"`
 }
 
 type ErrAppNotLocked struct {
@@ -426,6 +431,10 @@ func CreateApp(app *App, user *auth.User) error {
 	if err != nil {
 		return err
 	}
+	err = checkTeamQuota(app.TeamOwner, app.Name, app.Plan, 1)
+	if err != nil {
+		return err
+	}
 	actions := []*action.Action{
 		&reserveUserApp,
 		&insertApp,
@@ -536,6 +545,12 @@ func (app *App) Update(updateData App, w io.Writer) (err error) {
 	if err != nil {
 		return err
 	}
+	if app.Plan != oldApp.Plan || app.TeamOwner != oldApp.TeamOwner {
+		err = checkTeamQuota(app.TeamOwner, app.Name, app.Plan, app.Quota.InUse)
+		if err != nil {
+			return err
+		}
+	}
 	actions := []*action.Action{
 		&saveApp,
 	}
@@ -715,13 +730,12 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
-	logConn, err := db.LogConn()
+	logStorage, err := GetLogStorage()
 	if err == nil {
-		defer logConn.Close()
-		err = logConn.Logs(appName).DropCollection()
+		err = logStorage.Remove(appName)
 	}
 	if err != nil {
-		logErr("Unable to remove logs collection", err)
+		logErr("Unable to remove logs", err)
 	}
 	conn, err := db.Conn()
 	if err == nil {
@@ -1381,6 +1395,26 @@ func (app *App) SetQuotaInUse(inUse int) error {
 	return err
 }
 
+// SetLogRateLimit changes the number of log lines per second accepted for
+// the app. Zero means the limit defined in the app plan, or in the config
+// if the plan has no limit, is used. A negative value disables the limit.
+func (app *App) SetLogRateLimit(limit int) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"logratelimit": limit}})
+	if err == mgo.ErrNotFound {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+	app.LogRateLimit = limit
+	return nil
+}
+
 // GetCname returns the cnames of the app.
 func (app *App) GetCname() []string {
 	return app.CName
@@ -1598,36 +1632,44 @@ func (app *App) RemoveInstance(removeArgs bind.RemoveInstanceArgs) error {
 // user can filter where the message come from.
 func (app *App) Log(message, source, unit string) error {
 	messages := strings.Split(message, "\n")
-	logs := make([]interface{}, 0, len(messages))
+	logs := make([]*Applog, 0, len(messages))
 	for _, msg := range messages {
 		if msg != "" {
-			l := Applog{
+			l := &Applog{
 				Date:    time.Now().In(time.UTC),
 				Message: msg,
 				Source:  source,
 				AppName: app.Name,
 				Unit:    unit,
 			}
+			l.ParseFields()
 			logs = append(logs, l)
 		}
 	}
 	if len(logs) > 0 {
-		conn, err := db.LogConn()
+		storage, err := GetLogStorage()
 		if err != nil {
 			return err
 		}
-		defer conn.Close()
-		return conn.Logs(app.Name).Insert(logs...)
+		return storage.Insert(app.Name, logs...)
 	}
 	return nil
 }
 
 // LastLogs returns a list of the last `lines` log of the app, matching the
-// fields in the log instance received as an example.
-func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+// given filter.
+func (app *App) LastLogs(lines int, filter LogFilter) ([]Applog, error) {
+	logs, _, err := app.LastLogsPage(lines, filter)
+	return logs, err
+}
+
+// LastLogsPage works like LastLogs, also returning a cursor to be set in the
+// filter to retrieve the previous page of logs. The cursor is empty when
+// there are no older logs matching the filter.
+func (app *App) LastLogsPage(lines int, filter LogFilter) ([]Applog, string, error) {
 	prov, err := app.getProvisioner()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	logsProvisioner, ok := prov.(provision.OptionalLogsProvisioner)
 	if ok {
@@ -1635,34 +1677,17 @@ func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
 		var doc string
 		enabled, doc, err = logsProvisioner.LogsEnabled(app)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		if !enabled {
-			return nil, errors.New(doc)
+			return nil, "", errors.New(doc)
 		}
 	}
-	conn, err := db.LogConn()
+	storage, err := GetLogStorage()
 	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
-	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
-	if err != nil {
-		return nil, err
-	}
-	l := len(logs)
-	for i := 0; i < l/2; i++ {
-		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+		return nil, "", err
 	}
-	return logs, nil
+	return storage.List(app.Name, lines, filter)
 }
 
 type Filter struct {
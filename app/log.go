@@ -6,8 +6,6 @@ package app
 
 import (
 	"context"
-	"fmt"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,10 +13,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tsuru/tsuru/api/shutdown"
-	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
 var (
@@ -88,101 +83,21 @@ func init() {
 	prometheus.MustRegister(logsMongoLatency)
 }
 
+// LogListener receives the messages inserted in the log of an app.
 type LogListener struct {
-	c       <-chan Applog
-	logConn *db.LogStorage
-	quit    chan struct{}
+	c     <-chan Applog
+	quit  chan struct{}
+	close func()
 }
 
-func isCappedPositionLost(err error) bool {
-	if err == nil {
-		return false
-	}
-	return strings.Contains(err.Error(), "CappedPositionLost")
-}
-
-func isSessionClosed(r interface{}) bool {
-	return fmt.Sprintf("%v", r) == "Session already closed"
-}
-
-func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
-	conn, err := db.LogConn()
+// NewLogListener returns a listener for the messages of the app matching
+// filter, using the configured log storage.
+func NewLogListener(a *App, filter LogFilter) (*LogListener, error) {
+	storage, err := GetLogStorage()
 	if err != nil {
 		return nil, err
 	}
-	c := make(chan Applog, 10)
-	quit := make(chan struct{})
-	coll := conn.Logs(a.Name)
-	var lastLog Applog
-	err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
-	if err == mgo.ErrNotFound {
-		// Tail cursors do not work correctly if the collection is empty (the
-		// Next() call wouldn't block). So if the collection is empty we insert
-		// the very first log line in it. This is quite rare in the real world
-		// though so the impact of this extra log message is really small.
-		err = a.Log("Logs initialization", "tsuru", "")
-		if err != nil {
-			return nil, err
-		}
-		err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
-	}
-	if err != nil {
-		return nil, err
-	}
-	lastId := lastLog.MongoID
-	mkQuery := func() bson.M {
-		m := bson.M{
-			"_id": bson.M{"$gt": lastId},
-		}
-		if filterLog.Source != "" {
-			m["source"] = filterLog.Source
-		}
-		if filterLog.Unit != "" {
-			m["unit"] = filterLog.Unit
-		}
-		return m
-	}
-	query := coll.Find(mkQuery())
-	tailTimeout := 10 * time.Second
-	iter := query.Sort("$natural").Tail(tailTimeout)
-	go func() {
-		defer close(c)
-		defer func() {
-			if r := recover(); r != nil {
-				if isSessionClosed(r) {
-					return
-				}
-				panic(err)
-			}
-		}()
-		for {
-			var applog Applog
-			for iter.Next(&applog) {
-				lastId = applog.MongoID
-				select {
-				case c <- applog:
-				case <-quit:
-					iter.Close()
-					return
-				}
-			}
-			if iter.Timeout() {
-				continue
-			}
-			if err := iter.Err(); err != nil {
-				if !isCappedPositionLost(err) {
-					log.Errorf("error tailing logs: %v", err)
-					iter.Close()
-					return
-				}
-			}
-			iter.Close()
-			query = coll.Find(mkQuery())
-			iter = query.Sort("$natural").Tail(tailTimeout)
-		}
-	}()
-	l := LogListener{c: c, logConn: conn, quit: quit}
-	return &l, nil
+	return storage.Watch(a.Name, filter)
 }
 
 func (l *LogListener) ListenChan() <-chan Applog {
@@ -190,11 +105,14 @@ func (l *LogListener) ListenChan() <-chan Applog {
 }
 
 func (l *LogListener) Close() {
-	l.logConn.Close()
-	if l.quit != nil {
-		close(l.quit)
-		l.quit = nil
+	if l.quit == nil {
+		return
+	}
+	if l.close != nil {
+		l.close()
 	}
+	close(l.quit)
+	l.quit = nil
 }
 
 type LogDispatcher struct {
@@ -203,6 +121,7 @@ type LogDispatcher struct {
 	msgCh          chan *msgWithTS
 	shuttingDown   int32
 	doneProcessing chan struct{}
+	forwarding     *logForwarding
 }
 
 type msgWithTS struct {
@@ -215,7 +134,9 @@ func NewlogDispatcher(chanSize int) *LogDispatcher {
 		dispatchers:    make(map[string]*appLogDispatcher),
 		msgCh:          make(chan *msgWithTS, chanSize),
 		doneProcessing: make(chan struct{}),
+		forwarding:     newLogForwarding(),
 	}
+	go d.forwarding.run()
 	go d.runWriter()
 	shutdown.Register(d)
 	logsQueueSize.Set(float64(chanSize))
@@ -249,7 +170,9 @@ func (d *LogDispatcher) runWriter() {
 		}
 		logsInQueue.Dec()
 		appD := d.getMessageDispatcher(msgExtra.msg)
-		appD.send(msgExtra)
+		if appD.send(msgExtra) {
+			d.forwarding.send(msgExtra.msg)
+		}
 	}
 }
 
@@ -282,11 +205,13 @@ func (d *LogDispatcher) Shutdown(ctx context.Context) error {
 	for _, appD := range d.dispatchers {
 		appD.stopWait()
 	}
+	d.forwarding.stop()
 	return nil
 }
 
 type appLogDispatcher struct {
 	appName string
+	limiter *logRateLimiter
 	*bulkProcessor
 }
 
@@ -294,21 +219,35 @@ func newAppLogDispatcher(appName string) *appLogDispatcher {
 	d := &appLogDispatcher{
 		bulkProcessor: initBulkProcessor(bulkMaxWaitMongoTime, bulkMaxNumberMsgs),
 		appName:       appName,
+		limiter:       newLogRateLimiter(appName),
 	}
 	d.flushable = d
+	d.pending = d.limiter.droppedLog
 	go d.run()
 	return d
 }
 
-func (d *appLogDispatcher) flush(msgs []interface{}, lastMessage *msgWithTS) bool {
-	conn, err := db.LogConn()
+// send enqueues the message to be stored, unless the app is over its log
+// rate limit, in which case the message is dropped and false is returned.
+func (d *appLogDispatcher) send(msg *msgWithTS) bool {
+	if !d.limiter.allow(time.Now()) {
+		return false
+	}
+	d.bulkProcessor.send(msg)
+	return true
+}
+
+func (d *appLogDispatcher) flush(msgs []*Applog, lastMessage *msgWithTS) bool {
+	storage, err := GetLogStorage()
 	if err != nil {
-		log.Errorf("[log flusher] unable to connect to mongodb: %s", err)
+		log.Errorf("[log flusher] unable to get log storage: %s", err)
 		return false
 	}
-	coll := conn.Logs(d.appName)
-	err = coll.Insert(msgs...)
-	coll.Close()
+	err = storage.Insert(d.appName, msgs...)
+	if _, ok := err.(*InvalidLogsError); ok {
+		log.Errorf("[log flusher] dropping %d logs for app %q: %s", len(msgs), d.appName, err)
+		return true
+	}
 	if err != nil {
 		log.Errorf("[log flusher] unable to insert logs: %s", err)
 		return false
@@ -328,8 +267,11 @@ type bulkProcessor struct {
 	ch          chan *msgWithTS
 	nextNotify  *time.Timer
 	flushable   interface {
-		flush([]interface{}, *msgWithTS) bool
+		flush([]*Applog, *msgWithTS) bool
 	}
+	// pending, when set, is called before each flush to get an extra
+	// message to be stored along with the bulk.
+	pending func() *Applog
 }
 
 func initBulkProcessor(maxWait time.Duration, bulkSize int) *bulkProcessor {
@@ -366,7 +308,7 @@ func (p *bulkProcessor) run() {
 	defer close(p.finished)
 	t := time.NewTimer(p.maxWaitTime)
 	pos := 0
-	bulkBuffer := make([]interface{}, p.bulkSize)
+	bulkBuffer := make([]*Applog, p.bulkSize)
 	shouldReturn := false
 	var lastMessage *msgWithTS
 	for {
@@ -391,6 +333,12 @@ func (p *bulkProcessor) run() {
 			flush = true
 			t.Reset(p.maxWaitTime)
 		}
+		if flush && pos < p.bulkSize && p.pending != nil {
+			if msg := p.pending(); msg != nil {
+				bulkBuffer[pos] = msg
+				pos++
+			}
+		}
 		if flush && pos > 0 {
 			if p.flushable.flush(bulkBuffer[:pos], lastMessage) {
 				lastMessage = nil
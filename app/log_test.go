@@ -39,7 +39,7 @@ func compareLogs(c *check.C, logs1 []Applog, logs2 []Applog) {
 
 func (s *S) TestNewLogListener(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
@@ -56,7 +56,7 @@ func (s *S) TestNewLogListener(c *check.C) {
 
 func (s *S) TestNewLogListenerFiltered(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{Source: "web", Unit: "u1"})
+	l, err := NewLogListener(&app, LogFilter{Source: "web", Unit: "u1"})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	c.Assert(l.quit, check.NotNil)
@@ -79,7 +79,7 @@ func (s *S) TestNewLogListenerFiltered(c *check.C) {
 
 func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	c.Assert(l.quit, check.NotNil)
 	c.Assert(l.c, check.NotNil)
@@ -90,7 +90,7 @@ func (s *S) TestNewLogListenerClosingChannel(c *check.C) {
 
 func (s *S) TestLogListenerClose(c *check.C) {
 	app := App{Name: "myapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	_, ok := <-l.c
@@ -102,7 +102,7 @@ func (s *S) TestLogListenerDoubleClose(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "yourapp"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	l.Close()
@@ -114,7 +114,7 @@ func (s *S) TestNotify(c *check.C) {
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -165,7 +165,7 @@ func (s *S) TestNotifyFiltered(c *check.C) {
 		sync.Mutex
 	}
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{Source: "tsuru", Unit: "unit1"})
+	l, err := NewLogListener(&app, LogFilter{Source: "tsuru", Unit: "unit1"})
 	c.Assert(err, check.IsNil)
 	defer l.Close()
 	go func() {
@@ -218,7 +218,7 @@ func (s *S) TestNotifySendOnClosedChannel(c *check.C) {
 		c.Assert(recover(), check.IsNil)
 	}()
 	app := App{Name: "fade"}
-	l, err := NewLogListener(&app, Applog{})
+	l, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	l.Close()
 	ms := []interface{}{
@@ -232,7 +232,7 @@ func (s *S) TestLogDispatcherSend(c *check.C) {
 	app := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
 	c.Assert(err, check.IsNil)
-	listener, err := NewLogListener(&app, Applog{})
+	listener, err := NewLogListener(&app, LogFilter{})
 	c.Assert(err, check.IsNil)
 	defer listener.Close()
 	dispatcher := NewlogDispatcher(2000000)
@@ -244,7 +244,7 @@ func (s *S) TestLogDispatcherSend(c *check.C) {
 	}
 	dispatcher.Send(&logMsg)
 	dispatcher.Shutdown(context.Background())
-	logs, err := app.LastLogs(1, Applog{})
+	logs, err := app.LastLogs(1, LogFilter{})
 	c.Assert(err, check.IsNil)
 	compareLogs(c, logs, []Applog{logMsg})
 	err = dispatcher.Send(&logMsg)
@@ -284,10 +284,10 @@ func (s *S) TestLogDispatcherSendConcurrent(c *check.C) {
 	}
 	wg.Wait()
 	dispatcher.Shutdown(context.Background())
-	logs, err := app1.LastLogs(nConcurrent/2, Applog{})
+	logs, err := app1.LastLogs(nConcurrent/2, LogFilter{})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, nConcurrent/2)
-	logs, err = app2.LastLogs(nConcurrent/2, Applog{})
+	logs, err = app2.LastLogs(nConcurrent/2, LogFilter{})
 	c.Assert(err, check.IsNil)
 	c.Assert(logs, check.HasLen, nConcurrent/2)
 }
@@ -351,7 +351,7 @@ func (s *S) TestLogDispatcherSendDBFailure(c *check.C) {
 	timeout := time.After(10 * time.Second)
 loop:
 	for {
-		logs, logsErr := app.LastLogs(10, Applog{})
+		logs, logsErr := app.LastLogs(10, LogFilter{})
 		c.Assert(logsErr, check.IsNil)
 		if len(logs) == 10 {
 			break
@@ -0,0 +1,106 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/config"
+)
+
+// ParseFields fills the log fields with the keys of the message when it's a
+// JSON object and the app-log:parse-json config is enabled. Fields are left
+// untouched otherwise.
+func (l *Applog) ParseFields() {
+	if enabled, _ := config.GetBool("app-log:parse-json"); !enabled {
+		return
+	}
+	msg := strings.TrimSpace(l.Message)
+	if !strings.HasPrefix(msg, "{") || !strings.HasSuffix(msg, "}") {
+		return
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(msg), &fields) != nil || len(fields) == 0 {
+		return
+	}
+	l.Fields = sanitizeLogFields(fields)
+}
+
+// sanitizeLogFields replaces the characters MongoDB does not accept in
+// document keys, dots and leading dollar signs, by underscores.
+func sanitizeLogFields(fields map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		k = strings.Replace(k, ".", "_", -1)
+		if strings.HasPrefix(k, "$") {
+			k = "_" + k[1:]
+		}
+		result[k] = sanitizeLogValue(v)
+	}
+	return result
+}
+
+// sanitizeLogValue sanitizes the keys of objects found in v, including the
+// ones inside arrays.
+func sanitizeLogValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return sanitizeLogFields(value)
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i := range value {
+			result[i] = sanitizeLogValue(value[i])
+		}
+		return result
+	}
+	return v
+}
+
+// logFieldValue returns the value of a field, nested fields are accessed
+// using dots in the key.
+func logFieldValue(fields map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	var value interface{} = fields
+	for _, part := range parts {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// logFieldCandidates returns the values a field may hold to match the given
+// filter value, as parsed JSON numbers and booleans are not stored as
+// strings.
+func logFieldCandidates(value string) []interface{} {
+	candidates := []interface{}{value}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		candidates = append(candidates, f)
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		candidates = append(candidates, b)
+	}
+	return candidates
+}
+
+func logFieldMatches(fields map[string]interface{}, key, value string) bool {
+	fieldValue, ok := logFieldValue(fields, key)
+	if !ok {
+		return false
+	}
+	for _, candidate := range logFieldCandidates(value) {
+		if fieldValue == candidate {
+			return true
+		}
+	}
+	return false
+}
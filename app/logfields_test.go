@@ -0,0 +1,52 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestApplogParseFields(c *check.C) {
+	config.Set("app-log:parse-json", true)
+	defer config.Unset("app-log:parse-json")
+	l := Applog{Message: ` {"level": "error", "a.b": 1, "$set": {"x.y": true}, "items": [{"b.c": 1}, [{"$d": 2}], 3]} `}
+	l.ParseFields()
+	c.Assert(l.Fields, check.DeepEquals, map[string]interface{}{
+		"level": "error",
+		"a_b":   1.0,
+		"_set":  map[string]interface{}{"x_y": true},
+		"items": []interface{}{
+			map[string]interface{}{"b_c": 1.0},
+			[]interface{}{map[string]interface{}{"_d": 2.0}},
+			3.0,
+		},
+	})
+	for _, msg := range []string{"plain message", `{"level": `, "{}", `["a", "b"]`} {
+		l = Applog{Message: msg}
+		l.ParseFields()
+		c.Assert(l.Fields, check.IsNil, check.Commentf("message %q", msg))
+	}
+}
+
+func (s *S) TestApplogParseFieldsDisabled(c *check.C) {
+	l := Applog{Message: `{"level": "error"}`}
+	l.ParseFields()
+	c.Assert(l.Fields, check.IsNil)
+}
+
+func (s *S) TestAppLogParsesFields(c *check.C) {
+	config.Set("app-log:parse-json", true)
+	defer config.Unset("app-log:parse-json")
+	a := App{Name: "json-logs", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "warn"}`+"\nplain", "app", "u1")
+	c.Assert(err, check.IsNil)
+	logs, err := a.LastLogs(1, LogFilter{Fields: map[string]string{"level": "warn"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]interface{}{"level": "warn"})
+}
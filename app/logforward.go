@@ -0,0 +1,467 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	LogForwarderSyslog = "syslog"
+	LogForwarderHTTP   = "http"
+
+	// LogForwarderRedactedValue replaces header values whenever log
+	// forwarders are shown to users.
+	LogForwarderRedactedValue = "*****"
+
+	logForwardQueueSize = 10000
+	logForwardBatchSize = 500
+)
+
+var (
+	ErrLogForwarderAlreadyExists = errors.New("log forwarder already exists")
+	ErrLogForwarderNotFound      = errors.New("log forwarder not found")
+
+	logForwardRefreshInterval = 30 * time.Second
+	logForwardMaxWait         = time.Second
+	logForwardTimeout         = 10 * time.Second
+
+	logsForwardEnqueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_forward_enqueued_total",
+		Help: "The number of log entries enqueued to be forwarded.",
+	}, []string{"forwarder"})
+
+	logsForwardSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_forward_sent_total",
+		Help: "The number of log entries forwarded.",
+	}, []string{"forwarder"})
+
+	logsForwardDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_forward_dropped_total",
+		Help: "The number of log entries dropped due to full forwarder queues.",
+	}, []string{"forwarder"})
+
+	logsForwardErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_forward_errors_total",
+		Help: "The number of log entries unable to be forwarded.",
+	}, []string{"forwarder"})
+
+	logsForwardInQueue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_logs_forward_queue_current",
+		Help: "The current number of log entries in forwarder queues.",
+	}, []string{"forwarder"})
+
+	logsForwardLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsuru_logs_forward_duration_seconds",
+		Help:    "The latency distributions for log batches to be sent to forwarders.",
+		Buckets: buckets,
+	}, []string{"forwarder"})
+)
+
+func init() {
+	prometheus.MustRegister(logsForwardEnqueued)
+	prometheus.MustRegister(logsForwardSent)
+	prometheus.MustRegister(logsForwardDropped)
+	prometheus.MustRegister(logsForwardErrors)
+	prometheus.MustRegister(logsForwardInQueue)
+	prometheus.MustRegister(logsForwardLatency)
+}
+
+// LogForwarder describes an external sink receiving the logs of the apps
+// listed in Apps or running in the pools listed in Pools. A forwarder
+// without apps and pools receives the logs of every app.
+//
+// Syslog forwarders send each entry in the RFC5424 format to Address, using
+// UDP or TCP as set in Network. HTTP forwarders send batches of entries as a
+// JSON array in a POST request to URL.
+type LogForwarder struct {
+	Name    string `bson:"_id"`
+	Type    string
+	Network string
+	Address string
+	URL     string
+	Headers http.Header
+	Apps    []string
+	Pools   []string
+}
+
+func (f *LogForwarder) validate() error {
+	if f.Name == "" {
+		return &tsuruErrors.ValidationError{Message: "log forwarder name is required"}
+	}
+	switch f.Type {
+	case LogForwarderSyslog:
+		if f.Network == "" {
+			f.Network = "udp"
+		}
+		if f.Network != "udp" && f.Network != "tcp" {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid syslog network %q, must be udp or tcp", f.Network)}
+		}
+		if _, _, err := net.SplitHostPort(f.Address); err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid syslog address %q", f.Address)}
+		}
+	case LogForwarderHTTP:
+		u, err := url.Parse(f.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid log forwarder url %q", f.URL)}
+		}
+	default:
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid log forwarder type %q, must be %s or %s", f.Type, LogForwarderSyslog, LogForwarderHTTP)}
+	}
+	return nil
+}
+
+// Redacted returns a copy of the forwarder with its header values replaced
+// by LogForwarderRedactedValue, as headers usually carry credentials.
+func (f LogForwarder) Redacted() LogForwarder {
+	if f.Headers == nil {
+		return f
+	}
+	headers := make(http.Header, len(f.Headers))
+	for k, values := range f.Headers {
+		for range values {
+			headers[k] = append(headers[k], LogForwarderRedactedValue)
+		}
+	}
+	f.Headers = headers
+	return f
+}
+
+func (f *LogForwarder) matches(appName, pool string) bool {
+	if len(f.Apps) == 0 && len(f.Pools) == 0 {
+		return true
+	}
+	for _, a := range f.Apps {
+		if a == appName {
+			return true
+		}
+	}
+	for _, p := range f.Pools {
+		if p != "" && p == pool {
+			return true
+		}
+	}
+	return false
+}
+
+func logForwardersCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("log_forwarders"), nil
+}
+
+func CreateLogForwarder(f LogForwarder) error {
+	err := f.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := logForwardersCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(f)
+	if mgo.IsDup(err) {
+		return ErrLogForwarderAlreadyExists
+	}
+	return err
+}
+
+func UpdateLogForwarder(f LogForwarder) error {
+	err := f.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := logForwardersCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(f.Name, f)
+	if err == mgo.ErrNotFound {
+		return ErrLogForwarderNotFound
+	}
+	return err
+}
+
+func RemoveLogForwarder(name string) error {
+	coll, err := logForwardersCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrLogForwarderNotFound
+	}
+	return err
+}
+
+func GetLogForwarder(name string) (*LogForwarder, error) {
+	coll, err := logForwardersCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var f LogForwarder
+	err = coll.FindId(name).One(&f)
+	if err == mgo.ErrNotFound {
+		return nil, ErrLogForwarderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func ListLogForwarders() ([]LogForwarder, error) {
+	coll, err := logForwardersCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var forwarders []LogForwarder
+	err = coll.Find(nil).Sort("_id").All(&forwarders)
+	if err != nil {
+		return nil, err
+	}
+	return forwarders, nil
+}
+
+// logForwarding fans out the log entries received by a LogDispatcher to the
+// registered forwarders. Forwarders and the pool of each app are reloaded
+// from the database periodically.
+type logForwarding struct {
+	mu       sync.RWMutex
+	sinks    map[string]*logSinkWorker
+	appPools map[string]string
+	done     chan struct{}
+	finished chan struct{}
+}
+
+func newLogForwarding() *logForwarding {
+	return &logForwarding{
+		sinks:    map[string]*logSinkWorker{},
+		appPools: map[string]string{},
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+func (f *logForwarding) run() {
+	defer close(f.finished)
+	for {
+		err := f.refresh()
+		if err != nil {
+			log.Errorf("[log forwarding] unable to load log forwarders: %s", err)
+		}
+		select {
+		case <-f.done:
+			return
+		case <-time.After(logForwardRefreshInterval):
+		}
+	}
+}
+
+func (f *logForwarding) refresh() error {
+	forwarders, err := ListLogForwarders()
+	if err != nil {
+		return err
+	}
+	var appPools map[string]string
+	for _, fw := range forwarders {
+		if len(fw.Pools) > 0 {
+			appPools, err = loadAppPools()
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	// Replaced workers are only stopped after releasing the lock, sending
+	// their pending entries must not block the dispatcher.
+	var stale []*logSinkWorker
+	f.mu.Lock()
+	f.appPools = appPools
+	current := map[string]struct{}{}
+	for _, fw := range forwarders {
+		current[fw.Name] = struct{}{}
+		worker := f.sinks[fw.Name]
+		if worker != nil && reflect.DeepEqual(worker.forwarder, fw) {
+			continue
+		}
+		if worker != nil {
+			stale = append(stale, worker)
+		}
+		f.sinks[fw.Name] = newLogSinkWorker(fw)
+	}
+	for name, worker := range f.sinks {
+		if _, ok := current[name]; !ok {
+			stale = append(stale, worker)
+			delete(f.sinks, name)
+		}
+	}
+	f.mu.Unlock()
+	for _, worker := range stale {
+		worker.stop()
+	}
+	return nil
+}
+
+func loadAppPools() (map[string]string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var apps []struct {
+		Name string
+		Pool string
+	}
+	err = conn.Apps().Find(nil).Select(bson.M{"name": 1, "pool": 1}).All(&apps)
+	if err != nil {
+		return nil, err
+	}
+	appPools := make(map[string]string, len(apps))
+	for _, a := range apps {
+		appPools[a.Name] = a.Pool
+	}
+	return appPools, nil
+}
+
+func (f *logForwarding) send(msg *Applog) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, worker := range f.sinks {
+		if worker.forwarder.matches(msg.AppName, f.appPools[msg.AppName]) {
+			worker.enqueue(msg)
+		}
+	}
+}
+
+func (f *logForwarding) stop() {
+	close(f.done)
+	<-f.finished
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, worker := range f.sinks {
+		worker.stop()
+		delete(f.sinks, name)
+	}
+}
+
+type logSink interface {
+	send(msgs []*Applog) error
+	close()
+}
+
+func newLogSink(f LogForwarder) logSink {
+	if f.Type == LogForwarderHTTP {
+		return &httpLogSink{url: f.URL, headers: f.Headers}
+	}
+	return &syslogLogSink{network: f.Network, address: f.Address}
+}
+
+// logSinkWorker sends the entries enqueued for a forwarder in batches.
+// Entries are dropped when the queue is full, so a slow or unavailable
+// forwarder never blocks log ingestion.
+type logSinkWorker struct {
+	forwarder LogForwarder
+	sink      logSink
+	ch        chan *Applog
+	finished  chan struct{}
+	nextError time.Time
+}
+
+func newLogSinkWorker(f LogForwarder) *logSinkWorker {
+	w := &logSinkWorker{
+		forwarder: f,
+		sink:      newLogSink(f),
+		ch:        make(chan *Applog, logForwardQueueSize),
+		finished:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *logSinkWorker) enqueue(msg *Applog) {
+	name := w.forwarder.Name
+	select {
+	case w.ch <- msg:
+		logsForwardEnqueued.WithLabelValues(name).Inc()
+		logsForwardInQueue.WithLabelValues(name).Set(float64(len(w.ch)))
+	default:
+		logsForwardDropped.WithLabelValues(name).Inc()
+	}
+}
+
+func (w *logSinkWorker) stop() {
+	close(w.ch)
+	<-w.finished
+}
+
+func (w *logSinkWorker) run() {
+	defer close(w.finished)
+	defer w.sink.close()
+	t := time.NewTimer(logForwardMaxWait)
+	defer t.Stop()
+	batch := make([]*Applog, 0, logForwardBatchSize)
+	for {
+		var flush, shouldReturn bool
+		select {
+		case msg, ok := <-w.ch:
+			if !ok {
+				flush, shouldReturn = true, true
+				break
+			}
+			batch = append(batch, msg)
+			flush = len(batch) == logForwardBatchSize
+		case <-t.C:
+			flush = true
+			t.Reset(logForwardMaxWait)
+		}
+		if flush && len(batch) > 0 {
+			w.flush(batch)
+			batch = batch[:0]
+		}
+		if shouldReturn {
+			return
+		}
+	}
+}
+
+func (w *logSinkWorker) flush(batch []*Applog) {
+	name := w.forwarder.Name
+	logsForwardInQueue.WithLabelValues(name).Set(float64(len(w.ch)))
+	t0 := time.Now()
+	err := w.sink.send(batch)
+	logsForwardLatency.WithLabelValues(name).Observe(time.Since(t0).Seconds())
+	if err != nil {
+		logsForwardErrors.WithLabelValues(name).Add(float64(len(batch)))
+		if time.Now().After(w.nextError) {
+			log.Errorf("[log forwarding] unable to send logs to forwarder %q: %s", name, err)
+			w.nextError = time.Now().Add(time.Minute)
+		}
+		return
+	}
+	logsForwardSent.WithLabelValues(name).Add(float64(len(batch)))
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// syslogPriority is the priority of every forwarded entry, facility user
+	// and severity informational.
+	syslogPriority = 14
+
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogField returns value as a RFC5424 header field, which can only have
+// printable ASCII characters other than space and a maximum length. Empty
+// values are replaced by the nil value.
+func syslogField(value string, maxLen int) string {
+	if value == "" {
+		return "-"
+	}
+	field := []byte(value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	for i, b := range field {
+		if b < 33 || b > 126 {
+			field[i] = '_'
+		}
+	}
+	return string(field)
+}
+
+// formatRFC5424 formats msg as a syslog message, using the unit as hostname,
+// the app name as app-name and the source as procid.
+func formatRFC5424(msg *Applog) string {
+	timestamp := "-"
+	if !msg.Date.IsZero() {
+		timestamp = msg.Date.UTC().Format(syslogTimeFormat)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		syslogPriority,
+		timestamp,
+		syslogField(msg.Unit, 255),
+		syslogField(msg.AppName, 48),
+		syslogField(msg.Source, 128),
+		msg.Message,
+	)
+}
+
+// syslogLogSink sends entries to a syslog server. Over UDP, each entry is
+// sent in its own datagram. Over TCP, entries are framed using octet
+// counting, as described in RFC6587.
+type syslogLogSink struct {
+	network string
+	address string
+	conn    net.Conn
+}
+
+func (s *syslogLogSink) send(msgs []*Applog) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, logForwardTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(logForwardTimeout))
+	for _, msg := range msgs {
+		line := formatRFC5424(msg)
+		if s.network == "tcp" {
+			line = fmt.Sprintf("%d %s", len(line), line)
+		}
+		_, err := s.conn.Write([]byte(line))
+		if err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogLogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// httpLogSink sends each batch of entries as a JSON array to an URL.
+type httpLogSink struct {
+	url     string
+	headers http.Header
+}
+
+func (s *httpLogSink) send(msgs []*Applog) error {
+	body, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, values := range s.headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: logForwardTimeout}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return errors.Errorf("invalid status code %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpLogSink) close() {}
@@ -0,0 +1,216 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogForwarderValidate(c *check.C) {
+	tests := []struct {
+		f   LogForwarder
+		err string
+	}{
+		{LogForwarder{Type: "syslog", Address: "localhost:514"}, "log forwarder name is required"},
+		{LogForwarder{Name: "f", Type: "kafka"}, `invalid log forwarder type "kafka", must be syslog or http`},
+		{LogForwarder{Name: "f", Type: "syslog", Network: "sctp", Address: "localhost:514"}, `invalid syslog network "sctp", must be udp or tcp`},
+		{LogForwarder{Name: "f", Type: "syslog", Address: "localhost"}, `invalid syslog address "localhost"`},
+		{LogForwarder{Name: "f", Type: "http", URL: "ftp://example.com"}, `invalid log forwarder url "ftp://example.com"`},
+		{LogForwarder{Name: "f", Type: "syslog", Address: "localhost:514"}, ""},
+		{LogForwarder{Name: "f", Type: "http", URL: "https://example.com/logs"}, ""},
+	}
+	for i, tt := range tests {
+		err := tt.f.validate()
+		if tt.err == "" {
+			c.Assert(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Assert(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s *S) TestLogForwarderMatches(c *check.C) {
+	f := LogForwarder{}
+	c.Assert(f.matches("myapp", "pool1"), check.Equals, true)
+	f = LogForwarder{Apps: []string{"myapp"}, Pools: []string{"pool2"}}
+	c.Assert(f.matches("myapp", "pool1"), check.Equals, true)
+	c.Assert(f.matches("otherapp", "pool2"), check.Equals, true)
+	c.Assert(f.matches("otherapp", "pool1"), check.Equals, false)
+	c.Assert(f.matches("otherapp", ""), check.Equals, false)
+}
+
+func (s *S) TestLogForwarderRedacted(c *check.C) {
+	f := LogForwarder{Name: "f", Type: "http", Headers: http.Header{"Authorization": {"Bearer abc"}, "X-Ids": {"1", "2"}}}
+	redacted := f.Redacted()
+	c.Assert(redacted.Headers, check.DeepEquals, http.Header{
+		"Authorization": {LogForwarderRedactedValue},
+		"X-Ids":         {LogForwarderRedactedValue, LogForwarderRedactedValue},
+	})
+	c.Assert(f.Headers.Get("Authorization"), check.Equals, "Bearer abc")
+	c.Assert(LogForwarder{Name: "f"}.Redacted().Headers, check.IsNil)
+}
+
+func (s *S) TestLogForwarderCRUD(c *check.C) {
+	err := CreateLogForwarder(LogForwarder{Name: "f2", Type: "http", URL: "http://example.com/2"})
+	c.Assert(err, check.IsNil)
+	err = CreateLogForwarder(LogForwarder{Name: "f1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.IsNil)
+	err = CreateLogForwarder(LogForwarder{Name: "f1", Type: "syslog", Address: "localhost:514"})
+	c.Assert(err, check.Equals, ErrLogForwarderAlreadyExists)
+	err = UpdateLogForwarder(LogForwarder{Name: "f1", Type: "syslog", Network: "tcp", Address: "localhost:1514"})
+	c.Assert(err, check.IsNil)
+	err = UpdateLogForwarder(LogForwarder{Name: "f3", Type: "syslog", Address: "localhost:1514"})
+	c.Assert(err, check.Equals, ErrLogForwarderNotFound)
+	forwarders, err := ListLogForwarders()
+	c.Assert(err, check.IsNil)
+	c.Assert(forwarders, check.DeepEquals, []LogForwarder{
+		{Name: "f1", Type: "syslog", Network: "tcp", Address: "localhost:1514"},
+		{Name: "f2", Type: "http", URL: "http://example.com/2"},
+	})
+	err = RemoveLogForwarder("f2")
+	c.Assert(err, check.IsNil)
+	err = RemoveLogForwarder("f2")
+	c.Assert(err, check.Equals, ErrLogForwarderNotFound)
+	_, err = GetLogForwarder("f2")
+	c.Assert(err, check.Equals, ErrLogForwarderNotFound)
+}
+
+func (s *S) TestFormatRFC5424(c *check.C) {
+	msg := &Applog{
+		Date:    time.Date(2018, 3, 1, 10, 0, 0, 123456000, time.UTC),
+		Message: "hello world",
+		Source:  "web",
+		AppName: "myapp",
+		Unit:    "unit 1",
+	}
+	c.Assert(formatRFC5424(msg), check.Equals, "<14>1 2018-03-01T10:00:00.123456Z unit_1 myapp web - - hello world")
+	c.Assert(formatRFC5424(&Applog{Message: "m", AppName: "myapp"}), check.Equals, "<14>1 - - myapp - - - m")
+}
+
+func newForwardingDispatcher(c *check.C) *LogDispatcher {
+	d := NewlogDispatcher(1000)
+	err := d.forwarding.refresh()
+	c.Assert(err, check.IsNil)
+	return d
+}
+
+func (s *S) TestLogForwardingSyslogUDP(c *check.C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = CreateLogForwarder(LogForwarder{Name: "udp", Type: "syslog", Address: conn.LocalAddr().String(), Apps: []string{"myapp"}})
+	c.Assert(err, check.IsNil)
+	d := newForwardingDispatcher(c)
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d.Send(&Applog{Date: baseTime, Message: "ignored", Source: "web", AppName: "otherapp", Unit: "u1"})
+	d.Send(&Applog{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp", Unit: "u1"})
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buf[:n]), check.Equals, "<14>1 2018-03-01T10:00:00.000000Z u1 myapp web - - msg1")
+	err = d.Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestLogForwardingSyslogTCPPool(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer listener.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			length, readErr := reader.ReadString(' ')
+			if readErr != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(length))
+			line := make([]byte, size)
+			_, readErr = io.ReadFull(reader, line)
+			if readErr != nil {
+				return
+			}
+			received <- string(line)
+		}
+	}()
+	err = CreateLogForwarder(LogForwarder{Name: "tcp", Type: "syslog", Network: "tcp", Address: listener.Addr().String(), Pools: []string{s.Pool}})
+	c.Assert(err, check.IsNil)
+	d := newForwardingDispatcher(c)
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d.Send(&Applog{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp", Unit: "u1"})
+	d.Send(&Applog{Date: baseTime, Message: "msg2", Source: "worker", AppName: "myapp", Unit: "u2"})
+	for _, expected := range []string{
+		"<14>1 2018-03-01T10:00:00.000000Z u1 myapp web - - msg1",
+		"<14>1 2018-03-01T10:00:00.000000Z u2 myapp worker - - msg2",
+	} {
+		select {
+		case line := <-received:
+			c.Assert(line, check.Equals, expected)
+		case <-time.After(10 * time.Second):
+			c.Fatal("timeout waiting for syslog message")
+		}
+	}
+	err = d.Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestLogForwardingHTTP(c *check.C) {
+	var mu sync.Mutex
+	var received []Applog
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var logs []Applog
+		json.Unmarshal(body, &logs)
+		mu.Lock()
+		received = append(received, logs...)
+		headers = r.Header
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	err := CreateLogForwarder(LogForwarder{
+		Name:    "collector",
+		Type:    "http",
+		URL:     srv.URL,
+		Headers: http.Header{"X-Token": []string{"abc"}},
+	})
+	c.Assert(err, check.IsNil)
+	d := newForwardingDispatcher(c)
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d.Send(&Applog{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp", Unit: "u1"})
+	d.Send(&Applog{Date: baseTime, Message: "msg2", Source: "web", AppName: "otherapp", Unit: "u2"})
+	err = d.Shutdown(context.Background())
+	c.Assert(err, check.IsNil)
+	mu.Lock()
+	defer mu.Unlock()
+	compareLogs(c, received, []Applog{
+		{Date: baseTime, Message: "msg1", Source: "web", AppName: "myapp", Unit: "u1"},
+		{Date: baseTime, Message: "msg2", Source: "web", AppName: "otherapp", Unit: "u2"},
+	})
+	c.Assert(headers.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(headers.Get("X-Token"), check.Equals, "abc")
+}
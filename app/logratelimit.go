@@ -0,0 +1,134 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+)
+
+var (
+	logRateLimitRefreshInterval = time.Minute
+
+	logsRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_rate_limited_total",
+		Help: "The number of log entries dropped due to the app log rate limit.",
+	}, []string{"app"})
+)
+
+func init() {
+	prometheus.MustRegister(logsRateLimited)
+}
+
+// logRateLimit returns the number of log lines per second accepted for the
+// app. The limit set in the app takes precedence over the one set in its
+// plan, which takes precedence over the app-log:rate-limit config. A non
+// positive value means the app logs are not limited.
+func logRateLimit(appName string) int {
+	limit, _ := config.GetInt("app-log:rate-limit")
+	a, err := GetByName(appName)
+	if err != nil {
+		if err != ErrAppNotFound {
+			log.Errorf("[log rate limit] unable to get app %q: %s", appName, err)
+		}
+		return limit
+	}
+	if a.LogRateLimit != 0 {
+		return a.LogRateLimit
+	}
+	if a.Plan.LogRateLimit != 0 {
+		return a.Plan.LogRateLimit
+	}
+	return limit
+}
+
+// logRateLimiter is a token bucket limiting the log lines of an app, allowing
+// bursts of up to one second worth of lines. The limit is reloaded in
+// background every logRateLimitRefreshInterval so that the log dispatcher is
+// never blocked by database lookups.
+type logRateLimiter struct {
+	appName     string
+	mu          sync.Mutex
+	limit       int
+	tokens      float64
+	last        time.Time
+	dropped     int
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+func newLogRateLimiter(appName string) *logRateLimiter {
+	limit, _ := config.GetInt("app-log:rate-limit")
+	return &logRateLimiter{appName: appName, limit: limit}
+}
+
+func (l *logRateLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit != l.limit {
+		l.limit = limit
+		l.last = time.Time{}
+	}
+	l.refreshedAt = time.Now()
+	l.refreshing = false
+}
+
+func (l *logRateLimiter) refresh() {
+	l.setLimit(logRateLimit(l.appName))
+}
+
+// allow reports whether a log line arriving at now is within the limit.
+// Lines over the limit are counted to be reported by droppedLog.
+func (l *logRateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.refreshing && now.Sub(l.refreshedAt) >= logRateLimitRefreshInterval {
+		l.refreshing = true
+		go l.refresh()
+	}
+	if l.limit <= 0 {
+		return true
+	}
+	limit := float64(l.limit)
+	if l.last.IsZero() {
+		l.tokens = limit
+	} else if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * limit
+		if l.tokens > limit {
+			l.tokens = limit
+		}
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	l.dropped++
+	logsRateLimited.WithLabelValues(l.appName).Inc()
+	return false
+}
+
+// droppedLog returns a log entry informing the number of lines dropped since
+// the last call, or nil if no lines were dropped.
+func (l *logRateLimiter) droppedLog() *Applog {
+	l.mu.Lock()
+	dropped := l.dropped
+	l.dropped = 0
+	l.mu.Unlock()
+	if dropped == 0 {
+		return nil
+	}
+	return &Applog{
+		Date:    time.Now().In(time.UTC),
+		Message: fmt.Sprintf("%d lines dropped by rate limit", dropped),
+		Source:  "tsuru",
+		AppName: l.appName,
+	}
+}
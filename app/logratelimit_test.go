@@ -0,0 +1,107 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tsuru/config"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogRateLimiterAllow(c *check.C) {
+	config.Set("app-log:rate-limit", 2)
+	defer config.Unset("app-log:rate-limit")
+	limiter := newLogRateLimiter("myapp")
+	limiter.refreshedAt = time.Now()
+	now := time.Now()
+	c.Assert(limiter.allow(now), check.Equals, true)
+	c.Assert(limiter.allow(now), check.Equals, true)
+	c.Assert(limiter.allow(now), check.Equals, false)
+	c.Assert(limiter.allow(now.Add(100*time.Millisecond)), check.Equals, false)
+	c.Assert(limiter.allow(now.Add(500*time.Millisecond)), check.Equals, true)
+	c.Assert(limiter.allow(now.Add(time.Minute)), check.Equals, true)
+	c.Assert(limiter.allow(now.Add(time.Minute)), check.Equals, true)
+	c.Assert(limiter.allow(now.Add(time.Minute)), check.Equals, false)
+	msg := limiter.droppedLog()
+	c.Assert(msg, check.NotNil)
+	c.Assert(msg.Message, check.Equals, "3 lines dropped by rate limit")
+	c.Assert(msg.Source, check.Equals, "tsuru")
+	c.Assert(msg.AppName, check.Equals, "myapp")
+	c.Assert(limiter.droppedLog(), check.IsNil)
+}
+
+func (s *S) TestLogRateLimiterUnlimited(c *check.C) {
+	limiter := newLogRateLimiter("myapp")
+	limiter.refreshedAt = time.Now()
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		c.Assert(limiter.allow(now), check.Equals, true)
+	}
+	c.Assert(limiter.droppedLog(), check.IsNil)
+}
+
+func (s *S) TestLogRateLimit(c *check.C) {
+	config.Set("app-log:rate-limit", 10)
+	defer config.Unset("app-log:rate-limit")
+	c.Assert(logRateLimit("unknown-app"), check.Equals, 10)
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(logRateLimit(a.Name), check.Equals, 10)
+	err = s.conn.Apps().Update(map[string]string{"name": a.Name}, map[string]interface{}{
+		"$set": map[string]interface{}{"plan": appTypes.Plan{Name: "p1", CpuShare: 100, LogRateLimit: 20}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(logRateLimit(a.Name), check.Equals, 20)
+	err = a.SetLogRateLimit(-1)
+	c.Assert(err, check.IsNil)
+	c.Assert(logRateLimit(a.Name), check.Equals, -1)
+}
+
+func (s *S) TestSetLogRateLimit(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLogRateLimit(50)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.LogRateLimit, check.Equals, 50)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogRateLimit, check.Equals, 50)
+}
+
+func (s *S) TestSetLogRateLimitNotFound(c *check.C) {
+	a := App{Name: "myapp"}
+	err := a.SetLogRateLimit(50)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestLogDispatcherRateLimit(c *check.C) {
+	config.Set("app-log:rate-limit", 1)
+	defer config.Unset("app-log:rate-limit")
+	a := App{Name: "noisyapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	dispatcher := NewlogDispatcher(2000000)
+	for i := 0; i < 10; i++ {
+		err = dispatcher.Send(&Applog{Date: time.Now(), Message: fmt.Sprintf("msg%d", i), Source: "web", AppName: a.Name})
+		c.Assert(err, check.IsNil)
+	}
+	dispatcher.Shutdown(context.Background())
+	logs, err := a.LastLogs(10, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "msg0")
+	c.Assert(logs[1].Message, check.Equals, "9 lines dropped by rate limit")
+	c.Assert(logs[1].Source, check.Equals, "tsuru")
+	var dtoMetric dto.Metric
+	logsRateLimited.WithLabelValues(a.Name).Write(&dtoMetric)
+	c.Assert(dtoMetric.Counter.GetValue(), check.Equals, 9.0)
+}
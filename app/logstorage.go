@@ -0,0 +1,226 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+var errInvalidLogCursor = &tsuruErrors.ValidationError{Message: "invalid log cursor"}
+
+const defaultLogStorage = "mongodb"
+
+// InvalidLogsError is returned by LogStorage.Insert when the backend rejects
+// the messages themselves, inserting them again would fail the same way.
+type InvalidLogsError struct {
+	Err error
+}
+
+func (e *InvalidLogsError) Error() string {
+	return fmt.Sprintf("invalid log messages: %s", e.Err)
+}
+
+// LogStorage stores and retrieves application log messages. The backend in
+// use is selected by the app-log:backend config.
+type LogStorage interface {
+	// Insert stores the messages in the log of the given app. An
+	// *InvalidLogsError is returned when the messages can never be stored.
+	Insert(appName string, msgs ...*Applog) error
+
+	// List returns the last lines messages of the app matching filter, in
+	// the order they were inserted. A non positive value for lines means all
+	// messages. When there may be older matching messages, List also
+	// returns a cursor that can be set in the filter to retrieve them.
+	List(appName string, lines int, filter LogFilter) ([]Applog, string, error)
+
+	// Watch returns a listener receiving the messages inserted in the log of
+	// the app after the call, matching filter. The filter cursor is ignored.
+	Watch(appName string, filter LogFilter) (*LogListener, error)
+
+	// Remove removes all messages of the app.
+	Remove(appName string) error
+}
+
+var (
+	logStorageFactories = map[string]func() (LogStorage, error){}
+
+	logStoragesMu sync.Mutex
+	logStorages   = map[string]LogStorage{}
+)
+
+// RegisterLogStorage makes a log storage backend available to be selected
+// using the app-log:backend config.
+func RegisterLogStorage(name string, factory func() (LogStorage, error)) {
+	logStorageFactories[name] = factory
+}
+
+// GetLogStorage returns the log storage backend selected in the config. The
+// backend instance is created only once and shared by all callers.
+func GetLogStorage() (LogStorage, error) {
+	name, _ := config.GetString("app-log:backend")
+	if name == "" {
+		name = defaultLogStorage
+	}
+	logStoragesMu.Lock()
+	defer logStoragesMu.Unlock()
+	if storage, ok := logStorages[name]; ok {
+		return storage, nil
+	}
+	factory, ok := logStorageFactories[name]
+	if !ok {
+		return nil, errors.Errorf("unknown app log backend: %q", name)
+	}
+	storage, err := factory()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to initialize app log backend %q", name)
+	}
+	logStorages[name] = storage
+	return storage, nil
+}
+
+// LogFilter selects app log messages. Empty fields match every message.
+// Since and Until are inclusive. Grep is a regular expression matched
+// against the message, Invert selects the messages not matching it. Fields
+// selects messages whose parsed fields have the given values, nested fields
+// are selected using dots in the key. Cursor is returned by LogStorage.List
+// to retrieve older messages, its format depends on the backend.
+type LogFilter struct {
+	Source string
+	Unit   string
+	Since  time.Time
+	Until  time.Time
+	Grep   string
+	Invert bool
+	Fields map[string]string
+	Cursor string
+
+	grepRegexp *regexp.Regexp
+}
+
+func (f *LogFilter) validate() error {
+	if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+		return &tsuruErrors.ValidationError{Message: "until must not be before since"}
+	}
+	if f.Invert && f.Grep == "" {
+		return &tsuruErrors.ValidationError{Message: "invert requires a grep expression"}
+	}
+	for k := range f.Fields {
+		if k == "" || strings.HasPrefix(k, "$") || strings.Contains(k, "..") {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid field name %q", k)}
+		}
+	}
+	f.grepRegexp = nil
+	if f.Grep != "" {
+		re, err := regexp.Compile(f.Grep)
+		if err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid grep expression %q: %s", f.Grep, err)}
+		}
+		f.grepRegexp = re
+	}
+	return nil
+}
+
+// matches must only be called after validate.
+func (f *LogFilter) matches(msg *Applog) bool {
+	if f.Source != "" && msg.Source != f.Source {
+		return false
+	}
+	if f.Unit != "" && msg.Unit != f.Unit {
+		return false
+	}
+	if !f.Since.IsZero() && msg.Date.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && msg.Date.After(f.Until) {
+		return false
+	}
+	if !f.matchesGrep(msg) {
+		return false
+	}
+	for k, v := range f.Fields {
+		if !logFieldMatches(msg.Fields, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesGrep must only be called after validate.
+func (f *LogFilter) matchesGrep(msg *Applog) bool {
+	return f.grepRegexp == nil || f.grepRegexp.MatchString(msg.Message) != f.Invert
+}
+
+// logWatchBufferSize is the number of messages held for each watcher of
+// backends without native support for following logs. Messages are dropped
+// for watchers not keeping up, log ingestion is never blocked by them.
+const logWatchBufferSize = 1000
+
+type logWatcher struct {
+	filter LogFilter
+	c      chan Applog
+}
+
+// logWatchers notifies listeners about messages inserted in backends that
+// are unable to follow logs by themselves. Only messages inserted in the
+// current process are notified.
+type logWatchers struct {
+	sync.RWMutex
+	watchers map[string]map[*logWatcher]struct{}
+}
+
+func newLogWatchers() *logWatchers {
+	return &logWatchers{watchers: map[string]map[*logWatcher]struct{}{}}
+}
+
+func (w *logWatchers) watch(appName string, filter LogFilter) (*LogListener, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, err
+	}
+	watcher := &logWatcher{filter: filter, c: make(chan Applog, logWatchBufferSize)}
+	w.Lock()
+	if w.watchers[appName] == nil {
+		w.watchers[appName] = map[*logWatcher]struct{}{}
+	}
+	w.watchers[appName][watcher] = struct{}{}
+	w.Unlock()
+	return &LogListener{
+		c:    watcher.c,
+		quit: make(chan struct{}),
+		close: func() {
+			w.Lock()
+			delete(w.watchers[appName], watcher)
+			if len(w.watchers[appName]) == 0 {
+				delete(w.watchers, appName)
+			}
+			w.Unlock()
+			close(watcher.c)
+		},
+	}, nil
+}
+
+func (w *logWatchers) notify(appName string, msgs []*Applog) {
+	w.RLock()
+	defer w.RUnlock()
+	for watcher := range w.watchers[appName] {
+		for _, msg := range msgs {
+			if !watcher.filter.matches(msg) {
+				continue
+			}
+			select {
+			case watcher.c <- *msg:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+)
+
+const (
+	defaultDiskLogPath        = "/var/lib/tsuru/app-logs"
+	defaultDiskLogSegmentSize = 10 * 1024 * 1024
+	defaultDiskLogMaxSegments = 10
+
+	diskLogSegmentSuffix = ".log"
+	diskLogMaxLineSize   = 1024 * 1024
+)
+
+func init() {
+	RegisterLogStorage("disk", func() (LogStorage, error) {
+		return newDiskLogStorage()
+	})
+}
+
+// diskLogStorage stores the logs of each app in a directory of JSON lines
+// segment files. A new segment is started when the current one reaches the
+// configured size and the oldest segments are removed once the app has more
+// than the configured number of segments.
+type diskLogStorage struct {
+	path        string
+	segmentSize int64
+	maxSegments int
+	mu          sync.Mutex
+	appLocks    map[string]*sync.Mutex
+	watchers    *logWatchers
+}
+
+func newDiskLogStorage() (*diskLogStorage, error) {
+	s := &diskLogStorage{
+		path:        defaultDiskLogPath,
+		segmentSize: defaultDiskLogSegmentSize,
+		maxSegments: defaultDiskLogMaxSegments,
+		appLocks:    map[string]*sync.Mutex{},
+		watchers:    newLogWatchers(),
+	}
+	if path, err := config.GetString("app-log:disk:path"); err == nil && path != "" {
+		s.path = path
+	}
+	if size, err := config.GetInt("app-log:disk:segment-size"); err == nil && size > 0 {
+		s.segmentSize = int64(size)
+	}
+	if max, err := config.GetInt("app-log:disk:max-segments"); err == nil && max > 0 {
+		s.maxSegments = max
+	}
+	err := os.MkdirAll(s.path, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *diskLogStorage) lock(appName string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.appLocks[appName]
+	if l == nil {
+		l = &sync.Mutex{}
+		s.appLocks[appName] = l
+	}
+	l.Lock()
+	return l
+}
+
+func (s *diskLogStorage) appDir(appName string) (string, error) {
+	if appName == "" || appName == "." || appName == ".." || strings.ContainsAny(appName, `/\`) {
+		return "", errors.Errorf("invalid app name for logs: %q", appName)
+	}
+	return filepath.Join(s.path, appName), nil
+}
+
+func segmentName(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", n, diskLogSegmentSuffix))
+}
+
+// segments returns the segment numbers of the app, oldest first.
+func (s *diskLogStorage) segments(dir string) ([]int, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var segments []int
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, diskLogSegmentSuffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(name, diskLogSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (s *diskLogStorage) Insert(appName string, msgs ...*Applog) error {
+	dir, err := s.appDir(appName)
+	if err != nil {
+		return err
+	}
+	err = s.insert(appName, dir, msgs)
+	if err != nil {
+		return err
+	}
+	s.watchers.notify(appName, msgs)
+	return nil
+}
+
+func (s *diskLogStorage) insert(appName, dir string, msgs []*Applog) error {
+	defer s.lock(appName).Unlock()
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	segments, err := s.segments(dir)
+	if err != nil {
+		return err
+	}
+	current := 1
+	if len(segments) > 0 {
+		current = segments[len(segments)-1]
+		var info os.FileInfo
+		info, err = os.Stat(segmentName(dir, current))
+		if err != nil {
+			return err
+		}
+		if info.Size() >= s.segmentSize {
+			current++
+			segments = append(segments, current)
+		}
+	} else {
+		segments = append(segments, current)
+	}
+	file, err := os.OpenFile(segmentName(dir, current), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, msg := range msgs {
+		err = encoder.Encode(msg)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	for len(segments) > s.maxSegments {
+		err = os.Remove(segmentName(dir, segments[0]))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// diskLog is a message with its position in the app log, which is used as
+// cursor in the form <segment>:<line>.
+type diskLog struct {
+	segment int
+	line    int
+	msg     Applog
+}
+
+// readSegment returns the messages in a segment matching filter. Lines
+// unable to be decoded, like the last line of a segment being written when
+// the process stopped, are ignored.
+func readSegment(dir string, segment int, filter *LogFilter) ([]diskLog, error) {
+	file, err := os.Open(segmentName(dir, segment))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var logs []diskLog
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), diskLogMaxLineSize)
+	for line := 0; scanner.Scan(); line++ {
+		var msg Applog
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if filter.matches(&msg) {
+			logs = append(logs, diskLog{segment: segment, line: line, msg: msg})
+		}
+	}
+	return logs, scanner.Err()
+}
+
+func parseDiskLogCursor(cursor string) (int, int, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, errInvalidLogCursor
+	}
+	segment, err := strconv.Atoi(parts[0])
+	if err != nil || segment <= 0 {
+		return 0, 0, errInvalidLogCursor
+	}
+	line, err := strconv.Atoi(parts[1])
+	if err != nil || line < 0 {
+		return 0, 0, errInvalidLogCursor
+	}
+	return segment, line, nil
+}
+
+func (s *diskLogStorage) List(appName string, lines int, filter LogFilter) ([]Applog, string, error) {
+	dir, err := s.appDir(appName)
+	if err != nil {
+		return nil, "", err
+	}
+	err = filter.validate()
+	if err != nil {
+		return nil, "", err
+	}
+	var cursorSegment, cursorLine int
+	if filter.Cursor != "" {
+		cursorSegment, cursorLine, err = parseDiskLogCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	l := s.lock(appName)
+	segments, err := s.segments(dir)
+	l.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	var found []diskLog
+	for i := len(segments) - 1; i >= 0 && (lines <= 0 || len(found) <= lines); i-- {
+		if cursorSegment > 0 && segments[i] > cursorSegment {
+			continue
+		}
+		segmentLogs, err := readSegment(dir, segments[i], &filter)
+		if err != nil {
+			return nil, "", err
+		}
+		if segments[i] == cursorSegment {
+			last := len(segmentLogs)
+			for last > 0 && segmentLogs[last-1].line > cursorLine {
+				last--
+			}
+			segmentLogs = segmentLogs[:last]
+		}
+		found = append(segmentLogs, found...)
+	}
+	var cursor string
+	if lines > 0 && len(found) > lines {
+		next := found[len(found)-lines-1]
+		cursor = fmt.Sprintf("%d:%d", next.segment, next.line)
+		found = found[len(found)-lines:]
+	}
+	logs := make([]Applog, len(found))
+	for i := range found {
+		logs[i] = found[i].msg
+	}
+	return logs, cursor, nil
+}
+
+func (s *diskLogStorage) Watch(appName string, filter LogFilter) (*LogListener, error) {
+	if _, err := s.appDir(appName); err != nil {
+		return nil, err
+	}
+	return s.watchers.watch(appName, filter)
+}
+
+func (s *diskLogStorage) Remove(appName string) error {
+	dir, err := s.appDir(appName)
+	if err != nil {
+		return err
+	}
+	defer s.lock(appName).Unlock()
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"strconv"
+	"sync"
+)
+
+// memoryLogStorageMaxLines matches the size of the capped collections used
+// by the mongodb backend.
+const memoryLogStorageMaxLines = 5000
+
+func init() {
+	RegisterLogStorage("memory", func() (LogStorage, error) {
+		return newMemoryLogStorage(), nil
+	})
+}
+
+// memoryLogStorage keeps the last messages of each app in memory. It's
+// intended to be used in tests and single instance development setups,
+// messages are lost when the process stops.
+type memoryLogStorage struct {
+	mu       sync.RWMutex
+	logs     map[string][]memoryLog
+	nextSeq  map[string]int64
+	watchers *logWatchers
+}
+
+// memoryLog is a message with its sequence number in the app log, which is
+// used as cursor.
+type memoryLog struct {
+	seq int64
+	msg Applog
+}
+
+func newMemoryLogStorage() *memoryLogStorage {
+	return &memoryLogStorage{
+		logs:     map[string][]memoryLog{},
+		nextSeq:  map[string]int64{},
+		watchers: newLogWatchers(),
+	}
+}
+
+func (s *memoryLogStorage) Insert(appName string, msgs ...*Applog) error {
+	s.mu.Lock()
+	logs := s.logs[appName]
+	for _, msg := range msgs {
+		s.nextSeq[appName]++
+		logs = append(logs, memoryLog{seq: s.nextSeq[appName], msg: *msg})
+	}
+	if len(logs) > memoryLogStorageMaxLines {
+		logs = append([]memoryLog(nil), logs[len(logs)-memoryLogStorageMaxLines:]...)
+	}
+	s.logs[appName] = logs
+	s.mu.Unlock()
+	s.watchers.notify(appName, msgs)
+	return nil
+}
+
+func (s *memoryLogStorage) List(appName string, lines int, filter LogFilter) ([]Applog, string, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, "", err
+	}
+	var before int64
+	if filter.Cursor != "" {
+		before, err = strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return nil, "", errInvalidLogCursor
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	logs := []Applog{}
+	all := s.logs[appName]
+	var cursor string
+	for i := len(all) - 1; i >= 0; i-- {
+		if before > 0 && all[i].seq > before {
+			continue
+		}
+		if !filter.matches(&all[i].msg) {
+			continue
+		}
+		if lines > 0 && len(logs) == lines {
+			cursor = strconv.FormatInt(all[i].seq, 10)
+			break
+		}
+		logs = append(logs, all[i].msg)
+	}
+	l := len(logs)
+	for i := 0; i < l/2; i++ {
+		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+	}
+	return logs, cursor, nil
+}
+
+func (s *memoryLogStorage) Watch(appName string, filter LogFilter) (*LogListener, error) {
+	return s.watchers.watch(appName, filter)
+}
+
+func (s *memoryLogStorage) Remove(appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logs, appName)
+	return nil
+}
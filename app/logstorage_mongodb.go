@@ -0,0 +1,270 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func init() {
+	RegisterLogStorage("mongodb", func() (LogStorage, error) {
+		return &mongoLogStorage{}, nil
+	})
+}
+
+// mongoLogStorage stores the logs of each app in a capped collection.
+type mongoLogStorage struct{}
+
+func isCappedPositionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "CappedPositionLost")
+}
+
+func isSessionClosed(r interface{}) bool {
+	return fmt.Sprintf("%v", r) == "Session already closed"
+}
+
+func (s *mongoLogStorage) Insert(appName string, msgs ...*Applog) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	docs := make([]interface{}, len(msgs))
+	for i := range msgs {
+		docs[i] = msgs[i]
+	}
+	err = conn.Logs(appName).Insert(docs...)
+	if isRejectedInsert(err) {
+		return &InvalidLogsError{Err: err}
+	}
+	return err
+}
+
+// isRejectedInsert returns whether the error was returned by MongoDB when
+// refusing the documents, unlike connection or replication errors, after
+// which the insert may succeed if retried.
+func isRejectedInsert(err error) bool {
+	switch e := err.(type) {
+	case *mgo.LastError:
+		return !e.WTimeout && !isNotMasterCode(e.Code)
+	case *mgo.QueryError:
+		return !isNotMasterCode(e.Code)
+	case *mgo.BulkError:
+		for _, ecase := range e.Cases() {
+			if !isRejectedInsert(ecase.Err) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isNotMasterCode(code int) bool {
+	return code == 10058 || code == 10107 || code == 13435 || code == 13436
+}
+
+// mongoLogQueryMaxTime bounds the time MongoDB spends listing logs.
+var mongoLogQueryMaxTime = 30 * time.Second
+
+// mongoLogQuery returns the query selecting the messages matching filter,
+// except for the grep expression. It's matched by the storage using Go
+// regular expressions, as in the other backends, instead of MongoDB ones.
+func mongoLogQuery(filter *LogFilter) bson.M {
+	q := bson.M{}
+	if filter.Source != "" {
+		q["source"] = filter.Source
+	}
+	if filter.Unit != "" {
+		q["unit"] = filter.Unit
+	}
+	date := bson.M{}
+	if !filter.Since.IsZero() {
+		date["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		date["$lte"] = filter.Until
+	}
+	if len(date) > 0 {
+		q["date"] = date
+	}
+	for k, v := range filter.Fields {
+		q["fields."+k] = bson.M{"$in": logFieldCandidates(v)}
+	}
+	return q
+}
+
+// List sorts messages by date and then by id, as ids are only ordered by
+// insertion for messages inserted by the same API instance. The cursor
+// holds both the date and the id of the first message not returned.
+func (s *mongoLogStorage) List(appName string, lines int, filter LogFilter) ([]Applog, string, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, "", err
+	}
+	q := mongoLogQuery(&filter)
+	if filter.Cursor != "" {
+		date, id, err := parseMongoLogCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		q["$or"] = []bson.M{
+			{"date": bson.M{"$lt": date}},
+			{"date": date, "_id": bson.M{"$lte": id}},
+		}
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	logs := []Applog{}
+	query := conn.Logs(appName).Find(q).Sort("-date", "-_id").SetMaxTime(mongoLogQueryMaxTime)
+	if lines > 0 && filter.grepRegexp == nil {
+		query = query.Limit(lines + 1)
+	}
+	iter := query.Iter()
+	var applog Applog
+	for (lines <= 0 || len(logs) <= lines) && iter.Next(&applog) {
+		if filter.matchesGrep(&applog) {
+			logs = append(logs, applog)
+		}
+		applog = Applog{}
+	}
+	err = iter.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	var cursor string
+	if lines > 0 && len(logs) > lines {
+		next := logs[lines]
+		cursor = fmt.Sprintf("%d:%s", next.Date.UnixNano()/int64(time.Millisecond), next.MongoID.Hex())
+		logs = logs[:lines]
+	}
+	l := len(logs)
+	for i := 0; i < l/2; i++ {
+		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+	}
+	return logs, cursor, nil
+}
+
+func parseMongoLogCursor(cursor string) (time.Time, bson.ObjectId, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[1]) {
+		return time.Time{}, "", errInvalidLogCursor
+	}
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errInvalidLogCursor
+	}
+	date := time.Unix(0, ms*int64(time.Millisecond))
+	return date, bson.ObjectIdHex(parts[1]), nil
+}
+
+func (s *mongoLogStorage) Watch(appName string, filter LogFilter) (*LogListener, error) {
+	err := filter.validate()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan Applog, 10)
+	quit := make(chan struct{})
+	coll := conn.Logs(appName)
+	var lastLog Applog
+	err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
+	if err == mgo.ErrNotFound {
+		// Tail cursors do not work correctly if the collection is empty (the
+		// Next() call wouldn't block). So if the collection is empty we insert
+		// the very first log line in it. This is quite rare in the real world
+		// though so the impact of this extra log message is really small.
+		err = s.Insert(appName, &Applog{
+			Date:    time.Now().In(time.UTC),
+			Message: "Logs initialization",
+			Source:  "tsuru",
+			AppName: appName,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		err = coll.Find(nil).Sort("-_id").Limit(1).One(&lastLog)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	lastId := lastLog.MongoID
+	mkQuery := func() bson.M {
+		m := mongoLogQuery(&filter)
+		m["_id"] = bson.M{"$gt": lastId}
+		return m
+	}
+	query := coll.Find(mkQuery())
+	tailTimeout := 10 * time.Second
+	iter := query.Sort("$natural").Tail(tailTimeout)
+	go func() {
+		defer close(c)
+		defer func() {
+			if r := recover(); r != nil {
+				if isSessionClosed(r) {
+					return
+				}
+				panic(r)
+			}
+		}()
+		for {
+			var applog Applog
+			for iter.Next(&applog) {
+				lastId = applog.MongoID
+				if !filter.matchesGrep(&applog) {
+					continue
+				}
+				select {
+				case c <- applog:
+				case <-quit:
+					iter.Close()
+					return
+				}
+			}
+			if iter.Timeout() {
+				continue
+			}
+			if err := iter.Err(); err != nil {
+				if !isCappedPositionLost(err) {
+					log.Errorf("error tailing logs: %v", err)
+					iter.Close()
+					return
+				}
+			}
+			iter.Close()
+			query = coll.Find(mkQuery())
+			iter = query.Sort("$natural").Tail(tailTimeout)
+		}
+	}()
+	return &LogListener{c: c, quit: quit, close: conn.Close}, nil
+}
+
+func (s *mongoLogStorage) Remove(appName string) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Logs(appName).DropCollection()
+}
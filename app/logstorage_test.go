@@ -0,0 +1,366 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func newTestDiskLogStorage(c *check.C, segmentSize, maxSegments int) (*diskLogStorage, func()) {
+	dir, err := ioutil.TempDir("", "tsuru-app-logs")
+	c.Assert(err, check.IsNil)
+	config.Set("app-log:disk:path", dir)
+	config.Set("app-log:disk:segment-size", segmentSize)
+	config.Set("app-log:disk:max-segments", maxSegments)
+	defer config.Unset("app-log:disk")
+	storage, err := newDiskLogStorage()
+	c.Assert(err, check.IsNil)
+	return storage, func() { os.RemoveAll(dir) }
+}
+
+func testLogStorage(c *check.C, storage LogStorage) {
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := storage.Insert("myapp",
+		&Applog{Date: baseTime, Message: "m1", Source: "web", AppName: "myapp", Unit: "u1"},
+		&Applog{Date: baseTime, Message: "m2", Source: "worker", AppName: "myapp", Unit: "u2"},
+		&Applog{Date: baseTime, Message: "m3", Source: "web", AppName: "myapp", Unit: "u2"},
+	)
+	c.Assert(err, check.IsNil)
+	err = storage.Insert("otherapp", &Applog{Date: baseTime, Message: "other", Source: "web", AppName: "otherapp"})
+	c.Assert(err, check.IsNil)
+	logs, _, err := storage.List("myapp", 2, LogFilter{})
+	c.Assert(err, check.IsNil)
+	compareLogs(c, logs, []Applog{
+		{Date: baseTime, Message: "m2", Source: "worker", AppName: "myapp", Unit: "u2"},
+		{Date: baseTime, Message: "m3", Source: "web", AppName: "myapp", Unit: "u2"},
+	})
+	logs, _, err = storage.List("myapp", 10, LogFilter{Source: "web"})
+	c.Assert(err, check.IsNil)
+	compareLogs(c, logs, []Applog{
+		{Date: baseTime, Message: "m1", Source: "web", AppName: "myapp", Unit: "u1"},
+		{Date: baseTime, Message: "m3", Source: "web", AppName: "myapp", Unit: "u2"},
+	})
+	logs, _, err = storage.List("myapp", 10, LogFilter{Source: "web", Unit: "u1"})
+	c.Assert(err, check.IsNil)
+	compareLogs(c, logs, []Applog{
+		{Date: baseTime, Message: "m1", Source: "web", AppName: "myapp", Unit: "u1"},
+	})
+	l, err := storage.Watch("myapp", LogFilter{Source: "web"})
+	c.Assert(err, check.IsNil)
+	err = storage.Insert("myapp",
+		&Applog{Date: baseTime, Message: "m4", Source: "worker", AppName: "myapp"},
+		&Applog{Date: baseTime, Message: "m5", Source: "web", AppName: "myapp"},
+	)
+	c.Assert(err, check.IsNil)
+	select {
+	case msg := <-l.ListenChan():
+		c.Assert(msg.Message, check.Equals, "m5")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for log message")
+	}
+	l.Close()
+	l.Close()
+	_, ok := <-l.ListenChan()
+	c.Assert(ok, check.Equals, false)
+	err = storage.Remove("myapp")
+	c.Assert(err, check.IsNil)
+	logs, _, err = storage.List("myapp", 10, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+	logs, _, err = storage.List("otherapp", 10, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+}
+
+func (s *S) TestMemoryLogStorage(c *check.C) {
+	testLogStorage(c, newMemoryLogStorage())
+}
+
+func (s *S) TestDiskLogStorage(c *check.C) {
+	storage, cleanup := newTestDiskLogStorage(c, 1024*1024, 10)
+	defer cleanup()
+	testLogStorage(c, storage)
+}
+
+func (s *S) TestDiskLogStorageRotation(c *check.C) {
+	storage, cleanup := newTestDiskLogStorage(c, 200, 3)
+	defer cleanup()
+	for i := 0; i < 20; i++ {
+		err := storage.Insert("myapp", &Applog{Message: fmt.Sprintf("msg %d", i), Source: "web", AppName: "myapp"})
+		c.Assert(err, check.IsNil)
+	}
+	segments, err := storage.segments(filepath.Join(storage.path, "myapp"))
+	c.Assert(err, check.IsNil)
+	c.Assert(segments, check.HasLen, 3)
+	logs, _, err := storage.List("myapp", 0, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(len(logs) < 20, check.Equals, true)
+	c.Assert(logs[len(logs)-1].Message, check.Equals, "msg 19")
+	logs, _, err = storage.List("myapp", 2, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "msg 18")
+	c.Assert(logs[1].Message, check.Equals, "msg 19")
+}
+
+func (s *S) TestDiskLogStorageInvalidAppName(c *check.C) {
+	storage, cleanup := newTestDiskLogStorage(c, 1024, 10)
+	defer cleanup()
+	err := storage.Insert("../myapp", &Applog{Message: "msg"})
+	c.Assert(err, check.ErrorMatches, `invalid app name for logs: "../myapp"`)
+}
+
+func (s *S) TestGetLogStorage(c *check.C) {
+	storage, err := GetLogStorage()
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &mongoLogStorage{})
+	config.Set("app-log:backend", "memory")
+	defer config.Unset("app-log:backend")
+	storage, err = GetLogStorage()
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &memoryLogStorage{})
+	other, err := GetLogStorage()
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Equals, storage)
+	config.Set("app-log:backend", "invalid")
+	_, err = GetLogStorage()
+	c.Assert(err, check.ErrorMatches, `unknown app log backend: "invalid"`)
+}
+
+type rejectingLogStorage struct {
+	LogStorage
+	err error
+}
+
+func (s *rejectingLogStorage) Insert(appName string, msgs ...*Applog) error {
+	return s.err
+}
+
+func (s *S) TestAppLogDispatcherFlushInvalidLogs(c *check.C) {
+	storage := &rejectingLogStorage{err: &InvalidLogsError{Err: errors.New("can't have . in field names")}}
+	RegisterLogStorage("rejecting", func() (LogStorage, error) { return storage, nil })
+	config.Set("app-log:backend", "rejecting")
+	defer config.Unset("app-log:backend")
+	d := &appLogDispatcher{appName: "myapp"}
+	msgs := []*Applog{{AppName: "myapp", Message: "x"}}
+	c.Assert(d.flush(msgs, nil), check.Equals, true)
+	storage.err = errors.New("connection refused")
+	c.Assert(d.flush(msgs, nil), check.Equals, false)
+}
+
+func (s *S) TestIsRejectedInsert(c *check.C) {
+	c.Assert(isRejectedInsert(nil), check.Equals, false)
+	c.Assert(isRejectedInsert(errors.New("no reachable servers")), check.Equals, false)
+	c.Assert(isRejectedInsert(&mgo.LastError{Code: 57, Err: "can't have . in field names"}), check.Equals, true)
+	c.Assert(isRejectedInsert(&mgo.LastError{Code: 10107, Err: "not master"}), check.Equals, false)
+	c.Assert(isRejectedInsert(&mgo.LastError{WTimeout: true}), check.Equals, false)
+	c.Assert(isRejectedInsert(&mgo.QueryError{Code: 11000}), check.Equals, true)
+}
+
+func (s *S) TestLastLogsMemoryStorage(c *check.C) {
+	config.Set("app-log:backend", "memory")
+	defer config.Unset("app-log:backend")
+	a := App{Name: "app-memory-logs", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.Log("first\nsecond", "tsuru", "u1")
+	c.Assert(err, check.IsNil)
+	logs, err := a.LastLogs(1, LogFilter{Source: "tsuru"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "second")
+	err = Delete(&a, nil)
+	c.Assert(err, check.IsNil)
+	storage, err := GetLogStorage()
+	c.Assert(err, check.IsNil)
+	logs, _, err = storage.List(a.Name, 10, LogFilter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+}
+
+func testLogStorageFilters(c *check.C, storage LogStorage) {
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		msg := fmt.Sprintf("request %d ok", i)
+		if i%3 == 0 {
+			msg = fmt.Sprintf("request %d failed", i)
+		}
+		err := storage.Insert("myapp", &Applog{
+			Date:    baseTime.Add(time.Duration(i) * time.Hour),
+			Message: msg,
+			Source:  "web",
+			AppName: "myapp",
+		})
+		c.Assert(err, check.IsNil)
+	}
+	messages := func(logs []Applog) []string {
+		var result []string
+		for _, l := range logs {
+			result = append(result, l.Message)
+		}
+		return result
+	}
+	logs, _, err := storage.List("myapp", 0, LogFilter{Since: baseTime.Add(7 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 7 ok", "request 8 ok", "request 9 failed"})
+	logs, _, err = storage.List("myapp", 0, LogFilter{Since: baseTime.Add(time.Hour), Until: baseTime.Add(2 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 1 ok", "request 2 ok"})
+	logs, _, err = storage.List("myapp", 0, LogFilter{Grep: "fail(ed)?$"})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 0 failed", "request 3 failed", "request 6 failed", "request 9 failed"})
+	logs, _, err = storage.List("myapp", 0, LogFilter{Grep: "failed", Invert: true, Until: baseTime.Add(2 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 1 ok", "request 2 ok"})
+	logs, cursor, err := storage.List("myapp", 4, LogFilter{Grep: "ok"})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 4 ok", "request 5 ok", "request 7 ok", "request 8 ok"})
+	c.Assert(cursor, check.Not(check.Equals), "")
+	logs, cursor, err = storage.List("myapp", 4, LogFilter{Grep: "ok", Cursor: cursor})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(logs), check.DeepEquals, []string{"request 1 ok", "request 2 ok"})
+	c.Assert(cursor, check.Equals, "")
+	_, _, err = storage.List("myapp", 4, LogFilter{Grep: "("})
+	c.Assert(err, check.ErrorMatches, `invalid grep expression "\(": .*`)
+	_, _, err = storage.List("myapp", 4, LogFilter{Invert: true})
+	c.Assert(err, check.ErrorMatches, "invert requires a grep expression")
+	_, _, err = storage.List("myapp", 4, LogFilter{Since: baseTime, Until: baseTime.Add(-time.Hour)})
+	c.Assert(err, check.ErrorMatches, "until must not be before since")
+	_, _, err = storage.List("myapp", 4, LogFilter{Cursor: "invalid"})
+	c.Assert(err, check.Equals, errInvalidLogCursor)
+	l, err := storage.Watch("myapp", LogFilter{Grep: "failed", Invert: true})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	err = storage.Insert("myapp",
+		&Applog{Date: baseTime, Message: "request 10 failed", Source: "web", AppName: "myapp"},
+		&Applog{Date: baseTime, Message: "request 11 ok", Source: "web", AppName: "myapp"},
+	)
+	c.Assert(err, check.IsNil)
+	select {
+	case msg := <-l.ListenChan():
+		c.Assert(msg.Message, check.Equals, "request 11 ok")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for log message")
+	}
+}
+
+func testLogStorageFieldFilters(c *check.C, storage LogStorage) {
+	config.Set("app-log:parse-json", true)
+	defer config.Unset("app-log:parse-json")
+	messages := []string{
+		`{"level": "error", "request_id": "abc", "status": 500, "http": {"method": "GET"}}`,
+		`{"level": "info", "request_id": "abc", "status": 200, "http": {"method": "POST"}}`,
+		`{"level": "error", "request_id": "def", "ok": false}`,
+		`level=error`,
+	}
+	for _, msg := range messages {
+		l := &Applog{Date: time.Now(), Message: msg, Source: "web", AppName: "myapp"}
+		l.ParseFields()
+		err := storage.Insert("myapp", l)
+		c.Assert(err, check.IsNil)
+	}
+	tests := []struct {
+		fields   map[string]string
+		expected []string
+	}{
+		{map[string]string{"level": "error"}, []string{messages[0], messages[2]}},
+		{map[string]string{"level": "error", "request_id": "abc"}, []string{messages[0]}},
+		{map[string]string{"status": "200"}, []string{messages[1]}},
+		{map[string]string{"ok": "false"}, []string{messages[2]}},
+		{map[string]string{"http.method": "POST"}, []string{messages[1]}},
+		{map[string]string{"level": "debug"}, nil},
+	}
+	for _, tt := range tests {
+		logs, _, err := storage.List("myapp", 0, LogFilter{Fields: tt.fields})
+		c.Assert(err, check.IsNil)
+		var found []string
+		for _, l := range logs {
+			found = append(found, l.Message)
+		}
+		c.Assert(found, check.DeepEquals, tt.expected, check.Commentf("filter %v", tt.fields))
+	}
+	_, _, err := storage.List("myapp", 0, LogFilter{Fields: map[string]string{"$where": "1"}})
+	c.Assert(err, check.ErrorMatches, `invalid field name "\$where"`)
+}
+
+func (s *S) TestMemoryLogStorageFieldFilters(c *check.C) {
+	testLogStorageFieldFilters(c, newMemoryLogStorage())
+}
+
+func (s *S) TestDiskLogStorageFieldFilters(c *check.C) {
+	storage, cleanup := newTestDiskLogStorage(c, 1024*1024, 10)
+	defer cleanup()
+	testLogStorageFieldFilters(c, storage)
+}
+
+func (s *S) TestMongoLogStorageFieldFilters(c *check.C) {
+	testLogStorageFieldFilters(c, &mongoLogStorage{})
+}
+
+func (s *S) TestMemoryLogStorageFilters(c *check.C) {
+	testLogStorageFilters(c, newMemoryLogStorage())
+}
+
+func (s *S) TestDiskLogStorageFilters(c *check.C) {
+	storage, cleanup := newTestDiskLogStorage(c, 300, 10)
+	defer cleanup()
+	testLogStorageFilters(c, storage)
+}
+
+func (s *S) TestMongoLogStorageFilters(c *check.C) {
+	testLogStorageFilters(c, &mongoLogStorage{})
+}
+
+func (s *S) TestMongoLogStorageCursorIdsOutOfOrder(c *check.C) {
+	conn, err := db.LogConn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	baseTime := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, date := range []time.Time{
+		baseTime,
+		baseTime.Add(time.Second),
+		baseTime.Add(time.Second),
+		baseTime.Add(2 * time.Second),
+		baseTime.Add(3 * time.Second),
+	} {
+		// Instances with skewed clocks may insert later messages with
+		// lower ids.
+		err = conn.Logs("myapp").Insert(Applog{
+			MongoID: bson.NewObjectIdWithTime(baseTime.Add(-time.Duration(i) * time.Hour)),
+			Date:    date,
+			Message: fmt.Sprintf("msg%d", i),
+			AppName: "myapp",
+		})
+		c.Assert(err, check.IsNil)
+	}
+	storage := &mongoLogStorage{}
+	var messages []string
+	var cursor string
+	for {
+		var logs []Applog
+		logs, cursor, err = storage.List("myapp", 2, LogFilter{Cursor: cursor})
+		c.Assert(err, check.IsNil)
+		page := make([]string, len(logs))
+		for i, l := range logs {
+			page[i] = l.Message
+		}
+		messages = append(page, messages...)
+		if cursor == "" {
+			break
+		}
+	}
+	c.Assert(messages, check.DeepEquals, []string{"msg0", "msg2", "msg1", "msg3", "msg4"})
+}
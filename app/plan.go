@@ -31,6 +31,9 @@ func SavePlan(plan appTypes.Plan) error {
 	if plan.Memory > 0 && plan.Memory < 4194304 {
 		return appTypes.ErrLimitOfMemory
 	}
+	if plan.Cost < 0 {
+		return appTypes.PlanValidationError{Field: "cost"}
+	}
 	return PlanService().Insert(plan)
 }
 
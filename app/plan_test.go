@@ -45,8 +45,15 @@ func (s *S) TestPlanAddInvalid(c *check.C) {
 			Swap:     1024,
 			CpuShare: 100,
 		},
+		{
+			Name:     "plan1",
+			Memory:   9223372036854775807,
+			Swap:     1024,
+			CpuShare: 100,
+			Cost:     -1,
+		},
 	}
-	expectedError := []error{appTypes.PlanValidationError{Field: "name"}, appTypes.ErrLimitOfCpuShare, appTypes.ErrLimitOfMemory}
+	expectedError := []error{appTypes.PlanValidationError{Field: "name"}, appTypes.ErrLimitOfCpuShare, appTypes.ErrLimitOfMemory, appTypes.PlanValidationError{Field: "cost"}}
 	for i, p := range invalidPlans {
 		err := SavePlan(p)
 		c.Assert(err, check.FitsTypeOf, expectedError[i])
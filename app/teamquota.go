@@ -0,0 +1,142 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/service"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"github.com/tsuru/tsuru/volume"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TeamQuotaUsage is the amount of the resources limited by the team quota
+// in use by a team, see authTypes.TeamQuota.
+type TeamQuotaUsage struct {
+	Memory           int64          `json:"memory"`
+	CpuShare         int            `json:"cpushare"`
+	ServiceInstances int            `json:"serviceinstances"`
+	Services         map[string]int `json:"services,omitempty"`
+	Volumes          int            `json:"volumes"`
+}
+
+// TeamQuotaInUse returns the resources in use by the team: the memory and
+// cpu shares reserved by the units of the apps it owns, and the number of
+// service instances and volumes it owns.
+func TeamQuotaInUse(teamName string) (TeamQuotaUsage, error) {
+	usage, err := teamQuotaInUse(teamName, "")
+	if err != nil {
+		return usage, err
+	}
+	services, err := service.TeamServiceInstancesInUse(teamName)
+	if err != nil {
+		return usage, err
+	}
+	for _, n := range services {
+		usage.ServiceInstances += n
+	}
+	if len(services) > 0 {
+		usage.Services = services
+	}
+	usage.Volumes, err = volume.TeamVolumesInUse(teamName)
+	return usage, err
+}
+
+func teamQuotaInUse(teamName, exceptApp string) (TeamQuotaUsage, error) {
+	var usage TeamQuotaUsage
+	conn, err := db.Conn()
+	if err != nil {
+		return usage, err
+	}
+	defer conn.Close()
+	query := bson.M{"teamowner": teamName}
+	if exceptApp != "" {
+		query["name"] = bson.M{"$ne": exceptApp}
+	}
+	var apps []App
+	err = conn.Apps().Find(query).Select(bson.M{"plan": 1, "quota": 1}).All(&apps)
+	if err != nil {
+		return usage, err
+	}
+	for _, a := range apps {
+		usage.Memory += a.Plan.Memory * int64(a.Quota.InUse)
+		usage.CpuShare += a.Plan.CpuShare * a.Quota.InUse
+	}
+	return usage, nil
+}
+
+// checkTeamQuota returns an error if the given app having the given number
+// of units with plan would exceed the quota of the team. The usage of the
+// team is spread over its apps, so the check is not atomic with changes to
+// other apps: callers reserving units must check it again afterwards, see
+// reserveTeamUnits.
+func checkTeamQuota(teamName, appName string, plan appTypes.Plan, units int) error {
+	team, err := auth.GetTeam(teamName)
+	if err != nil {
+		if err == authTypes.ErrTeamNotFound {
+			return nil
+		}
+		return err
+	}
+	if team.Quota.Memory <= 0 && team.Quota.CpuShare <= 0 {
+		return nil
+	}
+	usage, err := teamQuotaInUse(teamName, appName)
+	if err != nil {
+		return err
+	}
+	if team.Quota.Memory > 0 {
+		requested := plan.Memory * int64(units)
+		if usage.Memory+requested > team.Quota.Memory {
+			return &quota.TeamQuotaExceededError{
+				Team:      teamName,
+				Resource:  "memory",
+				Requested: requested,
+				Available: team.Quota.Memory - usage.Memory,
+			}
+		}
+	}
+	if team.Quota.CpuShare > 0 {
+		requested := int64(plan.CpuShare * units)
+		if int64(usage.CpuShare)+requested > int64(team.Quota.CpuShare) {
+			return &quota.TeamQuotaExceededError{
+				Team:      teamName,
+				Resource:  "cpushare",
+				Requested: requested,
+				Available: int64(team.Quota.CpuShare - usage.CpuShare),
+			}
+		}
+	}
+	return nil
+}
+
+// reserveTeamUnits reserves n units for the app, as reserveUnits does, if
+// they fit in the quota of the team owning it. As concurrent reservations
+// for other apps of the team may pass the first check, the quota is checked
+// again after reserving the units, and they are released if it's exceeded.
+// Each reservation is visible to the second check of the others, so racing
+// reservations can't exceed the quota together, although they may all fail.
+func reserveTeamUnits(app *App, n int) error {
+	err := checkTeamQuota(app.TeamOwner, app.Name, app.Plan, app.Quota.InUse+n)
+	if err != nil {
+		return err
+	}
+	err = reserveUnits(app, n)
+	if err != nil {
+		return err
+	}
+	err = checkTeamQuota(app.TeamOwner, app.Name, app.Plan, app.Quota.InUse+n)
+	if err != nil {
+		if releaseErr := releaseUnits(app, n); releaseErr != nil {
+			log.Errorf("unable to release units of app %q exceeding the team quota: %s", app.Name, releaseErr)
+		}
+		return err
+	}
+	return nil
+}
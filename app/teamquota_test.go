@@ -0,0 +1,102 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/quota"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestTeamQuotaInUse(c *check.C) {
+	a1 := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "app2", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	err = a1.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a2.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	usage, err := TeamQuotaInUse(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, TeamQuotaUsage{Memory: 3 * s.defaultPlan.Memory, CpuShare: 3 * s.defaultPlan.CpuShare})
+	usage, err = TeamQuotaInUse("otherteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, TeamQuotaUsage{})
+}
+
+func (s *S) TestAddUnitsTeamQuotaExceeded(c *check.C) {
+	a := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{Memory: 3 * s.defaultPlan.Memory})
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{
+		Team:      s.team.Name,
+		Resource:  "memory",
+		Requested: 4 * s.defaultPlan.Memory,
+		Available: 3 * s.defaultPlan.Memory,
+	})
+	c.Assert(s.provisioner.GetUnits(&a), check.HasLen, 2)
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAddUnitsTeamQuotaCpuShareExceeded(c *check.C) {
+	a := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{CpuShare: s.defaultPlan.CpuShare})
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	e, ok := err.(*quota.TeamQuotaExceededError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Resource, check.Equals, "cpushare")
+	c.Assert(e.Error(), check.Equals, `Quota exceeded for team "tsuruteam" cpushare. Available: 100. Requested: 200.`)
+}
+
+func (s *S) TestCreateAppTeamQuotaExceeded(c *check.C) {
+	err := auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{Memory: s.defaultPlan.Memory - 1})
+	c.Assert(err, check.IsNil)
+	a := App{Name: "warpaint", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	_, ok := err.(*quota.TeamQuotaExceededError)
+	c.Assert(ok, check.Equals, true)
+	_, err = GetByName(a.Name)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestUpdatePlanTeamQuotaExceeded(c *check.C) {
+	plan := appTypes.Plan{Name: "big", CpuShare: 100, Memory: 4 * s.defaultPlan.Memory}
+	err := PlanService().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "my-test-app", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{Memory: 4 * s.defaultPlan.Memory})
+	c.Assert(err, check.IsNil)
+	updateData := App{Name: a.Name, Plan: appTypes.Plan{Name: "big"}}
+	err = a.Update(updateData, new(bytes.Buffer))
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{
+		Team:      s.team.Name,
+		Resource:  "memory",
+		Requested: 8 * s.defaultPlan.Memory,
+		Available: 4 * s.defaultPlan.Memory,
+	})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan.Name, check.Equals, s.defaultPlan.Name)
+}
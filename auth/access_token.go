@@ -0,0 +1,356 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrAccessTokenNotFound      = errors.New("access token not found")
+	ErrAccessTokenAlreadyExists = &tsuruErrors.ConflictError{Message: "an access token with this name already exists"}
+	ErrMissingAccessTokenName   = &tsuruErrors.ValidationError{Message: "access token name is required"}
+	ErrInvalidAccessTokenExpiry = &tsuruErrors.ValidationError{Message: "access token expiration must be in the future"}
+)
+
+const defaultAccessTokenMaxExpireDays = 365
+
+// AccessTokenMaxExpiration returns the maximum lifetime of access tokens, set
+// in auth:access-token-max-expire-days.
+func AccessTokenMaxExpiration() time.Duration {
+	days, err := config.GetInt("auth:access-token-max-expire-days")
+	if err != nil || days <= 0 {
+		days = defaultAccessTokenMaxExpireDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// lastUsedPrecision limits how often the last use of an access token is
+// written, avoiding an update on every request.
+var lastUsedPrecision = time.Minute
+
+// AccessTokenScope restricts an access token to a permission scheme,
+// optionally in a single context.
+type AccessTokenScope struct {
+	Scheme       string `json:"scheme"`
+	ContextType  string `json:"context_type,omitempty"`
+	ContextValue string `json:"context_value,omitempty"`
+}
+
+// ParseAccessTokenScope parses a scope in the <scheme> or the
+// <scheme>:<context type>:<context value> format, e.g. app.deploy:app:myapp.
+func ParseAccessTokenScope(value string) (AccessTokenScope, error) {
+	parts := strings.SplitN(value, ":", 3)
+	var scope AccessTokenScope
+	switch len(parts) {
+	case 1:
+		scope = AccessTokenScope{Scheme: parts[0]}
+	case 3:
+		scope = AccessTokenScope{Scheme: parts[0], ContextType: parts[1], ContextValue: parts[2]}
+	default:
+		return scope, &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("invalid scope %q, must be <permission> or <permission>:<context type>:<context value>", value),
+		}
+	}
+	_, err := scope.Permission()
+	return scope, err
+}
+
+func (s AccessTokenScope) String() string {
+	if s.ContextType == "" {
+		return s.Scheme
+	}
+	return fmt.Sprintf("%s:%s:%s", s.Scheme, s.ContextType, s.ContextValue)
+}
+
+// Permission returns the permission granted by the scope, in the global
+// context when the scope has no context.
+func (s AccessTokenScope) Permission() (permission.Permission, error) {
+	scheme, err := permission.SafeGet(s.Scheme)
+	if err != nil {
+		return permission.Permission{}, &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid scope %q: %s", s, err)}
+	}
+	if s.ContextType == "" {
+		return permission.Permission{Scheme: scheme, Context: permission.Context(permission.CtxGlobal, "")}, nil
+	}
+	for _, ctxType := range scheme.AllowedContexts() {
+		if string(ctxType) == s.ContextType && ctxType != permission.CtxGlobal {
+			return permission.Permission{Scheme: scheme, Context: permission.Context(ctxType, s.ContextValue)}, nil
+		}
+	}
+	return permission.Permission{}, &tsuruErrors.ValidationError{
+		Message: fmt.Sprintf("invalid scope %q: context type %q not allowed for permission %q", s, s.ContextType, s.Scheme),
+	}
+}
+
+// AccessToken is a named personal access token. Tokens grant the permissions
+// of their user until they expire, restricted to their scopes when there's
+// any. Only a hash of the token is stored, its value is returned once, when
+// the token is created.
+type AccessToken struct {
+	ID         string             `json:"-" bson:"_id"`
+	Token      string             `json:"token,omitempty" bson:"-"`
+	Name       string             `json:"name"`
+	UserEmail  string             `json:"email"`
+	CreatedAt  time.Time          `json:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	LastUsedAt time.Time          `json:"last_used_at"`
+	Scopes     []AccessTokenScope `json:"scopes"`
+}
+
+func accessTokensCollection(conn *db.Storage) *storage.Collection {
+	coll := conn.Collection("access_tokens")
+	coll.EnsureIndex(mgo.Index{Key: []string{"useremail", "name"}, Unique: true})
+	return coll
+}
+
+func hashAccessToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// CreateAccessToken creates a new access token for the user, valid until
+// expiresAt and restricted to the given scopes.
+func CreateAccessToken(u *User, name string, expiresAt time.Time, scopes []AccessTokenScope) (*AccessToken, error) {
+	if name == "" {
+		return nil, ErrMissingAccessTokenName
+	}
+	now := time.Now().UTC()
+	if !expiresAt.After(now) {
+		return nil, ErrInvalidAccessTokenExpiry
+	}
+	if maxExpiration := AccessTokenMaxExpiration(); expiresAt.After(now.Add(maxExpiration)) {
+		return nil, &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("access token expiration must be within %d days", int(maxExpiration.Hours()/24)),
+		}
+	}
+	for _, s := range scopes {
+		if _, err := s.Permission(); err != nil {
+			return nil, err
+		}
+	}
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	value := fmt.Sprintf("%x", randomBytes)
+	t := AccessToken{
+		ID:        hashAccessToken(value),
+		Token:     value,
+		Name:      name,
+		UserEmail: u.Email,
+		CreatedAt: now,
+		ExpiresAt: expiresAt.UTC(),
+		Scopes:    scopes,
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = accessTokensCollection(conn).Insert(t)
+	if mgo.IsDup(err) {
+		return nil, ErrAccessTokenAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListAccessTokens returns the access tokens of the user, without their
+// values.
+func ListAccessTokens(email string) ([]AccessToken, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tokens []AccessToken
+	err = accessTokensCollection(conn).Find(bson.M{"useremail": email}).Sort("name").All(&tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAccessToken removes the access token with the given name from the
+// user.
+func RevokeAccessToken(email, name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = accessTokensCollection(conn).Remove(bson.M{"useremail": email, "name": name})
+	if err == mgo.ErrNotFound {
+		return ErrAccessTokenNotFound
+	}
+	return err
+}
+
+func removeAccessTokens(conn *db.Storage, email string) error {
+	_, err := accessTokensCollection(conn).RemoveAll(bson.M{"useremail": email})
+	return err
+}
+
+// AccessTokenAuth returns the access token in the header, recording its use.
+func AccessTokenAuth(header string) (*AccessToken, error) {
+	token, err := ParseToken(header)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var t AccessToken
+	err = accessTokensCollection(conn).FindId(hashAccessToken(token)).One(&t)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !t.ExpiresAt.After(now) {
+		return nil, ErrInvalidToken
+	}
+	if now.Sub(t.LastUsedAt) >= lastUsedPrecision {
+		t.LastUsedAt = now
+		accessTokensCollection(conn).UpdateId(t.ID, bson.M{"$set": bson.M{"lastusedat": now}})
+	}
+	t.Token = token
+	return &t, nil
+}
+
+func (t *AccessToken) GetValue() string {
+	return t.Token
+}
+
+func (t *AccessToken) User() (*User, error) {
+	return GetUserByEmail(t.UserEmail)
+}
+
+func (t *AccessToken) IsAppToken() bool {
+	return false
+}
+
+func (t *AccessToken) GetUserName() string {
+	return t.UserEmail
+}
+
+func (t *AccessToken) GetAppName() string {
+	return ""
+}
+
+// Permissions returns the permissions of the user, restricted to the scopes
+// of the token when there's any.
+func (t *AccessToken) Permissions() ([]permission.Permission, error) {
+	perms, err := BaseTokenPermission(t)
+	if err != nil || len(t.Scopes) == 0 {
+		return perms, err
+	}
+	scopes := make([]permission.Permission, 0, len(t.Scopes))
+	for _, s := range t.Scopes {
+		p, err := s.Permission()
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, p)
+	}
+	return intersectPermissions(perms, scopes)
+}
+
+// intersectPermissions returns the permissions granted by both lists, each
+// one with the most specific scheme and context of the pair it comes from.
+func intersectPermissions(perms, scopes []permission.Permission) ([]permission.Permission, error) {
+	var result []permission.Permission
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		for _, perm := range perms {
+			var scheme *permission.PermissionScheme
+			switch {
+			case perm.Scheme.IsParent(scope.Scheme):
+				scheme = scope.Scheme
+			case scope.Scheme.IsParent(perm.Scheme):
+				scheme = perm.Scheme
+			default:
+				continue
+			}
+			ctx, ok, err := intersectContexts(perm.Context, scope.Context)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			p := permission.Permission{Scheme: scheme, Context: ctx}
+			if !seen[p.String()] {
+				seen[p.String()] = true
+				result = append(result, p)
+			}
+		}
+	}
+	return result, nil
+}
+
+func intersectContexts(a, b permission.PermissionContext) (permission.PermissionContext, bool, error) {
+	switch {
+	case a.CtxType == permission.CtxGlobal:
+		return b, true, nil
+	case b.CtxType == permission.CtxGlobal, a == b:
+		return a, true, nil
+	}
+	for _, pair := range [][2]permission.PermissionContext{{a, b}, {b, a}} {
+		included, err := contextIncludes(pair[0], pair[1])
+		if err != nil {
+			return permission.PermissionContext{}, false, err
+		}
+		if included {
+			return pair[1], true, nil
+		}
+	}
+	return permission.PermissionContext{}, false, nil
+}
+
+// contextIncludes reports whether permissions in the outer context apply to
+// the inner one. It's only known for apps, whose permissions are also
+// checked in the context of their teams and pool.
+func contextIncludes(outer, inner permission.PermissionContext) (bool, error) {
+	if inner.CtxType != permission.CtxApp {
+		return false, nil
+	}
+	var query bson.M
+	switch outer.CtxType {
+	case permission.CtxTeam:
+		query = bson.M{"name": inner.Value, "teams": outer.Value}
+	case permission.CtxPool:
+		query = bson.M{"name": inner.Value, "pool": outer.Value}
+	default:
+		return false, nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	n, err := conn.Apps().Find(query).Count()
+	return n > 0, err
+}
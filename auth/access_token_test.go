@@ -0,0 +1,175 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestParseAccessTokenScope(c *check.C) {
+	scope, err := ParseAccessTokenScope("app.deploy:app:myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(scope, check.DeepEquals, AccessTokenScope{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"})
+	c.Assert(scope.String(), check.Equals, "app.deploy:app:myapp")
+	scope, err = ParseAccessTokenScope("app.read")
+	c.Assert(err, check.IsNil)
+	c.Assert(scope, check.DeepEquals, AccessTokenScope{Scheme: "app.read"})
+	p, err := scope.Permission()
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Scheme, check.Equals, permission.PermAppRead)
+	c.Assert(p.Context, check.DeepEquals, permission.Context(permission.CtxGlobal, ""))
+	for _, invalid := range []string{"app.deploy:app", "app.invalid", "app.deploy:iaas:x", "app.deploy:global:x"} {
+		_, err = ParseAccessTokenScope(invalid)
+		c.Assert(err, check.NotNil, check.Commentf("scope %q", invalid))
+	}
+}
+
+func (s *S) TestCreateAccessToken(c *check.C) {
+	expires := time.Now().Add(time.Hour)
+	scopes := []AccessTokenScope{{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"}}
+	t, err := CreateAccessToken(s.user, "ci", expires, scopes)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Token, check.Not(check.Equals), "")
+	c.Assert(t.Name, check.Equals, "ci")
+	c.Assert(t.UserEmail, check.Equals, s.user.Email)
+	var stored AccessToken
+	err = accessTokensCollection(s.conn).Find(bson.M{"name": "ci"}).One(&stored)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.ID, check.Equals, hashAccessToken(t.Token))
+	c.Assert(stored.ID, check.Not(check.Equals), t.Token)
+	c.Assert(stored.Scopes, check.DeepEquals, scopes)
+	authToken, err := AccessTokenAuth("bearer " + t.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, s.user.Email)
+	c.Assert(authToken.GetValue(), check.Equals, t.Token)
+	c.Assert(authToken.LastUsedAt.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestCreateAccessTokenInvalid(c *check.C) {
+	_, err := CreateAccessToken(s.user, "", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.Equals, ErrMissingAccessTokenName)
+	_, err = CreateAccessToken(s.user, "ci", time.Now().Add(-time.Hour), nil)
+	c.Assert(err, check.Equals, ErrInvalidAccessTokenExpiry)
+	_, err = CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), []AccessTokenScope{{Scheme: "invalid"}})
+	c.Assert(err, check.ErrorMatches, `invalid scope "invalid": .*`)
+	_, err = CreateAccessToken(s.user, "ci", time.Now().Add(366*24*time.Hour), nil)
+	c.Assert(err, check.ErrorMatches, "access token expiration must be within 365 days")
+	config.Set("auth:access-token-max-expire-days", 2)
+	defer config.Unset("auth:access-token-max-expire-days")
+	_, err = CreateAccessToken(s.user, "ci", time.Now().Add(3*24*time.Hour), nil)
+	c.Assert(err, check.ErrorMatches, "access token expiration must be within 2 days")
+}
+
+func (s *S) TestCreateAccessTokenDuplicated(c *check.C) {
+	_, err := CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	_, err = CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.Equals, ErrAccessTokenAlreadyExists)
+	other := &User{Email: "other@globo.com"}
+	err = other.Create()
+	c.Assert(err, check.IsNil)
+	_, err = CreateAccessToken(other, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAccessTokenAuthExpired(c *check.C) {
+	t, err := CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	err = accessTokensCollection(s.conn).UpdateId(t.ID, bson.M{"$set": bson.M{"expiresat": time.Now().Add(-time.Minute)}})
+	c.Assert(err, check.IsNil)
+	_, err = AccessTokenAuth("bearer " + t.Token)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestAccessTokenAuthInvalid(c *check.C) {
+	_, err := AccessTokenAuth("bearer invalid")
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestListAndRevokeAccessTokens(c *check.C) {
+	_, err := CreateAccessToken(s.user, "deploy", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	ci, err := CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	tokens, err := ListAccessTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 2)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+	c.Assert(tokens[0].Token, check.Equals, "")
+	c.Assert(tokens[1].Name, check.Equals, "deploy")
+	err = RevokeAccessToken(s.user.Email, "ci")
+	c.Assert(err, check.IsNil)
+	_, err = AccessTokenAuth("bearer " + ci.Token)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+	err = RevokeAccessToken(s.user.Email, "ci")
+	c.Assert(err, check.Equals, ErrAccessTokenNotFound)
+	tokens, err = ListAccessTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+}
+
+func (s *S) TestAccessTokenPermissionsUnscoped(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	t, err := CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	userPerms, err := s.user.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, userPerms)
+}
+
+func (s *S) TestAccessTokenPermissionsIntersection(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy", "app.read")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Insert(bson.M{"name": "myapp", "teams": []string{"cobrateam"}, "pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Insert(bson.M{"name": "otherapp", "teams": []string{"otherteam"}, "pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	t, err := CreateAccessToken(s.user, "ci", time.Now().Add(time.Hour), []AccessTokenScope{
+		{Scheme: "app.deploy", ContextType: "app", ContextValue: "myapp"},
+		{Scheme: "app.deploy", ContextType: "app", ContextValue: "otherapp"},
+		{Scheme: "app"},
+		{Scheme: "team.create"},
+	})
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxApp, "myapp")},
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxTeam, "cobrateam")},
+		{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "cobrateam")},
+	})
+	c.Assert(permission.Check(t, permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp")), check.Equals, true)
+	c.Assert(permission.Check(t, permission.PermAppDeploy, permission.Context(permission.CtxApp, "otherapp")), check.Equals, false)
+	c.Assert(permission.Check(t, permission.PermUserUpdateToken, permission.Context(permission.CtxUser, s.user.Email)), check.Equals, false)
+}
+
+func (s *S) TestUserDeleteRemovesAccessTokens(c *check.C) {
+	u := &User{Email: "other@globo.com"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	_, err = CreateAccessToken(u, "ci", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	err = u.Delete()
+	c.Assert(err, check.IsNil)
+	tokens, err := ListAccessTokens(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package expiration provides the worker removing role assignments from
+// users once their expiration time is over.
+package expiration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const defaultInterval = time.Minute
+
+// PermSyncFunc runs the callback changing the roles of the user, syncing
+// whatever depends on the user permissions afterwards.
+type PermSyncFunc func(u *auth.User, callback func() error) error
+
+// RoleExpirer periodically looks for users holding expired roles, removing
+// them. Each removal generates an event targeting the role, the same way
+// assigning it does.
+type RoleExpirer struct {
+	Interval time.Duration
+	permSync PermSyncFunc
+	done     chan bool
+	running  bool
+}
+
+// Initialize starts the role expiration worker. It runs every
+// auth:role-expiration-interval seconds, defaulting to a minute.
+func Initialize(permSync PermSyncFunc) error {
+	interval := defaultInterval
+	if v, err := config.GetInt("auth:role-expiration-interval"); err == nil && v > 0 {
+		interval = time.Duration(v) * time.Second
+	}
+	expirer := &RoleExpirer{
+		Interval: interval,
+		permSync: permSync,
+		done:     make(chan bool),
+	}
+	shutdown.Register(expirer)
+	expirer.running = true
+	go expirer.run()
+	return nil
+}
+
+func (r *RoleExpirer) run() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.Interval):
+		}
+		err := r.expire()
+		if err != nil {
+			r.logError(err.Error())
+		}
+	}
+}
+
+func (r *RoleExpirer) logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[role expiration] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func (r *RoleExpirer) Shutdown(ctx context.Context) error {
+	if !r.running {
+		return nil
+	}
+	r.done <- true
+	r.running = false
+	return nil
+}
+
+func (r *RoleExpirer) String() string {
+	return "role expiration"
+}
+
+func (r *RoleExpirer) expire() (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	users, err := auth.ListUsersWithExpiredRoles()
+	if err != nil {
+		return errors.Wrap(err, "unable to list users")
+	}
+	for i := range users {
+		u := &users[i]
+		for _, role := range u.Roles {
+			if !role.Expired() {
+				continue
+			}
+			err = r.removeRole(u, role)
+			if err != nil {
+				r.logError("unable to remove expired role %q from user %q: %s", role.Name, u.Email, err)
+			}
+		}
+	}
+	return nil
+}
+
+func hasExpiredRole(u *auth.User, role auth.RoleInstance) bool {
+	for _, r := range u.Roles {
+		if r.Name == role.Name && r.ContextValue == role.ContextValue && r.Expired() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RoleExpirer) removeRole(u *auth.User, role auth.RoleInstance) (err error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeRole, Value: role.Name},
+		ExtraTargets: []event.ExtraTarget{{Target: event.Target{Type: event.TargetTypeUser, Value: u.Email}}},
+		InternalKind: "role-expiration",
+		CustomData: map[string]interface{}{
+			"email":      u.Email,
+			"context":    role.ContextValue,
+			"expires_at": role.ExpiresAt,
+		},
+		Allowed: event.Allowed(permission.PermRoleReadEvents),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil
+		}
+		return err
+	}
+	err = u.Reload()
+	if err != nil {
+		evt.Done(err)
+		return err
+	}
+	if !hasExpiredRole(u, role) {
+		// Assigned again or already removed while the users were listed.
+		evt.Abort()
+		return nil
+	}
+	defer func() { evt.Done(err) }()
+	callback := func() error {
+		return u.RemoveRole(role.Name, role.ContextValue)
+	}
+	if r.permSync == nil {
+		return callback()
+	}
+	return r.permSync(u, callback)
+}
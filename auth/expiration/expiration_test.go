@@ -0,0 +1,73 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expiration
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestExpire(c *check.C) {
+	_, err := permission.NewRole("oncall", "global", "")
+	c.Assert(err, check.IsNil)
+	u := auth.User{Email: "rand@althor.com", Password: "123456"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRoleWithExpiration("oncall", "", time.Now().Add(time.Hour))
+	c.Assert(err, check.IsNil)
+	other := auth.User{Email: "mat@althor.com", Password: "123456"}
+	err = other.Create()
+	c.Assert(err, check.IsNil)
+	err = other.AddRoleWithExpiration("oncall", "", time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	var synced []string
+	expirer := &RoleExpirer{permSync: func(u *auth.User, callback func() error) error {
+		synced = append(synced, u.Email)
+		return callback()
+	}}
+	err = expirer.expire()
+	c.Assert(err, check.IsNil)
+	c.Assert(synced, check.DeepEquals, []string{other.Email})
+	dbUser, err := auth.GetUserByEmail(other.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Roles, check.HasLen, 0)
+	dbUser, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Roles, check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeRole, Value: "oncall"},
+		ExtraTargets: []event.ExtraTarget{{Target: event.Target{Type: event.TargetTypeUser, Value: other.Email}}},
+		Kind:         "role-expiration",
+		StartCustomData: map[string]interface{}{
+			"email":   other.Email,
+			"context": "",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestExpireRoleAssignedAgain(c *check.C) {
+	_, err := permission.NewRole("oncall", "global", "")
+	c.Assert(err, check.IsNil)
+	u := auth.User{Email: "rand@althor.com", Password: "123456"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRoleWithExpiration("oncall", "", time.Now().Add(-time.Minute))
+	c.Assert(err, check.IsNil)
+	expired := u.Roles[0]
+	err = u.AddRole("oncall", "")
+	c.Assert(err, check.IsNil)
+	expirer := &RoleExpirer{}
+	err = expirer.removeRole(&u, expired)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "oncall"}})
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expiration
+
+import (
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn *db.Storage
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_expiration_test")
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	repositorytest.Reset()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+)
+
+// grantedRoles records the roles added to a user because of its groups in an
+// external identity provider, so that they can be removed once the user
+// leaves the groups without touching roles assigned by other means.
+type grantedRoles struct {
+	Email string `bson:"_id"`
+	Roles []RoleInstance
+}
+
+func grantedRolesCollection(conn *db.Storage) *storage.Collection {
+	return conn.Collection("group_roles")
+}
+
+// GroupRoles returns the roles mapped to the given groups by the
+// <prefix>:groups config, e.g. auth:oidc:groups. Each group may be mapped to
+// teams, which grant the role in <prefix>:team-role in the context of each
+// team, and to roles with an optional context value.
+func GroupRoles(prefix string, groups []string) ([]RoleInstance, error) {
+	teamRole, _ := config.GetString(prefix + ":team-role")
+	var roles []RoleInstance
+	seen := map[RoleInstance]bool{}
+	add := func(r RoleInstance) {
+		if !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	for _, group := range groups {
+		groupPrefix := fmt.Sprintf("%s:groups:%s", prefix, group)
+		if _, err := config.Get(groupPrefix); err != nil {
+			continue
+		}
+		teams, _ := config.GetList(groupPrefix + ":teams")
+		if len(teams) > 0 && teamRole == "" {
+			return nil, fmt.Errorf("%s:team-role must be set to map group %q to teams", prefix, group)
+		}
+		for _, team := range teams {
+			add(RoleInstance{Name: teamRole, ContextValue: team})
+		}
+		rawRoles, _ := config.Get(groupPrefix + ":roles")
+		roleList, _ := rawRoles.([]interface{})
+		for _, rawRole := range roleList {
+			var r RoleInstance
+			switch role := rawRole.(type) {
+			case string:
+				r.Name = role
+			case map[interface{}]interface{}:
+				r.Name, _ = role["name"].(string)
+				if ctx := role["context"]; ctx != nil {
+					r.ContextValue = fmt.Sprint(ctx)
+				}
+			}
+			if r.Name == "" {
+				return nil, fmt.Errorf("invalid role in %s:roles", groupPrefix)
+			}
+			add(r)
+		}
+	}
+	return roles, nil
+}
+
+// SyncGroupRoles adds to the user the given roles, mapped from its groups by
+// GroupRoles, removing the roles previously added by this function which are
+// no longer mapped from the user groups.
+func (u *User) SyncGroupRoles(wanted []RoleInstance) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var previous grantedRoles
+	err = grantedRolesCollection(conn).FindId(u.Email).One(&previous)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	wantedSet := map[RoleInstance]bool{}
+	for _, r := range wanted {
+		wantedSet[r] = true
+	}
+	previousSet := map[RoleInstance]bool{}
+	for _, r := range previous.Roles {
+		previousSet[r] = true
+		if wantedSet[r] {
+			continue
+		}
+		err = u.RemoveRole(r.Name, r.ContextValue)
+		if err != nil {
+			return err
+		}
+	}
+	userRoles := map[RoleInstance]bool{}
+	for _, r := range u.Roles {
+		userRoles[r] = true
+	}
+	granted := grantedRoles{Email: u.Email}
+	for _, r := range wanted {
+		if userRoles[r] && !previousSet[r] {
+			continue
+		}
+		if !userRoles[r] {
+			err = u.AddRole(r.Name, r.ContextValue)
+			if err == permission.ErrRoleNotFound {
+				log.Errorf("role %q mapped from groups of user %q not found", r.Name, u.Email)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		granted.Roles = append(granted.Roles, r)
+	}
+	_, err = grantedRolesCollection(conn).UpsertId(u.Email, granted)
+	return err
+}
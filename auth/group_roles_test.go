@@ -0,0 +1,72 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGroupRoles(c *check.C) {
+	config.Set("auth:test:team-role", "team-member")
+	config.Set("auth:test:groups", map[interface{}]interface{}{
+		"developers": map[interface{}]interface{}{
+			"teams": []interface{}{"team1", "team2"},
+			"roles": []interface{}{"viewer"},
+		},
+		"ops": map[interface{}]interface{}{
+			"roles": []interface{}{
+				map[interface{}]interface{}{"name": "pool-admin", "context": "pool1"},
+				"viewer",
+			},
+		},
+	})
+	defer config.Unset("auth:test")
+	roles, err := GroupRoles("auth:test", []string{"developers", "ops", "unmapped"})
+	c.Assert(err, check.IsNil)
+	c.Assert(roles, check.DeepEquals, []RoleInstance{
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "team-member", ContextValue: "team2"},
+		{Name: "viewer"},
+		{Name: "pool-admin", ContextValue: "pool1"},
+	})
+	roles, err = GroupRoles("auth:test", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(roles, check.IsNil)
+}
+
+func (s *S) TestGroupRolesTeamsWithoutTeamRole(c *check.C) {
+	config.Set("auth:test:groups:developers:teams", []interface{}{"team1"})
+	defer config.Unset("auth:test")
+	_, err := GroupRoles("auth:test", []string{"developers"})
+	c.Assert(err, check.ErrorMatches, `auth:test:team-role must be set to map group "developers" to teams`)
+}
+
+func (s *S) TestSyncGroupRoles(c *check.C) {
+	for _, name := range []string{"r1", "r2", "manual"} {
+		_, err := permission.NewRole(name, "global", "")
+		c.Assert(err, check.IsNil)
+	}
+	u := &User{Email: "groups@tsuru.io"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	err = u.SyncGroupRoles([]RoleInstance{{Name: "r1"}, {Name: "manual"}, {Name: "missing"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "manual"}, {Name: "r1"}})
+	err = u.SyncGroupRoles([]RoleInstance{{Name: "r2"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "manual"}, {Name: "r2"}})
+	err = u.SyncGroupRoles(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "manual"}})
+	err = u.Delete()
+	c.Assert(err, check.IsNil)
+	n, err := grantedRolesCollection(s.conn).FindId(u.Email).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
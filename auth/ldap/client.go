@@ -0,0 +1,140 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	ldap "gopkg.in/ldap.v3"
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	errPlaintextBind      = errors.New("refusing to send credentials in plaintext, use a ldaps:// url, enable auth:ldap:start-tls or set auth:ldap:allow-plaintext")
+)
+
+// entry is an entry returned by a search, with its attribute names in lower
+// case.
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e *entry) get(attribute string) string {
+	values := e.attributes[strings.ToLower(attribute)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// conn is a connection to the directory.
+type conn struct {
+	conn *ldap.Conn
+}
+
+// dial connects to the server in the configured ldap:// or ldaps:// URL.
+// Plain ldap:// connections are upgraded using StartTLS when enabled,
+// otherwise they're refused unless plaintext is explicitly allowed, as binds
+// would send passwords in cleartext.
+func dial(conf BaseConfig) (*conn, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ldap url %q", conf.URL)
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	tlsConfig := conf.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = u.Hostname()
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var c *ldap.Conn
+	switch u.Scheme {
+	case "ldap":
+		if !conf.StartTLS && !conf.AllowPlaintext {
+			return nil, errPlaintextBind
+		}
+		var netConn net.Conn
+		netConn, err = dialer.Dial("tcp", hostPort(u.Host, "389"))
+		if err != nil {
+			return nil, err
+		}
+		c = ldap.NewConn(netConn, false)
+	case "ldaps":
+		var netConn net.Conn
+		netConn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u.Host, "636"), tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		c = ldap.NewConn(netConn, true)
+	default:
+		return nil, errors.Errorf("invalid ldap url %q: scheme must be ldap or ldaps", conf.URL)
+	}
+	c.Start()
+	c.SetTimeout(timeout)
+	if u.Scheme == "ldap" && conf.StartTLS {
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			c.Close()
+			return nil, errors.Wrap(err, "unable to start tls")
+		}
+	}
+	return &conn{conn: c}, nil
+}
+
+func hostPort(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// bind authenticates the connection with a simple bind. Empty passwords are
+// refused by the client, as servers accept them as unauthenticated binds.
+func (c *conn) bind(dn, password string) error {
+	err := c.conn.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return errInvalidCredentials
+	}
+	return err
+}
+
+// search returns the entries in the subtree of base having attribute equal
+// to value, with the given attributes. Referrals are ignored.
+func (c *conn) search(base, attribute, value string, attributes []string) ([]entry, error) {
+	filter := fmt.Sprintf("(%s=%s)", ldap.EscapeFilter(attribute), ldap.EscapeFilter(value))
+	result, err := c.conn.Search(ldap.NewSearchRequest(
+		base, ldap.ScopeWholeSubtree, ldap.DerefAlways, 0, 0, false, filter, attributes, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, len(result.Entries))
+	for i, e := range result.Entries {
+		entries[i] = entry{dn: e.DN, attributes: map[string][]string{}}
+		for _, attr := range e.Attributes {
+			name := strings.ToLower(attr.Name)
+			entries[i].attributes[name] = append(entries[i].attributes[name], attr.Values...)
+		}
+	}
+	return entries, nil
+}
+
+// close closes the connection.
+func (c *conn) close() {
+	c.conn.Close()
+}
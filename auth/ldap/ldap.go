@@ -0,0 +1,287 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ldap implements an auth scheme authenticating users against an LDAP
+// directory, binding as the user and mapping the groups the user is a member
+// of to tsuru roles. Tokens are handled the same way as in the native scheme.
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+var (
+	ErrMissingEmailError    = &tsuruErrors.ValidationError{Message: "you must provide a email to login"}
+	ErrMissingPasswordError = &tsuruErrors.ValidationError{Message: "you must provide a password to login"}
+	ErrEmptyUserEmail       = &tsuruErrors.NotAuthorizedError{Message: "Couldn't find user email in the directory."}
+
+	errAuthenticationFailed = auth.AuthenticationFailure{Message: "Authentication failed, wrong email or password."}
+)
+
+const defaultTimeout = 10 * time.Second
+
+// BaseConfig is the configuration of the scheme, loaded from the auth:ldap
+// config.
+type BaseConfig struct {
+	URL                  string
+	BindDN               string
+	BindPassword         string
+	UserBaseDN           string
+	UserAttribute        string
+	EmailAttribute       string
+	GroupBaseDN          string
+	GroupMemberAttribute string
+	GroupNameAttribute   string
+	Timeout              time.Duration
+	TLSConfig            *tls.Config
+	StartTLS             bool
+	AllowPlaintext       bool
+}
+
+type LDAPScheme struct {
+	BaseConfig BaseConfig
+}
+
+func init() {
+	auth.RegisterScheme("ldap", &LDAPScheme{})
+}
+
+// This method loads basic config and returns a copy of the config object.
+func (s *LDAPScheme) loadConfig() (BaseConfig, error) {
+	if s.BaseConfig.URL != "" {
+		return s.BaseConfig, nil
+	}
+	var emptyConfig BaseConfig
+	url, err := config.GetString("auth:ldap:url")
+	if err != nil {
+		return emptyConfig, err
+	}
+	userBaseDN, err := config.GetString("auth:ldap:user-base-dn")
+	if err != nil {
+		return emptyConfig, err
+	}
+	bindDN, _ := config.GetString("auth:ldap:bind-dn")
+	bindPassword, _ := config.GetString("auth:ldap:bind-password")
+	userAttribute, err := config.GetString("auth:ldap:user-attribute")
+	if err != nil {
+		userAttribute = "mail"
+	}
+	emailAttribute, err := config.GetString("auth:ldap:email-attribute")
+	if err != nil {
+		emailAttribute = "mail"
+	}
+	groupBaseDN, _ := config.GetString("auth:ldap:group-base-dn")
+	groupMemberAttribute, err := config.GetString("auth:ldap:group-member-attribute")
+	if err != nil {
+		groupMemberAttribute = "member"
+	}
+	groupNameAttribute, err := config.GetString("auth:ldap:group-name-attribute")
+	if err != nil {
+		groupNameAttribute = "cn"
+	}
+	timeout := defaultTimeout
+	if seconds, err := config.GetFloat("auth:ldap:timeout"); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	var tlsConfig *tls.Config
+	if caFile, err := config.GetString("auth:ldap:ca-file"); err == nil {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return emptyConfig, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return emptyConfig, errors.Errorf("no certificates found in auth:ldap:ca-file %q", caFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+	startTLS, _ := config.GetBool("auth:ldap:start-tls")
+	allowPlaintext, _ := config.GetBool("auth:ldap:allow-plaintext")
+	s.BaseConfig = BaseConfig{
+		URL:                  url,
+		BindDN:               bindDN,
+		BindPassword:         bindPassword,
+		UserBaseDN:           userBaseDN,
+		UserAttribute:        userAttribute,
+		EmailAttribute:       emailAttribute,
+		GroupBaseDN:          groupBaseDN,
+		GroupMemberAttribute: groupMemberAttribute,
+		GroupNameAttribute:   groupNameAttribute,
+		Timeout:              timeout,
+		TLSConfig:            tlsConfig,
+		StartTLS:             startTLS,
+		AllowPlaintext:       allowPlaintext,
+	}
+	return s.BaseConfig, nil
+}
+
+// connect opens a connection to the directory, bound with the configured
+// service account or anonymous when there's none.
+func connect(conf BaseConfig) (*conn, error) {
+	c, err := dial(conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.BindDN != "" {
+		err = c.bind(conf.BindDN, conf.BindPassword)
+		if err != nil {
+			c.close()
+			return nil, errors.Wrap(err, "unable to bind with auth:ldap:bind-dn")
+		}
+	}
+	return c, nil
+}
+
+// findUser returns the entry of the user whose attribute has the given
+// value, or nil if there's no single such entry.
+func findUser(c *conn, conf BaseConfig, attribute, value string) (*entry, error) {
+	entries, err := c.search(conf.UserBaseDN, attribute, value, []string{conf.EmailAttribute})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// userGroups returns the names of the groups having the user DN as member.
+func userGroups(c *conn, conf BaseConfig, userDN string) ([]string, error) {
+	if conf.GroupBaseDN == "" {
+		return nil, nil
+	}
+	entries, err := c.search(conf.GroupBaseDN, conf.GroupMemberAttribute, userDN, []string{conf.GroupNameAttribute})
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if name := e.get(conf.GroupNameAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+func (s *LDAPScheme) Login(params map[string]string) (auth.Token, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	login := params["email"]
+	if login == "" {
+		return nil, ErrMissingEmailError
+	}
+	password := params["password"]
+	if password == "" {
+		return nil, ErrMissingPasswordError
+	}
+	c, err := connect(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	userEntry, err := findUser(c, conf, conf.UserAttribute, login)
+	if err != nil {
+		return nil, err
+	}
+	if userEntry == nil {
+		return nil, errAuthenticationFailed
+	}
+	err = c.bind(userEntry.dn, password)
+	if err == errInvalidCredentials {
+		return nil, errAuthenticationFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conf.BindDN != "" {
+		err = c.bind(conf.BindDN, conf.BindPassword)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to bind with auth:ldap:bind-dn")
+		}
+	}
+	email := userEntry.get(conf.EmailAttribute)
+	if email == "" {
+		return nil, ErrEmptyUserEmail
+	}
+	groups, err := userGroups(c, conf, userEntry.dn)
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user = &auth.User{Email: email}
+		err = user.Create()
+		if err != nil {
+			return nil, err
+		}
+	}
+	roles, err := auth.GroupRoles("auth:ldap", groups)
+	if err != nil {
+		return nil, err
+	}
+	err = user.SyncGroupRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	return native.CreateUserToken(user)
+}
+
+func (s *LDAPScheme) AppLogin(appName string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogin(appName)
+}
+
+func (s *LDAPScheme) AppLogout(token string) error {
+	return s.Logout(token)
+}
+
+func (s *LDAPScheme) Logout(token string) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Logout(token)
+}
+
+func (s *LDAPScheme) Auth(token string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Auth(token)
+}
+
+func (s *LDAPScheme) Name() string {
+	return "ldap"
+}
+
+func (s *LDAPScheme) Info() (auth.SchemeInfo, error) {
+	return nil, nil
+}
+
+func (s *LDAPScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	err := user.Create()
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *LDAPScheme) Remove(u *auth.User) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Remove(u)
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogin(c *check.C) {
+	scheme := LDAPScheme{}
+	token, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "rand@althor.com")
+	c.Assert(token.IsAppToken(), check.Equals, false)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Email, check.Equals, "rand@althor.com")
+	c.Assert(u.Password, check.Equals, "")
+	authToken, err := scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestLoginUserAttribute(c *check.C) {
+	config.Set("auth:ldap:user-attribute", "uid")
+	defer config.Unset("auth:ldap:user-attribute")
+	scheme := LDAPScheme{}
+	token, err := scheme.Login(map[string]string{"email": "rand", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestLoginWrongPassword(c *check.C) {
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "654321"})
+	c.Assert(err, check.Equals, errAuthenticationFailed)
+	_, err = auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginEmptyPassword(c *check.C) {
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": ""})
+	c.Assert(err, check.Equals, ErrMissingPasswordError)
+	_, err = scheme.Login(map[string]string{"email": "rand@althor.com"})
+	c.Assert(err, check.Equals, ErrMissingPasswordError)
+}
+
+func (s *S) TestLoginWithoutEmail(c *check.C) {
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"password": "123456"})
+	c.Assert(err, check.Equals, ErrMissingEmailError)
+}
+
+func (s *S) TestLoginUnknownUser(c *check.C) {
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "unknown@althor.com", "password": "123456"})
+	c.Assert(err, check.Equals, errAuthenticationFailed)
+}
+
+func (s *S) TestLoginWrongBindPassword(c *check.C) {
+	config.Set("auth:ldap:bind-password", "wrong")
+	defer config.Set("auth:ldap:bind-password", "secret")
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.ErrorMatches, "unable to bind with auth:ldap:bind-dn: invalid credentials")
+}
+
+func (s *S) TestLoginRefusesPlaintext(c *check.C) {
+	config.Set("auth:ldap:allow-plaintext", false)
+	defer config.Set("auth:ldap:allow-plaintext", true)
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.Equals, errPlaintextBind)
+	_, err = auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginWithoutEmailAttribute(c *check.C) {
+	config.Set("auth:ldap:user-attribute", "uid")
+	defer config.Unset("auth:ldap:user-attribute")
+	s.server.setAttribute("uid=rand,ou=people,dc=example,dc=com", "mail")
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand", "password": "123456"})
+	c.Assert(err, check.Equals, ErrEmptyUserEmail)
+}
+
+func (s *S) setGroupRoles(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("pool-admin", "pool", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("manual", "global", "")
+	c.Assert(err, check.IsNil)
+	config.Set("auth:ldap:team-role", "team-member")
+	config.Set("auth:ldap:groups", map[interface{}]interface{}{
+		"developers": map[interface{}]interface{}{
+			"teams": []interface{}{"team1"},
+		},
+		"ops": map[interface{}]interface{}{
+			"roles": []interface{}{
+				map[interface{}]interface{}{"name": "pool-admin", "context": "pool1"},
+			},
+		},
+	})
+}
+
+func (s *S) TestLoginGroupRoles(c *check.C) {
+	s.setGroupRoles(c)
+	defer config.Unset("auth:ldap:team-role")
+	defer config.Unset("auth:ldap:groups")
+	u := &auth.User{Email: "rand@althor.com"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	scheme := LDAPScheme{}
+	_, err = scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "manual"},
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "pool-admin", ContextValue: "pool1"},
+	})
+	s.server.setAttribute("cn=ops,ou=groups,dc=example,dc=com", "member")
+	_, err = scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "manual"},
+		{Name: "team-member", ContextValue: "team1"},
+	})
+}
+
+func (s *S) TestLogout(c *check.C) {
+	scheme := LDAPScheme{}
+	token, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	err = scheme.Logout(token.GetValue())
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestRemove(c *check.C) {
+	scheme := LDAPScheme{}
+	token, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = scheme.Remove(u)
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	_, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestResync(c *check.C) {
+	s.setGroupRoles(c)
+	defer config.Unset("auth:ldap:team-role")
+	defer config.Unset("auth:ldap:groups")
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Login(map[string]string{"email": "mat@althor.com", "password": "654321"})
+	c.Assert(err, check.IsNil)
+	s.server.setAttribute("cn=ops,ou=groups,dc=example,dc=com", "member", "uid=mat,ou=people,dc=example,dc=com")
+	s.server.remove("uid=rand,ou=people,dc=example,dc=com")
+	r := &Resyncer{scheme: &LDAPScheme{}}
+	err = r.resync()
+	c.Assert(err, check.IsNil)
+	u, err := auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 0)
+	u, err = auth.GetUserByEmail("mat@althor.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "pool-admin", ContextValue: "pool1"},
+	})
+}
+
+func (s *S) TestResyncSearchError(c *check.C) {
+	s.setGroupRoles(c)
+	defer config.Unset("auth:ldap:team-role")
+	defer config.Unset("auth:ldap:groups")
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Login(map[string]string{"email": "mat@althor.com", "password": "654321"})
+	c.Assert(err, check.IsNil)
+	s.server.setAttribute("cn=ops,ou=groups,dc=example,dc=com", "member", "uid=mat,ou=people,dc=example,dc=com")
+	s.server.fail("rand@althor.com")
+	r := &Resyncer{scheme: &LDAPScheme{}}
+	err = r.resync()
+	c.Assert(err, check.IsNil)
+	u, err := auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 2)
+	u, err = auth.GetUserByEmail("mat@althor.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "pool-admin", ContextValue: "pool1"},
+	})
+}
+
+func (s *S) TestResyncDirectoryUnavailable(c *check.C) {
+	s.setGroupRoles(c)
+	defer config.Unset("auth:ldap:team-role")
+	defer config.Unset("auth:ldap:groups")
+	scheme := LDAPScheme{}
+	_, err := scheme.Login(map[string]string{"email": "rand@althor.com", "password": "123456"})
+	c.Assert(err, check.IsNil)
+	r := &Resyncer{scheme: &LDAPScheme{BaseConfig: BaseConfig{URL: "ldap://127.0.0.1:1", AllowPlaintext: true}}}
+	err = r.resync()
+	c.Assert(err, check.NotNil)
+	u, err := auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 2)
+}
+
+func (s *S) TestInitializeResyncOtherScheme(c *check.C) {
+	config.Set("auth:scheme", "native")
+	defer config.Unset("auth:scheme")
+	config.Set("auth:ldap:resync-interval", 60)
+	defer config.Unset("auth:ldap:resync-interval")
+	globalResyncer = nil
+	err := InitializeResync()
+	c.Assert(err, check.IsNil)
+	c.Assert(globalResyncer, check.IsNil)
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/log"
+)
+
+var globalResyncer *Resyncer
+
+// Resyncer periodically looks up the groups of every tsuru user in the
+// directory, updating the roles mapped from them, so that changes in group
+// membership are applied without waiting for users to log in again. Users
+// no longer found in the directory lose the roles mapped from groups.
+type Resyncer struct {
+	Interval time.Duration
+	scheme   *LDAPScheme
+	done     chan bool
+	running  bool
+}
+
+// InitializeResync starts the group resync worker. The worker is only
+// started when ldap is the auth scheme and the auth:ldap:resync-interval
+// config is set.
+func InitializeResync() error {
+	if scheme, _ := config.GetString("auth:scheme"); scheme != "ldap" {
+		return nil
+	}
+	interval, _ := config.GetInt("auth:ldap:resync-interval")
+	if interval <= 0 {
+		return nil
+	}
+	globalResyncer = &Resyncer{
+		Interval: time.Duration(interval) * time.Second,
+		scheme:   &LDAPScheme{},
+		done:     make(chan bool),
+	}
+	shutdown.Register(globalResyncer)
+	globalResyncer.running = true
+	go globalResyncer.run()
+	return nil
+}
+
+func (r *Resyncer) run() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.Interval):
+		}
+		err := r.resync()
+		if err != nil {
+			r.logError(err.Error())
+		}
+	}
+}
+
+func (r *Resyncer) logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[ldap resync] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func (r *Resyncer) Shutdown(ctx context.Context) error {
+	if !r.running {
+		return nil
+	}
+	r.done <- true
+	r.running = false
+	return nil
+}
+
+func (r *Resyncer) String() string {
+	return "ldap group resync"
+}
+
+func (r *Resyncer) resync() (retErr error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", rec)
+		}
+	}()
+	conf, err := r.scheme.loadConfig()
+	if err != nil {
+		return err
+	}
+	users, err := auth.ListUsers()
+	if err != nil {
+		return errors.Wrap(err, "unable to list users")
+	}
+	c, err := connect(conf)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	for i := range users {
+		u := &users[i]
+		if u.IsServiceAccount() {
+			continue
+		}
+		userEntry, err := findUser(c, conf, conf.EmailAttribute, u.Email)
+		if err != nil {
+			r.logError("unable to find user %q: %s", u.Email, err)
+			continue
+		}
+		var groups []string
+		if userEntry != nil {
+			groups, err = userGroups(c, conf, userEntry.dn)
+			if err != nil {
+				r.logError("unable to find groups of user %q: %s", u.Email, err)
+				continue
+			}
+		}
+		roles, err := auth.GroupRoles("auth:ldap", groups)
+		if err != nil {
+			return err
+		}
+		err = u.SyncGroupRoles(roles)
+		if err != nil {
+			r.logError("unable to sync roles of user %q: %s", u.Email, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	ber "gopkg.in/asn1-ber.v1"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn   *db.Storage
+	server *directory
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.server, err = newDirectory()
+	c.Assert(err, check.IsNil)
+	config.Set("auth:ldap:url", "ldap://"+s.server.listener.Addr().String())
+	config.Set("auth:ldap:allow-plaintext", true)
+	config.Set("auth:ldap:bind-dn", "cn=tsuru,dc=example,dc=com")
+	config.Set("auth:ldap:bind-password", "secret")
+	config.Set("auth:ldap:user-base-dn", "ou=people,dc=example,dc=com")
+	config.Set("auth:ldap:group-base-dn", "ou=groups,dc=example,dc=com")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_ldap_test")
+	config.Set("auth:user-registration", true)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	s.server.reset()
+	s.server.add("cn=tsuru,dc=example,dc=com", "secret", nil)
+	s.server.add("uid=rand,ou=people,dc=example,dc=com", "123456", map[string][]string{
+		"uid":  {"rand"},
+		"mail": {"rand@althor.com"},
+	})
+	s.server.add("uid=mat,ou=people,dc=example,dc=com", "654321", map[string][]string{
+		"uid":  {"mat"},
+		"mail": {"mat@althor.com"},
+	})
+	s.server.add("cn=developers,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"cn":     {"developers"},
+		"member": {"uid=rand,ou=people,dc=example,dc=com", "uid=mat,ou=people,dc=example,dc=com"},
+	})
+	s.server.add("cn=ops,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"cn":     {"ops"},
+		"member": {"uid=rand,ou=people,dc=example,dc=com"},
+	})
+	repositorytest.Reset()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.server.listener.Close()
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
+
+// directory is an in-process stand-in LDAP server, answering simple binds
+// and subtree searches with equality filters from in-memory entries. Like
+// real servers, it accepts binds with empty passwords as unauthenticated.
+type directory struct {
+	listener  net.Listener
+	mu        sync.Mutex
+	entries   []entry
+	passwords map[string]string
+	failing   map[string]bool
+}
+
+func newDirectory() (*directory, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	d := &directory{listener: l}
+	d.reset()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.handle(c)
+		}
+	}()
+	return d, nil
+}
+
+func (d *directory) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = nil
+	d.passwords = map[string]string{}
+	d.failing = map[string]bool{}
+}
+
+func (d *directory) add(dn, password string, attributes map[string][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if password != "" {
+		d.passwords[dn] = password
+	}
+	d.entries = append(d.entries, entry{dn: dn, attributes: attributes})
+}
+
+func (d *directory) remove(dn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, e := range d.entries {
+		if e.dn == dn {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *directory) setAttribute(dn, attribute string, values ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.entries {
+		if e.dn == dn {
+			e.attributes[attribute] = values
+		}
+	}
+}
+
+// Protocol operations and result codes of LDAPv3 (RFC 4511) answered by the
+// directory.
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+	resultOther              = 80
+)
+
+// fail makes searches filtering by the given value return an error.
+func (d *directory) fail(value string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failing[value] = true
+}
+
+func (d *directory) handle(c net.Conn) {
+	defer c.Close()
+	for {
+		msg, err := ber.ReadPacket(c)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		msgID := msg.Children[0].Value
+		op := msg.Children[1]
+		if op.ClassType != ber.ClassApplication {
+			return
+		}
+		var responses []*ber.Packet
+		switch op.Tag {
+		case opBindRequest:
+			responses = append(responses, d.bind(op))
+		case opSearchRequest:
+			responses = d.search(op)
+		default:
+			return
+		}
+		for _, rsp := range responses {
+			envelope := ber.NewSequence("")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, ""))
+			envelope.AppendChild(rsp)
+			_, err = c.Write(envelope.Bytes())
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func ldapResult(op ber.Tag, code int64) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return p
+}
+
+func (d *directory) bind(op *ber.Packet) *ber.Packet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	if password == "" || d.passwords[dn] == password {
+		return ldapResult(opBindResponse, resultSuccess)
+	}
+	return ldapResult(opBindResponse, resultInvalidCredentials)
+}
+
+func (d *directory) search(op *ber.Packet) []*ber.Packet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	base := strings.ToLower(op.Children[0].Data.String())
+	filter := op.Children[6]
+	attribute, value := filter.Children[0].Data.String(), filter.Children[1].Data.String()
+	if d.failing[value] {
+		return []*ber.Packet{ldapResult(opSearchResultDone, resultOther)}
+	}
+	var responses []*ber.Packet
+	for _, e := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), base) || !hasValue(e.attributes[attribute], value) {
+			continue
+		}
+		rsp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "")
+		rsp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+		attrs := ber.NewSequence("")
+		for _, a := range op.Children[7].Children {
+			name := a.Data.String()
+			attr := ber.NewSequence("")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, v := range e.attributes[name] {
+				values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+			}
+			attr.AppendChild(values)
+			attrs.AppendChild(attr)
+		}
+		rsp.AppendChild(attrs)
+		responses = append(responses, rsp)
+	}
+	return append(responses, ldapResult(opSearchResultDone, resultSuccess))
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LockoutKindEmail = "email"
+	LockoutKindIP    = "ip"
+)
+
+var ErrLockoutNotFound = errors.New("lockout not found")
+
+// Lockout holds the failed logins for an email or a client IP. Logins are
+// refused until LockedUntil.
+type Lockout struct {
+	Kind        string    `json:"kind"`
+	Value       string    `json:"value"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LockoutScheme is implemented by schemes locking logins out after too many
+// failed attempts.
+type LockoutScheme interface {
+	Scheme
+	ListLockouts() ([]Lockout, error)
+	Unlock(kind, value string) error
+}
+
+// ErrLoginLocked is returned on logins attempted while locked out.
+type ErrLoginLocked struct {
+	Until time.Time
+}
+
+func (e *ErrLoginLocked) Error() string {
+	wait := time.Until(e.Until)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("Too many failed login attempts, try again in %s.", wait.Round(time.Second))
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLockoutMaxAttempts   = 5
+	defaultLockoutIPMaxAttempts = 20
+	defaultLockoutDuration      = time.Minute
+	defaultLockoutMaxDuration   = time.Hour
+)
+
+var ErrInvalidLockoutKind = &errors.ValidationError{Message: "lockout kind must be either email or ip"}
+
+// loginFailure counts the failed logins of an email or a client IP. It's
+// stored in the database so every API instance shares the counters.
+type loginFailure struct {
+	ID          string `bson:"_id"`
+	Kind        string
+	Value       string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+type lockoutConfig struct {
+	MaxAttempts   int
+	IPMaxAttempts int
+	Duration      time.Duration
+	MaxDuration   time.Duration
+}
+
+func loadLockoutConfig() lockoutConfig {
+	cfg := lockoutConfig{
+		MaxAttempts:   defaultLockoutMaxAttempts,
+		IPMaxAttempts: defaultLockoutIPMaxAttempts,
+		Duration:      defaultLockoutDuration,
+		MaxDuration:   defaultLockoutMaxDuration,
+	}
+	if v, err := config.GetInt("auth:lockout:max-attempts"); err == nil {
+		cfg.MaxAttempts = v
+	}
+	if v, err := config.GetInt("auth:lockout:ip-max-attempts"); err == nil {
+		cfg.IPMaxAttempts = v
+	}
+	if v, err := config.GetInt("auth:lockout:duration"); err == nil && v > 0 {
+		cfg.Duration = time.Duration(v) * time.Second
+	}
+	if v, err := config.GetInt("auth:lockout:max-duration"); err == nil && v > 0 {
+		cfg.MaxDuration = time.Duration(v) * time.Second
+	}
+	if cfg.MaxDuration < cfg.Duration {
+		cfg.MaxDuration = cfg.Duration
+	}
+	return cfg
+}
+
+func (cfg lockoutConfig) maxAttempts(kind string) int {
+	if kind == auth.LockoutKindIP {
+		return cfg.IPMaxAttempts
+	}
+	return cfg.MaxAttempts
+}
+
+// lockDuration doubles the lock duration for each failure after the maximum
+// attempts, up to the maximum duration.
+func (cfg lockoutConfig) lockDuration(failures, maxAttempts int) time.Duration {
+	duration := cfg.Duration
+	for i := maxAttempts; i < failures && duration < cfg.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > cfg.MaxDuration {
+		duration = cfg.MaxDuration
+	}
+	return duration
+}
+
+func loginFailuresCollection(conn *db.Storage) *storage.Collection {
+	return conn.Collection("login_failures")
+}
+
+func lockoutID(kind, value string) string {
+	return kind + ":" + value
+}
+
+// checkLockout returns auth.ErrLoginLocked when logins for the email or the
+// client IP are locked out.
+func checkLockout(kind, value string) error {
+	if value == "" {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var failure loginFailure
+	err = loginFailuresCollection(conn).FindId(lockoutID(kind, value)).One(&failure)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if failure.LockedUntil.After(time.Now()) {
+		return &auth.ErrLoginLocked{Until: failure.LockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure increments the failures of the email or the client IP,
+// locking logins out once the maximum attempts is reached. Failures older
+// than the maximum lock duration are forgotten.
+func recordLoginFailure(kind, value string) error {
+	cfg := loadLockoutConfig()
+	maxAttempts := cfg.maxAttempts(kind)
+	if value == "" || maxAttempts <= 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := loginFailuresCollection(conn)
+	id := lockoutID(kind, value)
+	now := time.Now().UTC()
+	_, err = coll.RemoveAll(bson.M{"_id": id, "lastfailure": bson.M{"$lt": now.Add(-cfg.MaxDuration)}})
+	if err != nil {
+		return err
+	}
+	var failure loginFailure
+	_, err = coll.FindId(id).Apply(mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"kind": kind, "value": value, "lastfailure": now},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &failure)
+	if err != nil {
+		return err
+	}
+	if failure.Failures < maxAttempts {
+		return nil
+	}
+	lockedUntil := now.Add(cfg.lockDuration(failure.Failures, maxAttempts))
+	return coll.UpdateId(id, bson.M{"$set": bson.M{"lockeduntil": lockedUntil}})
+}
+
+func resetLoginFailures(kind, value string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = loginFailuresCollection(conn).RemoveId(lockoutID(kind, value))
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func checkLoginLockouts(email, ip string) error {
+	err := checkLockout(auth.LockoutKindEmail, email)
+	if err != nil {
+		return err
+	}
+	return checkLockout(auth.LockoutKindIP, ip)
+}
+
+func recordLoginFailures(email, ip string) {
+	if email != "" {
+		if err := recordLoginFailure(auth.LockoutKindEmail, email); err != nil {
+			log.Errorf("Failed to record failed login for email %q: %s", email, err)
+		}
+	}
+	if err := recordLoginFailure(auth.LockoutKindIP, ip); err != nil {
+		log.Errorf("Failed to record failed login for ip %q: %s", ip, err)
+	}
+}
+
+// ListLockouts returns the emails and client IPs currently locked out.
+func (s NativeScheme) ListLockouts() ([]auth.Lockout, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var failures []loginFailure
+	err = loginFailuresCollection(conn).Find(bson.M{
+		"lockeduntil": bson.M{"$gt": time.Now().UTC()},
+	}).Sort("kind", "value").All(&failures)
+	if err != nil {
+		return nil, err
+	}
+	lockouts := make([]auth.Lockout, len(failures))
+	for i, f := range failures {
+		lockouts[i] = auth.Lockout{
+			Kind:        f.Kind,
+			Value:       f.Value,
+			Failures:    f.Failures,
+			LastFailure: f.LastFailure,
+			LockedUntil: f.LockedUntil,
+		}
+	}
+	return lockouts, nil
+}
+
+// Unlock resets the failed logins of an email or a client IP.
+func (s NativeScheme) Unlock(kind, value string) error {
+	if kind != auth.LockoutKindEmail && kind != auth.LockoutKindIP {
+		return ErrInvalidLockoutKind
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = loginFailuresCollection(conn).RemoveId(lockoutID(kind, value))
+	if err == mgo.ErrNotFound {
+		return auth.ErrLockoutNotFound
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestLockDuration(c *check.C) {
+	cfg := lockoutConfig{Duration: time.Minute, MaxDuration: 10 * time.Minute}
+	c.Assert(cfg.lockDuration(5, 5), check.Equals, time.Minute)
+	c.Assert(cfg.lockDuration(6, 5), check.Equals, 2*time.Minute)
+	c.Assert(cfg.lockDuration(8, 5), check.Equals, 8*time.Minute)
+	c.Assert(cfg.lockDuration(9, 5), check.Equals, 10*time.Minute)
+	c.Assert(cfg.lockDuration(500, 5), check.Equals, 10*time.Minute)
+}
+
+func (s *S) TestLoginLockoutByEmail(c *check.C) {
+	config.Set("auth:lockout:max-attempts", 3)
+	defer config.Unset("auth:lockout:max-attempts")
+	params := map[string]string{"email": s.user.Email, "password": "wrong1", "ip": "10.0.0.1"}
+	for i := 0; i < 3; i++ {
+		_, err := nativeScheme.Login(params)
+		c.Assert(err, check.FitsTypeOf, auth.AuthenticationFailure{})
+	}
+	params["password"] = "123456"
+	_, err := nativeScheme.Login(params)
+	locked, ok := err.(*auth.ErrLoginLocked)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(locked.Until.After(time.Now()), check.Equals, true)
+	lockouts, err := nativeScheme.ListLockouts()
+	c.Assert(err, check.IsNil)
+	c.Assert(lockouts, check.HasLen, 1)
+	c.Assert(lockouts[0].Kind, check.Equals, auth.LockoutKindEmail)
+	c.Assert(lockouts[0].Value, check.Equals, s.user.Email)
+	c.Assert(lockouts[0].Failures, check.Equals, 3)
+	err = nativeScheme.Unlock(auth.LockoutKindEmail, s.user.Email)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = nativeScheme.Unlock(auth.LockoutKindEmail, s.user.Email)
+	c.Assert(err, check.Equals, auth.ErrLockoutNotFound)
+}
+
+func (s *S) TestLoginLockoutByIP(c *check.C) {
+	config.Set("auth:lockout:ip-max-attempts", 2)
+	defer config.Unset("auth:lockout:ip-max-attempts")
+	_, err := nativeScheme.Login(map[string]string{"email": "unknown@globo.com", "password": "123456", "ip": "10.0.0.1"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "wrong1", "ip": "10.0.0.1"})
+	c.Assert(err, check.FitsTypeOf, auth.AuthenticationFailure{})
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "ip": "10.0.0.1"})
+	c.Assert(err, check.FitsTypeOf, &auth.ErrLoginLocked{})
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456", "ip": "10.0.0.2"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestLoginLockoutResetOnSuccess(c *check.C) {
+	config.Set("auth:lockout:max-attempts", 2)
+	defer config.Unset("auth:lockout:max-attempts")
+	params := map[string]string{"email": s.user.Email, "password": "wrong1"}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.NotNil)
+	params["password"] = "123456"
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	params["password"] = "wrong1"
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.FitsTypeOf, auth.AuthenticationFailure{})
+	params["password"] = "123456"
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestLoginLockoutDisabled(c *check.C) {
+	config.Set("auth:lockout:max-attempts", 0)
+	defer config.Unset("auth:lockout:max-attempts")
+	params := map[string]string{"email": s.user.Email, "password": "wrong1"}
+	for i := 0; i < defaultLockoutMaxAttempts+1; i++ {
+		_, err := nativeScheme.Login(params)
+		c.Assert(err, check.FitsTypeOf, auth.AuthenticationFailure{})
+	}
+}
+
+func (s *S) TestLoginLockoutExpiredFailures(c *check.C) {
+	config.Set("auth:lockout:max-attempts", 2)
+	defer config.Unset("auth:lockout:max-attempts")
+	params := map[string]string{"email": s.user.Email, "password": "wrong1"}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.NotNil)
+	err = s.conn.Collection("login_failures").UpdateId(lockoutID(auth.LockoutKindEmail, s.user.Email), bson.M{
+		"$set": bson.M{"lastfailure": time.Now().Add(-2 * defaultLockoutMaxDuration)},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.FitsTypeOf, auth.AuthenticationFailure{})
+	params["password"] = "123456"
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUnlockInvalidKind(c *check.C) {
+	err := nativeScheme.Unlock("team", "cobrateam")
+	c.Assert(err, check.Equals, ErrInvalidLockoutKind)
+}
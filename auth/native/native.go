@@ -8,6 +8,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/validation"
 )
 
@@ -35,14 +36,27 @@ func (s NativeScheme) Login(params map[string]string) (auth.Token, error) {
 	if !ok {
 		return nil, ErrMissingPasswordError
 	}
+	ip := params["ip"]
+	if err := checkLoginLockouts(email, ip); err != nil {
+		return nil, err
+	}
 	user, err := auth.GetUserByEmail(email)
 	if err != nil {
+		if err == auth.ErrUserNotFound {
+			recordLoginFailures("", ip)
+		}
 		return nil, err
 	}
-	token, err := createToken(user, password)
+	token, err := createToken(user, password, params["otp"])
 	if err != nil {
+		if _, ok := err.(auth.AuthenticationFailure); ok && err != auth.ErrTwoFactorCodeRequired {
+			recordLoginFailures(email, ip)
+		}
 		return nil, err
 	}
+	if err = resetLoginFailures(auth.LockoutKindEmail, email); err != nil {
+		log.Errorf("Failed to reset failed logins for email %q: %s", email, err)
+	}
 	return token, nil
 }
 
@@ -66,8 +80,8 @@ func (s NativeScheme) Create(user *auth.User) (*auth.User, error) {
 	if !validation.ValidateEmail(user.Email) {
 		return nil, ErrInvalidEmail
 	}
-	if !validation.ValidateLength(user.Password, passwordMinLen, passwordMaxLen) {
-		return nil, ErrInvalidPassword
+	if err := loadPasswordPolicy().validate(user.Password); err != nil {
+		return nil, err
 	}
 	if _, err := auth.GetUserByEmail(user.Email); err == nil {
 		return nil, ErrEmailRegistered
@@ -89,12 +103,20 @@ func (s NativeScheme) ChangePassword(token auth.Token, oldPassword string, newPa
 	if err = checkPassword(user.Password, oldPassword); err != nil {
 		return ErrPasswordMismatch
 	}
-	if !validation.ValidateLength(newPassword, passwordMinLen, passwordMaxLen) {
-		return ErrInvalidPassword
+	policy := loadPasswordPolicy()
+	if err = policy.validate(newPassword); err != nil {
+		return err
+	}
+	if err = policy.checkHistory(user, newPassword); err != nil {
+		return err
 	}
+	oldHash := user.Password
 	user.Password = newPassword
 	hashPassword(user)
-	return user.Update()
+	if err = user.Update(); err != nil {
+		return err
+	}
+	return policy.recordPasswordHistory(user.Email, oldHash)
 }
 
 func (s NativeScheme) StartPasswordReset(user *auth.User) error {
@@ -125,13 +147,18 @@ func (s NativeScheme) ResetPassword(user *auth.User, resetToken string) error {
 	if passToken.UserEmail != user.Email {
 		return auth.ErrInvalidToken
 	}
-	password := generatePassword(12)
+	policy := loadPasswordPolicy()
+	password := policy.generateValidPassword()
+	oldHash := user.Password
 	user.Password = password
 	hashPassword(user)
 	go sendNewPassword(user, password)
 	passToken.Used = true
 	conn.PasswordTokens().UpdateId(passToken.Token, passToken)
-	return user.Update()
+	if err = user.Update(); err != nil {
+		return err
+	}
+	return policy.recordPasswordHistory(user.Email, oldHash)
 }
 
 func (s NativeScheme) Remove(u *auth.User) error {
@@ -139,6 +166,18 @@ func (s NativeScheme) Remove(u *auth.User) error {
 	if err != nil {
 		return err
 	}
+	err = removeTwoFactor(u.Email)
+	if err != nil {
+		return err
+	}
+	err = removePasswordHistory(u.Email)
+	if err != nil {
+		return err
+	}
+	err = resetLoginFailures(auth.LockoutKindEmail, u.Email)
+	if err != nil {
+		return err
+	}
 	return u.Delete()
 }
 
@@ -67,6 +67,19 @@ func (s *S) TestNativeLoginInvalidUser(c *check.C) {
 	c.Assert(err, check.Equals, auth.ErrUserNotFound)
 }
 
+func (s *S) TestNativeLoginServiceAccount(c *check.C) {
+	u, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	u.Password = "123456"
+	err = hashPassword(u)
+	c.Assert(err, check.IsNil)
+	err = u.Update()
+	c.Assert(err, check.IsNil)
+	scheme := NativeScheme{}
+	_, err = scheme.Login(map[string]string{"email": u.Email, "password": "123456"})
+	c.Assert(err, check.Equals, auth.ErrServiceAccountLogin)
+}
+
 func (s *S) TestNativeCreateNoPassword(c *check.C) {
 	scheme := NativeScheme{}
 	user := &auth.User{Email: "x@x.com"}
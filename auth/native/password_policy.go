@@ -0,0 +1,175 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/validation"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	generatedPasswordLen = 12
+	characterClassesMax  = 4
+)
+
+var ErrPasswordReused = &tsuruErrors.ValidationError{Message: "the password was used recently, choose a different one"}
+
+// passwordPolicy holds the rules for new passwords: a minimum length, a
+// minimum number of character classes (lower case and upper case letters,
+// digits and symbols) and how many previous passwords can't be reused,
+// including the current one.
+type passwordPolicy struct {
+	MinLength        int
+	CharacterClasses int
+	History          int
+}
+
+func loadPasswordPolicy() passwordPolicy {
+	p := passwordPolicy{MinLength: passwordMinLen}
+	if v, err := config.GetInt("auth:password-policy:min-length"); err == nil && v > passwordMinLen {
+		p.MinLength = v
+	}
+	if p.MinLength > passwordMaxLen {
+		p.MinLength = passwordMaxLen
+	}
+	if v, err := config.GetInt("auth:password-policy:character-classes"); err == nil && v > 0 {
+		p.CharacterClasses = v
+	}
+	if p.CharacterClasses > characterClassesMax {
+		p.CharacterClasses = characterClassesMax
+	}
+	if v, err := config.GetInt("auth:password-policy:history"); err == nil && v > 0 {
+		p.History = v
+	}
+	return p
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// validate checks the length and the character classes of the password.
+func (p passwordPolicy) validate(password string) error {
+	if !validation.ValidateLength(password, p.MinLength, passwordMaxLen) {
+		if p.MinLength == passwordMinLen {
+			return ErrInvalidPassword
+		}
+		return &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("password length should be least %d characters and at most %d characters", p.MinLength, passwordMaxLen),
+		}
+	}
+	if characterClasses(password) < p.CharacterClasses {
+		return &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("password should have at least %d of: lower case letters, upper case letters, digits and symbols", p.CharacterClasses),
+		}
+	}
+	return nil
+}
+
+// checkHistory checks that the password is neither the current password of
+// the user nor any of the ones kept in the history.
+func (p passwordPolicy) checkHistory(u *auth.User, password string) error {
+	if p.History == 0 {
+		return nil
+	}
+	hashes := []string{u.Password}
+	previous, err := passwordHistory(u.Email)
+	if err != nil {
+		return err
+	}
+	hashes = append(hashes, previous...)
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+func passwordHistoryCollection(conn *db.Storage) *storage.Collection {
+	return conn.Collection("password_history")
+}
+
+func passwordHistory(email string) ([]string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var entry struct{ Hashes []string }
+	err = passwordHistoryCollection(conn).FindId(email).One(&entry)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	return entry.Hashes, nil
+}
+
+// recordPasswordHistory keeps the hash of a replaced password, as long as the
+// policy requires more than the current password not to be reused.
+func (p passwordPolicy) recordPasswordHistory(email, hash string) error {
+	if p.History < 2 || hash == "" {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = passwordHistoryCollection(conn).UpsertId(email, bson.M{
+		"$push": bson.M{"hashes": bson.M{"$each": []string{hash}, "$slice": -(p.History - 1)}},
+	})
+	return err
+}
+
+func removePasswordHistory(email string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = passwordHistoryCollection(conn).RemoveId(email)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// generateValidPassword generates a random password complying with the
+// policy.
+func (p passwordPolicy) generateValidPassword() string {
+	length := generatedPasswordLen
+	if p.MinLength > length {
+		length = p.MinLength
+	}
+	for {
+		password := generatePassword(length)
+		if p.validate(password) == nil {
+			return password
+		}
+	}
+}
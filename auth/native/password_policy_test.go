@@ -0,0 +1,75 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoadPasswordPolicy(c *check.C) {
+	c.Assert(loadPasswordPolicy(), check.Equals, passwordPolicy{MinLength: 6})
+	config.Set("auth:password-policy:min-length", 100)
+	defer config.Unset("auth:password-policy:min-length")
+	config.Set("auth:password-policy:character-classes", 7)
+	defer config.Unset("auth:password-policy:character-classes")
+	config.Set("auth:password-policy:history", 3)
+	defer config.Unset("auth:password-policy:history")
+	c.Assert(loadPasswordPolicy(), check.Equals, passwordPolicy{MinLength: 50, CharacterClasses: 4, History: 3})
+}
+
+func (s *S) TestPasswordPolicyValidate(c *check.C) {
+	p := passwordPolicy{MinLength: 6}
+	c.Assert(p.validate("12345"), check.Equals, ErrInvalidPassword)
+	c.Assert(p.validate("123456"), check.IsNil)
+	p = passwordPolicy{MinLength: 10, CharacterClasses: 3}
+	c.Assert(p.validate("aB1$"), check.ErrorMatches, "password length should be least 10 characters .*")
+	c.Assert(p.validate("abcdefghij"), check.ErrorMatches, "password should have at least 3 of: .*")
+	c.Assert(p.validate("abcdefghi1"), check.NotNil)
+	c.Assert(p.validate("abcdefgh1!"), check.IsNil)
+	c.Assert(p.validate("Abcdefghi1"), check.IsNil)
+}
+
+func (s *S) TestGenerateValidPassword(c *check.C) {
+	p := passwordPolicy{MinLength: 20, CharacterClasses: 3}
+	password := p.generateValidPassword()
+	c.Assert(password, check.HasLen, 20)
+	c.Assert(p.validate(password), check.IsNil)
+}
+
+func (s *S) TestCreateWithPasswordPolicy(c *check.C) {
+	config.Set("auth:password-policy:character-classes", 2)
+	defer config.Unset("auth:password-policy:character-classes")
+	_, err := nativeScheme.Create(&auth.User{Email: "x@x.com", Password: "123456"})
+	c.Assert(err, check.ErrorMatches, "password should have at least 2 of: .*")
+	_, err = nativeScheme.Create(&auth.User{Email: "x@x.com", Password: "abc123"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestChangePasswordHistory(c *check.C) {
+	config.Set("auth:password-policy:history", 3)
+	defer config.Unset("auth:password-policy:history")
+	err := nativeScheme.ChangePassword(s.token, "123456", "123456")
+	c.Assert(err, check.Equals, ErrPasswordReused)
+	err = nativeScheme.ChangePassword(s.token, "123456", "abcdef")
+	c.Assert(err, check.IsNil)
+	err = nativeScheme.ChangePassword(s.token, "abcdef", "123456")
+	c.Assert(err, check.Equals, ErrPasswordReused)
+	err = nativeScheme.ChangePassword(s.token, "abcdef", "ghijkl")
+	c.Assert(err, check.IsNil)
+	err = nativeScheme.ChangePassword(s.token, "ghijkl", "mnopqr")
+	c.Assert(err, check.IsNil)
+	hashes, err := passwordHistory(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(hashes, check.HasLen, 2)
+	err = nativeScheme.ChangePassword(s.token, "mnopqr", "123456")
+	c.Assert(err, check.IsNil)
+	err = nativeScheme.Remove(s.user)
+	c.Assert(err, check.IsNil)
+	hashes, err = passwordHistory(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(hashes, check.HasLen, 0)
+}
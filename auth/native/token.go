@@ -41,6 +41,9 @@ type Token struct {
 	Expires   time.Duration `json:"expires"`
 	UserEmail string        `json:"email"`
 	AppName   string        `json:"app"`
+	// TwoFactorPending is set on tokens of users that must enroll in
+	// two-factor authentication, which have no permissions until they do.
+	TwoFactorPending bool `json:"-" bson:",omitempty"`
 }
 
 func (t *Token) GetValue() string {
@@ -63,7 +66,14 @@ func (t *Token) GetAppName() string {
 	return t.AppName
 }
 
+func (t *Token) IsTwoFactorPending() bool {
+	return t.TwoFactorPending
+}
+
 func (t *Token) Permissions() ([]permission.Permission, error) {
+	if t.TwoFactorPending {
+		return nil, nil
+	}
 	return auth.BaseTokenPermission(t)
 }
 
@@ -169,13 +179,34 @@ func checkPassword(passwordHash string, password string) error {
 	return auth.AuthenticationFailure{Message: "Authentication failed, wrong password."}
 }
 
-func createToken(u *auth.User, password string) (*Token, error) {
+func createToken(u *auth.User, password, code string) (*Token, error) {
 	if u.Email == "" {
 		return nil, errors.New("User does not have an email")
 	}
 	if err := checkPassword(u.Password, password); err != nil {
 		return nil, err
 	}
+	pending, err := checkTwoFactor(u, code)
+	if err != nil {
+		return nil, err
+	}
+	return createUserToken(u, pending)
+}
+
+// CreateUserToken issues a new token for the user without checking its
+// password, to be used by schemes that authenticate users elsewhere and
+// handle tokens the same way as the native scheme.
+func CreateUserToken(u *auth.User) (*Token, error) {
+	return createUserToken(u, false)
+}
+
+func createUserToken(u *auth.User, twoFactorPending bool) (*Token, error) {
+	if u.Email == "" {
+		return nil, errors.New("User does not have an email")
+	}
+	if err := u.CheckInteractiveLogin(); err != nil {
+		return nil, err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -185,6 +216,7 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	token.TwoFactorPending = twoFactorPending
 	err = conn.Tokens().Insert(token)
 	go removeOldTokens(u.Email)
 	return token, err
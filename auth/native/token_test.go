@@ -202,7 +202,7 @@ func (s *S) TestCreateTokenShouldSaveTheTokenInTheDatabase(c *check.C) {
 	_, err := nativeScheme.Create(&u)
 	c.Assert(err, check.IsNil)
 	defer u.Delete()
-	_, err = createToken(&u, "123456")
+	_, err = createToken(&u, "123456", "")
 	c.Assert(err, check.IsNil)
 	var result Token
 	err = s.conn.Tokens().Find(bson.M{"useremail": u.Email}).One(&result)
@@ -223,7 +223,7 @@ func (s *S) TestCreateTokenRemoveOldTokens(c *check.C) {
 	t2.Token += "aa"
 	err = s.conn.Tokens().Insert(t1, t2)
 	c.Assert(err, check.IsNil)
-	_, err = createToken(&u, "123456")
+	_, err = createToken(&u, "123456", "")
 	c.Assert(err, check.IsNil)
 	ok := make(chan bool, 1)
 	go func() {
@@ -254,13 +254,13 @@ func (s *S) TestCreateTokenUsesDefaultCostWhenHasCostIsUndefined(c *check.C) {
 	defer u.Delete()
 	cost = 0
 	tokenExpire = 0
-	_, err = createToken(&u, "123456")
+	_, err = createToken(&u, "123456", "")
 	c.Assert(err, check.IsNil)
 }
 
 func (s *S) TestCreateTokenShouldReturnErrorIfTheProvidedUserDoesNotHaveEmailDefined(c *check.C) {
 	u := auth.User{Password: "123"}
-	_, err := createToken(&u, "123")
+	_, err := createToken(&u, "123", "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.ErrorMatches, "^User does not have an email$")
 }
@@ -270,7 +270,7 @@ func (s *S) TestCreateTokenShouldValidateThePassword(c *check.C) {
 	_, err := nativeScheme.Create(&u)
 	c.Assert(err, check.IsNil)
 	defer u.Delete()
-	_, err = createToken(&u, "123")
+	_, err = createToken(&u, "123", "")
 	c.Assert(err, check.NotNil)
 }
 
@@ -0,0 +1,322 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	totpDigits            = 6
+	totpModulo            = 1000000
+	totpPeriod            = 30
+	totpSkew              = 1
+	totpSecretSize        = 20
+	recoveryCodesCount    = 10
+	recoveryCodeSize      = 10
+	recoveryCodeGroupSize = 5
+	defaultTOTPIssuer     = "tsuru"
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// twoFactor holds the TOTP secret of a user. Enrollment is pending until a
+// code generated with the secret is confirmed. Recovery codes are stored
+// hashed, each one may be used only once.
+type twoFactor struct {
+	Email         string `bson:"_id"`
+	Secret        string
+	Confirmed     bool
+	RecoveryCodes []string
+	LastCounter   int64
+}
+
+func twoFactorCollection(conn *db.Storage) *storage.Collection {
+	return conn.Collection("two_factor")
+}
+
+func getTwoFactor(email string) (*twoFactor, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tf twoFactor
+	err = twoFactorCollection(conn).FindId(email).One(&tf)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// totpCode returns the HOTP value (RFC 4226) of the secret for the counter,
+// which is the TOTP value (RFC 6238) when the counter is derived from the
+// current time.
+func totpCode(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+func totpURI(email, secret string) string {
+	issuer, err := config.GetString("auth:two-factor-issuer")
+	if err != nil || issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + email)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
+
+func hashRecoveryCode(code string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(normalizeRecoveryCode(code))))
+}
+
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := fmt.Sprintf("%x", b)
+		var groups []string
+		for len(value) > 0 {
+			groups = append(groups, value[:recoveryCodeGroupSize])
+			value = value[recoveryCodeGroupSize:]
+		}
+		code := strings.Join(groups, "-")
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// checkTOTP validates a code generated by the authenticator of the user,
+// accepting a step of clock skew. Codes can't be used twice.
+func (tf *twoFactor) checkTOTP(code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return auth.ErrInvalidTwoFactorCode
+	}
+	secret, err := secretEncoding.DecodeString(tf.Secret)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix() / totpPeriod
+	var counter int64
+	for i := -totpSkew; i <= totpSkew; i++ {
+		c := now + int64(i)
+		if c > tf.LastCounter && hmac.Equal([]byte(totpCode(secret, c)), []byte(code)) {
+			counter = c
+			break
+		}
+	}
+	if counter == 0 {
+		return auth.ErrInvalidTwoFactorCode
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = twoFactorCollection(conn).Update(
+		bson.M{"_id": tf.Email, "lastcounter": bson.M{"$lt": counter}},
+		bson.M{"$set": bson.M{"lastcounter": counter}},
+	)
+	if err == mgo.ErrNotFound {
+		return auth.ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return err
+	}
+	tf.LastCounter = counter
+	return nil
+}
+
+// check validates either a TOTP code or a recovery code, which is discarded
+// once used.
+func (tf *twoFactor) check(code string) error {
+	if len(strings.TrimSpace(code)) == totpDigits {
+		return tf.checkTOTP(code)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	hash := hashRecoveryCode(code)
+	err = twoFactorCollection(conn).Update(
+		bson.M{"_id": tf.Email, "confirmed": true, "recoverycodes": hash},
+		bson.M{"$pull": bson.M{"recoverycodes": hash}},
+	)
+	if err == mgo.ErrNotFound {
+		return auth.ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// checkTwoFactor validates the two-factor authentication code of the user
+// during login. It reports whether the user still has to enroll, which is
+// the case for users with roles making it mandatory.
+func checkTwoFactor(u *auth.User, code string) (bool, error) {
+	tf, err := getTwoFactor(u.Email)
+	if err != nil {
+		return false, err
+	}
+	if tf == nil || !tf.Confirmed {
+		return u.TwoFactorRequired()
+	}
+	if code == "" {
+		return false, auth.ErrTwoFactorCodeRequired
+	}
+	err = tf.check(code)
+	if err == auth.ErrInvalidTwoFactorCode {
+		return false, auth.AuthenticationFailure{Message: "Authentication failed, invalid two-factor authentication code."}
+	}
+	return false, err
+}
+
+// EnrollTwoFactor starts the enrollment of the user, returning the otpauth
+// URI to be added to an authenticator. Enrolling again before confirming
+// replaces the secret.
+func (s NativeScheme) EnrollTwoFactor(u *auth.User) (string, error) {
+	tf, err := getTwoFactor(u.Email)
+	if err != nil {
+		return "", err
+	}
+	if tf != nil && tf.Confirmed {
+		return "", auth.ErrTwoFactorAlreadyEnabled
+	}
+	b := make([]byte, totpSecretSize)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	secret := secretEncoding.EncodeToString(b)
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_, err = twoFactorCollection(conn).UpsertId(u.Email, twoFactor{Email: u.Email, Secret: secret})
+	if err != nil {
+		return "", err
+	}
+	return totpURI(u.Email, secret), nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication for the user once the
+// code is valid for the pending secret, returning the recovery codes.
+func (s NativeScheme) ConfirmTwoFactor(u *auth.User, code string) ([]string, error) {
+	tf, err := getTwoFactor(u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, auth.ErrTwoFactorNotEnrolled
+	}
+	if tf.Confirmed {
+		return nil, auth.ErrTwoFactorAlreadyEnabled
+	}
+	err = tf.checkTOTP(code)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = twoFactorCollection(conn).UpdateId(u.Email, bson.M{
+		"$set": bson.M{"confirmed": true, "recoverycodes": hashes},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Tokens().UpdateAll(
+		bson.M{"useremail": u.Email, "twofactorpending": true},
+		bson.M{"$unset": bson.M{"twofactorpending": ""}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor disables two-factor authentication for the user, given a
+// valid TOTP or recovery code. It's not allowed when any role of the user
+// makes it mandatory.
+func (s NativeScheme) DisableTwoFactor(u *auth.User, code string) error {
+	tf, err := getTwoFactor(u.Email)
+	if err != nil {
+		return err
+	}
+	if tf == nil || !tf.Confirmed {
+		return auth.ErrTwoFactorNotEnabled
+	}
+	required, err := u.TwoFactorRequired()
+	if err != nil {
+		return err
+	}
+	if required {
+		return auth.ErrTwoFactorMandatory
+	}
+	err = tf.check(code)
+	if err != nil {
+		return err
+	}
+	return removeTwoFactor(u.Email)
+}
+
+func removeTwoFactor(email string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = twoFactorCollection(conn).RemoveId(email)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func currentCode(c *check.C, uri string) string {
+	u, err := url.Parse(uri)
+	c.Assert(err, check.IsNil)
+	secret, err := secretEncoding.DecodeString(u.Query().Get("secret"))
+	c.Assert(err, check.IsNil)
+	return totpCode(secret, time.Now().Unix()/totpPeriod)
+}
+
+func (s *S) enableTwoFactor(c *check.C) (string, []string) {
+	uri, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	codes, err := nativeScheme.ConfirmTwoFactor(s.user, currentCode(c, uri))
+	c.Assert(err, check.IsNil)
+	return uri, codes
+}
+
+func (s *S) TestTOTPCode(c *check.C) {
+	secret := []byte("12345678901234567890")
+	c.Assert(totpCode(secret, 59/totpPeriod), check.Equals, "287082")
+	c.Assert(totpCode(secret, 1111111109/totpPeriod), check.Equals, "081804")
+	c.Assert(totpCode(secret, 2000000000/totpPeriod), check.Equals, "279037")
+}
+
+func (s *S) TestEnrollTwoFactor(c *check.C) {
+	uri, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	u, err := url.Parse(uri)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Scheme, check.Equals, "otpauth")
+	c.Assert(u.Host, check.Equals, "totp")
+	c.Assert(u.Path, check.Equals, "/tsuru:"+s.user.Email)
+	c.Assert(u.Query().Get("issuer"), check.Equals, "tsuru")
+	c.Assert(u.Query().Get("secret"), check.HasLen, 32)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Confirmed, check.Equals, false)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestConfirmTwoFactor(c *check.C) {
+	_, err := nativeScheme.ConfirmTwoFactor(s.user, "123456")
+	c.Assert(err, check.Equals, auth.ErrTwoFactorNotEnrolled)
+	uri, err := nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.ConfirmTwoFactor(s.user, "000000x")
+	c.Assert(err, check.Equals, auth.ErrInvalidTwoFactorCode)
+	codes, err := nativeScheme.ConfirmTwoFactor(s.user, currentCode(c, uri))
+	c.Assert(err, check.IsNil)
+	c.Assert(codes, check.HasLen, recoveryCodesCount)
+	c.Assert(codes[0], check.Matches, `[0-9a-f]{5}(-[0-9a-f]{5}){3}`)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Confirmed, check.Equals, true)
+	c.Assert(tf.RecoveryCodes[0], check.Equals, hashRecoveryCode(codes[0]))
+	_, err = nativeScheme.EnrollTwoFactor(s.user)
+	c.Assert(err, check.Equals, auth.ErrTwoFactorAlreadyEnabled)
+}
+
+func (s *S) TestLoginTwoFactor(c *check.C) {
+	uri, codes := s.enableTwoFactor(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456"}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.Equals, auth.ErrTwoFactorCodeRequired)
+	params["otp"] = "000000"
+	_, err = nativeScheme.Login(params)
+	_, isAuthFail := err.(auth.AuthenticationFailure)
+	c.Assert(isAuthFail, check.Equals, true)
+	params["otp"] = strings.ToUpper(codes[0])
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.NotNil)
+	err = s.conn.Collection("two_factor").UpdateId(s.user.Email, bson.M{"$set": bson.M{"lastcounter": 0}})
+	c.Assert(err, check.IsNil)
+	params["otp"] = currentCode(c, uri)
+	token, err := nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetValue(), check.Not(check.Equals), "")
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestLoginTwoFactorMandatory(c *check.C) {
+	role, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = role.SetTwoFactorRequired(true)
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	perms, err := token.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 0)
+	s.enableTwoFactor(c)
+	token, err = nativeScheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	perms, err = token.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.Not(check.HasLen), 0)
+}
+
+func (s *S) TestDisableTwoFactor(c *check.C) {
+	err := nativeScheme.DisableTwoFactor(s.user, "123456")
+	c.Assert(err, check.Equals, auth.ErrTwoFactorNotEnabled)
+	_, codes := s.enableTwoFactor(c)
+	err = nativeScheme.DisableTwoFactor(s.user, "invalid")
+	c.Assert(err, check.Equals, auth.ErrInvalidTwoFactorCode)
+	err = nativeScheme.DisableTwoFactor(s.user, codes[1])
+	c.Assert(err, check.IsNil)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf, check.IsNil)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestDisableTwoFactorMandatory(c *check.C) {
+	_, codes := s.enableTwoFactor(c)
+	role, err := permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.SetTwoFactorRequired(true)
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("admin", "")
+	c.Assert(err, check.IsNil)
+	err = nativeScheme.DisableTwoFactor(s.user, codes[0])
+	c.Assert(err, check.Equals, auth.ErrTwoFactorMandatory)
+}
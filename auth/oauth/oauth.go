@@ -152,7 +152,7 @@ func (s *OAuthScheme) handleToken(t *oauth2.Token) (*Token, error) {
 	if email == "" {
 		return nil, ErrEmptyUserEmail
 	}
-	_, err = auth.GetUserByEmail(email)
+	user, err := auth.GetUserByEmail(email)
 	if err != nil {
 		if err != auth.ErrUserNotFound {
 			return nil, err
@@ -161,12 +161,16 @@ func (s *OAuthScheme) handleToken(t *oauth2.Token) (*Token, error) {
 		if !registrationEnabled {
 			return nil, err
 		}
-		user := &auth.User{Email: email}
+		user = &auth.User{Email: email}
 		err = user.Create()
 		if err != nil {
 			return nil, err
 		}
 	}
+	err = user.CheckInteractiveLogin()
+	if err != nil {
+		return nil, err
+	}
 	token := Token{*t, email}
 	err = token.save()
 	if err != nil {
@@ -0,0 +1,221 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+// minKeysRefreshInterval limits how often the provider keys are fetched
+// again when an ID token is signed by an unknown key.
+var minKeysRefreshInterval = time.Minute
+
+// providerMetadata is the subset of the OpenID Connect discovery document
+// used by the scheme.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func getJSON(url string, result interface{}) error {
+	t0 := time.Now()
+	rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Get(url)
+	requestLatencies.Observe(time.Since(t0).Seconds())
+	if err != nil {
+		requestErrors.Inc()
+		return err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read response from %s", url)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		requestErrors.Inc()
+		return errors.Errorf("unexpected response from %s %d: %s", url, rsp.StatusCode, data)
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse response from %s: %s", url, data)
+	}
+	return nil
+}
+
+// discover reads the discovery document of the issuer, checking that it
+// belongs to the issuer.
+func discover(issuer string) (*providerMetadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	var provider providerMetadata
+	err := getJSON(issuer+"/.well-known/openid-configuration", &provider)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, errors.Errorf("issuer %q in discovery document does not match the configured issuer %q", provider.Issuer, issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.Errorf("incomplete discovery document for issuer %q", issuer)
+	}
+	return &provider, nil
+}
+
+// keySet holds the RSA keys used by the provider to sign ID tokens, fetched
+// from its JWKS URL.
+type keySet struct {
+	url       string
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(url string) *keySet {
+	return &keySet{url: url}
+}
+
+// key returns the key with the given id, fetching the keys again if it's not
+// known. An empty id is accepted when the provider has a single key.
+func (k *keySet) key(kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := k.find(kid)
+	if key == nil && time.Since(k.fetchedAt) >= minKeysRefreshInterval {
+		err := k.fetch()
+		if err != nil {
+			return nil, err
+		}
+		key = k.find(kid)
+	}
+	if key == nil {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (k *keySet) find(kid string) *rsa.PublicKey {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key
+		}
+	}
+	return k.keys[kid]
+}
+
+func (k *keySet) fetch() error {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err := getJSON(k.url, &jwks)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.N, "="))
+		if err != nil {
+			return errors.Wrapf(err, "invalid modulus in key %q", jwk.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.E, "="))
+		if err != nil {
+			return errors.Wrapf(err, "invalid exponent in key %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	return nil
+}
+
+// verifyIDToken checks the signature of the ID token against the provider
+// keys and validates its issuer, audience and expiration, returning its
+// claims.
+func (s *OIDCScheme) verifyIDToken(rawIDToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.key(kid)
+	})
+	if err != nil {
+		return nil, invalidIDToken(err.Error())
+	}
+	if !claims.VerifyIssuer(s.BaseConfig.Issuer, true) {
+		return nil, invalidIDToken("invalid issuer")
+	}
+	if !hasAudience(claims, s.BaseConfig.ClientID) {
+		return nil, invalidIDToken("invalid audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, invalidIDToken("token is expired")
+	}
+	return claims, nil
+}
+
+func invalidIDToken(reason string) error {
+	return &tsuruErrors.NotAuthorizedError{Message: fmt.Sprintf("Invalid ID token: %s.", reason)}
+}
+
+// hasAudience reports whether the aud claim, which may be a single value or
+// a list, contains the client id.
+func hasAudience(claims jwt.MapClaims, clientID string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimGroups returns the groups in the given claim, which may be a list or
+// a single value.
+func claimGroups(claims jwt.MapClaims, claim string) []string {
+	switch value := claims[claim].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, g := range value {
+			if group, ok := g.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oidc implements an auth scheme authenticating users against an
+// OpenID Connect provider, using the authorization code flow with PKCE.
+// Tokens are handled the same way as in the native scheme.
+package oidc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+var (
+	ErrMissingCodeError       = &tsuruErrors.ValidationError{Message: "You must provide code to login"}
+	ErrMissingCodeRedirectURL = &tsuruErrors.ValidationError{Message: "You must provide the used redirect url to login"}
+	ErrMissingIDToken         = &tsuruErrors.NotAuthorizedError{Message: "Couldn't convert code to ID token."}
+	ErrEmptyUserEmail         = &tsuruErrors.NotAuthorizedError{Message: "Couldn't parse user email."}
+	ErrEmailNotVerified       = &tsuruErrors.NotAuthorizedError{Message: "User email is not verified."}
+
+	requestLatencies = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "tsuru_oidc_request_duration_seconds",
+		Help: "The OpenID Connect requests latency distributions.",
+	})
+	requestErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_oidc_request_errors_total",
+		Help: "The total number of OpenID Connect request errors.",
+	})
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// BaseConfig is the configuration of the scheme, loaded from the auth:oidc
+// config and from the provider discovery document.
+type BaseConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	CallbackPort int
+	EmailClaim   string
+	GroupsClaim  string
+}
+
+type OIDCScheme struct {
+	BaseConfig BaseConfig
+	keys       *keySet
+}
+
+func init() {
+	auth.RegisterScheme("oidc", &OIDCScheme{})
+	prometheus.MustRegister(requestLatencies)
+	prometheus.MustRegister(requestErrors)
+}
+
+// This method loads basic config, discovering the provider endpoints, and
+// returns a copy of the config object.
+func (s *OIDCScheme) loadConfig() (BaseConfig, error) {
+	if s.BaseConfig.ClientID != "" {
+		return s.BaseConfig, nil
+	}
+	var emptyConfig BaseConfig
+	issuer, err := config.GetString("auth:oidc:issuer")
+	if err != nil {
+		return emptyConfig, err
+	}
+	clientID, err := config.GetString("auth:oidc:client-id")
+	if err != nil {
+		return emptyConfig, err
+	}
+	clientSecret, _ := config.GetString("auth:oidc:client-secret")
+	scopes, err := config.GetList("auth:oidc:scopes")
+	if err != nil {
+		scopes = defaultScopes
+	}
+	callbackPort, err := config.GetInt("auth:oidc:callback-port")
+	if err != nil {
+		log.Debugf("auth:oidc:callback-port not found using random port: %s", err)
+	}
+	emailClaim, err := config.GetString("auth:oidc:email-claim")
+	if err != nil {
+		emailClaim = "email"
+	}
+	groupsClaim, err := config.GetString("auth:oidc:groups-claim")
+	if err != nil {
+		groupsClaim = "groups"
+	}
+	provider, err := discover(issuer)
+	if err != nil {
+		return emptyConfig, err
+	}
+	s.keys = newKeySet(provider.JWKSURI)
+	s.BaseConfig = BaseConfig{
+		Issuer:       provider.Issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		AuthURL:      provider.AuthorizationEndpoint,
+		TokenURL:     provider.TokenEndpoint,
+		CallbackPort: callbackPort,
+		EmailClaim:   emailClaim,
+		GroupsClaim:  groupsClaim,
+	}
+	return s.BaseConfig, nil
+}
+
+func (s *OIDCScheme) Login(params map[string]string) (auth.Token, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	code, ok := params["code"]
+	if !ok {
+		return nil, ErrMissingCodeError
+	}
+	redirectURL, ok := params["redirectUrl"]
+	if !ok {
+		return nil, ErrMissingCodeRedirectURL
+	}
+	rawIDToken, err := s.exchange(conf, code, redirectURL, params["code_verifier"])
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.verifyIDToken(rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := claims[conf.EmailClaim].(string)
+	if email == "" {
+		return nil, ErrEmptyUserEmail
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, ErrEmailNotVerified
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user = &auth.User{Email: email}
+		err = user.Create()
+		if err != nil {
+			return nil, err
+		}
+	}
+	roles, err := auth.GroupRoles("auth:oidc", claimGroups(claims, conf.GroupsClaim))
+	if err != nil {
+		return nil, err
+	}
+	err = user.SyncGroupRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	return native.CreateUserToken(user)
+}
+
+// exchange converts the authorization code to tokens in the provider token
+// endpoint, returning the ID token. The code verifier is sent when the
+// client started the login using PKCE.
+func (s *OIDCScheme) exchange(conf BaseConfig, code, redirectURL, codeVerifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("client_id", conf.ClientID)
+	if codeVerifier != "" {
+		v.Set("code_verifier", codeVerifier)
+	}
+	req, err := http.NewRequest("POST", conf.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+	t0 := time.Now()
+	rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Do(req)
+	requestLatencies.Observe(time.Since(t0).Seconds())
+	if err != nil {
+		requestErrors.Inc()
+		return "", err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read token response")
+	}
+	if rsp.StatusCode != http.StatusOK {
+		requestErrors.Inc()
+		return "", errors.Errorf("unexpected token response %d: %s", rsp.StatusCode, data)
+	}
+	var result struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse token response: %s", data)
+	}
+	if result.IDToken == "" {
+		return "", ErrMissingIDToken
+	}
+	return result.IDToken, nil
+}
+
+func (s *OIDCScheme) AppLogin(appName string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogin(appName)
+}
+
+func (s *OIDCScheme) AppLogout(token string) error {
+	return s.Logout(token)
+}
+
+func (s *OIDCScheme) Logout(token string) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Logout(token)
+}
+
+func (s *OIDCScheme) Auth(token string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Auth(token)
+}
+
+func (s *OIDCScheme) Name() string {
+	return "oidc"
+}
+
+// Info returns the authorization URL used by clients to start the login,
+// with the __redirect_url__ placeholder to be replaced by the client
+// callback URL. Clients must add a PKCE code challenge, using the S256
+// method, and a state to the URL.
+func (s *OIDCScheme) Info() (auth.SchemeInfo, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", conf.ClientID)
+	v.Set("scope", strings.Join(conf.Scopes, " "))
+	authURL := conf.AuthURL
+	if strings.Contains(authURL, "?") {
+		authURL += "&"
+	} else {
+		authURL += "?"
+	}
+	authURL += v.Encode() + "&redirect_uri=__redirect_url__"
+	return auth.SchemeInfo{
+		"authorizeUrl": authURL,
+		"port":         strconv.Itoa(conf.CallbackPort),
+		"pkce":         "S256",
+	}, nil
+}
+
+func (s *OIDCScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	err := user.Create()
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OIDCScheme) Remove(u *auth.User) error {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.Remove(u)
+}
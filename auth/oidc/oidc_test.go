@@ -0,0 +1,229 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoginWithoutCode(c *check.C) {
+	scheme := OIDCScheme{}
+	_, err := scheme.Login(map[string]string{"redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrMissingCodeError)
+}
+
+func (s *S) TestLoginWithoutRedirectURL(c *check.C) {
+	scheme := OIDCScheme{}
+	_, err := scheme.Login(map[string]string{"code": "abcdefg"})
+	c.Assert(err, check.Equals, ErrMissingCodeRedirectURL)
+}
+
+func (s *S) TestLogin(c *check.C) {
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "email_verified": true})
+	scheme := OIDCScheme{}
+	token, err := scheme.Login(map[string]string{
+		"code":          "abcdefg",
+		"redirectUrl":   "http://localhost",
+		"code_verifier": "myverifier",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "rand@althor.com")
+	c.Assert(token.IsAppToken(), check.Equals, false)
+	u, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Email, check.Equals, "rand@althor.com")
+	c.Assert(s.forms, check.DeepEquals, []url.Values{{
+		"grant_type":    {"authorization_code"},
+		"code":          {"abcdefg"},
+		"redirect_uri":  {"http://localhost"},
+		"client_id":     {"tsuru"},
+		"code_verifier": {"myverifier"},
+	}})
+	authToken, err := scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestLoginRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com"})
+	scheme := OIDCScheme{}
+	_, err := scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginInvalidIDTokens(c *check.C) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, check.IsNil)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.issuer.URL,
+		"aud":   "tsuru",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "rand@althor.com",
+	})
+	forged.Header["kid"] = "key1"
+	forgedToken, err := forged.SignedString(otherKey)
+	c.Assert(err, check.IsNil)
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"iss":   s.issuer.URL,
+		"aud":   "tsuru",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "rand@althor.com",
+	})
+	unsignedToken, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	c.Assert(err, check.IsNil)
+	tokens := []string{
+		forgedToken,
+		unsignedToken,
+		s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "iss": "http://otherissuer"}),
+		s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "aud": "otherclient"}),
+		s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "exp": time.Now().Add(-time.Minute).Unix()}),
+		s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "exp": nil}),
+	}
+	scheme := OIDCScheme{}
+	for i, idToken := range tokens {
+		s.idToken = idToken
+		_, err = scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.NotAuthorizedError{}, check.Commentf("token %d", i))
+	}
+	_, err = auth.GetUserByEmail("rand@althor.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginAudienceList(c *check.C) {
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "aud": []string{"other", "tsuru"}})
+	scheme := OIDCScheme{}
+	token, err := scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "rand@althor.com")
+}
+
+func (s *S) TestLoginEmailNotVerified(c *check.C) {
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com", "email_verified": false})
+	scheme := OIDCScheme{}
+	_, err := scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrEmailNotVerified)
+}
+
+func (s *S) TestLoginWithoutEmail(c *check.C) {
+	s.idToken = s.signIDToken(c, nil)
+	scheme := OIDCScheme{}
+	_, err := scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrEmptyUserEmail)
+}
+
+func (s *S) TestLoginGroupRoles(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("pool-admin", "pool", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("manual", "global", "")
+	c.Assert(err, check.IsNil)
+	config.Set("auth:oidc:team-role", "team-member")
+	config.Set("auth:oidc:groups", map[interface{}]interface{}{
+		"developers": map[interface{}]interface{}{
+			"teams": []interface{}{"team1", "team2"},
+		},
+		"ops": map[interface{}]interface{}{
+			"roles": []interface{}{
+				map[interface{}]interface{}{"name": "pool-admin", "context": "pool1"},
+				"manual",
+			},
+		},
+	})
+	defer config.Unset("auth:oidc:team-role")
+	defer config.Unset("auth:oidc:groups")
+	u := &auth.User{Email: "rand@althor.com"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	scheme := OIDCScheme{}
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": u.Email, "groups": []string{"developers", "ops", "unmapped"}})
+	_, err = scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "manual"},
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "team-member", ContextValue: "team2"},
+		{Name: "pool-admin", ContextValue: "pool1"},
+	})
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": u.Email, "groups": "developers"})
+	_, err = scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{
+		{Name: "manual"},
+		{Name: "team-member", ContextValue: "team1"},
+		{Name: "team-member", ContextValue: "team2"},
+	})
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": u.Email})
+	_, err = scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "manual"}})
+}
+
+func (s *S) TestInfo(c *check.C) {
+	config.Set("auth:oidc:callback-port", 4242)
+	defer config.Unset("auth:oidc:callback-port")
+	scheme := OIDCScheme{}
+	info, err := scheme.Info()
+	c.Assert(err, check.IsNil)
+	c.Assert(info["port"], check.Equals, "4242")
+	c.Assert(info["pkce"], check.Equals, "S256")
+	authURL := info["authorizeUrl"].(string)
+	c.Assert(strings.HasPrefix(authURL, s.issuer.URL+"/authorize?"), check.Equals, true)
+	u, err := url.Parse(authURL)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Query(), check.DeepEquals, url.Values{
+		"response_type": {"code"},
+		"client_id":     {"tsuru"},
+		"scope":         {"openid email profile"},
+		"redirect_uri":  {"__redirect_url__"},
+	})
+}
+
+func (s *S) TestDiscoverIssuerMismatch(c *check.C) {
+	config.Set("auth:oidc:issuer", s.issuer.URL+"/other")
+	defer config.Set("auth:oidc:issuer", s.issuer.URL)
+	scheme := OIDCScheme{}
+	_, err := scheme.Info()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestLogout(c *check.C) {
+	s.idToken = s.signIDToken(c, jwt.MapClaims{"email": "rand@althor.com"})
+	scheme := OIDCScheme{}
+	token, err := scheme.Login(map[string]string{"code": "abcdefg", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	err = scheme.Logout(token.GetValue())
+	c.Assert(err, check.IsNil)
+	_, err = scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestClaimGroups(c *check.C) {
+	claims := jwt.MapClaims{"groups": []interface{}{"a", "b", 1}, "group": "c"}
+	c.Assert(claimGroups(claims, "groups"), check.DeepEquals, []string{"a", "b"})
+	c.Assert(claimGroups(claims, "group"), check.DeepEquals, []string{"c"})
+	c.Assert(claimGroups(claims, "missing"), check.IsNil)
+}
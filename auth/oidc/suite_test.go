@@ -0,0 +1,126 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn    *db.Storage
+	issuer  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+	forms   []url.Values
+}
+
+var _ = check.Suite(&S{})
+
+// SetUpSuite starts a stand-in OpenID Connect issuer, serving its discovery
+// document, its keys and a token endpoint returning s.idToken.
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.key, err = rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, check.IsNil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.issuer.URL,
+			"authorization_endpoint": s.issuer.URL + "/authorize",
+			"token_endpoint":         s.issuer.URL + "/token",
+			"jwks_uri":               s.issuer.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.forms = append(s.forms, r.PostForm)
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     s.idToken,
+		})
+	})
+	s.issuer = httptest.NewServer(mux)
+	config.Set("auth:oidc:issuer", s.issuer.URL)
+	config.Set("auth:oidc:client-id", "tsuru")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_oidc_test")
+	config.Set("auth:user-registration", true)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	s.forms = nil
+	s.idToken = ""
+	repositorytest.Reset()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.issuer.Close()
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
+
+// signIDToken returns an ID token issued by the stand-in issuer for the
+// tsuru client, with the given claims added. Nil claims are removed.
+func (s *S) signIDToken(c *check.C, claims jwt.MapClaims) string {
+	all := jwt.MapClaims{
+		"iss": s.issuer.URL,
+		"aud": "tsuru",
+		"sub": "1234",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = "key1"
+	signed, err := token.SignedString(s.key)
+	c.Assert(err, check.IsNil)
+	return signed
+}
@@ -138,6 +138,9 @@ func createToken(u *auth.User) (*Token, error) {
 	if u.Email == "" {
 		return nil, errors.New("User does not have an email")
 	}
+	if err := u.CheckInteractiveLogin(); err != nil {
+		return nil, err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -27,6 +27,15 @@ type ManagedScheme interface {
 	ChangePassword(token Token, oldPassword string, newPassword string) error
 }
 
+// TwoFactorScheme is implemented by schemes supporting two-factor
+// authentication with time-based one-time passwords.
+type TwoFactorScheme interface {
+	Scheme
+	EnrollTwoFactor(user *User) (string, error)
+	ConfirmTwoFactor(user *User, code string) ([]string, error)
+	DisableTwoFactor(user *User, code string) error
+}
+
 type AuthenticationFailure struct {
 	Message string
 }
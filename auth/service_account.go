@@ -0,0 +1,137 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// serviceAccountDomain is the email domain of service accounts. The .invalid
+// top level domain is reserved, so no real mailbox nor identity provider
+// user can have an email in it.
+const serviceAccountDomain = "serviceaccounts.tsuru.invalid"
+
+var (
+	ErrServiceAccountNotFound      = errors.New("service account not found")
+	ErrServiceAccountAlreadyExists = &tsuruErrors.ConflictError{Message: "a service account with this name already exists"}
+	ErrInvalidServiceAccountName   = &tsuruErrors.ValidationError{
+		Message: "Invalid service account name, it should have at most 63 characters, containing only lower case letters, numbers or dashes, starting with a letter.",
+	}
+	ErrServiceAccountLogin  = &tsuruErrors.NotAuthorizedError{Message: "Service accounts can't log in, use an access token instead."}
+	ErrServiceAccountAPIKey = &tsuruErrors.NotAuthorizedError{Message: "Service accounts have no API key, use an access token instead."}
+)
+
+// ServiceAccount holds the data of users that are service accounts, non
+// human principals owned by a team. Service accounts have roles like any
+// other user but never log in, authenticating only with access tokens.
+type ServiceAccount struct {
+	Name        string
+	Team        string
+	Description string
+	CreatedBy   string
+}
+
+// IsServiceAccount reports whether the user is a service account.
+func (u *User) IsServiceAccount() bool {
+	return u.ServiceAccount != nil
+}
+
+// ServiceAccountEmail returns the email of the service account user with the
+// given name.
+func ServiceAccountEmail(name string) string {
+	return name + "@" + serviceAccountDomain
+}
+
+// ServiceAccountName returns the name of the service account with the given
+// email, reporting whether the email belongs to a service account.
+func ServiceAccountName(email string) (string, bool) {
+	suffix := "@" + serviceAccountDomain
+	if !strings.HasSuffix(email, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(email, suffix), true
+}
+
+// CreateServiceAccount creates a service account owned by the team. Service
+// account names are unique across teams.
+func CreateServiceAccount(sa ServiceAccount) (*User, error) {
+	if !validation.ValidateName(sa.Name) {
+		return nil, ErrInvalidServiceAccountName
+	}
+	_, err := GetTeam(sa.Team)
+	if err != nil {
+		return nil, err
+	}
+	email := ServiceAccountEmail(sa.Name)
+	_, err = GetUserByEmail(email)
+	if err == nil {
+		return nil, ErrServiceAccountAlreadyExists
+	}
+	if err != ErrUserNotFound {
+		return nil, err
+	}
+	u := &User{Email: email, ServiceAccount: &sa}
+	err = u.Create()
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetServiceAccount returns the service account with the given name owned by
+// the team.
+func GetServiceAccount(team, name string) (*User, error) {
+	u, err := GetUserByEmail(ServiceAccountEmail(name))
+	if err != nil {
+		if err == ErrUserNotFound {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, err
+	}
+	if !u.IsServiceAccount() || u.ServiceAccount.Team != team {
+		return nil, ErrServiceAccountNotFound
+	}
+	return u, nil
+}
+
+// ListServiceAccounts returns the service accounts owned by the given teams,
+// or by any team when teams is nil.
+func ListServiceAccounts(teams []string) ([]User, error) {
+	filter := bson.M{"serviceaccount": bson.M{"$exists": true}}
+	if teams != nil {
+		filter["serviceaccount.team"] = bson.M{"$in": teams}
+	}
+	return listUsers(filter)
+}
+
+// RenameServiceAccountTeam moves the service accounts of a team being
+// renamed to the team with the new name.
+func RenameServiceAccountTeam(oldName, newName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Users().UpdateAll(
+		bson.M{"serviceaccount.team": oldName},
+		bson.M{"$set": bson.M{"serviceaccount.team": newName}},
+	)
+	return err
+}
+
+// CheckInteractiveLogin returns an error when the user is a service account,
+// to be called by auth schemes before issuing login tokens.
+func (u *User) CheckInteractiveLogin() error {
+	if u.IsServiceAccount() {
+		return ErrServiceAccountLogin
+	}
+	return nil
+}
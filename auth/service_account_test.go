@@ -0,0 +1,121 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/tsuru/permission"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestServiceAccountName(c *check.C) {
+	email := ServiceAccountEmail("ci")
+	c.Assert(email, check.Equals, "ci@serviceaccounts.tsuru.invalid")
+	name, ok := ServiceAccountName(email)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(name, check.Equals, "ci")
+	_, ok = ServiceAccountName(s.user.Email)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestCreateServiceAccount(c *check.C) {
+	u, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name, CreatedBy: s.user.Email})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.IsServiceAccount(), check.Equals, true)
+	c.Assert(u.Email, check.Equals, ServiceAccountEmail("ci"))
+	sa, err := GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.IsNil)
+	c.Assert(sa.ServiceAccount, check.DeepEquals, &ServiceAccount{Name: "ci", Team: s.team.Name, CreatedBy: s.user.Email})
+	c.Assert(sa.Roles, check.HasLen, 0)
+	_, err = GetServiceAccount("otherteam", "ci")
+	c.Assert(err, check.Equals, ErrServiceAccountNotFound)
+}
+
+func (s *S) TestCreateServiceAccountSkipsDefaultRoles(c *check.C) {
+	role, err := permission.NewRole("default", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddEvent(permission.RoleEventUserCreate.String())
+	c.Assert(err, check.IsNil)
+	u, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 0)
+}
+
+func (s *S) TestCreateServiceAccountInvalid(c *check.C) {
+	_, err := CreateServiceAccount(ServiceAccount{Name: "Invalid Name", Team: s.team.Name})
+	c.Assert(err, check.Equals, ErrInvalidServiceAccountName)
+	_, err = CreateServiceAccount(ServiceAccount{Name: "ci", Team: "unknown"})
+	c.Assert(err, check.Equals, authTypes.ErrTeamNotFound)
+	_, err = CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	_, err = CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.Equals, ErrServiceAccountAlreadyExists)
+}
+
+func (s *S) TestCreateUserWithServiceAccountEmail(c *check.C) {
+	u := &User{Email: ServiceAccountEmail("ci")}
+	err := u.Create()
+	c.Assert(err, check.ErrorMatches, "invalid email, reserved for service accounts")
+}
+
+func (s *S) TestListServiceAccounts(c *check.C) {
+	err := TeamService().Insert(authTypes.Team{Name: "otherteam"})
+	c.Assert(err, check.IsNil)
+	_, err = CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	_, err = CreateServiceAccount(ServiceAccount{Name: "deployer", Team: "otherteam"})
+	c.Assert(err, check.IsNil)
+	users, err := ListServiceAccounts(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(users, check.HasLen, 2)
+	users, err = ListServiceAccounts([]string{"otherteam"})
+	c.Assert(err, check.IsNil)
+	c.Assert(users, check.HasLen, 1)
+	c.Assert(users[0].ServiceAccount.Name, check.Equals, "deployer")
+}
+
+func (s *S) TestRenameServiceAccountTeam(c *check.C) {
+	_, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	err = RenameServiceAccountTeam(s.team.Name, "newteam")
+	c.Assert(err, check.IsNil)
+	_, err = GetServiceAccount("newteam", "ci")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRemoveTeamWithServiceAccounts(c *check.C) {
+	_, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	err = RemoveTeam(s.team.Name)
+	c.Assert(err, check.DeepEquals, &ErrTeamStillUsed{ServiceAccounts: []string{"ci"}})
+	c.Assert(err, check.ErrorMatches, "Service accounts: ci")
+}
+
+func (s *S) TestCheckInteractiveLogin(c *check.C) {
+	c.Assert(s.user.CheckInteractiveLogin(), check.IsNil)
+	u, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	c.Assert(u.CheckInteractiveLogin(), check.Equals, ErrServiceAccountLogin)
+}
+
+func (s *S) TestServiceAccountAPIKey(c *check.C) {
+	u, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	_, err = u.ShowAPIKey()
+	c.Assert(err, check.Equals, ErrServiceAccountAPIKey)
+	_, err = u.RegenerateAPIKey()
+	c.Assert(err, check.Equals, ErrServiceAccountAPIKey)
+	u, err = GetServiceAccount(s.team.Name, "ci")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.APIKey, check.Equals, "")
+}
+
+func (s *S) TestServiceAccountPermissions(c *check.C) {
+	u, err := CreateServiceAccount(ServiceAccount{Name: "ci", Team: s.team.Name})
+	c.Assert(err, check.IsNil)
+	perms, err := u.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 0)
+}
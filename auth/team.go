@@ -11,6 +11,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/storage"
@@ -23,6 +24,7 @@ var teamNameRegexp = regexp.MustCompile(`^[a-z][-@_.+\w]+$`)
 type ErrTeamStillUsed struct {
 	Apps             []string
 	ServiceInstances []string
+	ServiceAccounts  []string
 }
 
 func TeamService() authTypes.TeamService {
@@ -40,7 +42,10 @@ func (e *ErrTeamStillUsed) Error() string {
 	if len(e.Apps) > 0 {
 		return fmt.Sprintf("Apps: %s", strings.Join(e.Apps, ", "))
 	}
-	return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	if len(e.ServiceInstances) > 0 {
+		return fmt.Sprintf("Service instances: %s", strings.Join(e.ServiceInstances, ", "))
+	}
+	return fmt.Sprintf("Service accounts: %s", strings.Join(e.ServiceAccounts, ", "))
 }
 
 func validateTeam(t authTypes.Team) error {
@@ -110,9 +115,39 @@ func RemoveTeam(teamName string) error {
 	if len(serviceInstances) > 0 {
 		return &ErrTeamStillUsed{ServiceInstances: serviceInstances}
 	}
+	var serviceAccounts []string
+	err = conn.Users().Find(bson.M{"serviceaccount.team": teamName}).Distinct("serviceaccount.name", &serviceAccounts)
+	if err != nil {
+		return err
+	}
+	if len(serviceAccounts) > 0 {
+		return &ErrTeamStillUsed{ServiceAccounts: serviceAccounts}
+	}
 	return TeamService().Delete(authTypes.Team{Name: teamName})
 }
 
+// SetTeamQuota changes the resource limits of the team.
+func SetTeamQuota(name string, quota authTypes.TeamQuota) error {
+	invalid := quota.Memory < 0 || quota.CpuShare < 0 || quota.ServiceInstances < 0 || quota.Volumes < 0
+	for _, limit := range quota.Services {
+		invalid = invalid || limit < 0
+	}
+	if invalid {
+		return &tsuruErrors.ValidationError{Message: "quota limits must not be negative"}
+	}
+	return TeamService().SetQuota(name, quota)
+}
+
+// RenameTeamQuota sets the quota of the team being renamed in the team with
+// the new name.
+func RenameTeamQuota(oldName, newName string) error {
+	team, err := GetTeam(oldName)
+	if err != nil {
+		return err
+	}
+	return TeamService().SetQuota(newName, team.Quota)
+}
+
 func ListTeams() ([]authTypes.Team, error) {
 	return TeamService().FindAll()
 }
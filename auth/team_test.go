@@ -129,3 +129,30 @@ func (s *S) TestListTeams(c *check.C) {
 	sort.Strings(names)
 	c.Assert(names, check.DeepEquals, []string{"cobrateam", "corrino", "fenring"})
 }
+
+func (s *S) TestSetTeamQuota(c *check.C) {
+	quota := authTypes.TeamQuota{Memory: 1024, CpuShare: 200}
+	err := SetTeamQuota(s.team.Name, quota)
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, quota)
+}
+
+func (s *S) TestSetTeamQuotaNegative(c *check.C) {
+	err := SetTeamQuota(s.team.Name, authTypes.TeamQuota{Memory: -1})
+	c.Assert(err, check.ErrorMatches, "quota limits must not be negative")
+}
+
+func (s *S) TestRenameTeamQuota(c *check.C) {
+	quota := authTypes.TeamQuota{Memory: 1024, CpuShare: 200}
+	err := SetTeamQuota(s.team.Name, quota)
+	c.Assert(err, check.IsNil)
+	err = TeamService().Insert(authTypes.Team{Name: "newteam"})
+	c.Assert(err, check.IsNil)
+	err = RenameTeamQuota(s.team.Name, "newteam")
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam("newteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, quota)
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+)
+
+var (
+	ErrTwoFactorCodeRequired   = AuthenticationFailure{Message: "Two-factor authentication code required."}
+	ErrInvalidTwoFactorCode    = &tsuruErrors.ValidationError{Message: "invalid two-factor authentication code"}
+	ErrTwoFactorAlreadyEnabled = &tsuruErrors.ConflictError{Message: "two-factor authentication is already enabled"}
+	ErrTwoFactorNotEnrolled    = &tsuruErrors.ValidationError{Message: "two-factor authentication enrollment not started"}
+	ErrTwoFactorNotEnabled     = &tsuruErrors.ValidationError{Message: "two-factor authentication is not enabled"}
+	ErrTwoFactorMandatory      = &tsuruErrors.NotAuthorizedError{Message: "two-factor authentication is mandatory for one of your roles"}
+	ErrTwoFactorPending        = &tsuruErrors.NotAuthorizedError{Message: "two-factor authentication is mandatory for one of your roles, enroll before using this token"}
+)
+
+// TwoFactorPendingToken is implemented by tokens that may be issued to users
+// who still have to enroll in mandatory two-factor authentication.
+type TwoFactorPendingToken interface {
+	IsTwoFactorPending() bool
+}
+
+// CheckTwoFactorPending returns ErrTwoFactorPending for tokens issued before
+// the enrollment in mandatory two-factor authentication. Such tokens have no
+// permissions, so it's only needed where the token user is used without
+// checking any permission.
+func CheckTwoFactorPending(t Token) error {
+	if p, ok := t.(TwoFactorPendingToken); ok && p.IsTwoFactorPending() {
+		return ErrTwoFactorPending
+	}
+	return nil
+}
+
+// TwoFactorRequired reports whether any of the roles of the user makes
+// two-factor authentication mandatory.
+func (u *User) TwoFactorRequired() (bool, error) {
+	seen := make(map[string]bool, len(u.Roles))
+	for _, r := range u.Roles {
+		if seen[r.Name] {
+			continue
+		}
+		seen[r.Name] = true
+		role, err := permission.FindRole(r.Name)
+		if err != nil {
+			if err == permission.ErrRoleNotFound {
+				continue
+			}
+			return false, err
+		}
+		if role.TwoFactorRequired {
+			return true, nil
+		}
+	}
+	return false, nil
+}
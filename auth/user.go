@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -27,11 +28,22 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrInvalidKey   = errors.New("invalid key")
 	ErrKeyDisabled  = errors.New("key management is disabled")
+
+	ErrRoleAssignedWithoutExpiration = &tsuruErrors.ConflictError{Message: "role is already assigned without expiration"}
 )
 
 type RoleInstance struct {
 	Name         string
 	ContextValue string
+	// ExpiresAt is set for roles assigned for a limited time, which are
+	// removed from the user once expired.
+	ExpiresAt time.Time `bson:",omitempty"`
+}
+
+// Expired reports whether the role was assigned for a limited time which is
+// already over.
+func (r RoleInstance) Expired() bool {
+	return !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(time.Now())
 }
 
 type User struct {
@@ -40,6 +52,8 @@ type User struct {
 	Password string
 	APIKey   string
 	Roles    []RoleInstance `bson:",omitempty"`
+	// ServiceAccount is only set for users that are service accounts.
+	ServiceAccount *ServiceAccount `bson:",omitempty"`
 }
 
 func listUsers(filter bson.M) ([]User, error) {
@@ -65,6 +79,12 @@ func ListUsersWithRole(role string) ([]User, error) {
 	return listUsers(bson.M{"roles.name": role})
 }
 
+// ListUsersWithExpiredRoles returns the users holding roles whose expiration
+// time is over.
+func ListUsersWithExpiredRoles() ([]User, error) {
+	return listUsers(bson.M{"roles.expiresat": bson.M{"$lte": time.Now().UTC()}})
+}
+
 func ListUsersWithPermissions(wantedPerms ...permission.Permission) ([]User, error) {
 	allUsers, err := ListUsers()
 	if err != nil {
@@ -112,6 +132,9 @@ func (u *User) Create() error {
 		return errors.New(fmt.Sprintf("Failed to connect to MongoDB %q - %s.", addr, err.Error()))
 	}
 	defer conn.Close()
+	if _, ok := ServiceAccountName(u.Email); ok && !u.IsServiceAccount() {
+		return &tsuruErrors.ValidationError{Message: "invalid email, reserved for service accounts"}
+	}
 	if u.Quota.Limit == 0 {
 		u.Quota = quota.Unlimited
 		var limit int
@@ -128,6 +151,9 @@ func (u *User) Create() error {
 		u.Delete()
 		return err
 	}
+	if u.IsServiceAccount() {
+		return nil
+	}
 	err = u.AddRolesForEvent(permission.RoleEventUserCreate, "")
 	if err != nil {
 		log.Errorf("unable to add default roles during user creation for %q: %s", u.Email, err)
@@ -145,6 +171,14 @@ func (u *User) Delete() error {
 	if err != nil {
 		log.Errorf("failed to remove user %q from the database: %s", u.Email, err)
 	}
+	err = grantedRolesCollection(conn).RemoveId(u.Email)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("failed to remove group roles of user %q from the database: %s", u.Email, err)
+	}
+	err = removeAccessTokens(conn, u.Email)
+	if err != nil {
+		log.Errorf("failed to remove access tokens of user %q from the database: %s", u.Email, err)
+	}
 	err = repository.Manager().RemoveUser(u.Email)
 	if err != nil {
 		log.Errorf("failed to remove user %q from the repository manager: %s", u.Email, err)
@@ -202,6 +236,9 @@ func (u *User) createOnRepositoryManager() error {
 }
 
 func (u *User) ShowAPIKey() (string, error) {
+	if u.IsServiceAccount() {
+		return "", ErrServiceAccountAPIKey
+	}
 	if u.APIKey == "" {
 		u.RegenerateAPIKey()
 	}
@@ -209,6 +246,9 @@ func (u *User) ShowAPIKey() (string, error) {
 }
 
 func (u *User) RegenerateAPIKey() (string, error) {
+	if u.IsServiceAccount() {
+		return "", ErrServiceAccountAPIKey
+	}
 	random_byte := make([]byte, 32)
 	_, err := rand.Read(random_byte)
 	if err != nil {
@@ -232,11 +272,20 @@ func (u *User) Reload() error {
 }
 
 func (u *User) Permissions() ([]permission.Permission, error) {
-	permissions := []permission.Permission{
-		{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)},
+	var permissions []permission.Permission
+	// Service accounts are managed by their team, so they don't get the
+	// permissions over themselves, like deleting or creating tokens.
+	if !u.IsServiceAccount() {
+		permissions = append(permissions, permission.Permission{
+			Scheme:  permission.PermUser,
+			Context: permission.Context(permission.CtxUser, u.Email),
+		})
 	}
 	roles := make(map[string]*permission.Role)
 	for _, roleData := range u.Roles {
+		if roleData.Expired() {
+			continue
+		}
 		role := roles[roleData.Name]
 		if role == nil {
 			foundRole, err := permission.FindRole(roleData.Name)
@@ -251,7 +300,20 @@ func (u *User) Permissions() ([]permission.Permission, error) {
 	return permissions, nil
 }
 
+// AddRole assigns the role to the user, replacing any assignment of the same
+// role with an expiration.
 func (u *User) AddRole(roleName string, contextValue string) error {
+	return u.addRole(roleName, contextValue, time.Time{})
+}
+
+// AddRoleWithExpiration assigns the role to the user until expiresAt,
+// replacing any previous assignment of the same role with an expiration. It
+// fails if the role is already assigned without expiration.
+func (u *User) AddRoleWithExpiration(roleName string, contextValue string, expiresAt time.Time) error {
+	return u.addRole(roleName, contextValue, expiresAt)
+}
+
+func (u *User) addRole(roleName string, contextValue string, expiresAt time.Time) error {
 	_, err := permission.FindRole(roleName)
 	if err != nil {
 		return err
@@ -261,19 +323,45 @@ func (u *User) AddRole(roleName string, contextValue string) error {
 		return err
 	}
 	defer conn.Close()
+	// Order matters in $addToSet, that's why bson.D is used instead of
+	// bson.M.
+	instance := bson.D([]bson.DocElem{
+		{Name: "name", Value: roleName},
+		{Name: "contextvalue", Value: contextValue},
+	})
+	if !expiresAt.IsZero() {
+		var n int
+		n, err = conn.Users().Find(bson.M{"email": u.Email, "roles": bson.M{"$elemMatch": bson.M{
+			"name":         roleName,
+			"contextvalue": contextValue,
+			"expiresat":    bson.M{"$exists": false},
+		}}}).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrRoleAssignedWithoutExpiration
+		}
+		instance = append(instance, bson.DocElem{Name: "expiresat", Value: expiresAt.UTC()})
+	}
 	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
-		"$addToSet": bson.M{
-			// Order matters in $addToSet, that's why bson.D is used instead
-			// of bson.M.
-			"roles": bson.D([]bson.DocElem{
-				{Name: "name", Value: roleName},
-				{Name: "contextvalue", Value: contextValue},
-			}),
+		"$pull": bson.M{
+			"roles": bson.M{
+				"name":         roleName,
+				"contextvalue": contextValue,
+				"expiresat":    bson.M{"$exists": true},
+			},
 		},
 	})
 	if err != nil {
 		return err
 	}
+	err = conn.Users().Update(bson.M{"email": u.Email}, bson.M{
+		"$addToSet": bson.M{"roles": instance},
+	})
+	if err != nil {
+		return err
+	}
 	return u.Reload()
 }
 
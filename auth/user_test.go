@@ -6,6 +6,7 @@ package auth
 
 import (
 	"sort"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -346,6 +347,55 @@ func (s *S) TestUserRemoveRole(c *check.C) {
 	c.Assert(uDB.Roles, check.DeepEquals, expected)
 }
 
+func (s *S) TestUserAddRoleWithExpiration(c *check.C) {
+	_, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123"}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	err = u.AddRoleWithExpiration("r1", "c1", expiresAt)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].ExpiresAt.Equal(expiresAt), check.Equals, true)
+	expiresAt = expiresAt.Add(time.Hour)
+	err = u.AddRoleWithExpiration("r1", "c1", expiresAt)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.HasLen, 1)
+	c.Assert(u.Roles[0].ExpiresAt.Equal(expiresAt), check.Equals, true)
+	err = u.AddRole("r1", "c1")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "c1"}})
+	err = u.AddRoleWithExpiration("r1", "c1", expiresAt)
+	c.Assert(err, check.Equals, ErrRoleAssignedWithoutExpiration)
+	err = u.AddRoleWithExpiration("r1", "c2", expiresAt)
+	c.Assert(err, check.IsNil)
+	err = u.RemoveRole("r1", "c2")
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "c1"}})
+}
+
+func (s *S) TestListUsersWithExpiredRoles(c *check.C) {
+	u1 := User{Email: "me@tsuru.com", Password: "123", Roles: []RoleInstance{
+		{Name: "r1", ContextValue: "c1", ExpiresAt: time.Now().Add(-time.Minute)},
+	}}
+	err := u1.Create()
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "you@tsuru.com", Password: "123", Roles: []RoleInstance{
+		{Name: "r1", ContextValue: "c1", ExpiresAt: time.Now().Add(time.Hour)},
+		{Name: "r2", ContextValue: "c1"},
+	}}
+	err = u2.Create()
+	c.Assert(err, check.IsNil)
+	users, err := ListUsersWithExpiredRoles()
+	c.Assert(err, check.IsNil)
+	c.Assert(users, check.HasLen, 1)
+	c.Assert(users[0].Email, check.Equals, u1.Email)
+	c.Assert(users[0].Roles[0].Expired(), check.Equals, true)
+	c.Assert(u2.Roles[0].Expired(), check.Equals, false)
+	c.Assert(u2.Roles[1].Expired(), check.Equals, false)
+}
+
 func (s *S) TestRemoveRoleFromAllUsers(c *check.C) {
 	u := User{
 		Email:    "me@tsuru.com",
@@ -400,6 +450,25 @@ func (s *S) TestUserPermissions(c *check.C) {
 	})
 }
 
+func (s *S) TestUserPermissionsWithExpiredRole(c *check.C) {
+	r1, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	u := User{Email: "me@tsuru.com", Password: "123", Roles: []RoleInstance{
+		{Name: "r1", ContextValue: "myapp", ExpiresAt: time.Now().Add(-time.Minute)},
+		{Name: "r1", ContextValue: "myapp2", ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	err = u.Create()
+	c.Assert(err, check.IsNil)
+	perms, err := u.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)},
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxApp, "myapp2")},
+	})
+}
+
 func (s *S) TestUserPermissionsWithRemovedRole(c *check.C) {
 	role, err := permission.NewRole("test", "team", "")
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,168 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AppRule describes how units of a single app process must be scaled. Exactly
+// one of TargetCPU, TargetMemory and TargetRequestsPerUnit must be set.
+// TargetCPU and TargetMemory are percentages of the unit limits, while
+// TargetRequestsPerUnit is the number of requests per second each unit is
+// expected to handle.
+type AppRule struct {
+	AppName               string
+	Process               string
+	Error                 string `bson:"-"`
+	MinUnits              uint
+	MaxUnits              uint
+	TargetCPU             float64
+	TargetMemory          float64
+	TargetRequestsPerUnit float64
+	Enabled               bool
+}
+
+type appRuleList []AppRule
+
+func (l appRuleList) Len() int      { return len(l) }
+func (l appRuleList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l appRuleList) Less(i, j int) bool {
+	if l[i].AppName == l[j].AppName {
+		return l[i].Process < l[j].Process
+	}
+	return l[i].AppName < l[j].AppName
+}
+
+func (r *AppRule) validate() error {
+	var err error
+	targets := 0
+	for _, t := range []float64{r.TargetCPU, r.TargetMemory, r.TargetRequestsPerUnit} {
+		if t < 0 {
+			err = errors.New("invalid rule, targets cannot be negative")
+		} else if t > 0 {
+			targets++
+		}
+	}
+	switch {
+	case err != nil:
+	case r.AppName == "":
+		err = errors.New("invalid rule, app name is required")
+	case r.Process == "":
+		err = errors.New("invalid rule, process is required")
+	case r.MinUnits == 0:
+		err = errors.New("invalid rule, min units must be greater than 0")
+	case r.MaxUnits < r.MinUnits:
+		err = errors.Errorf("invalid rule, max units (%d) must be greater than or equal to min units (%d)", r.MaxUnits, r.MinUnits)
+	case targets != 1:
+		err = errors.New("invalid rule, exactly one of cpu, memory or requests per unit target must be set")
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return err
+}
+
+func (r *AppRule) metricName() string {
+	switch {
+	case r.TargetCPU > 0:
+		return "cpu"
+	case r.TargetMemory > 0:
+		return "memory"
+	}
+	return "requests"
+}
+
+func (r *AppRule) target() float64 {
+	switch {
+	case r.TargetCPU > 0:
+		return r.TargetCPU
+	case r.TargetMemory > 0:
+		return r.TargetMemory
+	}
+	return r.TargetRequestsPerUnit
+}
+
+func (r *AppRule) Update() error {
+	err := r.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := appAutoScaleRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"appname": r.AppName, "process": r.Process}, r)
+	return err
+}
+
+func appAutoScaleRuleCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("app_auto_scale_rule")
+	err = coll.EnsureIndex(mgo.Index{Key: []string{"appname", "process"}, Unique: true})
+	if err != nil {
+		coll.Close()
+		return nil, err
+	}
+	return coll, nil
+}
+
+// ListAppRules returns the autoscale rules for the given app, or for all apps
+// if appName is empty.
+func ListAppRules(appName string) ([]AppRule, error) {
+	coll, err := appAutoScaleRuleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{}
+	if appName != "" {
+		query["appname"] = appName
+	}
+	var rules []AppRule
+	err = coll.Find(query).All(&rules)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rules[i].validate()
+	}
+	sort.Sort(appRuleList(rules))
+	return rules, nil
+}
+
+func AppRuleForProcess(appName, process string) (*AppRule, error) {
+	coll, err := appAutoScaleRuleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var rule AppRule
+	err = coll.Find(bson.M{"appname": appName, "process": process}).One(&rule)
+	if err != nil {
+		return nil, err
+	}
+	rule.validate()
+	return &rule, nil
+}
+
+func DeleteAppRule(appName, process string) error {
+	coll, err := appAutoScaleRuleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Remove(bson.M{"appname": appName, "process": process})
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const (
+	AppEventKind = "app.autoscale"
+
+	defaultAppScaleTolerance = 0.1
+)
+
+var globalAppScaler *AppScaler
+
+// AppScaler periodically evaluates the enabled app autoscale rules, adding or
+// removing units from app processes based on the metrics returned by the
+// configured MetricsSource.
+type AppScaler struct {
+	RunInterval time.Duration
+	Tolerance   float64
+	source      MetricsSource
+	done        chan bool
+	writer      io.Writer
+	running     bool
+}
+
+type AppScaleResult struct {
+	CurrentUnits int
+	DesiredUnits int
+	Reason       string
+}
+
+func (r *AppScaleResult) NoAction() bool {
+	return r.CurrentUnits == r.DesiredUnits
+}
+
+type AppEventCustomData struct {
+	Result  *AppScaleResult
+	Metrics *ProcessMetrics
+	Rule    *AppRule
+}
+
+// InitializeAppScaler starts the app autoscale worker. The worker is only
+// started when a metrics source is configured.
+func InitializeAppScaler() error {
+	if _, err := config.Get("autoscale:app:metrics-source"); err != nil {
+		return nil
+	}
+	scaler, err := newAppScaler()
+	if err != nil {
+		return err
+	}
+	globalAppScaler = scaler
+	shutdown.Register(globalAppScaler)
+	globalAppScaler.running = true
+	go globalAppScaler.run()
+	return nil
+}
+
+func RunAppScalerOnce(w io.Writer) error {
+	scaler, err := newAppScaler()
+	if err != nil {
+		return err
+	}
+	scaler.writer = w
+	return scaler.runOnce()
+}
+
+func newAppScaler() (*AppScaler, error) {
+	source, err := configuredMetricsSource()
+	if err != nil {
+		return nil, err
+	}
+	runInterval, _ := config.GetInt("autoscale:app:run-interval")
+	tolerance, err := config.GetFloat("autoscale:app:tolerance")
+	if err != nil {
+		tolerance = defaultAppScaleTolerance
+	}
+	s := &AppScaler{
+		RunInterval: time.Duration(runInterval) * time.Second,
+		Tolerance:   tolerance,
+		source:      source,
+		done:        make(chan bool),
+	}
+	if s.RunInterval == 0 {
+		s.RunInterval = time.Minute
+	}
+	return s, nil
+}
+
+func (s *AppScaler) run() error {
+	for {
+		err := s.runScaler()
+		if err != nil {
+			s.logError(err.Error())
+			err = errors.Wrap(err, "[app autoscale]")
+		}
+		select {
+		case <-s.done:
+			return err
+		case <-time.After(s.RunInterval):
+		}
+	}
+}
+
+func (s *AppScaler) runOnce() error {
+	err := s.runScaler()
+	if err != nil {
+		s.logError(err.Error())
+	}
+	return err
+}
+
+func (s *AppScaler) logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[app autoscale] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func (s *AppScaler) logDebug(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[app autoscale] %s", msg)
+	log.Debugf(msg, params...)
+}
+
+func (s *AppScaler) Shutdown(ctx context.Context) error {
+	if !s.running {
+		return nil
+	}
+	s.done <- true
+	s.running = false
+	return nil
+}
+
+func (s *AppScaler) String() string {
+	return "app auto scale"
+}
+
+func (s *AppScaler) runScaler() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	rules, err := ListAppRules("")
+	if err != nil {
+		return errors.Wrap(err, "unable to list app auto scale rules")
+	}
+	for i := range rules {
+		if !rules[i].Enabled || rules[i].Error != "" {
+			continue
+		}
+		s.runScalerForRule(&rules[i])
+	}
+	return nil
+}
+
+func (s *AppScaler) runScalerForRule(rule *AppRule) {
+	a, err := app.GetByName(rule.AppName)
+	if err != nil {
+		s.logError("unable to get app %q: %s", rule.AppName, err)
+		return
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: AppEventKind,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			s.logDebug("skipping already running for: %s", a.Name)
+		} else {
+			s.logError("error creating scale event %s: %s", a.Name, err.Error())
+		}
+		return
+	}
+	evt.SetLogWriter(s.writer)
+	var retErr error
+	customData := AppEventCustomData{Rule: rule}
+	defer func() {
+		if retErr != nil {
+			evt.Logf(retErr.Error())
+		}
+		if customData.Result == nil && retErr == nil || customData.Result != nil && customData.Result.NoAction() {
+			evt.Logf("nothing to do for app %q, process %q", a.Name, rule.Process)
+			evt.Abort()
+		} else {
+			evt.DoneCustomData(retErr, customData)
+		}
+	}()
+	units, err := a.Units()
+	if err != nil {
+		retErr = errors.Wrapf(err, "unable to list units for app %s", a.Name)
+		return
+	}
+	current := 0
+	for _, u := range units {
+		if u.ProcessName == rule.Process {
+			current++
+		}
+	}
+	if current == 0 {
+		evt.Logf("no units for process %q, app autoscale only acts on running processes", rule.Process)
+		return
+	}
+	customData.Metrics, err = s.source.ProcessMetrics(a, rule.Process)
+	if err != nil {
+		retErr = errors.Wrapf(err, "unable to get metrics for app %s", a.Name)
+		return
+	}
+	customData.Result = s.desiredUnits(rule, current, customData.Metrics)
+	result := customData.Result
+	if result.NoAction() {
+		if result.Reason != "" {
+			evt.Logf("keeping %d units for process %q: %s", result.CurrentUnits, rule.Process, result.Reason)
+		}
+		return
+	}
+	evt.Logf("scaling process %q from %d to %d units: %s", rule.Process, result.CurrentUnits, result.DesiredUnits, result.Reason)
+	if result.DesiredUnits > result.CurrentUnits {
+		retErr = a.AddUnits(uint(result.DesiredUnits-result.CurrentUnits), rule.Process, evt)
+	} else {
+		retErr = a.RemoveUnits(uint(result.CurrentUnits-result.DesiredUnits), rule.Process, evt)
+	}
+}
+
+func (s *AppScaler) desiredUnits(rule *AppRule, current int, metrics *ProcessMetrics) *AppScaleResult {
+	result := &AppScaleResult{CurrentUnits: current, DesiredUnits: current}
+	if !metrics.hasData(rule.metricName()) {
+		result.Reason = fmt.Sprintf("no data for %s metric", rule.metricName())
+		return result
+	}
+	var value float64
+	switch rule.metricName() {
+	case "cpu":
+		value = metrics.CPU
+	case "memory":
+		value = metrics.Memory
+	default:
+		value = metrics.Requests / float64(current)
+	}
+	target := rule.target()
+	ratio := value / target
+	if math.Abs(ratio-1) > s.Tolerance {
+		result.DesiredUnits = int(math.Ceil(float64(current) * ratio))
+		result.Reason = fmt.Sprintf("%s usage is %.2f, target is %.2f", rule.metricName(), value, target)
+	}
+	if result.DesiredUnits < int(rule.MinUnits) {
+		result.DesiredUnits = int(rule.MinUnits)
+		result.Reason = fmt.Sprintf("units below minimum of %d", rule.MinUnits)
+	} else if result.DesiredUnits > int(rule.MaxUnits) {
+		result.DesiredUnits = int(rule.MaxUnits)
+		if current > int(rule.MaxUnits) {
+			result.Reason = fmt.Sprintf("units above maximum of %d", rule.MaxUnits)
+		}
+	}
+	return result
+}
@@ -0,0 +1,229 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeMetricsSource struct {
+	metrics map[string]ProcessMetrics
+	err     error
+}
+
+func (f *fakeMetricsSource) ProcessMetrics(a provision.App, process string) (*ProcessMetrics, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	m, ok := f.metrics[a.GetName()+"/"+process]
+	if !ok {
+		return nil, errors.Errorf("no metrics for %s/%s", a.GetName(), process)
+	}
+	return &m, nil
+}
+
+func (s *S) setupFakeMetricsSource(c *check.C, metrics map[string]ProcessMetrics) *fakeMetricsSource {
+	source := &fakeMetricsSource{metrics: metrics}
+	RegisterMetricsSource("fake", source)
+	config.Set("autoscale:app:metrics-source", "fake")
+	err := s.conn.Apps().Update(bson.M{"name": "myapp"}, bson.M{"$set": bson.M{"quota": quota.Unlimited}})
+	c.Assert(err, check.IsNil)
+	return source
+}
+
+func (s *S) tearDownFakeMetricsSource() {
+	UnregisterMetricsSource("fake")
+	config.Unset("autoscale:app:metrics-source")
+}
+
+func (s *S) TestAppRuleUpdate(c *check.C) {
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 3, TargetCPU: 70, Enabled: true}
+	err := rule.Update()
+	c.Assert(err, check.IsNil)
+	rule.MaxUnits = 5
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	rules, err := ListAppRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []AppRule{rule})
+	dbRule, err := AppRuleForProcess("myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(*dbRule, check.DeepEquals, rule)
+}
+
+func (s *S) TestAppRuleUpdateInvalid(c *check.C) {
+	tests := []struct {
+		rule AppRule
+		err  string
+	}{
+		{AppRule{AppName: "myapp", MinUnits: 1, MaxUnits: 2, TargetCPU: 50}, "invalid rule, process is required"},
+		{AppRule{AppName: "myapp", Process: "web", MaxUnits: 2, TargetCPU: 50}, "invalid rule, min units must be greater than 0"},
+		{AppRule{AppName: "myapp", Process: "web", MinUnits: 3, MaxUnits: 2, TargetCPU: 50}, `invalid rule, max units \(2\) must be greater than or equal to min units \(3\)`},
+		{AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 2}, "invalid rule, exactly one of .*"},
+		{AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 2, TargetCPU: 50, TargetMemory: 50}, "invalid rule, exactly one of .*"},
+		{AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 2, TargetCPU: -1}, "invalid rule, targets cannot be negative"},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Update()
+		c.Assert(err, check.ErrorMatches, tt.err)
+		c.Assert(tt.rule.Error, check.Matches, tt.err)
+	}
+	rules, err := ListAppRules("")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+}
+
+func (s *S) TestDeleteAppRule(c *check.C) {
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 3, TargetCPU: 70}
+	err := rule.Update()
+	c.Assert(err, check.IsNil)
+	err = DeleteAppRule("myapp", "web")
+	c.Assert(err, check.IsNil)
+	_, err = AppRuleForProcess("myapp", "web")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+	err = DeleteAppRule("myapp", "web")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+}
+
+func (s *S) TestAppScalerDesiredUnits(c *check.C) {
+	scaler := &AppScaler{Tolerance: 0.1}
+	tests := []struct {
+		rule     AppRule
+		current  int
+		metrics  ProcessMetrics
+		expected int
+	}{
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetCPU: 50}, 2, ProcessMetrics{CPU: 100}, 4},
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetCPU: 50}, 4, ProcessMetrics{CPU: 25}, 2},
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetCPU: 50}, 4, ProcessMetrics{CPU: 54}, 4},
+		{AppRule{MinUnits: 1, MaxUnits: 3, TargetCPU: 50}, 2, ProcessMetrics{CPU: 100}, 3},
+		{AppRule{MinUnits: 2, MaxUnits: 10, TargetMemory: 80}, 4, ProcessMetrics{Memory: 10}, 2},
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetRequestsPerUnit: 100}, 2, ProcessMetrics{Requests: 500}, 5},
+		{AppRule{MinUnits: 3, MaxUnits: 10, TargetCPU: 50}, 1, ProcessMetrics{CPU: 50}, 3},
+		{AppRule{MinUnits: 1, MaxUnits: 2, TargetCPU: 50}, 4, ProcessMetrics{CPU: 50}, 2},
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetCPU: 50}, 4, ProcessMetrics{Missing: []string{"cpu"}}, 4},
+		{AppRule{MinUnits: 3, MaxUnits: 10, TargetCPU: 50}, 1, ProcessMetrics{Missing: []string{"cpu"}}, 1},
+		{AppRule{MinUnits: 1, MaxUnits: 10, TargetCPU: 50}, 2, ProcessMetrics{CPU: 100, Missing: []string{"requests"}}, 4},
+	}
+	for i, tt := range tests {
+		result := scaler.desiredUnits(&tt.rule, tt.current, &tt.metrics)
+		c.Assert(result.CurrentUnits, check.Equals, tt.current)
+		c.Assert(result.DesiredUnits, check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestAppScalerRunOnceAddUnits(c *check.C) {
+	s.setupFakeMetricsSource(c, map[string]ProcessMetrics{"myapp/web": {CPU: 150}})
+	defer s.tearDownFakeMetricsSource()
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	err = RunAppScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 5)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   "app.autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.currentunits": 2,
+			"result.desiredunits": 5,
+			"result.reason":       "cpu usage is 150.00, target is 50.00",
+			"metrics.cpu":         150.0,
+			"rule.process":        "web",
+		},
+		LogMatches: `(?s).*scaling process "web" from 2 to 5 units.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppScalerRunOnceRemoveUnits(c *check.C) {
+	s.setupFakeMetricsSource(c, map[string]ProcessMetrics{"myapp/web": {Requests: 100}})
+	defer s.tearDownFakeMetricsSource()
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 2, MaxUnits: 5, TargetRequestsPerUnit: 100, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	err = RunAppScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:   "app.autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.currentunits": 4,
+			"result.desiredunits": 2,
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppScalerRunOnceNoAction(c *check.C) {
+	s.setupFakeMetricsSource(c, map[string]ProcessMetrics{"myapp/web": {CPU: 50}})
+	defer s.tearDownFakeMetricsSource()
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	err = RunAppScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestAppScalerRunOnceDisabledRule(c *check.C) {
+	s.setupFakeMetricsSource(c, map[string]ProcessMetrics{"myapp/web": {CPU: 150}})
+	defer s.tearDownFakeMetricsSource()
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	err = RunAppScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(s.appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestAppScalerRunOnceMetricsError(c *check.C) {
+	source := s.setupFakeMetricsSource(c, nil)
+	defer s.tearDownFakeMetricsSource()
+	source.err = errors.New("metrics unavailable")
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	rule := AppRule{AppName: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, TargetCPU: 50, Enabled: true}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	err = RunAppScalerOnce(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: "myapp"},
+		Kind:         "app.autoscale",
+		ErrorMatches: `unable to get metrics for app myapp: metrics unavailable`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunAppScalerOnceNoMetricsSource(c *check.C) {
+	err := RunAppScalerOnce(nil)
+	c.Assert(err, check.ErrorMatches, "no metrics source configured for app autoscale.*")
+}
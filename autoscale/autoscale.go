@@ -41,6 +41,8 @@ type Config struct {
 	done                chan bool
 	writer              io.Writer
 	running             bool
+	dryRun              bool
+	dryResults          map[string]*DryRunResult
 	Enabled             bool
 }
 
@@ -65,6 +67,29 @@ func RunOnce(w io.Writer) error {
 	return conf.runOnce()
 }
 
+// DryRunResult is the outcome of a dry run for a single pool. Rules are
+// evaluated even when disabled, RuleDisabled tells whether the result would
+// be applied by the auto scale worker.
+type DryRunResult struct {
+	*ScalerResult
+	RuleDisabled bool   `json:",omitempty"`
+	Error        string `json:",omitempty"`
+}
+
+// RunOnceDry runs the scalers against the current pools without adding,
+// removing or rebalancing nodes, returning the result for each pool.
+func RunOnceDry(w io.Writer) (map[string]*DryRunResult, error) {
+	conf := newConfig()
+	conf.writer = w
+	conf.dryRun = true
+	conf.dryResults = map[string]*DryRunResult{}
+	err := conf.runOnce()
+	if err != nil {
+		return nil, err
+	}
+	return conf.dryResults, nil
+}
+
 func newConfig() *Config {
 	waitSecondsNewMachine, _ := config.GetInt("docker:auto-scale:wait-new-time")
 	runInterval, _ := config.GetInt("docker:auto-scale:run-interval")
@@ -90,6 +115,7 @@ type ScalerResult struct {
 	ToRemove    []provision.NodeSpec
 	ToRebalance bool
 	Reason      string
+	Scheduled   bool
 }
 
 func (r *ScalerResult) IsRebalanceOnly() bool {
@@ -105,10 +131,16 @@ type autoScaler interface {
 }
 
 func (a *Config) scalerForRule(rule *Rule) (autoScaler, error) {
+	var scaler autoScaler
 	if rule.MaxContainerCount > 0 {
-		return &countScaler{Config: a, rule: rule}, nil
+		scaler = &countScaler{Config: a, rule: rule}
+	} else if len(rule.Schedules) == 0 || rule.hasMemoryInfo() {
+		scaler = &memoryScaler{Config: a, rule: rule}
+	}
+	if len(rule.Schedules) > 0 {
+		return &scheduleScaler{Config: a, rule: rule, base: scaler}, nil
 	}
-	return &memoryScaler{Config: a, rule: rule}, nil
+	return scaler, nil
 }
 
 func (a *Config) run() error {
@@ -235,6 +267,20 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 		if retErr != nil {
 			evt.Logf(retErr.Error())
 		}
+		if a.dryRun {
+			result := &DryRunResult{ScalerResult: customData.Result}
+			if customData.Rule != nil {
+				result.RuleDisabled = !customData.Rule.Enabled
+			}
+			if retErr != nil {
+				result.Error = retErr.Error()
+			}
+			if result.ScalerResult != nil || result.Error != "" {
+				a.dryResults[pool] = result
+			}
+			evt.Abort()
+			return
+		}
 		if (customData.Result == nil && retErr == nil) || (customData.Result != nil && customData.Result.NoAction()) {
 			evt.Logf("nothing to do for %q: %q", provision.PoolMetadataName, pool)
 			evt.Abort()
@@ -256,7 +302,9 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 	}
 	if !customData.Rule.Enabled {
 		evt.Logf("auto scale rule disabled for %s", pool)
-		return
+		if !a.dryRun {
+			return
+		}
 	}
 	scaler, err := a.scalerForRule(customData.Rule)
 	if err != nil {
@@ -273,7 +321,15 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 		retErr = errors.Wrapf(err, "error scaling group %s", pool)
 		return
 	}
-	if customData.Result.ToAdd > 0 {
+	if a.dryRun {
+		if customData.Result.ToAdd > 0 {
+			evt.Logf("would add %d nodes to %q", customData.Result.ToAdd, pool)
+		} else if len(customData.Result.ToRemove) > 0 {
+			for _, n := range customData.Result.ToRemove {
+				evt.Logf("would remove node %s from %q", n.Address, pool)
+			}
+		}
+	} else if customData.Result.ToAdd > 0 {
 		evt.Logf("running event \"add\" for %q: %#v", pool, customData.Result)
 		customData.Nodes, err = a.addMultipleNodes(evt, prov, pool, nodes, customData.Result.ToAdd)
 		if err != nil {
@@ -282,6 +338,12 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 			}
 			evt.Logf("not all required nodes were created: %s", err)
 		}
+		if customData.Result.Scheduled {
+			err = markScheduledNodes(pool, customData.Nodes)
+			if err != nil {
+				evt.Logf("unable to store nodes added by schedule: %s", err)
+			}
+		}
 	} else if len(customData.Result.ToRemove) > 0 {
 		evt.Logf("running event \"remove\" for %q: %#v", pool, customData.Result)
 		customData.Nodes = customData.Result.ToRemove
@@ -290,11 +352,15 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 			retErr = err
 			return
 		}
+		err = unmarkScheduledNodes(customData.Result.ToRemove)
+		if err != nil {
+			evt.Logf("unable to remove nodes added by schedule: %s", err)
+		}
 	}
 	if !customData.Rule.PreventRebalance {
 		err := a.rebalanceIfNeeded(evt, prov, pool, nodes, &customData)
 		if err != nil {
-			if customData.Result.IsRebalanceOnly() {
+			if customData.Result.IsRebalanceOnly() || a.dryRun {
 				retErr = err
 			} else {
 				evt.Logf("unable to rebalance: %s", err.Error())
@@ -318,9 +384,10 @@ func (a *Config) rebalanceIfNeeded(evt *event.Event, prov provision.NodeProvisio
 		defer evt.SetLogWriter(oldWriter)
 	}
 	shouldRebalance, err := rebalanceProv.RebalanceNodes(provision.RebalanceNodesOptions{
-		Force: len(customData.Nodes) > 0,
+		Force: len(customData.Nodes) > 0 || (a.dryRun && customData.Result.ToAdd > 0),
 		Pool:  pool,
 		Event: evt,
+		Dry:   a.dryRun,
 	})
 	customData.Result.ToRebalance = shouldRebalance
 	if err != nil {
@@ -364,7 +431,7 @@ func (a *Config) addNode(evt *event.Event, prov provision.NodeProvisioner, pool
 	if !hasIaas {
 		return nil, errors.Errorf("no IaaS information in nodes metadata: %#v", metadata)
 	}
-	machine, err := iaas.CreateMachineForIaaS(metadata[provision.IaaSMetadataName], metadata)
+	machine, err := iaas.CreateMachine(metadata)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create machine")
 	}
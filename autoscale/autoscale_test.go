@@ -1188,3 +1188,91 @@ func (s *S) TestChooseMetadataFromNodes(c *check.C) {
 	_, err = chooseMetadataFromNodes(nodes)
 	c.Assert(err, check.ErrorMatches, "unbalanced metadata for node group:.*")
 }
+
+func (s *S) TestAutoScaleRunOnceDry(c *check.C) {
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	results, err := RunOnceDry(buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.DeepEquals, map[string]*DryRunResult{
+		"pool1": {ScalerResult: &ScalerResult{ToAdd: 1, ToRebalance: true, Reason: "number of free slots is -2"}},
+	})
+	c.Assert(buf.String(), check.Matches, `(?s).*running scaler.*countScaler.*pool1.*would add 1 nodes to "pool1".*rebalancing - dry: true, force: true.*`)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestAutoScaleRunOnceDryRemove(c *check.C) {
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Pool:    "pool1",
+		Metadata: map[string]string{
+			"iaas":     "my-scale-iaas",
+			"totalMem": "25165824",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	results, err := RunOnceDry(buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+	c.Assert(results["pool1"].ToAdd, check.Equals, 0)
+	c.Assert(results["pool1"].ToRemove, check.HasLen, 1)
+	c.Assert(results["pool1"].ToRebalance, check.Equals, false)
+	c.Assert(results["pool1"].Reason, check.Equals, "number of free slots is 4")
+	c.Assert(buf.String(), check.Matches, `(?s).*would remove node http://n[12]:[12] from "pool1".*`)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestAutoScaleRunOnceDryDisabledRule(c *check.C) {
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(Rule{MetadataFilter: "pool1", Enabled: false, MaxContainerCount: 2})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	results, err := RunOnceDry(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.DeepEquals, map[string]*DryRunResult{
+		"pool1": {
+			ScalerResult: &ScalerResult{ToAdd: 1, ToRebalance: true, Reason: "number of free slots is -2"},
+			RuleDisabled: true,
+		},
+	})
+	a := newConfig()
+	a.runOnce()
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
+
+func (s *S) TestAutoScaleRunOnceDryError(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	config.Set("docker:scheduler:max-used-memory", 0.8)
+	config.Set("docker:scheduler:total-memory-metadata", "totalMem")
+	err := app.PlanRemove("default")
+	c.Assert(err, check.IsNil)
+	err = app.SavePlan(appTypes.Plan{Memory: 25165824, Name: "default", CpuShare: 10})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	results, err := RunOnceDry(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 1)
+	c.Assert(results["pool1"].ScalerResult, check.IsNil)
+	c.Assert(results["pool1"].Error, check.Matches, `error scaling group pool1: aborting, impossible to fit max plan memory.*`)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
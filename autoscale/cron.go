@@ -0,0 +1,139 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cronSchedule is a parsed standard five field cron expression (minute, hour,
+// day of month, month and day of week). Each field supports "*", lists,
+// ranges and steps, e.g. "0 8-18/2 * * 1,3,5".
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, errors.Errorf("invalid cron expression %q: expected %d fields, got %d", expr, len(cronFields), len(parts))
+	}
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		var err error
+		bits[i], err = parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron expression %q", expr)
+		}
+	}
+	// Sunday may be either 0 or 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+		bits[4] &^= 1 << 7
+	}
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(value, ",") {
+		rangePart, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			var err error
+			rangePart = item[:idx]
+			step, err = strconv.Atoi(item[idx+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step in %s field: %q", field.name, item)
+			}
+		}
+		start, end := field.min, field.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, errors.Errorf("invalid value in %s field: %q", field.name, item)
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, errors.Errorf("invalid value in %s field: %q", field.name, item)
+				}
+			} else if step > 1 {
+				end = field.max
+			}
+		}
+		if start < field.min || end > field.max || start > end {
+			return 0, errors.Errorf("%s field out of range [%d-%d]: %q", field.name, field.min, field.max, item)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time after t matching the schedule, or the zero
+// time if no such time exists in the next five years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// ProcessMetrics holds the current usage of an app process. CPU and Memory
+// are the average percentage of the units limits in use, Requests is the
+// total number of requests per second handled by the process. Missing lists
+// the metrics for which the source had no data, the autoscaler never acts on
+// those.
+type ProcessMetrics struct {
+	CPU      float64
+	Memory   float64
+	Requests float64
+	Missing  []string `json:",omitempty" bson:",omitempty"`
+}
+
+func (m *ProcessMetrics) hasData(name string) bool {
+	for _, missing := range m.Missing {
+		if missing == name {
+			return false
+		}
+	}
+	return true
+}
+
+// MetricsSource is the interface that must be implemented by sources of
+// metrics used by the app autoscaler.
+type MetricsSource interface {
+	ProcessMetrics(a provision.App, process string) (*ProcessMetrics, error)
+}
+
+var (
+	metricsSourcesMu sync.RWMutex
+	metricsSources   = map[string]MetricsSource{}
+)
+
+// RegisterMetricsSource registers a new metrics source, which can be selected
+// using the autoscale:app:metrics-source config entry.
+func RegisterMetricsSource(name string, source MetricsSource) {
+	metricsSourcesMu.Lock()
+	defer metricsSourcesMu.Unlock()
+	metricsSources[name] = source
+}
+
+func UnregisterMetricsSource(name string) {
+	metricsSourcesMu.Lock()
+	defer metricsSourcesMu.Unlock()
+	delete(metricsSources, name)
+}
+
+func GetMetricsSource(name string) (MetricsSource, error) {
+	metricsSourcesMu.RLock()
+	defer metricsSourcesMu.RUnlock()
+	source, ok := metricsSources[name]
+	if !ok {
+		return nil, errors.Errorf("unknown metrics source: %q", name)
+	}
+	return source, nil
+}
+
+func configuredMetricsSource() (MetricsSource, error) {
+	name, err := config.GetString("autoscale:app:metrics-source")
+	if err != nil {
+		return nil, errors.Wrap(err, "no metrics source configured for app autoscale")
+	}
+	return GetMetricsSource(name)
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const (
+	defaultPrometheusCPUQuery = `avg(rate(container_cpu_usage_seconds_total{tsuru_app_name="{{.App}}",tsuru_process_name="{{.Process}}"}[1m]) / ignoring(cpu) ((container_spec_cpu_quota{tsuru_app_name="{{.App}}",tsuru_process_name="{{.Process}}"} > 0) / container_spec_cpu_period{tsuru_app_name="{{.App}}",tsuru_process_name="{{.Process}}"})) * 100`
+
+	defaultPrometheusMemoryQuery = `avg(container_memory_usage_bytes{tsuru_app_name="{{.App}}",tsuru_process_name="{{.Process}}"} / (container_spec_memory_limit_bytes{tsuru_app_name="{{.App}}",tsuru_process_name="{{.Process}}"} > 0)) * 100`
+
+	defaultPrometheusRequestsQuery = `sum(rate(tsuru_router_requests_total{app="{{.App}}"}[1m]))`
+)
+
+func init() {
+	RegisterMetricsSource("prometheus", &prometheusSource{})
+}
+
+// prometheusSource fetches process metrics by running instant queries against
+// the Prometheus HTTP API. Queries are text/template strings receiving App and
+// Process and can be customized using autoscale:app:prometheus:*-query.
+type prometheusSource struct{}
+
+// errNoMetricData is returned by query when Prometheus has no series matching
+// the query, e.g. during a scrape gap or with a misspelled metric name, or
+// when the value is not finite, e.g. after a division by zero.
+var errNoMetricData = errors.New("no data returned by prometheus")
+
+type prometheusQueryResponse struct {
+	Status string
+	Error  string
+	Data   struct {
+		ResultType string
+		Result     []struct {
+			Value []interface{}
+		}
+	}
+}
+
+func (s *prometheusSource) ProcessMetrics(a provision.App, process string) (*ProcessMetrics, error) {
+	address, err := config.GetString("autoscale:app:prometheus:address")
+	if err != nil {
+		return nil, errors.Wrap(err, "prometheus address not configured")
+	}
+	var metrics ProcessMetrics
+	queries := []struct {
+		name         string
+		defaultQuery string
+		dst          *float64
+	}{
+		{name: "cpu", defaultQuery: defaultPrometheusCPUQuery, dst: &metrics.CPU},
+		{name: "memory", defaultQuery: defaultPrometheusMemoryQuery, dst: &metrics.Memory},
+		{name: "requests", defaultQuery: defaultPrometheusRequestsQuery, dst: &metrics.Requests},
+	}
+	for _, q := range queries {
+		queryTemplate, _ := config.GetString("autoscale:app:prometheus:" + q.name + "-query")
+		if queryTemplate == "" {
+			queryTemplate = q.defaultQuery
+		}
+		query, err := renderQuery(queryTemplate, a.GetName(), process)
+		if err != nil {
+			return nil, err
+		}
+		*q.dst, err = s.query(address, query)
+		if err == errNoMetricData {
+			metrics.Missing = append(metrics.Missing, q.name)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to query %s metrics", q.name)
+		}
+	}
+	return &metrics, nil
+}
+
+func renderQuery(queryTemplate, appName, process string) (string, error) {
+	tpl, err := template.New("query").Parse(queryTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid query template")
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, struct{ App, Process string }{App: appName, Process: process})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (s *prometheusSource) query(address, query string) (float64, error) {
+	u := strings.TrimRight(address, "/") + "/api/v1/query?" + url.Values{"query": []string{query}}.Encode()
+	rsp, err := net.Dial5Full60ClientNoKeepAlive.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	var data prometheusQueryResponse
+	err = json.NewDecoder(rsp.Body).Decode(&data)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid response from prometheus, status code %d", rsp.StatusCode)
+	}
+	if rsp.StatusCode != http.StatusOK || data.Status != "success" {
+		return 0, errors.Errorf("prometheus query failed with status code %d: %s", rsp.StatusCode, data.Error)
+	}
+	if len(data.Data.Result) == 0 {
+		return 0, errNoMetricData
+	}
+	value := data.Data.Result[0].Value
+	if len(value) != 2 {
+		return 0, errors.Errorf("invalid prometheus sample: %v", value)
+	}
+	str, _ := value[1].(string)
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid prometheus sample: %v", value)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errNoMetricData
+	}
+	return v, nil
+}
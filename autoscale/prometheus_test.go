@@ -0,0 +1,61 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPrometheusProcessMetrics(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		switch {
+		case strings.Contains(query, "container_cpu_usage_seconds_total"):
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"value":[1520000000,"42.5"]}]}}`))
+		default:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		}
+	}))
+	defer srv.Close()
+	config.Set("autoscale:app:prometheus:address", srv.URL)
+	defer config.Unset("autoscale:app:prometheus:address")
+	source := &prometheusSource{}
+	metrics, err := source.ProcessMetrics(s.appInstance, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, &ProcessMetrics{CPU: 42.5, Missing: []string{"memory", "requests"}})
+	scaler := &AppScaler{Tolerance: 0.1}
+	result := scaler.desiredUnits(&AppRule{MinUnits: 1, MaxUnits: 10, TargetMemory: 80}, 4, metrics)
+	c.Assert(result.NoAction(), check.Equals, true)
+	c.Assert(result.Reason, check.Equals, "no data for memory metric")
+}
+
+func (s *S) TestPrometheusQueryError(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"error","error":"parse error"}`))
+	}))
+	defer srv.Close()
+	source := &prometheusSource{}
+	_, err := source.query(srv.URL, "invalid{")
+	c.Assert(err, check.ErrorMatches, "prometheus query failed with status code 400: parse error")
+}
+
+func (s *S) TestPrometheusQueryNotFinite(c *check.C) {
+	var value string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"value":[1520000000,"` + value + `"]}]}}`))
+	}))
+	defer srv.Close()
+	source := &prometheusSource{}
+	for _, value = range []string{"+Inf", "-Inf", "NaN"} {
+		_, err := source.query(srv.URL, "up")
+		c.Assert(err, check.Equals, errNoMetricData, check.Commentf("value %s", value))
+	}
+}
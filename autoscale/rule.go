@@ -23,6 +23,7 @@ type Rule struct {
 	MaxMemoryRatio    float32
 	Enabled           bool
 	PreventRebalance  bool
+	Schedules         []ScheduleWindow
 }
 
 type ruleList []Rule
@@ -43,8 +44,15 @@ func (r *Rule) normalize() error {
 		maxMemoryRatio, _ := config.GetFloat("docker:scheduler:max-used-memory")
 		r.MaxMemoryRatio = float32(maxMemoryRatio)
 	}
-	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
-	if r.Enabled && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
+	for i := range r.Schedules {
+		err := r.Schedules[i].validate()
+		if err != nil {
+			err = errors.Wrap(err, "invalid rule")
+			r.Error = err.Error()
+			return err
+		}
+	}
+	if r.Enabled && r.MaxContainerCount <= 0 && !r.hasMemoryInfo() && len(r.Schedules) == 0 {
 		err := errors.Errorf("invalid rule, either memory information or max container count must be set")
 		r.Error = err.Error()
 		return err
@@ -52,6 +60,11 @@ func (r *Rule) normalize() error {
 	return nil
 }
 
+func (r *Rule) hasMemoryInfo() bool {
+	totalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
+	return totalMemoryMetadata != "" && r.MaxMemoryRatio > 0
+}
+
 func (r *Rule) Update() error {
 	coll, err := autoScaleRuleCollection()
 	if err != nil {
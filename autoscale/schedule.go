@@ -0,0 +1,229 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var timeNow = time.Now
+
+// ScheduleWindow is a recurring time window, delimited by two cron
+// expressions, during which a pool must have at least MinNodes nodes.
+type ScheduleWindow struct {
+	Name     string
+	Start    string
+	End      string
+	MinNodes int
+}
+
+func (w *ScheduleWindow) validate() error {
+	if w.MinNodes <= 0 {
+		return errors.Errorf("invalid schedule %q, min nodes must be greater than 0", w.Name)
+	}
+	if _, err := parseCron(w.Start); err != nil {
+		return errors.Wrapf(err, "invalid schedule %q start", w.Name)
+	}
+	if _, err := parseCron(w.End); err != nil {
+		return errors.Wrapf(err, "invalid schedule %q end", w.Name)
+	}
+	return nil
+}
+
+// isActive returns whether now is inside the window, which is the case when
+// the next end of the window happens before its next start.
+func (w *ScheduleWindow) isActive(now time.Time) (bool, error) {
+	start, err := parseCron(w.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseCron(w.End)
+	if err != nil {
+		return false, err
+	}
+	nextStart, nextEnd := start.next(now), end.next(now)
+	if nextEnd.IsZero() {
+		return false, nil
+	}
+	return nextStart.IsZero() || nextEnd.Before(nextStart), nil
+}
+
+// activeSchedule returns the active schedule window in the rule requiring the
+// highest number of nodes, or nil if no window is active.
+func (r *Rule) activeSchedule(now time.Time) (*ScheduleWindow, error) {
+	var active *ScheduleWindow
+	for i := range r.Schedules {
+		isActive, err := r.Schedules[i].isActive(now)
+		if err != nil {
+			return nil, err
+		}
+		if isActive && (active == nil || r.Schedules[i].MinNodes > active.MinNodes) {
+			active = &r.Schedules[i]
+		}
+	}
+	return active, nil
+}
+
+// scheduleScaler enforces the minimum number of nodes of the active schedule
+// windows on top of the count or memory scalers. For rules with schedules
+// only, nodes added by a window are removed once it's over.
+type scheduleScaler struct {
+	*Config
+	rule *Rule
+	base autoScaler
+}
+
+func (a *scheduleScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	result := &ScalerResult{}
+	if a.base != nil {
+		var err error
+		result, err = a.base.scale(pool, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	window, err := a.rule.activeSchedule(timeNow())
+	if err != nil {
+		return nil, err
+	}
+	minNodes := 0
+	if window != nil {
+		minNodes = window.MinNodes
+	}
+	if len(nodes)+result.ToAdd < minNodes {
+		return &ScalerResult{
+			ToAdd:     minNodes - len(nodes),
+			Reason:    fmt.Sprintf("schedule %q requires at least %d nodes, pool has %d", window.Name, minNodes, len(nodes)),
+			Scheduled: true,
+		}, nil
+	}
+	if len(result.ToRemove) > 0 {
+		maxRemove := len(nodes) - minNodes
+		if maxRemove <= 0 {
+			return &ScalerResult{}, nil
+		}
+		if len(result.ToRemove) > maxRemove {
+			result.ToRemove = result.ToRemove[:maxRemove]
+		}
+		return result, nil
+	}
+	if a.base != nil || !result.NoAction() || len(nodes) <= minNodes {
+		return result, nil
+	}
+	scheduled, err := scheduledNodes(pool)
+	if err != nil {
+		return nil, err
+	}
+	chosenNodes := chooseScheduledNodeForRemoval(nodes, scheduled, len(nodes)-minNodes)
+	if len(chosenNodes) == 0 {
+		return result, nil
+	}
+	return &ScalerResult{
+		ToRemove:  nodesToSpec(chosenNodes),
+		Reason:    fmt.Sprintf("no active schedule, removing %d nodes added by schedules", len(chosenNodes)),
+		Scheduled: true,
+	}, nil
+}
+
+func chooseScheduledNodeForRemoval(nodes []provision.Node, scheduled map[string]struct{}, toRemoveCount int) []provision.Node {
+	var chosenNodes []provision.Node
+	remainingNodes := make([]provision.Node, len(nodes))
+	copy(remainingNodes, nodes)
+	for _, node := range nodes {
+		if len(chosenNodes) >= toRemoveCount {
+			break
+		}
+		if _, ok := scheduled[node.Address()]; !ok {
+			continue
+		}
+		canRemove, _ := canRemoveNode(node, remainingNodes)
+		if !canRemove {
+			continue
+		}
+		for i := range remainingNodes {
+			if remainingNodes[i].Address() == node.Address() {
+				remainingNodes = append(remainingNodes[:i], remainingNodes[i+1:]...)
+				break
+			}
+		}
+		chosenNodes = append(chosenNodes, node)
+	}
+	return chosenNodes
+}
+
+type scheduledNode struct {
+	Address string `bson:"_id"`
+	Pool    string
+}
+
+func scheduledNodesCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		name = "docker"
+	}
+	return conn.Collection(fmt.Sprintf("%s_auto_scale_scheduled_nodes", name)), nil
+}
+
+func scheduledNodes(pool string) (map[string]struct{}, error) {
+	coll, err := scheduledNodesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var nodes []scheduledNode
+	err = coll.Find(bson.M{"pool": pool}).All(&nodes)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		result[n.Address] = struct{}{}
+	}
+	return result, nil
+}
+
+func markScheduledNodes(pool string, nodes []provision.NodeSpec) error {
+	coll, err := scheduledNodesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	for _, n := range nodes {
+		_, err = coll.UpsertId(n.Address, scheduledNode{Address: n.Address, Pool: pool})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarkScheduledNodes(nodes []provision.NodeSpec) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	coll, err := scheduledNodesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	addrs := make([]string, len(nodes))
+	for i, n := range nodes {
+		addrs[i] = n.Address
+	}
+	_, err = coll.RemoveAll(bson.M{"_id": bson.M{"$in": addrs}})
+	return err
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestParseCronNext(c *check.C) {
+	base := time.Date(2018, time.January, 1, 8, 30, 15, 0, time.UTC) // Monday
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.January, 1, 8, 31, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2018, time.January, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1", time.Date(2018, time.January, 8, 7, 0, 0, 0, time.UTC)},
+		{"*/20 8-9 * * *", time.Date(2018, time.January, 1, 8, 40, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 0", time.Date(2018, time.January, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2018, time.January, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"15,45 10 3 * 5", time.Date(2018, time.January, 1, 10, 15, 0, 0, time.UTC).AddDate(0, 0, 2)},
+	}
+	for _, tt := range tests {
+		sched, err := parseCron(tt.expr)
+		c.Assert(err, check.IsNil)
+		c.Assert(sched.next(base), check.DeepEquals, tt.expected, check.Commentf("expr: %s", tt.expr))
+	}
+}
+
+func (s *S) TestParseCronInvalid(c *check.C) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"* * * *", `invalid cron expression "\* \* \* \*": expected 5 fields, got 4`},
+		{"60 * * * *", `.*minute field out of range \[0-59\]: "60"`},
+		{"* 5-2 * * *", `.*hour field out of range \[0-23\]: "5-2"`},
+		{"* * 0 * *", `.*day of month field out of range \[1-31\]: "0"`},
+		{"*/0 * * * *", `.*invalid step in minute field: "\*/0"`},
+		{"a * * * *", `.*invalid value in minute field: "a"`},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		c.Assert(err, check.ErrorMatches, tt.err)
+	}
+}
+
+func (s *S) TestScheduleWindowIsActive(c *check.C) {
+	w := ScheduleWindow{Name: "monday", Start: "0 7 * * 1", End: "0 12 * * 1", MinNodes: 2}
+	tests := []struct {
+		now    time.Time
+		active bool
+	}{
+		{time.Date(2018, time.January, 1, 6, 59, 0, 0, time.UTC), false},
+		{time.Date(2018, time.January, 1, 7, 0, 0, 0, time.UTC), true},
+		{time.Date(2018, time.January, 1, 11, 59, 0, 0, time.UTC), true},
+		{time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC), false},
+		{time.Date(2018, time.January, 3, 9, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		active, err := w.isActive(tt.now)
+		c.Assert(err, check.IsNil)
+		c.Assert(active, check.Equals, tt.active, check.Commentf("now: %s", tt.now))
+	}
+}
+
+func (s *S) TestRuleUpdateInvalidSchedule(c *check.C) {
+	rule := Rule{MetadataFilter: "pool1", Enabled: true, Schedules: []ScheduleWindow{
+		{Name: "w1", Start: "0 7 * *", End: "0 12 * * 1", MinNodes: 2},
+	}}
+	err := rule.Update()
+	c.Assert(err, check.ErrorMatches, `invalid rule: invalid schedule "w1" start: invalid cron expression.*`)
+	rule.Schedules[0].Start = "0 7 * * 1"
+	rule.Schedules[0].MinNodes = 0
+	err = rule.Update()
+	c.Assert(err, check.ErrorMatches, `invalid rule: invalid schedule "w1", min nodes must be greater than 0`)
+	rule.Schedules[0].MinNodes = 2
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAutoScaleConfigRunOnceScheduleAddAndRemove(c *check.C) {
+	defer func() { timeNow = time.Now }()
+	rule := Rule{MetadataFilter: "pool1", Enabled: true, Schedules: []ScheduleWindow{
+		{Name: "monday-peak", Start: "0 7 * * 1", End: "0 12 * * 1", MinNodes: 3},
+	}}
+	err := rule.Update()
+	c.Assert(err, check.IsNil)
+	timeNow = func() time.Time { return time.Date(2018, time.January, 1, 8, 0, 0, 0, time.UTC) }
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 3, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":     2,
+			"result.scheduled": true,
+			"result.reason":    `schedule "monday-peak" requires at least 3 nodes, pool has 1`,
+			"nodes":            bson.M{"$size": 2},
+		},
+		LogMatches: `(?s).*running scaler.*scheduleScaler.*pool1.*new machine created.*`,
+	}, eventtest.HasEvent)
+	scheduled, err := scheduledNodes("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(scheduled, check.DeepEquals, map[string]struct{}{"http://n2:2": {}, "http://n3:3": {}})
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 3)
+	timeNow = func() time.Time { return time.Date(2018, time.January, 1, 12, 30, 0, 0, time.UTC) }
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(nodes[0].Address(), check.Equals, "http://n1:1")
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toremove":  bson.M{"$size": 2},
+			"result.scheduled": true,
+			"result.reason":    "no active schedule, removing 2 nodes added by schedules",
+		},
+	}, eventtest.HasEvent)
+	scheduled, err = scheduledNodes("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(scheduled, check.HasLen, 0)
+	evts, err := ListAutoScaleEvents(0, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+}
+
+func (s *S) TestAutoScaleConfigRunOnceScheduleKeepsMinNodes(c *check.C) {
+	defer func() { timeNow = time.Now }()
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Pool:    "pool1",
+		Metadata: map[string]string{
+			"iaas":     "my-scale-iaas",
+			"totalMem": "25165824",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	rule := Rule{MetadataFilter: "pool1", Enabled: true, MaxContainerCount: 2, Schedules: []ScheduleWindow{
+		{Name: "monday-peak", Start: "0 7 * * 1", End: "0 12 * * 1", MinNodes: 2},
+	}}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	timeNow = func() time.Time { return time.Date(2018, time.January, 1, 8, 0, 0, 0, time.UTC) }
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	timeNow = func() time.Time { return time.Date(2018, time.January, 1, 13, 0, 0, 0, time.UTC) }
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err = s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	tsuruNet "github.com/tsuru/tsuru/net"
@@ -29,6 +30,10 @@ type login struct {
 	scheme *loginScheme
 }
 
+// twoFactorHeader is set by the API when the user must provide a two-factor
+// authentication code to log in.
+const twoFactorHeader = "X-Tsuru-Two-Factor"
+
 func nativeLogin(context *Context, client *Client) error {
 	var email string
 	if len(context.Args) > 0 {
@@ -43,19 +48,16 @@ func nativeLogin(context *Context, client *Client) error {
 		return err
 	}
 	fmt.Fprintln(context.Stdout)
-	u, err := GetURL("/users/" + email + "/tokens")
-	if err != nil {
-		return err
-	}
 	v := url.Values{}
 	v.Set("password", password)
-	b := strings.NewReader(v.Encode())
-	request, err := http.NewRequest("POST", u, b)
-	if err != nil {
-		return err
+	response, err := requestLoginToken(client, email, v)
+	if err == errUnauthorized && response.Header.Get(twoFactorHeader) == "required" {
+		fmt.Fprint(context.Stdout, "Two-factor authentication code: ")
+		var code string
+		fmt.Fscanf(context.Stdin, "%s\n", &code)
+		v.Set("otp", code)
+		response, err = requestLoginToken(client, email, v)
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := client.Do(request)
 	if err != nil {
 		return err
 	}
@@ -73,6 +75,19 @@ func nativeLogin(context *Context, client *Client) error {
 	return writeToken(out["token"].(string))
 }
 
+func requestLoginToken(client *Client, email string, v url.Values) (*http.Response, error) {
+	u, err := GetURL("/users/" + email + "/tokens")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(request)
+}
+
 func (c *login) getScheme() *loginScheme {
 	if c.scheme == nil {
 		info, err := schemeInfo()
@@ -86,7 +101,7 @@ func (c *login) getScheme() *loginScheme {
 }
 
 func (c *login) Run(context *Context, client *Client) error {
-	if c.getScheme().Name == "oauth" {
+	if c.getScheme().Name == "oauth" || c.getScheme().Name == "oidc" {
 		return c.oauthLogin(context, client)
 	}
 	if c.getScheme().Name == "saml" {
@@ -141,6 +156,7 @@ type APIRolePermissionData struct {
 	Name         string
 	ContextType  string
 	ContextValue string
+	ExpiresAt    *time.Time `json:",omitempty"`
 }
 
 // APIUser is a user in the tsuru API.
@@ -157,6 +173,9 @@ func (u *APIUser) RoleInstances() []string {
 			r.ContextValue = " " + r.ContextValue
 		}
 		roles[i] = fmt.Sprintf("%s(%s%s)", r.Name, r.ContextType, r.ContextValue)
+		if r.ExpiresAt != nil {
+			roles[i] += fmt.Sprintf(" expires at %s", r.ExpiresAt.Local().Format(time.RFC822))
+		}
 	}
 	sort.Strings(roles)
 	return roles
@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/tsuru/tsuru/cmd/cmdtest"
 	"github.com/tsuru/tsuru/fs/fstest"
@@ -54,6 +55,49 @@ func (s *S) TestNativeLogin(c *check.C) {
 	c.Assert(token, check.Equals, "sometoken")
 }
 
+func (s *S) TestNativeLoginTwoFactor(c *check.C) {
+	os.Unsetenv("TSURU_TOKEN")
+	nativeScheme()
+	fsystem = &fstest.RecordingFs{FileContent: "old-token"}
+	defer func() {
+		fsystem = nil
+	}()
+	expected := "Password: \nTwo-factor authentication code: Successfully logged in!\n"
+	reader := strings.NewReader("chico\n123456\n")
+	context := Context{[]string{"foo@foo.com"}, globalManager.stdout, globalManager.stderr, reader}
+	transport := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{
+					Message: "Two-factor authentication code required.",
+					Status:  http.StatusUnauthorized,
+					Headers: map[string][]string{"X-Tsuru-Two-Factor": {"required"}},
+				},
+				CondFunc: func(r *http.Request) bool {
+					return r.FormValue("password") == "chico" && r.FormValue("otp") == ""
+				},
+			},
+			{
+				Transport: cmdtest.Transport{
+					Message: `{"token": "sometoken"}`,
+					Status:  http.StatusOK,
+				},
+				CondFunc: func(r *http.Request) bool {
+					return r.FormValue("password") == "chico" && r.FormValue("otp") == "123456"
+				},
+			},
+		},
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, globalManager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(globalManager.stdout.(*bytes.Buffer).String(), check.Equals, expected)
+	token, err := ReadToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "sometoken")
+}
+
 func (s *S) TestNativeLoginWithoutEmailFromArg(c *check.C) {
 	os.Unsetenv("TSURU_TOKEN")
 	nativeScheme()
@@ -325,6 +369,21 @@ Permissions:
 	c.Assert(called, check.Equals, true)
 }
 
+func (s *S) TestAPIUserRoleInstancesWithExpiration(c *check.C) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+	expiresAt := time.Date(2018, 5, 10, 14, 30, 0, 0, time.UTC)
+	u := APIUser{Roles: []APIRolePermissionData{
+		{Name: "oncall", ContextType: "global"},
+		{Name: "deployer", ContextType: "team", ContextValue: "ops", ExpiresAt: &expiresAt},
+	}}
+	c.Assert(u.RoleInstances(), check.DeepEquals, []string{
+		"deployer(team ops) expires at 10 May 18 14:30 UTC",
+		"oncall(global)",
+	})
+}
+
 func (s *S) TestPasswordFromReaderUsingFile(c *check.C) {
 	tmpdir, err := filepath.EvalSymlinks(os.TempDir())
 	filename := path.Join(tmpdir, "password-reader.txt")
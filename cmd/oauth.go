@@ -5,6 +5,9 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -61,11 +64,58 @@ func port(schemeData map[string]string) string {
 	return ":0"
 }
 
-func convertToken(code, redirectURL string) (string, error) {
+// pkceLogin holds the parameters of a login using Proof Key for Code Exchange
+// (RFC 7636), required by the oidc scheme.
+type pkceLogin struct {
+	verifier string
+	state    string
+}
+
+func randomURLString(size int) (string, error) {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func newPKCELogin() (*pkceLogin, error) {
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomURLString(16)
+	if err != nil {
+		return nil, err
+	}
+	return &pkceLogin{verifier: verifier, state: state}, nil
+}
+
+// authURL adds the S256 code challenge and the state to the authorization
+// URL.
+func (p *pkceLogin) authURL(authURL string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(p.verifier))
+	q := u.Query()
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	q.Set("state", p.state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func convertToken(code, redirectURL string, pkce *pkceLogin) (string, error) {
 	var token string
 	v := url.Values{}
 	v.Set("code", code)
 	v.Set("redirectUrl", redirectURL)
+	if pkce != nil {
+		v.Set("code_verifier", pkce.verifier)
+	}
 	u, err := GetURL("/auth/login")
 	if err != nil {
 		return token, errors.Wrap(err, "Error in GetURL")
@@ -79,6 +129,9 @@ func convertToken(code, redirectURL string) (string, error) {
 	if err != nil {
 		return token, errors.Wrap(err, "Error reading body")
 	}
+	if resp.StatusCode != http.StatusOK {
+		return token, errors.Errorf("Error during login: %s", strings.TrimSpace(string(result)))
+	}
 	data := make(map[string]interface{})
 	err = json.Unmarshal(result, &data)
 	if err != nil {
@@ -87,13 +140,19 @@ func convertToken(code, redirectURL string) (string, error) {
 	return data["token"].(string), nil
 }
 
-func callback(redirectURL string, finish chan bool) http.HandlerFunc {
+func callback(redirectURL string, pkce *pkceLogin, finish chan bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			finish <- true
 		}()
 		var page string
-		token, err := convertToken(r.URL.Query().Get("code"), redirectURL)
+		var token string
+		var err error
+		if pkce != nil && r.URL.Query().Get("state") != pkce.state {
+			err = errors.New("Invalid state in login callback")
+		} else {
+			token, err = convertToken(r.URL.Query().Get("code"), redirectURL, pkce)
+		}
 		if err == nil {
 			writeToken(token)
 			page = fmt.Sprintf(callbackPage, successMarkup)
@@ -119,7 +178,18 @@ func (c *login) oauthLogin(context *Context, client *Client) error {
 	}
 	redirectURL := fmt.Sprintf("http://localhost:%s", port)
 	authURL := strings.Replace(schemeData["authorizeUrl"], "__redirect_url__", redirectURL, 1)
-	http.HandleFunc("/", callback(redirectURL, finish))
+	var pkce *pkceLogin
+	if schemeData["pkce"] == "S256" {
+		pkce, err = newPKCELogin()
+		if err != nil {
+			return err
+		}
+		authURL, err = pkce.authURL(authURL)
+		if err != nil {
+			return err
+		}
+	}
+	http.HandleFunc("/", callback(redirectURL, pkce, finish))
 	server := &http.Server{}
 	go server.Serve(l)
 	err = open(authURL)
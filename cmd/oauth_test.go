@@ -5,10 +5,13 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
@@ -52,7 +55,7 @@ func (s *S) TestCallbackHandler(c *check.C) {
 	os.Setenv("TSURU_TARGET", ts.URL)
 	redirectURL := "someurl"
 	finish := make(chan bool, 1)
-	handler := callback(redirectURL, finish)
+	handler := callback(redirectURL, nil, finish)
 	body := `{"code":"xpto"}`
 	request, err := http.NewRequest("GET", "/", strings.NewReader(body))
 	c.Assert(err, check.IsNil)
@@ -67,3 +70,62 @@ func (s *S) TestCallbackHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(string(data), check.Equals, "xpto")
 }
+
+func (s *S) TestPKCELoginAuthURL(c *check.C) {
+	pkce, err := newPKCELogin()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(pkce.verifier) >= 43, check.Equals, true)
+	authURL, err := pkce.authURL("http://idp/authorize?client_id=tsuru&redirect_uri=http://localhost:4242")
+	c.Assert(err, check.IsNil)
+	u, err := url.Parse(authURL)
+	c.Assert(err, check.IsNil)
+	challenge := sha256.Sum256([]byte(pkce.verifier))
+	c.Assert(u.Query(), check.DeepEquals, url.Values{
+		"client_id":             {"tsuru"},
+		"redirect_uri":          {"http://localhost:4242"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"state":                 {pkce.state},
+	})
+}
+
+func (s *S) TestCallbackHandlerPKCE(c *check.C) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.Form
+		w.Write([]byte(`{"token": "xpto"}`))
+	}))
+	defer ts.Close()
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	os.Setenv("TSURU_TARGET", ts.URL)
+	pkce := &pkceLogin{verifier: "myverifier", state: "mystate"}
+	finish := make(chan bool, 1)
+	handler := callback("someurl", pkce, finish)
+	request, err := http.NewRequest("GET", "/?code=xpto&state=mystate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf(callbackPage, successMarkup))
+	c.Assert(form.Get("code"), check.Equals, "xpto")
+	c.Assert(form.Get("redirectUrl"), check.Equals, "someurl")
+	c.Assert(form.Get("code_verifier"), check.Equals, "myverifier")
+}
+
+func (s *S) TestCallbackHandlerPKCEInvalidState(c *check.C) {
+	pkce := &pkceLogin{verifier: "myverifier", state: "mystate"}
+	finish := make(chan bool, 1)
+	handler := callback("someurl", pkce, finish)
+	request, err := http.NewRequest("GET", "/?code=xpto&state=otherstate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	msg := fmt.Sprintf(errorMarkup, "Invalid state in login callback")
+	c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf(callbackPage, msg))
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event"
+)
+
+type eventRetentionCmd struct{}
+
+func (eventRetentionCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "event-retention",
+		Usage: "event-retention",
+		Desc: `Removes finished events older than the retention configured for their
+kinds in event:retention, archiving them first if event:retention:archive-path
+is set. The same process runs periodically in the tsuru API.`,
+	}
+}
+
+func (eventRetentionCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	result, err := event.RunRetention()
+	if err != nil {
+		return err
+	}
+	if len(result.Removed) == 0 {
+		fmt.Fprintln(context.Stdout, "No expired events found.")
+		return nil
+	}
+	kinds := make([]string, 0, len(result.Removed))
+	for kind := range result.Removed {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(context.Stdout, "%s: %d events removed\n", kind, result.Removed[kind])
+	}
+	for _, archive := range result.Archives {
+		fmt.Fprintf(context.Stdout, "Archived events to %s\n", archive)
+	}
+	return nil
+}
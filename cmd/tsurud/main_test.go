@@ -65,3 +65,12 @@ func (s *S) TestGandalfSyncCmdIsRegistered(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 	c.Assert(sync.Command, check.FitsTypeOf, gandalfSyncCmd{})
 }
+
+func (s *S) TestEventRetentionCmdIsRegistered(c *check.C) {
+	manager := buildManager()
+	cmd, ok := manager.Commands["event-retention"]
+	c.Assert(ok, check.Equals, true)
+	retention, ok := cmd.(*tsurudCommand)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(retention.Command, check.FitsTypeOf, eventRetentionCmd{})
+}
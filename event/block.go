@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -38,15 +39,113 @@ func (e ErrEventBlocked) Error() string {
 	)
 }
 
+type BlockRecurrence string
+
+const (
+	BlockRecurrenceDaily  = BlockRecurrence("daily")
+	BlockRecurrenceWeekly = BlockRecurrence("weekly")
+)
+
+// Block prevents events matching its kind, owner and target from running.
+// The block takes effect at StartTime and lasts until EndTime or, if EndTime
+// is not set, until it's removed. Blocks with a Recurrence repeat the window
+// between StartTime and EndTime every day or week, optionally until the
+// Until time.
 type Block struct {
-	ID        bson.ObjectId `bson:"_id,omitempty"`
-	StartTime time.Time
-	EndTime   time.Time `bson:"endtime,omitempty"`
-	KindName  string
-	OwnerName string
-	Target    Target `bson:"target,omitempty"`
-	Reason    string
-	Active    bool
+	ID         bson.ObjectId `bson:"_id,omitempty"`
+	StartTime  time.Time
+	EndTime    time.Time `bson:"endtime,omitempty"`
+	KindName   string
+	OwnerName  string
+	Target     Target `bson:"target,omitempty"`
+	Reason     string
+	Active     bool
+	Recurrence BlockRecurrence `bson:",omitempty"`
+	Until      time.Time       `bson:",omitempty"`
+	NextStart  time.Time       `bson:"-"`
+	NextEnd    time.Time       `bson:"-"`
+}
+
+func (b *Block) validate() error {
+	if !b.EndTime.IsZero() && !b.EndTime.After(b.StartTime) {
+		return &tsuruErrors.ValidationError{Message: "end time must be after start time"}
+	}
+	if b.Recurrence == "" {
+		if !b.Until.IsZero() {
+			return &tsuruErrors.ValidationError{Message: "until is only valid for recurring blocks"}
+		}
+		return nil
+	}
+	days := b.Recurrence.days()
+	if days == 0 {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid recurrence %q, valid values are %q and %q", b.Recurrence, BlockRecurrenceDaily, BlockRecurrenceWeekly)}
+	}
+	if b.EndTime.IsZero() {
+		return &tsuruErrors.ValidationError{Message: "end time is required for recurring blocks"}
+	}
+	if b.EndTime.After(b.StartTime.AddDate(0, 0, days)) {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("block duration must not be longer than the %s recurrence", b.Recurrence)}
+	}
+	if !b.Until.IsZero() && b.Until.Before(b.StartTime) {
+		return &tsuruErrors.ValidationError{Message: "until must be after start time"}
+	}
+	return nil
+}
+
+func (r BlockRecurrence) days() int {
+	switch r {
+	case BlockRecurrenceDaily:
+		return 1
+	case BlockRecurrenceWeekly:
+		return 7
+	}
+	return 0
+}
+
+// window returns the current window of the block at t or, if t is not
+// inside a window, the next one. ok is false if the block has no windows
+// ending after t.
+func (b *Block) window(t time.Time) (start, end time.Time, ok bool) {
+	days := b.Recurrence.days()
+	if days == 0 {
+		if !b.EndTime.IsZero() && !b.EndTime.After(t) {
+			return time.Time{}, time.Time{}, false
+		}
+		return b.StartTime, b.EndTime, true
+	}
+	period := time.Duration(days) * 24 * time.Hour
+	k := 0
+	if t.After(b.EndTime) {
+		k = int(t.Sub(b.EndTime)/period) - 1
+		if k < 0 {
+			k = 0
+		}
+	}
+	for {
+		start = b.StartTime.AddDate(0, 0, k*days)
+		end = b.EndTime.AddDate(0, 0, k*days)
+		if !b.Until.IsZero() && start.After(b.Until) {
+			return time.Time{}, time.Time{}, false
+		}
+		if end.After(t) {
+			return start, end, true
+		}
+		k++
+	}
+}
+
+// ActiveAt returns whether the block is in effect at t.
+func (b *Block) ActiveAt(t time.Time) bool {
+	if !b.Active {
+		return false
+	}
+	start, _, ok := b.window(t)
+	return ok && !start.After(t)
+}
+
+func (b *Block) expired(t time.Time) bool {
+	_, _, ok := b.window(t)
+	return !ok
 }
 
 func (b *Block) Blocks(e *Event) bool {
@@ -79,6 +178,13 @@ func (b *Block) String() string {
 }
 
 func AddBlock(b *Block) error {
+	if b.StartTime.IsZero() {
+		b.StartTime = time.Now()
+	}
+	err := b.validate()
+	if err != nil {
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -86,7 +192,6 @@ func AddBlock(b *Block) error {
 	defer conn.Close()
 	b.Active = true
 	b.ID = bson.NewObjectId()
-	b.StartTime = time.Now()
 	return conn.EventBlocks().Insert(b)
 }
 
@@ -104,22 +209,38 @@ func RemoveBlock(id bson.ObjectId) error {
 	return err
 }
 
+// ListBlocks returns the most recent blocks. Active blocks have NextStart and
+// NextEnd set to their current or upcoming window.
 func ListBlocks(active *bool) ([]Block, error) {
 	query := bson.M{}
 	if active != nil {
 		query["active"] = *active
 	}
-	return listBlocks(query)
+	blocks, err := listBlocks(query)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range blocks {
+		if blocks[i].Active {
+			blocks[i].NextStart, blocks[i].NextEnd, _ = blocks[i].window(now)
+		}
+	}
+	return blocks, nil
 }
 
 func listBlocks(query bson.M) ([]Block, error) {
+	return findBlocks(query, blockListLimit)
+}
+
+func findBlocks(query bson.M, limit int) ([]Block, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 	var blocks []Block
-	err = conn.EventBlocks().Find(query).Sort("-starttime").Limit(blockListLimit).All(&blocks)
+	err = conn.EventBlocks().Find(query).Sort("-starttime").Limit(limit).All(&blocks)
 	if err != nil {
 		return nil, err
 	}
@@ -130,14 +251,40 @@ func checkIsBlocked(evt *Event) error {
 	if evt.Target.Type == TargetTypeEventBlock {
 		return nil
 	}
-	blocks, err := listBlocks(bson.M{"active": true})
+	now := time.Now()
+	blocks, err := findBlocks(bson.M{"active": true, "starttime": bson.M{"$lte": now}}, 0)
 	if err != nil {
 		return err
 	}
 	for _, b := range blocks {
-		if b.Blocks(evt) {
+		if b.ActiveAt(now) && b.Blocks(evt) {
 			return ErrEventBlocked{event: evt, block: &b}
 		}
 	}
 	return nil
 }
+
+// deactivateExpiredBlocks marks blocks with no remaining windows as inactive.
+func deactivateExpiredBlocks() error {
+	now := time.Now()
+	blocks, err := findBlocks(bson.M{"active": true, "endtime": bson.M{"$exists": true}}, 0)
+	if err != nil {
+		return err
+	}
+	var expired []bson.ObjectId
+	for _, b := range blocks {
+		if b.expired(now) {
+			expired = append(expired, b.ID)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.EventBlocks().UpdateAll(bson.M{"_id": bson.M{"$in": expired}}, bson.M{"$set": bson.M{"active": false}})
+	return err
+}
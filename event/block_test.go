@@ -117,3 +117,121 @@ func (s *S) TestCheckIsBlocked(c *check.C) {
 		}
 	}
 }
+
+func (s *S) TestAddBlockInvalid(c *check.C) {
+	now := time.Now()
+	tt := []struct {
+		block *Block
+		err   string
+	}{
+		{&Block{StartTime: now, EndTime: now.Add(-time.Hour)}, "end time must be after start time"},
+		{&Block{Until: now.Add(time.Hour)}, "until is only valid for recurring blocks"},
+		{&Block{Recurrence: "monthly", EndTime: now.Add(time.Hour)}, `invalid recurrence "monthly", valid values are "daily" and "weekly"`},
+		{&Block{Recurrence: BlockRecurrenceDaily}, "end time is required for recurring blocks"},
+		{&Block{Recurrence: BlockRecurrenceDaily, StartTime: now, EndTime: now.Add(25 * time.Hour)}, "block duration must not be longer than the daily recurrence"},
+	}
+	for i, t := range tt {
+		err := AddBlock(t.block)
+		c.Assert(err, check.ErrorMatches, t.err, check.Commentf("test %d", i))
+	}
+	blocks, err := listBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 0)
+}
+
+func (s *S) TestBlockActiveAt(c *check.C) {
+	friday := time.Date(2018, time.October, 19, 18, 0, 0, 0, time.UTC)
+	monday := time.Date(2018, time.October, 22, 8, 0, 0, 0, time.UTC)
+	freeze := Block{Active: true, StartTime: friday, EndTime: monday, Recurrence: BlockRecurrenceWeekly}
+	release := Block{Active: true, StartTime: friday, EndTime: monday}
+	limited := Block{Active: true, StartTime: friday, EndTime: monday, Recurrence: BlockRecurrenceWeekly, Until: friday.AddDate(0, 0, 7)}
+	forever := Block{Active: true, StartTime: friday}
+	tt := []struct {
+		block    Block
+		t        time.Time
+		expected bool
+	}{
+		{freeze, friday.Add(-time.Minute), false},
+		{freeze, friday, true},
+		{freeze, monday.Add(-time.Minute), true},
+		{freeze, monday, false},
+		{freeze, friday.AddDate(0, 0, 7).Add(time.Hour), true},
+		{freeze, friday.AddDate(0, 0, 70).Add(-time.Hour), false},
+		{freeze, monday.AddDate(0, 0, 70).Add(-time.Hour), true},
+		{release, friday.Add(time.Hour), true},
+		{release, friday.AddDate(0, 0, 7).Add(time.Hour), false},
+		{limited, friday.AddDate(0, 0, 7).Add(time.Hour), true},
+		{limited, friday.AddDate(0, 0, 14).Add(time.Hour), false},
+		{forever, friday.AddDate(1, 0, 0), true},
+		{forever, friday.Add(-time.Hour), false},
+	}
+	for i, t := range tt {
+		c.Assert(t.block.ActiveAt(t.t), check.Equals, t.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestCheckIsBlockedScheduled(c *check.C) {
+	now := time.Now()
+	future := &Block{KindName: "app.deploy", StartTime: now.Add(time.Hour), EndTime: now.Add(2 * time.Hour)}
+	past := &Block{KindName: "app.deploy", StartTime: now.Add(-2 * time.Hour), EndTime: now.Add(-time.Hour)}
+	recurring := &Block{
+		KindName:   "app.update",
+		StartTime:  now.Add(-49 * time.Hour),
+		EndTime:    now.Add(-47 * time.Hour),
+		Recurrence: BlockRecurrenceDaily,
+	}
+	for _, b := range []*Block{future, past, recurring} {
+		err := AddBlock(b)
+		c.Assert(err, check.IsNil)
+	}
+	err := checkIsBlocked(&Event{eventData: eventData{Kind: Kind{Name: "app.deploy"}}})
+	c.Assert(err, check.IsNil)
+	err = checkIsBlocked(&Event{eventData: eventData{Kind: Kind{Name: "app.update"}}})
+	c.Assert(err, check.FitsTypeOf, ErrEventBlocked{})
+	c.Assert(err.(ErrEventBlocked).block.ID, check.Equals, recurring.ID)
+}
+
+func (s *S) TestListBlocksUpcomingWindow(c *check.C) {
+	now := time.Now()
+	block := &Block{
+		KindName:   "app.deploy",
+		StartTime:  now.Add(-25 * time.Hour),
+		EndTime:    now.Add(-23 * time.Hour),
+		Recurrence: BlockRecurrenceDaily,
+	}
+	err := AddBlock(block)
+	c.Assert(err, check.IsNil)
+	blocks, err := ListBlocks(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(blocks, check.HasLen, 1)
+	c.Assert(blocks[0].NextStart.Equal(block.StartTime.Truncate(time.Millisecond).AddDate(0, 0, 1)), check.Equals, true)
+	c.Assert(blocks[0].NextEnd.Equal(block.EndTime.Truncate(time.Millisecond).AddDate(0, 0, 1)), check.Equals, true)
+}
+
+func (s *S) TestDeactivateExpiredBlocks(c *check.C) {
+	now := time.Now()
+	expired := &Block{KindName: "app.deploy", StartTime: now.Add(-2 * time.Hour), EndTime: now.Add(-time.Hour)}
+	expiredRecurring := &Block{
+		KindName:   "app.deploy",
+		StartTime:  now.Add(-72 * time.Hour),
+		EndTime:    now.Add(-71 * time.Hour),
+		Recurrence: BlockRecurrenceDaily,
+		Until:      now.Add(-48 * time.Hour),
+	}
+	recurring := &Block{KindName: "app.deploy", StartTime: now.Add(-72 * time.Hour), EndTime: now.Add(-71 * time.Hour), Recurrence: BlockRecurrenceDaily}
+	forever := &Block{KindName: "app.deploy"}
+	for _, b := range []*Block{expired, expiredRecurring, recurring, forever} {
+		err := AddBlock(b)
+		c.Assert(err, check.IsNil)
+	}
+	err := deactivateExpiredBlocks()
+	c.Assert(err, check.IsNil)
+	active := true
+	blocks, err := ListBlocks(&active)
+	c.Assert(err, check.IsNil)
+	var ids []bson.ObjectId
+	for _, b := range blocks {
+		ids = append(ids, b.ID)
+	}
+	c.Assert(ids, check.DeepEquals, []bson.ObjectId{forever.ID, recurring.ID})
+}
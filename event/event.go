@@ -49,6 +49,11 @@ var (
 		Name: "tsuru_events_expired_total",
 		Help: "The total number of events expired",
 	}, []string{"kind"})
+
+	eventsRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_events_removed_total",
+		Help: "The total number of events removed by the retention policy",
+	}, []string{"kind"})
 )
 
 const (
@@ -75,9 +80,10 @@ var (
 	ErrInvalidKind            = ErrValidation("event kind must not be set on internal events")
 	ErrInvalidTargetType      = errors.New("invalid event target type")
 
-	OwnerTypeUser     = ownerType("user")
-	OwnerTypeApp      = ownerType("app")
-	OwnerTypeInternal = ownerType("internal")
+	OwnerTypeUser           = ownerType("user")
+	OwnerTypeApp            = ownerType("app")
+	OwnerTypeInternal       = ownerType("internal")
+	OwnerTypeServiceAccount = ownerType("service-account")
 
 	KindTypePermission = kindType("permission")
 	KindTypeInternal   = kindType("internal")
@@ -100,6 +106,10 @@ var (
 	TargetTypeEventBlock      = TargetType("event-block")
 	TargetTypeCluster         = TargetType("cluster")
 	TargetTypeVolume          = TargetType("volume")
+	TargetTypeWebhook         = TargetType("webhook")
+	TargetTypeLogForwarder    = TargetType("log-forwarder")
+	TargetTypeServiceAccount  = TargetType("service-account")
+	TargetTypeLockout         = TargetType("lockout")
 )
 
 const (
@@ -107,7 +117,7 @@ const (
 )
 
 func init() {
-	prometheus.MustRegister(eventDuration, eventCurrent, eventsRejected)
+	prometheus.MustRegister(eventDuration, eventCurrent, eventsRejected, eventsRemoved)
 }
 
 type ErrThrottled struct {
@@ -300,6 +310,7 @@ func Initialize() error {
 		return errors.Wrap(err, "unable to load event throttling")
 	}
 	cleaner.start()
+	retentionWorker.start()
 	return nil
 }
 
@@ -419,7 +430,9 @@ type Filter struct {
 
 	Limit int
 	Skip  int
-	Sort  string
+	// Sort is a comma separated list of fields, prefixed with - for
+	// descending order.
+	Sort string
 }
 
 func (f *Filter) PruneUserValues() {
@@ -641,7 +654,7 @@ func List(filter *Filter) ([]Event, error) {
 	}
 	defer conn.Close()
 	coll := conn.Events()
-	find := coll.Find(query).Sort(sort)
+	find := coll.Find(query).Sort(strings.Split(sort, ",")...)
 	if limit > 0 {
 		find = find.Limit(limit)
 	}
@@ -829,6 +842,9 @@ func newEvt(opts *Opts) (evt *Event, err error) {
 	} else if opts.Owner.IsAppToken() {
 		o.Type = OwnerTypeApp
 		o.Name = opts.Owner.GetAppName()
+	} else if name, ok := auth.ServiceAccountName(opts.Owner.GetUserName()); ok {
+		o.Type = OwnerTypeServiceAccount
+		o.Name = name
 	} else {
 		o.Type = OwnerTypeUser
 		o.Name = opts.Owner.GetUserName()
@@ -890,6 +906,7 @@ func newEvt(opts *Opts) (evt *Event, err error) {
 				return nil, err
 			}
 			updater.addCh <- id
+			hub.publish(streamNotification{typ: StreamMessageStart, id: evt.UniqueID})
 			return evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -1016,6 +1033,7 @@ func (e *Event) Logf(format string, params ...interface{}) {
 	if e.logBuffer != nil {
 		fmt.Fprintf(e.logBuffer, format, params...)
 	}
+	hub.publish(streamNotification{typ: StreamMessageLog, id: e.UniqueID, log: fmt.Sprintf(format, params...)})
 }
 
 func (e *Event) Write(data []byte) (int, error) {
@@ -1025,6 +1043,7 @@ func (e *Event) Write(data []byte) (int, error) {
 	if e.logBuffer != nil {
 		e.logBuffer.Write(data)
 	}
+	hub.publish(streamNotification{typ: StreamMessageLog, id: e.UniqueID, log: string(data)})
 	return len(data), nil
 }
 
@@ -1138,6 +1157,12 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 		eventCurrent.WithLabelValues(e.Kind.Name).Dec()
 		if err != nil {
 			log.Errorf("[events] error marking event as done - %#v: %s", e, err)
+			return
+		}
+		if abort {
+			hub.publish(streamNotification{typ: StreamMessageAbort, id: e.UniqueID})
+		} else {
+			hub.publish(streamNotification{typ: StreamMessageFinish, id: e.UniqueID})
 		}
 	}()
 	updater.removeCh <- e.ID
@@ -25,6 +25,7 @@ import (
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/safe"
+	authTypes "github.com/tsuru/tsuru/types/auth"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
@@ -1423,3 +1424,21 @@ func (s *S) TestEventCancelableContextNotCancelable(c *check.C) {
 	}
 	c.Assert(ctx.Err(), check.IsNil)
 }
+
+func (s *S) TestNewServiceAccountOwner(c *check.C) {
+	team := authTypes.Team{Name: "myteam"}
+	err := auth.TeamService().Insert(team)
+	c.Assert(err, check.IsNil)
+	u, err := auth.CreateServiceAccount(auth.ServiceAccount{Name: "ci", Team: team.Name})
+	c.Assert(err, check.IsNil)
+	token, err := auth.CreateAccessToken(u, "deploy", time.Now().Add(time.Hour), nil)
+	c.Assert(err, check.IsNil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Owner, check.DeepEquals, Owner{Type: OwnerTypeServiceAccount, Name: "ci"})
+}
@@ -0,0 +1,342 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	internalConfig "github.com/tsuru/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/fs"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	retentionKind            = "event.retention"
+	defaultRetentionInterval = time.Hour
+	retentionBatchSize       = 10000
+)
+
+var (
+	retentionWorker = eventRetention{
+		once: &sync.Once{},
+	}
+
+	fsystem fs.Fs
+)
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+// RetentionSpec configures for how long finished events of a kind are kept.
+// KindName matches the kind with the same name and every kind below it in
+// the permission tree, e.g. "app.update" matches "app.update.env.set". When
+// more than one spec matches a kind, the most specific one is used.
+type RetentionSpec struct {
+	KindName string `json:"kind-name"`
+	Days     int    `json:"days"`
+}
+
+type retentionConfig struct {
+	specs       []RetentionSpec
+	defaultDays int
+	archivePath string
+}
+
+func loadRetentionConfig() (*retentionConfig, error) {
+	cfg := &retentionConfig{}
+	err := internalConfig.UnmarshalConfig("event:retention:kinds", &cfg.specs)
+	if err != nil {
+		if _, isNotFound := errors.Cause(err).(config.ErrKeyNotFound); !isNotFound {
+			return nil, errors.Wrap(err, "unable to load event retention")
+		}
+	}
+	for _, spec := range cfg.specs {
+		if spec.KindName == "" {
+			return nil, errors.New("invalid event retention, kind-name is required")
+		}
+		if spec.Days < 0 {
+			return nil, errors.Errorf("invalid event retention for %q, days must not be negative", spec.KindName)
+		}
+	}
+	cfg.defaultDays, _ = config.GetInt("event:retention:default-days")
+	cfg.archivePath, _ = config.GetString("event:retention:archive-path")
+	return cfg, nil
+}
+
+func (c *retentionConfig) enabled() bool {
+	if c.defaultDays > 0 {
+		return true
+	}
+	for _, spec := range c.specs {
+		if spec.Days > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// daysFor returns for how many days events of the given kind must be kept,
+// 0 meaning forever.
+func (c *retentionConfig) daysFor(kindName string) int {
+	days := c.defaultDays
+	matchLen := -1
+	for _, spec := range c.specs {
+		if kindName != spec.KindName && !strings.HasPrefix(kindName, spec.KindName+".") {
+			continue
+		}
+		if len(spec.KindName) > matchLen {
+			matchLen = len(spec.KindName)
+			days = spec.Days
+		}
+	}
+	return days
+}
+
+// RetentionResult describes the events removed by a retention run.
+type RetentionResult struct {
+	Removed  map[string]int
+	Archives []string
+}
+
+// RunRetention removes finished events older than the retention configured
+// for their kinds. When event:retention:archive-path is set, events are
+// written to gzipped JSON lines files in that path before being removed.
+func RunRetention() (*RetentionResult, error) {
+	cfg, err := loadRetentionConfig()
+	if err != nil {
+		return nil, err
+	}
+	result := &RetentionResult{Removed: map[string]int{}}
+	if !cfg.enabled() {
+		return result, nil
+	}
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeGlobal, Value: retentionKind},
+		InternalKind: retentionKind,
+		Allowed:      Allowed(permission.PermEventRetentionReadEvents),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = runRetention(cfg, time.Now().UTC(), result)
+	if err == nil && len(result.Removed) == 0 {
+		evt.Abort()
+		return result, nil
+	}
+	evt.DoneCustomData(err, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func runRetention(cfg *retentionConfig, now time.Time, result *RetentionResult) error {
+	kinds, err := GetKinds()
+	if err != nil {
+		return err
+	}
+	names := map[string]struct{}{}
+	for _, k := range kinds {
+		names[k.Name] = struct{}{}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	for _, name := range sortedNames {
+		days := cfg.daysFor(name)
+		if days <= 0 {
+			continue
+		}
+		cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+		err = expireKind(cfg, name, cutoff, now, result)
+		if err != nil {
+			return errors.Wrapf(err, "unable to expire events of kind %q", name)
+		}
+	}
+	return nil
+}
+
+func expireKind(cfg *retentionConfig, kindName string, cutoff, now time.Time, result *RetentionResult) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	query := bson.M{
+		"kind.name": kindName,
+		"running":   false,
+		"starttime": bson.M{"$lt": cutoff},
+	}
+	for batch := 0; ; batch++ {
+		var allData []eventData
+		err = coll.Find(query).Sort("starttime").Limit(retentionBatchSize).All(&allData)
+		if err != nil {
+			return err
+		}
+		if len(allData) == 0 {
+			return nil
+		}
+		if cfg.archivePath != "" {
+			var archive string
+			archive, err = archiveEvents(cfg.archivePath, kindName, now, batch, allData)
+			if err != nil {
+				return err
+			}
+			result.Archives = append(result.Archives, archive)
+		}
+		ids := make([]bson.ObjectId, len(allData))
+		for i := range allData {
+			ids[i] = allData[i].UniqueID
+		}
+		_, err = coll.RemoveAll(bson.M{"uniqueid": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		result.Removed[kindName] += len(allData)
+		eventsRemoved.WithLabelValues(kindName).Add(float64(len(allData)))
+		if len(allData) < retentionBatchSize {
+			return nil
+		}
+	}
+}
+
+type archivedEvent struct {
+	eventData
+	StartCustomData interface{} `json:",omitempty"`
+	EndCustomData   interface{} `json:",omitempty"`
+	OtherCustomData interface{} `json:",omitempty"`
+}
+
+func newArchivedEvent(data eventData) (*archivedEvent, error) {
+	evt := &Event{eventData: data}
+	archived := &archivedEvent{eventData: data}
+	var start, end, other bson.M
+	if err := evt.StartData(&start); err != nil {
+		return nil, err
+	}
+	if err := evt.EndData(&end); err != nil {
+		return nil, err
+	}
+	if err := evt.OtherData(&other); err != nil {
+		return nil, err
+	}
+	if start != nil {
+		archived.StartCustomData = start
+	}
+	if end != nil {
+		archived.EndCustomData = end
+	}
+	if other != nil {
+		archived.OtherCustomData = other
+	}
+	return archived, nil
+}
+
+// archiveEvents writes the events to a new gzipped JSON lines file. The file
+// is written with a temporary name and only renamed after being completely
+// written, so a file with the final name is always complete.
+func archiveEvents(basePath, kindName string, now time.Time, batch int, allData []eventData) (string, error) {
+	dir := filepath.Join(basePath, kindName)
+	err := filesystem().MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s-%04d.jsonl.gz", now.Format("20060102T150405Z"), batch))
+	tmpName := name + ".tmp"
+	file, err := filesystem().Create(tmpName)
+	if err != nil {
+		return "", err
+	}
+	err = writeArchive(file, allData)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		filesystem().Remove(tmpName)
+		return "", err
+	}
+	err = filesystem().Rename(tmpName, name)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func writeArchive(file fs.File, allData []eventData) error {
+	gzWriter := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gzWriter)
+	for _, data := range allData {
+		archived, err := newArchivedEvent(data)
+		if err != nil {
+			return err
+		}
+		err = encoder.Encode(archived)
+		if err != nil {
+			return err
+		}
+	}
+	return gzWriter.Close()
+}
+
+type eventRetention struct {
+	once   *sync.Once
+	stopCh chan struct{}
+}
+
+func (l *eventRetention) start() {
+	l.once.Do(func() {
+		l.stopCh = make(chan struct{})
+		go l.spin()
+	})
+}
+
+func (l *eventRetention) stop() {
+	if l.stopCh == nil {
+		return
+	}
+	l.stopCh <- struct{}{}
+	l.stopCh = nil
+	l.once = &sync.Once{}
+}
+
+func (l *eventRetention) spin() {
+	interval := defaultRetentionInterval
+	if seconds, err := config.GetInt("event:retention:run-interval"); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	for {
+		_, err := RunRetention()
+		if err != nil {
+			if _, isLocked := err.(ErrEventLocked); !isLocked {
+				log.Errorf("[events] [event retention] %v", err)
+			}
+		}
+		select {
+		case <-l.stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
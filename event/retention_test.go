@@ -0,0 +1,127 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func insertEventWithAge(c *check.C, kindName string, age time.Duration, running bool) *Event {
+	start := time.Now().UTC().Add(-age)
+	evt := &Event{eventData: eventData{
+		UniqueID:  bson.NewObjectId(),
+		Target:    Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:      Kind{Type: KindTypePermission, Name: kindName},
+		Owner:     Owner{Type: OwnerTypeUser, Name: "me@me.com"},
+		StartTime: start,
+		EndTime:   start.Add(time.Minute),
+		Running:   running,
+		Allowed:   Allowed(permission.PermAppReadEvents),
+	}}
+	err := evt.RawInsert(map[string]string{"image": "v1"}, nil, nil)
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestRetentionConfigDaysFor(c *check.C) {
+	cfg := retentionConfig{
+		defaultDays: 90,
+		specs: []RetentionSpec{
+			{KindName: "app.deploy", Days: 365},
+			{KindName: "app.update", Days: 30},
+			{KindName: "app.update.env", Days: 0},
+		},
+	}
+	c.Assert(cfg.daysFor("app.deploy"), check.Equals, 365)
+	c.Assert(cfg.daysFor("app.update.restart"), check.Equals, 30)
+	c.Assert(cfg.daysFor("app.update.env.set"), check.Equals, 0)
+	c.Assert(cfg.daysFor("app.updated"), check.Equals, 90)
+	c.Assert(cfg.daysFor("node.update"), check.Equals, 90)
+}
+
+func (s *S) TestRunRetentionDisabled(c *check.C) {
+	insertEventWithAge(c, "app.deploy", 400*24*time.Hour, false)
+	result, err := RunRetention()
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Removed, check.HasLen, 0)
+	evts, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestRunRetention(c *check.C) {
+	config.Set("event:retention:kinds", []interface{}{
+		map[interface{}]interface{}{"kind-name": "app.deploy", "days": 365},
+		map[interface{}]interface{}{"kind-name": "node.update", "days": 30},
+	})
+	defer config.Unset("event:retention")
+	oldDeploy := insertEventWithAge(c, "app.deploy", 400*24*time.Hour, false)
+	recentDeploy := insertEventWithAge(c, "app.deploy", 40*24*time.Hour, false)
+	oldNode := insertEventWithAge(c, "node.update", 40*24*time.Hour, false)
+	runningNode := insertEventWithAge(c, "node.update", 40*24*time.Hour, true)
+	other := insertEventWithAge(c, "app.create", 400*24*time.Hour, false)
+	result, err := RunRetention()
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Removed, check.DeepEquals, map[string]int{"app.deploy": 1, "node.update": 1})
+	c.Assert(result.Archives, check.HasLen, 0)
+	evts, err := List(&Filter{IncludeRemoved: true, Raw: bson.M{"kind.name": bson.M{"$ne": retentionKind}}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 3)
+	for _, removed := range []*Event{oldDeploy, oldNode} {
+		_, err = GetByID(removed.UniqueID)
+		c.Assert(err, check.Equals, ErrEventNotFound)
+	}
+	for _, kept := range []*Event{recentDeploy, runningNode, other} {
+		_, err = GetByID(kept.UniqueID)
+		c.Assert(err, check.IsNil)
+	}
+	retentionEvts, err := List(&Filter{KindNames: []string{retentionKind}})
+	c.Assert(err, check.IsNil)
+	c.Assert(retentionEvts, check.HasLen, 1)
+	c.Assert(retentionEvts[0].Target, check.DeepEquals, Target{Type: TargetTypeGlobal, Value: retentionKind})
+}
+
+func (s *S) TestRunRetentionWithArchive(c *check.C) {
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() { fsystem = nil }()
+	config.Set("event:retention:default-days", 30)
+	config.Set("event:retention:archive-path", "/var/lib/tsuru/events")
+	defer config.Unset("event:retention")
+	evt := insertEventWithAge(c, "app.deploy", 40*24*time.Hour, false)
+	result, err := RunRetention()
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Removed, check.DeepEquals, map[string]int{"app.deploy": 1})
+	c.Assert(result.Archives, check.HasLen, 1)
+	c.Assert(rfs.HasAction("mkdirall /var/lib/tsuru/events/app.deploy with mode 0755"), check.Equals, true)
+	c.Assert(rfs.HasAction("rename "+result.Archives[0]+".tmp "+result.Archives[0]), check.Equals, true)
+	file, err := rfs.Open(result.Archives[0])
+	c.Assert(err, check.IsNil)
+	gzReader, err := gzip.NewReader(file)
+	c.Assert(err, check.IsNil)
+	scanner := bufio.NewScanner(gzReader)
+	var lines []map[string]interface{}
+	for scanner.Scan() {
+		var line map[string]interface{}
+		err = json.Unmarshal(scanner.Bytes(), &line)
+		c.Assert(err, check.IsNil)
+		lines = append(lines, line)
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	c.Assert(lines, check.HasLen, 1)
+	c.Assert(lines[0]["UniqueID"], check.Equals, evt.UniqueID.Hex())
+	c.Assert(lines[0]["StartCustomData"], check.DeepEquals, map[string]interface{}{"image": "v1"})
+	_, err = GetByID(evt.UniqueID)
+	c.Assert(err, check.Equals, ErrEventNotFound)
+}
@@ -0,0 +1,300 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type StreamMessageType string
+
+const (
+	StreamMessageStart  = StreamMessageType("start")
+	StreamMessageLog    = StreamMessageType("log")
+	StreamMessageFinish = StreamMessageType("finish")
+	StreamMessageAbort  = StreamMessageType("abort")
+)
+
+const (
+	streamBufferSize = 1000
+	streamStateTTL   = 10 * time.Minute
+)
+
+var (
+	ErrStreamOverflow = errors.New("event stream subscriber is too slow, messages were lost")
+
+	// streamPollInterval controls how often subscriptions look for events
+	// started or finished by other tsuru instances, which are not published
+	// to the local hub.
+	streamPollInterval = 5 * time.Second
+)
+
+// StreamMessage is sent to event stream subscribers when an event starts,
+// writes to its log or finishes. Event is only set for start and finish
+// messages, Log is only set for log messages.
+type StreamMessage struct {
+	Type    StreamMessageType
+	EventID string
+	Event   *Event `json:",omitempty"`
+	Log     string `json:",omitempty"`
+}
+
+type streamNotification struct {
+	typ StreamMessageType
+	id  bson.ObjectId
+	log string
+}
+
+type streamHub struct {
+	sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+var hub = streamHub{subs: map[*Subscription]struct{}{}}
+
+func (h *streamHub) publish(n streamNotification) {
+	h.RLock()
+	defer h.RUnlock()
+	for s := range h.subs {
+		select {
+		case s.in <- n:
+		default:
+			s.fail(ErrStreamOverflow)
+		}
+	}
+}
+
+func (h *streamHub) add(s *Subscription) {
+	h.Lock()
+	defer h.Unlock()
+	h.subs[s] = struct{}{}
+}
+
+func (h *streamHub) remove(s *Subscription) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.subs, s)
+}
+
+type streamState struct {
+	matched  bool
+	started  bool
+	finished bool
+	updated  time.Time
+}
+
+// Subscription receives messages about events matching a filter. Log lines
+// are only available for events running in the current process, events
+// started in other tsuru instances are found by periodically querying the
+// database and only have their start and finish messages sent.
+type Subscription struct {
+	filter    Filter
+	in        chan streamNotification
+	out       chan StreamMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	errMu     sync.Mutex
+	err       error
+	states    map[bson.ObjectId]*streamState
+	lastPoll  time.Time
+}
+
+// Subscribe starts a subscription for events matching filter. The filter
+// Running, Limit, Skip and Sort fields are ignored.
+func Subscribe(filter *Filter) (*Subscription, error) {
+	s := &Subscription{
+		in:       make(chan streamNotification, streamBufferSize),
+		out:      make(chan StreamMessage),
+		done:     make(chan struct{}),
+		states:   map[bson.ObjectId]*streamState{},
+		lastPoll: time.Now().UTC(),
+	}
+	if filter != nil {
+		s.filter = *filter
+	}
+	s.filter.Running = nil
+	s.filter.Limit = 0
+	s.filter.Skip = 0
+	s.filter.Sort = ""
+	_, err := s.filter.toQuery()
+	if err != nil && err != errInvalidQuery {
+		return nil, err
+	}
+	hub.add(s)
+	go s.run()
+	return s, nil
+}
+
+// Messages returns the channel where messages are sent. The channel is
+// closed when the subscription ends, Err returns the reason.
+func (s *Subscription) Messages() <-chan StreamMessage {
+	return s.out
+}
+
+func (s *Subscription) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.fail(nil)
+}
+
+func (s *Subscription) fail(err error) {
+	s.closeOnce.Do(func() {
+		s.errMu.Lock()
+		s.err = err
+		s.errMu.Unlock()
+		close(s.done)
+	})
+}
+
+func (s *Subscription) run() {
+	defer func() {
+		hub.remove(s)
+		close(s.out)
+	}()
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-s.done:
+			return
+		case n := <-s.in:
+			err = s.handle(n)
+		case <-ticker.C:
+			err = s.poll()
+		}
+		if err != nil {
+			log.Errorf("[events] error in event stream: %s", err)
+		}
+	}
+}
+
+func (s *Subscription) send(msg StreamMessage) {
+	select {
+	case s.out <- msg:
+	case <-s.done:
+	}
+}
+
+func (s *Subscription) state(id bson.ObjectId) *streamState {
+	st := s.states[id]
+	if st == nil {
+		st = &streamState{}
+		s.states[id] = st
+	}
+	st.updated = time.Now()
+	return st
+}
+
+// find returns the event with the given id if it matches the subscription
+// filter, using the same query as List.
+func (s *Subscription) find(id bson.ObjectId) (*Event, error) {
+	f := s.filter
+	f.Raw = bson.M{}
+	for k, v := range s.filter.Raw {
+		f.Raw[k] = v
+	}
+	f.Raw["uniqueid"] = id
+	f.Sort = "running"
+	f.Limit = 1
+	evts, err := List(&f)
+	if err != nil || len(evts) == 0 {
+		return nil, err
+	}
+	return &evts[0], nil
+}
+
+func (s *Subscription) handle(n streamNotification) error {
+	_, known := s.states[n.id]
+	st := s.state(n.id)
+	switch n.typ {
+	case StreamMessageStart, StreamMessageFinish:
+		evt, err := s.find(n.id)
+		if err != nil {
+			return err
+		}
+		st.matched = evt != nil
+		if evt == nil {
+			return nil
+		}
+		if n.typ == StreamMessageStart && !st.started {
+			st.started = true
+			s.send(StreamMessage{Type: StreamMessageStart, EventID: n.id.Hex(), Event: evt})
+		}
+		if n.typ == StreamMessageFinish && !st.finished {
+			st.finished = true
+			s.send(StreamMessage{Type: StreamMessageFinish, EventID: n.id.Hex(), Event: evt})
+		}
+	case StreamMessageLog:
+		if !known {
+			evt, err := s.find(n.id)
+			if err != nil {
+				return err
+			}
+			st.matched = evt != nil
+			if evt != nil {
+				st.started = true
+				s.send(StreamMessage{Type: StreamMessageStart, EventID: n.id.Hex(), Event: evt})
+			}
+		}
+		if st.matched && !st.finished {
+			s.send(StreamMessage{Type: StreamMessageLog, EventID: n.id.Hex(), Log: n.log})
+		}
+	case StreamMessageAbort:
+		if st.matched && !st.finished {
+			st.finished = true
+			s.send(StreamMessage{Type: StreamMessageAbort, EventID: n.id.Hex()})
+		}
+	}
+	return nil
+}
+
+func (s *Subscription) poll() error {
+	now := time.Now().UTC()
+	since := s.lastPoll.Add(-streamPollInterval)
+	s.lastPoll = now
+	f := s.filter
+	f.Raw = bson.M{}
+	for k, v := range s.filter.Raw {
+		f.Raw[k] = v
+	}
+	f.Raw["$or"] = []bson.M{
+		{"starttime": bson.M{"$gte": since}},
+		{"endtime": bson.M{"$gte": since}},
+	}
+	f.Sort = "starttime"
+	evts, err := List(&f)
+	if err != nil {
+		return err
+	}
+	for i := range evts {
+		evt := &evts[i]
+		st := s.state(evt.UniqueID)
+		st.matched = true
+		if evt.Running && !st.started {
+			st.started = true
+			s.send(StreamMessage{Type: StreamMessageStart, EventID: evt.UniqueID.Hex(), Event: evt})
+		}
+		if !evt.Running && !st.finished {
+			st.finished = true
+			s.send(StreamMessage{Type: StreamMessageFinish, EventID: evt.UniqueID.Hex(), Event: evt})
+		}
+	}
+	for id, st := range s.states {
+		if time.Since(st.updated) > streamStateTTL {
+			delete(s.states, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func nextMessage(c *check.C, sub *Subscription) StreamMessage {
+	select {
+	case msg, ok := <-sub.Messages():
+		c.Assert(ok, check.Equals, true)
+		return msg
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for stream message")
+	}
+	return StreamMessage{}
+}
+
+func (s *S) TestSubscribeStartLogFinish(c *check.C) {
+	sub, err := Subscribe(&Filter{Target: Target{Type: TargetTypeApp}})
+	c.Assert(err, check.IsNil)
+	defer sub.Close()
+	other, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeNode, Value: "n1"},
+		InternalKind: "healer",
+		Allowed:      Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	other.Logf("ignored")
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("hello %s", "world")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	msg := nextMessage(c, sub)
+	c.Assert(msg.Type, check.Equals, StreamMessageStart)
+	c.Assert(msg.EventID, check.Equals, evt.UniqueID.Hex())
+	c.Assert(msg.Event.Running, check.Equals, true)
+	msg = nextMessage(c, sub)
+	c.Assert(msg, check.DeepEquals, StreamMessage{Type: StreamMessageLog, EventID: evt.UniqueID.Hex(), Log: "hello world\n"})
+	msg = nextMessage(c, sub)
+	c.Assert(msg.Type, check.Equals, StreamMessageFinish)
+	c.Assert(msg.Event.Running, check.Equals, false)
+	c.Assert(msg.Event.Log, check.Equals, "hello world\n")
+}
+
+func (s *S) TestSubscribeHonorsPermissions(c *check.C) {
+	sub, err := Subscribe(&Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxApp, "myapp")},
+	}})
+	c.Assert(err, check.IsNil)
+	defer sub.Close()
+	forbidden, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeApp, Value: "otherapp"},
+		InternalKind: "healer",
+		Allowed:      Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "otherapp")),
+	})
+	c.Assert(err, check.IsNil)
+	err = forbidden.Abort()
+	c.Assert(err, check.IsNil)
+	evt, err := NewInternal(&Opts{
+		Target:       Target{Type: TargetTypeApp, Value: "myapp"},
+		InternalKind: "healer",
+		Allowed:      Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "myapp")),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Abort()
+	c.Assert(err, check.IsNil)
+	msg := nextMessage(c, sub)
+	c.Assert(msg.Type, check.Equals, StreamMessageStart)
+	c.Assert(msg.EventID, check.Equals, evt.UniqueID.Hex())
+	msg = nextMessage(c, sub)
+	c.Assert(msg, check.DeepEquals, StreamMessage{Type: StreamMessageAbort, EventID: evt.UniqueID.Hex()})
+}
+
+func (s *S) TestSubscribePollsRemoteEvents(c *check.C) {
+	oldInterval := streamPollInterval
+	streamPollInterval = 100 * time.Millisecond
+	defer func() { streamPollInterval = oldInterval }()
+	sub, err := Subscribe(nil)
+	c.Assert(err, check.IsNil)
+	defer sub.Close()
+	evt := Event{eventData: eventData{
+		UniqueID:  bson.NewObjectId(),
+		Target:    Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:      Kind{Type: KindTypeInternal, Name: "healer"},
+		Owner:     Owner{Type: OwnerTypeInternal},
+		StartTime: time.Now().UTC(),
+		EndTime:   time.Now().UTC(),
+		Allowed:   Allowed(permission.PermAppReadEvents),
+	}}
+	err = evt.RawInsert(nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	msg := nextMessage(c, sub)
+	c.Assert(msg.Type, check.Equals, StreamMessageFinish)
+	c.Assert(msg.EventID, check.Equals, evt.UniqueID.Hex())
+}
+
+func (s *S) TestSubscribeClose(c *check.C) {
+	sub, err := Subscribe(nil)
+	c.Assert(err, check.IsNil)
+	sub.Close()
+	_, ok := <-sub.Messages()
+	c.Assert(ok, check.Equals, false)
+	c.Assert(sub.Err(), check.IsNil)
+}
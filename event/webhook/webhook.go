@@ -0,0 +1,282 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook implements outgoing webhooks for tsuru events. Registered
+// webhooks receive a POST request with the serialized event every time a
+// matching event finishes.
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RedactedValue replaces header values whenever webhooks are shown to users.
+const RedactedValue = "*****"
+
+var (
+	ErrWebhookAlreadyExists = errors.New("webhook already exists")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+)
+
+// Webhook describes an URL that must be notified about finished events
+// matching EventFilter. When Secret is set, the request body is signed using
+// HMAC-SHA256 and the signature is sent in the X-Tsuru-Signature header.
+type Webhook struct {
+	Name        string `bson:"_id"`
+	Description string
+	URL         string
+	Headers     http.Header
+	Secret      string `json:"-"`
+	Insecure    bool
+	EventFilter EventFilter
+}
+
+// EventFilter selects the events sent to a webhook. Empty fields match every
+// event.
+type EventFilter struct {
+	TargetTypes  []string
+	TargetValues []string
+	KindTypes    []string
+	KindNames    []string
+	ErrorOnly    bool
+	SuccessOnly  bool
+}
+
+func (f *EventFilter) Matches(evt *event.Event) bool {
+	if f.ErrorOnly && evt.Error == "" {
+		return false
+	}
+	if f.SuccessOnly && evt.Error != "" {
+		return false
+	}
+	if len(f.KindTypes) > 0 && !contains(f.KindTypes, string(evt.Kind.Type)) {
+		return false
+	}
+	if len(f.KindNames) > 0 && !contains(f.KindNames, evt.Kind.Name) {
+		return false
+	}
+	targets := []event.Target{evt.Target}
+	for _, et := range evt.ExtraTargets {
+		targets = append(targets, et.Target)
+	}
+	for _, t := range targets {
+		if len(f.TargetTypes) > 0 && !contains(f.TargetTypes, string(t.Type)) {
+			continue
+		}
+		if len(f.TargetValues) > 0 && !contains(f.TargetValues, t.Value) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the webhook with its header values replaced by
+// RedactedValue, as headers usually carry credentials.
+func (w Webhook) Redacted() Webhook {
+	if w.Headers == nil {
+		return w
+	}
+	headers := make(http.Header, len(w.Headers))
+	for k, values := range w.Headers {
+		for range values {
+			headers[k] = append(headers[k], RedactedValue)
+		}
+	}
+	w.Headers = headers
+	return w
+}
+
+func (w *Webhook) validate() error {
+	if w.Name == "" {
+		return &tsuruErrors.ValidationError{Message: "webhook name is required"}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid webhook url %q", w.URL)}
+	}
+	if w.EventFilter.ErrorOnly && w.EventFilter.SuccessOnly {
+		return &tsuruErrors.ValidationError{Message: "error only and success only filters are mutually exclusive"}
+	}
+	return nil
+}
+
+func webhooksCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("webhook"), nil
+}
+
+func Create(w Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+// Update replaces the webhook definition. The stored secret is kept unless
+// updateSecret is true, so that updates not mentioning the secret don't
+// disable the signing of requests.
+func Update(w Webhook, updateSecret bool) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	if !updateSecret {
+		var current Webhook
+		err = coll.FindId(w.Name).One(&current)
+		if err == mgo.ErrNotFound {
+			return ErrWebhookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		w.Secret = current.Secret
+	}
+	err = coll.UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func Delete(name string) error {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func Find(name string) (*Webhook, error) {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var w Webhook
+	err = coll.FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func List() ([]Webhook, error) {
+	coll, err := webhooksCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var webhooks []Webhook
+	err = coll.Find(nil).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+// Delivery records every attempt to send an event to a webhook.
+type Delivery struct {
+	ID          string `bson:"_id"`
+	WebhookName string
+	EventID     bson.ObjectId
+	EventKind   string
+	Status      string
+	CreatedAt   time.Time
+	NextAttempt time.Time `json:"-"`
+	LockedUntil time.Time `json:"-"`
+	Attempts    []Attempt
+}
+
+type Attempt struct {
+	Time       time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+}
+
+func deliveriesCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("webhook_delivery")
+	err = coll.EnsureIndex(mgo.Index{Key: []string{"status", "nextattempt"}})
+	if err != nil {
+		coll.Close()
+		return nil, err
+	}
+	return coll, nil
+}
+
+// ListDeliveries returns the most recent deliveries for the given webhook.
+func ListDeliveries(webhookName string, limit int) ([]Delivery, error) {
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := coll.Find(bson.M{"webhookname": webhookName}).Sort("-createdat")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var deliveries []Delivery
+	err = query.All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
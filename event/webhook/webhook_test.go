@@ -0,0 +1,288 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_event_webhook_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = dbtest.ClearAllCollections(conn.Events().Database)
+	c.Assert(err, check.IsNil)
+	baseRetryDelay = 0
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	baseRetryDelay = 10 * time.Second
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(statusCode int) (*httptest.Server, func() []receivedRequest) {
+	var mu sync.Mutex
+	var requests []receivedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, receivedRequest{header: r.Header, body: body})
+		mu.Unlock()
+		w.WriteHeader(statusCode)
+	}))
+	return srv, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func newFinishedEvent(c *check.C, target event.Target, kind string, evtErr error) *event.Event {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: kind,
+		Allowed:      event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.DoneCustomData(evtErr, map[string]string{"result": "ok"})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestCreateAndFind(c *check.C) {
+	w := Webhook{
+		Name:    "hook1",
+		URL:     "http://example.com/hook",
+		Headers: http.Header{"X-Token": []string{"abc"}},
+		EventFilter: EventFilter{
+			TargetTypes: []string{"app"},
+			KindNames:   []string{"app.deploy"},
+		},
+	}
+	err := Create(w)
+	c.Assert(err, check.IsNil)
+	dbHook, err := Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(*dbHook, check.DeepEquals, w)
+	err = Create(w)
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+}
+
+func (s *S) TestCreateInvalid(c *check.C) {
+	err := Create(Webhook{URL: "http://example.com"})
+	c.Assert(err, check.ErrorMatches, "webhook name is required")
+	err = Create(Webhook{Name: "h", URL: "ftp://example.com"})
+	c.Assert(err, check.ErrorMatches, `invalid webhook url "ftp://example.com"`)
+	err = Create(Webhook{Name: "h", URL: "http://example.com", EventFilter: EventFilter{ErrorOnly: true, SuccessOnly: true}})
+	c.Assert(err, check.ErrorMatches, "error only and success only filters are mutually exclusive")
+}
+
+func (s *S) TestUpdateDeleteList(c *check.C) {
+	err := Create(Webhook{Name: "hook2", URL: "http://example.com/2"})
+	c.Assert(err, check.IsNil)
+	err = Create(Webhook{Name: "hook1", URL: "http://example.com/1"})
+	c.Assert(err, check.IsNil)
+	err = Update(Webhook{Name: "hook1", URL: "http://example.com/updated"}, true)
+	c.Assert(err, check.IsNil)
+	err = Update(Webhook{Name: "hook3", URL: "http://example.com/3"}, true)
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	err = Update(Webhook{Name: "hook3", URL: "http://example.com/3"}, false)
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	hooks, err := List()
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks, check.DeepEquals, []Webhook{
+		{Name: "hook1", URL: "http://example.com/updated"},
+		{Name: "hook2", URL: "http://example.com/2"},
+	})
+	err = Delete("hook2")
+	c.Assert(err, check.IsNil)
+	err = Delete("hook2")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	_, err = Find("hook2")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestUpdateKeepsSecret(c *check.C) {
+	err := Create(Webhook{Name: "hook1", URL: "http://example.com/1", Secret: "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	err = Update(Webhook{Name: "hook1", URL: "http://example.com/updated"}, false)
+	c.Assert(err, check.IsNil)
+	hook, err := Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook, check.DeepEquals, &Webhook{Name: "hook1", URL: "http://example.com/updated", Secret: "s3cr3t"})
+	err = Update(Webhook{Name: "hook1", URL: "http://example.com/updated"}, true)
+	c.Assert(err, check.IsNil)
+	hook, err = Find("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(hook.Secret, check.Equals, "")
+}
+
+func (s *S) TestWebhookRedacted(c *check.C) {
+	hook := Webhook{Name: "hook1", Headers: http.Header{"X-Token": []string{"abc", "def"}}}
+	redacted := hook.Redacted()
+	c.Assert(redacted.Headers, check.DeepEquals, http.Header{"X-Token": []string{RedactedValue, RedactedValue}})
+	c.Assert(hook.Headers.Get("X-Token"), check.Equals, "abc")
+	c.Assert(Webhook{Name: "hook1"}.Redacted(), check.DeepEquals, Webhook{Name: "hook1"})
+}
+
+func (s *S) TestEventFilterMatches(c *check.C) {
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "healer", nil)
+	failed := newFinishedEvent(c, event.Target{Type: event.TargetTypeNode, Value: "n1"}, "healer", errors.New("fail"))
+	tests := []struct {
+		filter   EventFilter
+		evt      *event.Event
+		expected bool
+	}{
+		{EventFilter{}, evt, true},
+		{EventFilter{TargetTypes: []string{"app"}}, evt, true},
+		{EventFilter{TargetTypes: []string{"node"}}, evt, false},
+		{EventFilter{TargetTypes: []string{"app"}, TargetValues: []string{"other"}}, evt, false},
+		{EventFilter{KindNames: []string{"healer"}}, evt, true},
+		{EventFilter{KindNames: []string{"app.deploy"}}, evt, false},
+		{EventFilter{KindTypes: []string{"internal"}}, evt, true},
+		{EventFilter{ErrorOnly: true}, evt, false},
+		{EventFilter{ErrorOnly: true}, failed, true},
+		{EventFilter{SuccessOnly: true}, failed, false},
+	}
+	for i, tt := range tests {
+		c.Assert(tt.filter.Matches(tt.evt), check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestRunOnceDeliversEvent(c *check.C) {
+	srv, requests := newTestServer(http.StatusOK)
+	defer srv.Close()
+	err := Create(Webhook{
+		Name:        "hook1",
+		URL:         srv.URL,
+		Headers:     http.Header{"X-Token": []string{"abc"}},
+		Secret:      "s3cr3t",
+		EventFilter: EventFilter{TargetTypes: []string{"app"}},
+	})
+	c.Assert(err, check.IsNil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "healer", nil)
+	newFinishedEvent(c, event.Target{Type: event.TargetTypeNode, Value: "n1"}, "healer", nil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	reqs := requests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].header.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(reqs[0].header.Get("X-Token"), check.Equals, "abc")
+	c.Assert(reqs[0].header.Get("X-Tsuru-Event"), check.Equals, "healer")
+	c.Assert(reqs[0].header.Get("X-Tsuru-Delivery"), check.Equals, "hook1/"+evt.UniqueID.Hex())
+	c.Assert(reqs[0].header.Get("X-Tsuru-Signature"), check.Equals, Sign("s3cr3t", reqs[0].body))
+	var payload Payload
+	err = json.Unmarshal(reqs[0].body, &payload)
+	c.Assert(err, check.IsNil)
+	c.Assert(payload.ID, check.Equals, evt.UniqueID.Hex())
+	c.Assert(payload.Target, check.DeepEquals, event.Target{Type: event.TargetTypeApp, Value: "myapp"})
+	c.Assert(payload.Successful, check.Equals, true)
+	c.Assert(payload.EndCustomData, check.DeepEquals, map[string]interface{}{"result": "ok"})
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(requests(), check.HasLen, 1)
+	deliveries, err := ListDeliveries("hook1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Status, check.Equals, DeliverySuccess)
+	c.Assert(deliveries[0].Attempts, check.HasLen, 1)
+	c.Assert(deliveries[0].Attempts[0].StatusCode, check.Equals, http.StatusOK)
+}
+
+func (s *S) TestRunOnceRetriesAndFails(c *check.C) {
+	config.Set("event:webhooks:max-attempts", 3)
+	defer config.Unset("event:webhooks:max-attempts")
+	srv, requests := newTestServer(http.StatusInternalServerError)
+	defer srv.Close()
+	err := Create(Webhook{Name: "hook1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "healer", nil)
+	for i := 0; i < 5; i++ {
+		err = RunOnce()
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(requests(), check.HasLen, 3)
+	deliveries, err := ListDeliveries("hook1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Status, check.Equals, DeliveryFailed)
+	c.Assert(deliveries[0].Attempts, check.HasLen, 3)
+	c.Assert(deliveries[0].Attempts[2].StatusCode, check.Equals, http.StatusInternalServerError)
+	c.Assert(deliveries[0].Attempts[2].Error, check.Equals, "invalid status code 500")
+}
+
+func (s *S) TestRunOnceIgnoresEventsBeforeFirstRun(c *check.C) {
+	srv, requests := newTestServer(http.StatusOK)
+	defer srv.Close()
+	err := Create(Webhook{Name: "hook1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "healer", nil)
+	timeNow = func() time.Time { return time.Now().Add(2 * eventScanOverlap) }
+	defer func() { timeNow = time.Now }()
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(requests(), check.HasLen, 0)
+}
+
+func (s *S) TestRunOncePagesEventsWithSameEndTime(c *check.C) {
+	eventScanLimit = 2
+	defer func() { eventScanLimit = 500 }()
+	srv, requests := newTestServer(http.StatusOK)
+	defer srv.Close()
+	err := Create(Webhook{Name: "hook1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 5; i++ {
+		newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "healer", nil)
+	}
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	_, err = conn.Events().UpdateAll(nil, bson.M{"$set": bson.M{"endtime": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(requests(), check.HasLen, 5)
+	deliveries, err := ListDeliveries("hook1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 5)
+}
@@ -0,0 +1,383 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultRunInterval = 5 * time.Second
+	defaultMaxAttempts = 5
+	defaultTimeout     = 30 * time.Second
+
+	// eventScanOverlap is subtracted from the last seen event end time on
+	// each scan, events finishing concurrently with a scan would be lost
+	// otherwise. Duplicates are discarded by the delivery unique id.
+	eventScanOverlap = time.Minute
+
+	stateID = "webhook_worker"
+)
+
+var (
+	eventScanLimit = 500
+	baseRetryDelay = 10 * time.Second
+	timeNow        = time.Now
+)
+
+// Payload is the body sent to webhooks.
+type Payload struct {
+	ID              string
+	Target          event.Target
+	ExtraTargets    []event.ExtraTarget
+	Kind            event.Kind
+	Owner           event.Owner
+	StartTime       time.Time
+	EndTime         time.Time
+	Error           string
+	Successful      bool
+	StartCustomData interface{}
+	EndCustomData   interface{}
+}
+
+func newPayload(evt *event.Event) (*Payload, error) {
+	p := &Payload{
+		ID:           evt.UniqueID.Hex(),
+		Target:       evt.Target,
+		ExtraTargets: evt.ExtraTargets,
+		Kind:         evt.Kind,
+		Owner:        evt.Owner,
+		StartTime:    evt.StartTime,
+		EndTime:      evt.EndTime,
+		Error:        evt.Error,
+		Successful:   evt.Error == "",
+	}
+	var startData, endData bson.M
+	err := evt.StartData(&startData)
+	if err != nil {
+		return nil, err
+	}
+	err = evt.EndData(&endData)
+	if err != nil {
+		return nil, err
+	}
+	if startData != nil {
+		p.StartCustomData = startData
+	}
+	if endData != nil {
+		p.EndCustomData = endData
+	}
+	return p, nil
+}
+
+// Sign returns the signature sent in the X-Tsuru-Signature header for the
+// given body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type workerState struct {
+	ID          string `bson:"_id"`
+	LastEndTime time.Time
+}
+
+type worker struct {
+	runInterval time.Duration
+	maxAttempts int
+	timeout     time.Duration
+	done        chan bool
+	running     bool
+}
+
+var globalWorker *worker
+
+// Initialize starts the worker responsible for sending events to webhooks.
+func Initialize() error {
+	globalWorker = newWorker()
+	shutdown.Register(globalWorker)
+	globalWorker.running = true
+	go globalWorker.run()
+	return nil
+}
+
+// RunOnce scans finished events and sends pending deliveries once.
+func RunOnce() error {
+	return newWorker().runOnce()
+}
+
+func newWorker() *worker {
+	w := &worker{
+		runInterval: defaultRunInterval,
+		maxAttempts: defaultMaxAttempts,
+		timeout:     defaultTimeout,
+		done:        make(chan bool),
+	}
+	if interval, err := config.GetInt("event:webhooks:run-interval"); err == nil && interval > 0 {
+		w.runInterval = time.Duration(interval) * time.Second
+	}
+	if attempts, err := config.GetInt("event:webhooks:max-attempts"); err == nil && attempts > 0 {
+		w.maxAttempts = attempts
+	}
+	if timeout, err := config.GetInt("event:webhooks:timeout"); err == nil && timeout > 0 {
+		w.timeout = time.Duration(timeout) * time.Second
+	}
+	return w
+}
+
+func (w *worker) run() {
+	for {
+		err := w.runOnce()
+		if err != nil {
+			log.Errorf("[webhooks] %s", err)
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(w.runInterval):
+		}
+	}
+}
+
+func (w *worker) runOnce() error {
+	err := w.scanEvents()
+	if err != nil {
+		return errors.Wrap(err, "unable to scan events")
+	}
+	return w.sendPending()
+}
+
+func (w *worker) Shutdown(ctx context.Context) error {
+	if !w.running {
+		return nil
+	}
+	w.done <- true
+	w.running = false
+	return nil
+}
+
+func (w *worker) String() string {
+	return "event webhooks"
+}
+
+func (w *worker) scanEvents() error {
+	webhooks, err := List()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stateColl := conn.Collection("webhook_state")
+	var state workerState
+	err = stateColl.FindId(stateID).One(&state)
+	if err == mgo.ErrNotFound {
+		_, err = stateColl.UpsertId(stateID, workerState{ID: stateID, LastEndTime: timeNow().UTC()})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		_, err = stateColl.UpsertId(stateID, bson.M{"$max": bson.M{"lastendtime": timeNow().UTC()}})
+		return err
+	}
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	// Events are paged by end time using the unique id as tie breaker, a
+	// cursor based only on the end time would never move past more than
+	// eventScanLimit events ending at the same time.
+	notRunning := false
+	cursorTime := state.LastEndTime.Add(-eventScanOverlap)
+	var cursorID bson.ObjectId
+	for {
+		query := bson.M{"endtime": bson.M{"$gt": cursorTime}}
+		if cursorID != "" {
+			query = bson.M{"$or": []bson.M{
+				query,
+				{"endtime": cursorTime, "uniqueid": bson.M{"$gt": cursorID}},
+			}}
+		}
+		evts, err := event.List(&event.Filter{
+			Running: &notRunning,
+			Raw:     query,
+			Sort:    "endtime,uniqueid",
+			Limit:   eventScanLimit,
+		})
+		if err != nil {
+			return err
+		}
+		if len(evts) == 0 {
+			return nil
+		}
+		err = enqueueDeliveries(coll, webhooks, evts)
+		if err != nil {
+			return err
+		}
+		last := evts[len(evts)-1]
+		cursorTime, cursorID = last.EndTime, last.UniqueID
+		_, err = stateColl.UpsertId(stateID, bson.M{"$max": bson.M{"lastendtime": cursorTime}})
+		if err != nil {
+			return err
+		}
+		if len(evts) < eventScanLimit {
+			return nil
+		}
+	}
+}
+
+func enqueueDeliveries(coll *storage.Collection, webhooks []Webhook, evts []event.Event) error {
+	for i := range evts {
+		evt := &evts[i]
+		for _, hook := range webhooks {
+			if !hook.EventFilter.Matches(evt) {
+				continue
+			}
+			err := coll.Insert(Delivery{
+				ID:          fmt.Sprintf("%s/%s", hook.Name, evt.UniqueID.Hex()),
+				WebhookName: hook.Name,
+				EventID:     evt.UniqueID,
+				EventKind:   evt.Kind.Name,
+				Status:      DeliveryPending,
+				CreatedAt:   timeNow().UTC(),
+				NextAttempt: timeNow().UTC(),
+			})
+			if err != nil && !mgo.IsDup(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *worker) sendPending() error {
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := timeNow().UTC()
+	for {
+		var delivery Delivery
+		_, err = coll.Find(bson.M{
+			"status":      DeliveryPending,
+			"nextattempt": bson.M{"$lte": now},
+			"lockeduntil": bson.M{"$lt": now},
+		}).Apply(mgo.Change{
+			Update:    bson.M{"$set": bson.M{"lockeduntil": now.Add(2 * w.timeout)}},
+			ReturnNew: true,
+		}, &delivery)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		attempt := w.deliver(&delivery)
+		update := bson.M{"lockeduntil": time.Time{}}
+		attempts := len(delivery.Attempts) + 1
+		if attempt.Error == "" {
+			update["status"] = DeliverySuccess
+		} else if attempts >= w.maxAttempts {
+			update["status"] = DeliveryFailed
+		} else {
+			update["nextattempt"] = timeNow().UTC().Add(baseRetryDelay * time.Duration(1<<uint(attempts-1)))
+		}
+		err = coll.UpdateId(delivery.ID, bson.M{
+			"$set":  update,
+			"$push": bson.M{"attempts": attempt},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *worker) deliver(delivery *Delivery) Attempt {
+	start := timeNow()
+	attempt := Attempt{Time: start.UTC()}
+	statusCode, err := w.send(delivery)
+	attempt.Duration = timeNow().Sub(start)
+	attempt.StatusCode = statusCode
+	if err != nil {
+		attempt.Error = err.Error()
+		log.Errorf("[webhooks] unable to deliver event %s to webhook %q: %s", delivery.EventID.Hex(), delivery.WebhookName, err)
+	}
+	return attempt
+}
+
+func (w *worker) send(delivery *Delivery) (int, error) {
+	hook, err := Find(delivery.WebhookName)
+	if err != nil {
+		return 0, err
+	}
+	evt, err := event.GetByID(delivery.EventID)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to get event")
+	}
+	payload, err := newPayload(evt)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, values := range hook.Headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tsuru-Event", evt.Kind.Name)
+	req.Header.Set("X-Tsuru-Delivery", delivery.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-Tsuru-Signature", Sign(hook.Secret, body))
+	}
+	client := &http.Client{Timeout: w.timeout}
+	if hook.Insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.StatusCode, errors.Errorf("invalid status code %d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
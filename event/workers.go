@@ -77,6 +77,10 @@ func (l *eventCleaner) tryCleaning() error {
 			eventsExpired.WithLabelValues(evt.Kind.Name).Inc()
 		}
 	}
+	err = deactivateExpiredBlocks()
+	if err != nil {
+		return errors.Wrap(err, "[events] [event cleaner] error deactivating expired blocks")
+	}
 	return nil
 }
 
@@ -1,7 +1,7 @@
 // AUTOMATICALLY GENERATED FILE - DO NOT EDIT!
 // Please run 'go generate' to update this file.
 //
-// Copyright 2017 tsuru authors. All rights reserved.
+// Copyright 2026 tsuru authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
@@ -11,6 +11,7 @@ var (
 	PermAll                              = PermissionRegistry.get("")                                    // [global]
 	PermApp                              = PermissionRegistry.get("app")                                 // [global app team pool]
 	PermAppAdmin                         = PermissionRegistry.get("app.admin")                           // [global app team pool]
+	PermAppAdminLogRateLimit             = PermissionRegistry.get("app.admin.log-rate-limit")            // [global app team pool]
 	PermAppAdminQuota                    = PermissionRegistry.get("app.admin.quota")                     // [global app team pool]
 	PermAppAdminRoutes                   = PermissionRegistry.get("app.admin.routes")                    // [global app team pool]
 	PermAppAdminUnlock                   = PermissionRegistry.get("app.admin.unlock")                    // [global app team pool]
@@ -35,6 +36,9 @@ var (
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
+	PermAppUpdateAutoscale               = PermissionRegistry.get("app.update.autoscale")                // [global app team pool]
+	PermAppUpdateAutoscaleSet            = PermissionRegistry.get("app.update.autoscale.set")            // [global app team pool]
+	PermAppUpdateAutoscaleUnset          = PermissionRegistry.get("app.update.autoscale.unset")          // [global app team pool]
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")                     // [global app team pool]
 	PermAppUpdateBindVolume              = PermissionRegistry.get("app.update.bind-volume")              // [global app team pool]
 	PermAppUpdateCertificate             = PermissionRegistry.get("app.update.certificate")              // [global app team pool]
@@ -87,12 +91,21 @@ var (
 	PermEventBlockRead                   = PermissionRegistry.get("event-block.read")                    // [global]
 	PermEventBlockReadEvents             = PermissionRegistry.get("event-block.read.events")             // [global]
 	PermEventBlockRemove                 = PermissionRegistry.get("event-block.remove")                  // [global]
+	PermEventRetention                   = PermissionRegistry.get("event-retention")                     // [global]
+	PermEventRetentionRead               = PermissionRegistry.get("event-retention.read")                // [global]
+	PermEventRetentionReadEvents         = PermissionRegistry.get("event-retention.read.events")         // [global]
 	PermHealing                          = PermissionRegistry.get("healing")                             // [global pool]
 	PermHealingDelete                    = PermissionRegistry.get("healing.delete")                      // [global pool]
 	PermHealingRead                      = PermissionRegistry.get("healing.read")                        // [global pool]
 	PermHealingUpdate                    = PermissionRegistry.get("healing.update")                      // [global pool]
 	PermInstall                          = PermissionRegistry.get("install")                             // [global]
 	PermInstallManage                    = PermissionRegistry.get("install.manage")                      // [global]
+	PermLogForwarder                     = PermissionRegistry.get("log-forwarder")                       // [global app team pool]
+	PermLogForwarderCreate               = PermissionRegistry.get("log-forwarder.create")                // [global app team pool]
+	PermLogForwarderDelete               = PermissionRegistry.get("log-forwarder.delete")                // [global app team pool]
+	PermLogForwarderRead                 = PermissionRegistry.get("log-forwarder.read")                  // [global app team pool]
+	PermLogForwarderReadEvents           = PermissionRegistry.get("log-forwarder.read.events")           // [global app team pool]
+	PermLogForwarderUpdate               = PermissionRegistry.get("log-forwarder.update")                // [global app team pool]
 	PermMachine                          = PermissionRegistry.get("machine")                             // [global iaas]
 	PermMachineDelete                    = PermissionRegistry.get("machine.delete")                      // [global iaas]
 	PermMachineRead                      = PermissionRegistry.get("machine.read")                        // [global iaas]
@@ -164,6 +177,7 @@ var (
 	PermRoleUpdatePermission             = PermissionRegistry.get("role.update.permission")              // [global]
 	PermRoleUpdatePermissionAdd          = PermissionRegistry.get("role.update.permission.add")          // [global]
 	PermRoleUpdatePermissionRemove       = PermissionRegistry.get("role.update.permission.remove")       // [global]
+	PermRoleUpdateTwoFactor              = PermissionRegistry.get("role.update.two-factor")              // [global]
 	PermService                          = PermissionRegistry.get("service")                             // [global service team]
 	PermServiceInstance                  = PermissionRegistry.get("service-instance")                    // [global service-instance team]
 	PermServiceInstanceCreate            = PermissionRegistry.get("service-instance.create")             // [global team]
@@ -193,11 +207,16 @@ var (
 	PermServiceUpdateProxy               = PermissionRegistry.get("service.update.proxy")                // [global service team]
 	PermServiceUpdateRevokeAccess        = PermissionRegistry.get("service.update.revoke-access")        // [global service team]
 	PermTeam                             = PermissionRegistry.get("team")                                // [global team]
+	PermTeamAdmin                        = PermissionRegistry.get("team.admin")                          // [global team]
+	PermTeamAdminQuota                   = PermissionRegistry.get("team.admin.quota")                    // [global team]
 	PermTeamCreate                       = PermissionRegistry.get("team.create")                         // [global]
 	PermTeamDelete                       = PermissionRegistry.get("team.delete")                         // [global team]
 	PermTeamRead                         = PermissionRegistry.get("team.read")                           // [global team]
 	PermTeamReadEvents                   = PermissionRegistry.get("team.read.events")                    // [global team]
+	PermTeamServiceAccount               = PermissionRegistry.get("team.service-account")                // [global team]
 	PermTeamUpdate                       = PermissionRegistry.get("team.update")                         // [global team]
+	PermUsage                            = PermissionRegistry.get("usage")                               // [global team]
+	PermUsageRead                        = PermissionRegistry.get("usage.read")                          // [global team]
 	PermUser                             = PermissionRegistry.get("user")                                // [global user]
 	PermUserCreate                       = PermissionRegistry.get("user.create")                         // [global]
 	PermUserDelete                       = PermissionRegistry.get("user.delete")                         // [global user]
@@ -211,6 +230,8 @@ var (
 	PermUserUpdateQuota                  = PermissionRegistry.get("user.update.quota")                   // [global user]
 	PermUserUpdateReset                  = PermissionRegistry.get("user.update.reset")                   // [global user]
 	PermUserUpdateToken                  = PermissionRegistry.get("user.update.token")                   // [global user]
+	PermUserUpdateTwoFactor              = PermissionRegistry.get("user.update.two-factor")              // [global user]
+	PermUserUpdateUnlock                 = PermissionRegistry.get("user.update.unlock")                  // [global user]
 	PermVolume                           = PermissionRegistry.get("volume")                              // [global volume team pool]
 	PermVolumeCreate                     = PermissionRegistry.get("volume.create")                       // [global team pool]
 	PermVolumeDelete                     = PermissionRegistry.get("volume.delete")                       // [global volume team pool]
@@ -219,4 +240,10 @@ var (
 	PermVolumeUpdate                     = PermissionRegistry.get("volume.update")                       // [global volume team pool]
 	PermVolumeUpdateBind                 = PermissionRegistry.get("volume.update.bind")                  // [global volume team pool]
 	PermVolumeUpdateUnbind               = PermissionRegistry.get("volume.update.unbind")                // [global volume team pool]
+	PermWebhook                          = PermissionRegistry.get("webhook")                             // [global]
+	PermWebhookCreate                    = PermissionRegistry.get("webhook.create")                      // [global]
+	PermWebhookDelete                    = PermissionRegistry.get("webhook.delete")                      // [global]
+	PermWebhookRead                      = PermissionRegistry.get("webhook.read")                        // [global]
+	PermWebhookReadEvents                = PermissionRegistry.get("webhook.read.events")                 // [global]
+	PermWebhookUpdate                    = PermissionRegistry.get("webhook.update")                      // [global]
 )
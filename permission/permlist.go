@@ -45,6 +45,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.router.add",
 	"app.update.router.update",
 	"app.update.router.remove",
+	"app.update.autoscale.set",
+	"app.update.autoscale.unset",
 	"app.deploy",
 	"app.deploy.archive-url",
 	"app.deploy.build",
@@ -66,6 +68,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.admin.unlock",
 	"app.admin.routes",
 	"app.admin.quota",
+	"app.admin.log-rate-limit",
 	"app.build",
 ).addWithCtx(
 	"node", []contextType{CtxPool},
@@ -101,6 +104,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.read.events",
 	"team.delete",
 	"team.update",
+	"team.admin.quota",
+	"team.service-account",
 ).addWithCtx(
 	"user", []contextType{CtxUser},
 ).addWithCtx(
@@ -114,6 +119,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"user.update.reset",
 	"user.update.key.add",
 	"user.update.key.remove",
+	"user.update.two-factor",
+	"user.update.unlock",
 ).addWithCtx(
 	"service", []contextType{CtxService, CtxTeam},
 ).addWithCtx(
@@ -155,6 +162,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"role.update.context.type",
 	"role.update.permission.add",
 	"role.update.permission.remove",
+	"role.update.two-factor",
 	"role.default.create",
 	"role.default.delete",
 ).add(
@@ -203,6 +211,22 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"event-block.read.events",
 	"event-block.add",
 	"event-block.remove",
+).add(
+	"event-retention.read.events",
+).add(
+	"webhook.read",
+	"webhook.read.events",
+	"webhook.create",
+	"webhook.update",
+	"webhook.delete",
+).addWithCtx(
+	"log-forwarder", []contextType{CtxApp, CtxTeam, CtxPool},
+).add(
+	"log-forwarder.read",
+	"log-forwarder.read.events",
+	"log-forwarder.create",
+	"log-forwarder.update",
+	"log-forwarder.delete",
 ).add(
 	"cluster.read.events",
 	"cluster.create",
@@ -217,4 +241,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"volume.update.bind",
 	"volume.update.unbind",
 	"volume.delete",
+).addWithCtx(
+	"usage", []contextType{CtxTeam},
+).add(
+	"usage.read",
 )
@@ -82,6 +82,9 @@ type Role struct {
 	Description string
 	SchemeNames []string `json:"scheme_names,omitempty"`
 	Events      []string `json:"events,omitempty"`
+	// TwoFactorRequired makes two-factor authentication mandatory for users
+	// with the role, in schemes supporting it.
+	TwoFactorRequired bool `json:"two_factor_required,omitempty"`
 }
 
 func NewRole(name string, ctx string, description string) (Role, error) {
@@ -331,6 +334,23 @@ func (r *Role) RemoveEvent(eventName string) error {
 	return nil
 }
 
+func (r *Role) SetTwoFactorRequired(required bool) error {
+	coll, err := rolesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(r.Name, bson.M{"$set": bson.M{"twofactorrequired": required}})
+	if err == mgo.ErrNotFound {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	r.TwoFactorRequired = required
+	return nil
+}
+
 func rolesCollection() (*storage.Collection, error) {
 	conn, err := db.Conn()
 	if err != nil {
@@ -358,7 +378,14 @@ func (r *Role) Add() error {
 		return err
 	}
 	defer coll.Close()
-	insertRole := Role{Name: name, ContextType: r.ContextType, Description: r.Description, SchemeNames: r.SchemeNames, Events: r.Events}
+	insertRole := Role{
+		Name:              name,
+		ContextType:       r.ContextType,
+		Description:       r.Description,
+		SchemeNames:       r.SchemeNames,
+		Events:            r.Events,
+		TwoFactorRequired: r.TwoFactorRequired,
+	}
 	err = coll.Insert(insertRole)
 	if mgo.IsDup(err) {
 		return ErrRoleAlreadyExists
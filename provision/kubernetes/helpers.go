@@ -105,6 +105,93 @@ func waitFor(timeout time.Duration, fn func() (bool, error), onTimeout func() er
 	}
 }
 
+// waitPodsRemoved waits until the given pods are gone, either removed or
+// replaced by a new pod with the same name.
+func waitPodsRemoved(client *clusterClient, pods []apiv1.Pod, timeout time.Duration) error {
+	return waitFor(timeout, func() (bool, error) {
+		for _, pod := range pods {
+			current, err := client.CoreV1().Pods(client.Namespace()).Get(pod.Name, metav1.GetOptions{})
+			if err != nil {
+				if k8sErrors.IsNotFound(err) {
+					continue
+				}
+				return false, errors.WithStack(err)
+			}
+			if current.UID == pod.UID {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, nil)
+}
+
+// waitDeploymentsAvailable waits until every deployment has as many ready and
+// not terminating pods as its desired replicas. Pods are counted directly as
+// the deployment status may not reflect recently removed pods yet.
+func waitDeploymentsAvailable(client *clusterClient, depNames map[string]struct{}, timeout time.Duration) error {
+	return waitFor(timeout, func() (bool, error) {
+		for name := range depNames {
+			dep, err := client.AppsV1beta2().Deployments(client.Namespace()).Get(name, metav1.GetOptions{})
+			if err != nil {
+				if k8sErrors.IsNotFound(err) {
+					continue
+				}
+				return false, errors.WithStack(err)
+			}
+			if dep.Spec.Replicas == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector)
+			if err != nil {
+				return false, errors.WithStack(err)
+			}
+			pods, err := client.CoreV1().Pods(client.Namespace()).List(metav1.ListOptions{
+				LabelSelector: selector.String(),
+			})
+			if err != nil {
+				return false, errors.WithStack(err)
+			}
+			ready := 0
+			for i := range pods.Items {
+				if pods.Items[i].DeletionTimestamp == nil && isPodReady(&pods.Items[i]) {
+					ready++
+				}
+			}
+			if ready < int(*dep.Spec.Replicas) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, nil)
+}
+
+func isPodReady(pod *apiv1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == apiv1.PodReady {
+			return cond.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setNodeUnschedulable changes whether new pods may be scheduled to the node,
+// returning false if it already had the requested value.
+func setNodeUnschedulable(client *clusterClient, name string, unschedulable bool) (bool, error) {
+	node, err := client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if node.Spec.Unschedulable == unschedulable {
+		return false, nil
+	}
+	node.Spec.Unschedulable = unschedulable
+	_, err = client.CoreV1().Nodes().Update(node)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
 func podsForAppProcess(client *clusterClient, a provision.App, process string) (*apiv1.PodList, error) {
 	labelOpts := provision.ServiceLabelsOpts{
 		App:     a,
@@ -37,6 +37,7 @@ const (
 	defaultPodReadyTimeout           = time.Minute
 	defaultPodRunningTimeout         = 10 * time.Minute
 	defaultDeploymentProgressTimeout = 10 * time.Minute
+	defaultRebalanceMaxUnavailable   = 1
 	defaultDockerImageName           = "docker:1.11.2"
 )
 
@@ -53,14 +54,14 @@ var (
 	_ provision.SleepableProvisioner     = &kubernetesProvisioner{}
 	_ provision.ImageDeployer            = &kubernetesProvisioner{}
 	_ provision.VolumeProvisioner        = &kubernetesProvisioner{}
+	_ provision.RollbackableDeployer     = &kubernetesProvisioner{}
+	_ provision.NodeRebalanceProvisioner = &kubernetesProvisioner{}
+	_ provision.AppFilterProvisioner     = &kubernetesProvisioner{}
 	// _ provision.ArchiveDeployer          = &kubernetesProvisioner{}
 	// _ provision.InitializableProvisioner = &kubernetesProvisioner{}
-	// _ provision.RollbackableDeployer     = &kubernetesProvisioner{}
 	// _ provision.RebuildableDeployer      = &kubernetesProvisioner{}
 	// _ provision.OptionalLogsProvisioner  = &kubernetesProvisioner{}
 	// _ provision.UnitStatusProvisioner    = &kubernetesProvisioner{}
-	// _ provision.NodeRebalanceProvisioner = &kubernetesProvisioner{}
-	// _ provision.AppFilterProvisioner     = &kubernetesProvisioner{}
 	// _ builder.PlatformBuilder            = &kubernetesProvisioner{}
 )
 
@@ -84,6 +85,9 @@ type kubernetesConfig struct {
 	// DeploymentProgressTimeout is the timeout for a deployment to
 	// successfully complete.
 	DeploymentProgressTimeout time.Duration
+	// RebalanceMaxUnavailable is the maximum number of units evicted at the
+	// same time during a node rebalance.
+	RebalanceMaxUnavailable int
 }
 
 func getKubeConfig() kubernetesConfig {
@@ -126,6 +130,10 @@ func getKubeConfig() kubernetesConfig {
 	} else {
 		conf.DeploymentProgressTimeout = defaultDeploymentProgressTimeout
 	}
+	conf.RebalanceMaxUnavailable, _ = config.GetInt("kubernetes:rebalance-max-unavailable")
+	if conf.RebalanceMaxUnavailable <= 0 {
+		conf.RebalanceMaxUnavailable = defaultRebalanceMaxUnavailable
+	}
 	return conf
 }
 
@@ -737,6 +745,33 @@ func (p *kubernetesProvisioner) UploadDeploy(a provision.App, archiveFile io.Rea
 	return buildingImage, nil
 }
 
+func (p *kubernetesProvisioner) Rollback(a provision.App, imageID string, evt *event.Event) (string, error) {
+	imageID, err := image.GetAppImageBySuffix(a.GetName(), imageID)
+	if err != nil {
+		return "", err
+	}
+	imgMetaData, err := image.GetImageMetaData(imageID)
+	if err != nil {
+		return "", err
+	}
+	if imgMetaData.DisableRollback {
+		return "", errors.Errorf("Can't Rollback image %s, reason: %s", imageID, imgMetaData.Reason)
+	}
+	client, err := clusterForPool(a.GetPool())
+	if err != nil {
+		return "", err
+	}
+	manager := &serviceManager{
+		client: client,
+		writer: evt,
+	}
+	err = servicecommon.RunServicePipeline(manager, a, imageID, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return imageID, nil
+}
+
 func (p *kubernetesProvisioner) UpgradeNodeContainer(name string, pool string, writer io.Writer) error {
 	m := nodeContainerManager{}
 	return servicecommon.UpgradeNodeContainer(&m, name, pool, writer)
@@ -888,6 +923,207 @@ func (p *kubernetesProvisioner) Sleep(a provision.App, process string) error {
 	return changeState(a, process, servicecommon.ProcessState{Stop: true, Sleep: true}, nil)
 }
 
+func (p *kubernetesProvisioner) FilterAppsByUnitStatus(apps []provision.App, status []string) ([]provision.App, error) {
+	if apps == nil {
+		return nil, errors.Errorf("apps must be provided to FilterAppsByUnitStatus")
+	}
+	if status == nil {
+		return make([]provision.App, 0), nil
+	}
+	statusSet := set.FromSlice(status)
+	result := make([]provision.App, 0)
+	for _, a := range apps {
+		units, err := p.units(a)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range units {
+			if statusSet.Includes(u.Status.String()) {
+				result = append(result, a)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *kubernetesProvisioner) RebalanceNodes(opts provision.RebalanceNodesOptions) (bool, error) {
+	if opts.MetadataFilter == nil {
+		opts.MetadataFilter = map[string]string{}
+	}
+	if opts.Pool != "" {
+		opts.MetadataFilter[provision.PoolMetadataName] = opts.Pool
+	}
+	var clients []*clusterClient
+	if opts.Pool != "" {
+		client, err := clusterForPool(opts.Pool)
+		if err != nil {
+			return false, err
+		}
+		clients = append(clients, client)
+	} else {
+		var err error
+		clients, err = allClusters()
+		if err != nil {
+			if err == cluster.ErrNoCluster {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	var rebalanced bool
+	for _, client := range clients {
+		clusterRebalanced, err := p.rebalanceNodesForCluster(client, opts)
+		if err != nil {
+			return rebalanced, err
+		}
+		rebalanced = rebalanced || clusterRebalanced
+	}
+	return rebalanced, nil
+}
+
+func (p *kubernetesProvisioner) rebalanceNodesForCluster(client *clusterClient, opts provision.RebalanceNodesOptions) (bool, error) {
+	nodes, err := p.listNodesForCluster(client, nil)
+	if err != nil {
+		return false, err
+	}
+	podsByNode := map[string][]apiv1.Pod{}
+	for _, n := range nodes {
+		kubeNode := n.(*kubernetesNodeWrapper).node
+		if kubeNode.Spec.Unschedulable || !provision.MatchesMetadata(n.MetadataNoPrefix(), opts.MetadataFilter) {
+			continue
+		}
+		podsByNode[kubeNode.Name] = nil
+	}
+	if len(podsByNode) == 0 {
+		fmt.Fprintf(opts.Event, "No nodes matching metadata filters\n")
+		return false, nil
+	}
+	var appSet set.Set
+	if len(opts.AppFilter) > 0 {
+		appSet = set.FromSlice(opts.AppFilter)
+	}
+	l := provision.LabelSet{Prefix: tsuruLabelPrefix}
+	l.SetIsService()
+	pods, err := client.CoreV1().Pods(client.Namespace()).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set(l.ToIsServiceSelector())).String(),
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	total := 0
+	for _, pod := range pods.Items {
+		if _, ok := podsByNode[pod.Spec.NodeName]; !ok {
+			continue
+		}
+		if appSet != nil && !appSet.Includes(labelSetFromMeta(&pod.ObjectMeta).AppName()) {
+			continue
+		}
+		podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+		total++
+	}
+	if total == 0 {
+		fmt.Fprintf(opts.Event, "No units found to rebalance\n")
+		return false, nil
+	}
+	maxPerNode := total / len(podsByNode)
+	if total%len(podsByNode) != 0 {
+		maxPerNode++
+	}
+	minCount, maxCount := total, 0
+	var toEvict []apiv1.Pod
+	var sourceNodes []string
+	for nodeName, nodePods := range podsByNode {
+		if len(nodePods) < minCount {
+			minCount = len(nodePods)
+		}
+		if len(nodePods) > maxCount {
+			maxCount = len(nodePods)
+		}
+		if len(nodePods) > maxPerNode {
+			toEvict = append(toEvict, nodePods[maxPerNode:]...)
+			sourceNodes = append(sourceNodes, nodeName)
+		}
+	}
+	isOnlyPool := len(opts.MetadataFilter) == 1 && opts.MetadataFilter[provision.PoolMetadataName] != ""
+	if !opts.Force && isOnlyPool && len(opts.AppFilter) == 0 {
+		gap := maxCount - minCount
+		gapAfter := 0
+		if total%len(podsByNode) != 0 {
+			gapAfter = 1
+		}
+		if gap-gapAfter <= 2 {
+			return false, nil
+		}
+		fmt.Fprintf(opts.Event, "Rebalancing as gap is %d, after rebalance gap will be %d\n", gap, gapAfter)
+	}
+	if len(toEvict) == 0 {
+		fmt.Fprintf(opts.Event, "No units found to rebalance\n")
+		return false, nil
+	}
+	fmt.Fprintf(opts.Event, "Rebalancing %d units...\n", len(toEvict))
+	if opts.Dry {
+		for _, pod := range toEvict {
+			fmt.Fprintf(opts.Event, " ---> Would evict unit %s from node %s\n", pod.Name, pod.Spec.NodeName)
+		}
+		return true, nil
+	}
+	// Nodes losing units are cordoned while rebalancing, otherwise the evicted
+	// pods could be scheduled back to them.
+	var cordoned []string
+	defer func() {
+		for _, nodeName := range cordoned {
+			fmt.Fprintf(opts.Event, " ---> Uncordoning node %s\n", nodeName)
+			if _, err := setNodeUnschedulable(client, nodeName, false); err != nil {
+				fmt.Fprintf(opts.Event, " ---> Unable to uncordon node %s: %s\n", nodeName, err)
+			}
+		}
+	}()
+	for _, nodeName := range sourceNodes {
+		fmt.Fprintf(opts.Event, " ---> Cordoning node %s\n", nodeName)
+		changed, err := setNodeUnschedulable(client, nodeName, true)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			cordoned = append(cordoned, nodeName)
+		}
+	}
+	kubeConf := getKubeConfig()
+	for len(toEvict) > 0 {
+		batchSize := kubeConf.RebalanceMaxUnavailable
+		if batchSize > len(toEvict) {
+			batchSize = len(toEvict)
+		}
+		batch := toEvict[:batchSize]
+		toEvict = toEvict[batchSize:]
+		depNames := map[string]struct{}{}
+		for _, pod := range batch {
+			fmt.Fprintf(opts.Event, " ---> Evicting unit %s from node %s\n", pod.Name, pod.Spec.NodeName)
+			err = client.CoreV1().Pods(client.Namespace()).Evict(&policy.Eviction{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      pod.Name,
+					Namespace: client.Namespace(),
+				},
+			})
+			if err != nil {
+				return true, errors.WithStack(err)
+			}
+			podLabels := labelSetFromMeta(&pod.ObjectMeta)
+			depNames[deploymentNameForApp(&app.App{Name: podLabels.AppName()}, podLabels.AppProcess())] = struct{}{}
+		}
+		err = waitPodsRemoved(client, batch, kubeConf.DeploymentProgressTimeout)
+		if err != nil {
+			return true, err
+		}
+		err = waitDeploymentsAvailable(client, depNames, kubeConf.DeploymentProgressTimeout)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
 func (p *kubernetesProvisioner) DeleteVolume(volumeName, pool string) error {
 	client, err := clusterForPool(pool)
 	if err != nil {
@@ -7,6 +7,7 @@ package kubernetes
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -28,6 +29,7 @@ import (
 	"gopkg.in/check.v1"
 	"k8s.io/api/apps/v1beta2"
 	apiv1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ktesting "k8s.io/client-go/testing"
@@ -840,6 +842,66 @@ func (s *S) TestImageDeployWithProcfile(c *check.C) {
 	c.Assert(units, check.HasLen, 1)
 }
 
+func (s *S) TestRollback(c *check.C) {
+	a, wait, rollback := s.defaultReactions(c)
+	defer rollback()
+	imgData := image.ImageMetadata{
+		Name:      "tsuru/app-myapp:v1",
+		Processes: map[string][]string{"web": {"python myapp.py"}},
+	}
+	err := imgData.Save()
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	img, err := s.p.Rollback(a, "v1", evt)
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	c.Assert(img, check.Equals, "tsuru/app-myapp:v1")
+	wait()
+	deps, err := s.client.AppsV1beta2().Deployments(s.client.Namespace()).List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(deps.Items, check.HasLen, 1)
+	c.Assert(deps.Items[0].Name, check.Equals, "myapp-web")
+	containers := deps.Items[0].Spec.Template.Spec.Containers
+	c.Assert(containers, check.HasLen, 1)
+	c.Assert(containers[0].Image, check.Equals, "tsuru/app-myapp:v1")
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil, check.Commentf("%+v", err))
+	c.Assert(units, check.HasLen, 1)
+}
+
+func (s *S) TestRollbackNoDeployImage(c *check.C) {
+	a := provisiontest.NewFakeApp("otherapp", "python", 1)
+	_, err := s.p.Rollback(a, "inexist", nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*image.ImageNotFoundErr)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.App, check.Equals, "otherapp")
+	c.Assert(e.Image, check.Equals, "inexist")
+}
+
+func (s *S) TestRollbackDisabledImage(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	imgData := image.ImageMetadata{
+		Name:            "tsuru/app-myapp:v1",
+		Processes:       map[string][]string{"web": {"python myapp.py"}},
+		DisableRollback: true,
+		Reason:          "buggy version",
+	}
+	err := imgData.Save()
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.Rollback(a, "v1", nil)
+	c.Assert(err, check.ErrorMatches, `Can't Rollback image tsuru/app-myapp:v1, reason: buggy version`)
+}
+
 func (s *S) TestUpgradeNodeContainer(c *check.C) {
 	s.mockfakeNodes(c)
 	c1 := nodecontainer.NodeContainerConfig{
@@ -1168,6 +1230,7 @@ func (s *S) TestGetKubeConfig(c *check.C) {
 	config.Set("kubernetes:pod-ready-timeout", 6)
 	config.Set("kubernetes:pod-running-timeout", 2*60)
 	config.Set("kubernetes:deployment-progress-timeout", 3*60)
+	config.Set("kubernetes:rebalance-max-unavailable", 3)
 	defer config.Unset("kubernetes")
 	kubeConf := getKubeConfig()
 	c.Assert(kubeConf, check.DeepEquals, kubernetesConfig{
@@ -1178,6 +1241,7 @@ func (s *S) TestGetKubeConfig(c *check.C) {
 		PodReadyTimeout:           6 * time.Second,
 		PodRunningTimeout:         2 * time.Minute,
 		DeploymentProgressTimeout: 3 * time.Minute,
+		RebalanceMaxUnavailable:   3,
 	})
 }
 
@@ -1192,5 +1256,198 @@ func (s *S) TestGetKubeConfigDefaults(c *check.C) {
 		PodReadyTimeout:           time.Minute,
 		PodRunningTimeout:         10 * time.Minute,
 		DeploymentProgressTimeout: 10 * time.Minute,
+		RebalanceMaxUnavailable:   1,
+	})
+}
+
+func (s *S) TestFilterAppsByUnitStatus(c *check.C) {
+	a, wait, rollback := s.defaultReactions(c)
+	defer rollback()
+	imgName := "myapp:v1"
+	err := image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.Start(a, "")
+	c.Assert(err, check.IsNil)
+	wait()
+	apps, err := s.p.FilterAppsByUnitStatus([]provision.App{a}, []string{"started"})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.DeepEquals, []provision.App{a})
+	apps, err = s.p.FilterAppsByUnitStatus([]provision.App{a}, []string{"error", "stopped"})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.DeepEquals, []provision.App{})
+	apps, err = s.p.FilterAppsByUnitStatus([]provision.App{a}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.DeepEquals, []provision.App{})
+	_, err = s.p.FilterAppsByUnitStatus(nil, []string{"started"})
+	c.Assert(err, check.ErrorMatches, "apps must be provided to FilterAppsByUnitStatus")
+}
+
+func (s *S) createRebalancePods(c *check.C, node string, count int) {
+	for i := 0; i < count; i++ {
+		_, err := s.client.CoreV1().Pods(s.client.Namespace()).Create(&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("myapp-web-%s-%d", node, i),
+				Namespace: s.client.Namespace(),
+				Labels: map[string]string{
+					"tsuru.io/is-tsuru":    "true",
+					"tsuru.io/is-service":  "true",
+					"tsuru.io/app-name":    "myapp",
+					"tsuru.io/app-process": "web",
+				},
+			},
+			Spec: apiv1.PodSpec{NodeName: node},
+		})
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *S) evictionReaction() *[]string {
+	var evicted []string
+	s.client.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(ktesting.CreateAction).GetObject().(*policy.Eviction)
+		evicted = append(evicted, eviction.Name)
+		// The fake client is locked while reacting, the evicted pod is
+		// removed as soon as the eviction returns.
+		go s.client.CoreV1().Pods(s.client.Namespace()).Delete(eviction.Name, nil)
+		return true, eviction, nil
+	})
+	return &evicted
+}
+
+func (s *S) TestRebalanceNodes(c *check.C) {
+	s.mockfakeNodes(c)
+	s.createRebalancePods(c, "n1", 6)
+	evicted := s.evictionReaction()
+	buf := safe.NewBuffer(nil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "test-default"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.SetLogWriter(buf)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "test-default",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, true)
+	c.Assert(*evicted, check.HasLen, 3)
+	c.Assert(buf.String(), check.Matches, `(?s)Rebalancing as gap is 6, after rebalance gap will be 0.*Rebalancing 3 units.*Cordoning node n1.*Evicting unit myapp-web-n1-.* from node n1.*Uncordoning node n1.*`)
+	node, err := s.client.CoreV1().Nodes().Get("n1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Spec.Unschedulable, check.Equals, false)
+}
+
+func (s *S) TestRebalanceNodesWaitsEvictedPods(c *check.C) {
+	config.Set("kubernetes:deployment-progress-timeout", 1)
+	defer config.Unset("kubernetes:deployment-progress-timeout")
+	s.mockfakeNodes(c)
+	s.createRebalancePods(c, "n1", 4)
+	var evicted []string
+	s.client.PrependReactor("create", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(ktesting.CreateAction).GetObject().(*policy.Eviction)
+		evicted = append(evicted, eviction.Name)
+		return true, eviction, nil
+	})
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "test-default"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "test-default",
+		Force: true,
 	})
+	c.Assert(err, check.ErrorMatches, "timeout after 1s")
+	c.Assert(evicted, check.HasLen, 1)
+	node, err := s.client.CoreV1().Nodes().Get("n1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Spec.Unschedulable, check.Equals, false)
+}
+
+func (s *S) TestRebalanceNodesDry(c *check.C) {
+	s.mockfakeNodes(c)
+	s.createRebalancePods(c, "n1", 4)
+	evicted := s.evictionReaction()
+	buf := safe.NewBuffer(nil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "test-default"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.SetLogWriter(buf)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "test-default",
+		Force: true,
+		Dry:   true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, true)
+	c.Assert(*evicted, check.HasLen, 0)
+	c.Assert(buf.String(), check.Matches, `(?s)Rebalancing 2 units.*Would evict unit myapp-web-n1-.* from node n1.*`)
+	pods, err := s.client.CoreV1().Pods(s.client.Namespace()).List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(pods.Items, check.HasLen, 4)
+}
+
+func (s *S) TestRebalanceNodesBalanced(c *check.C) {
+	s.mockfakeNodes(c)
+	s.createRebalancePods(c, "n1", 2)
+	s.createRebalancePods(c, "n2", 1)
+	evicted := s.evictionReaction()
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "test-default"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "test-default",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, false)
+	c.Assert(*evicted, check.HasLen, 0)
+}
+
+func (s *S) TestRebalanceNodesAppFilter(c *check.C) {
+	s.mockfakeNodes(c)
+	s.createRebalancePods(c, "n1", 4)
+	evicted := s.evictionReaction()
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "test-default"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event:     evt,
+		Pool:      "test-default",
+		AppFilter: []string{"otherapp"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, false)
+	c.Assert(*evicted, check.HasLen, 0)
 }
@@ -477,6 +477,18 @@ type RebalanceNodesOptions struct {
 	Force          bool
 }
 
+// MatchesMetadata returns whether every key in filter is present in metadata
+// with the same value. Used by provisioners to select the nodes affected by
+// RebalanceNodesOptions.MetadataFilter.
+func MatchesMetadata(metadata, filter map[string]string) bool {
+	for k, v := range filter {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 type NodeRebalanceProvisioner interface {
 	RebalanceNodes(RebalanceNodesOptions) (bool, error)
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/tsuru/tsuru/provision/dockercommon"
 	"github.com/tsuru/tsuru/provision/nodecontainer"
 	"github.com/tsuru/tsuru/provision/servicecommon"
+	"github.com/tsuru/tsuru/set"
 )
 
 const (
@@ -49,13 +50,13 @@ var (
 	_ provision.SleepableProvisioner     = &swarmProvisioner{}
 	_ provision.BuilderDeploy            = &swarmProvisioner{}
 	_ provision.VolumeProvisioner        = &swarmProvisioner{}
+	_ provision.RollbackableDeployer     = &swarmProvisioner{}
+	_ provision.NodeRebalanceProvisioner = &swarmProvisioner{}
+	_ provision.AppFilterProvisioner     = &swarmProvisioner{}
 	_ cluster.InitClusterProvisioner     = &swarmProvisioner{}
-	// _ provision.RollbackableDeployer     = &swarmProvisioner{}
 	// _ provision.RebuildableDeployer      = &swarmProvisioner{}
 	// _ provision.OptionalLogsProvisioner  = &swarmProvisioner{}
 	// _ provision.UnitStatusProvisioner    = &swarmProvisioner{}
-	// _ provision.NodeRebalanceProvisioner = &swarmProvisioner{}
-	// _ provision.AppFilterProvisioner     = &swarmProvisioner{}
 	// _ provision.ExtensibleProvisioner    = &swarmProvisioner{}
 	// _ builder.PlatformBuilder            = &swarmProvisioner{}
 )
@@ -697,6 +698,25 @@ func (p *swarmProvisioner) Deploy(a provision.App, buildImageID string, evt *eve
 	return deployImage, nil
 }
 
+func (p *swarmProvisioner) Rollback(a provision.App, imageID string, evt *event.Event) (string, error) {
+	imageID, err := image.GetAppImageBySuffix(a.GetName(), imageID)
+	if err != nil {
+		return "", err
+	}
+	imgMetaData, err := image.GetImageMetaData(imageID)
+	if err != nil {
+		return "", err
+	}
+	if imgMetaData.DisableRollback {
+		return "", errors.Errorf("Can't Rollback image %s, reason: %s", imageID, imgMetaData.Reason)
+	}
+	err = deployProcesses(a, imageID, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return imageID, nil
+}
+
 func (p *swarmProvisioner) Shell(opts provision.ShellOptions) error {
 	client, err := clusterForPool(opts.App.GetPool())
 	if err != nil {
@@ -1079,6 +1099,182 @@ func (p *swarmProvisioner) Sleep(a provision.App, process string) error {
 	}, a, process, servicecommon.ProcessState{Stop: true, Sleep: true})
 }
 
+func (p *swarmProvisioner) FilterAppsByUnitStatus(apps []provision.App, status []string) ([]provision.App, error) {
+	if apps == nil {
+		return nil, errors.Errorf("apps must be provided to FilterAppsByUnitStatus")
+	}
+	if status == nil {
+		return make([]provision.App, 0), nil
+	}
+	statusSet := set.FromSlice(status)
+	result := make([]provision.App, 0)
+	for _, a := range apps {
+		units, err := p.units(a)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range units {
+			if statusSet.Includes(u.Status.String()) {
+				result = append(result, a)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *swarmProvisioner) RebalanceNodes(opts provision.RebalanceNodesOptions) (bool, error) {
+	if opts.MetadataFilter == nil {
+		opts.MetadataFilter = map[string]string{}
+	}
+	if opts.Pool != "" {
+		opts.MetadataFilter[provision.PoolMetadataName] = opts.Pool
+	}
+	var clients []*clusterClient
+	if opts.Pool != "" {
+		client, err := clusterForPool(opts.Pool)
+		if err != nil {
+			return false, err
+		}
+		clients = append(clients, client)
+	} else {
+		var err error
+		clients, err = allClusters()
+		if err != nil {
+			if errors.Cause(err) == cluster.ErrNoCluster {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	var rebalanced bool
+	for _, client := range clients {
+		clusterRebalanced, err := p.rebalanceNodesForCluster(client, opts)
+		if err != nil {
+			return rebalanced, err
+		}
+		rebalanced = rebalanced || clusterRebalanced
+	}
+	return rebalanced, nil
+}
+
+func (p *swarmProvisioner) rebalanceNodesForCluster(client *clusterClient, opts provision.RebalanceNodesOptions) (bool, error) {
+	nodes, err := client.ListNodes(docker.ListNodesOptions{})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	tasksByNode := map[string]int{}
+	for i := range nodes {
+		if nodes[i].Spec.Availability != swarm.NodeAvailabilityActive {
+			continue
+		}
+		wrapped := &swarmNodeWrapper{Node: &nodes[i], provisioner: p, client: client}
+		if !provision.MatchesMetadata(wrapped.MetadataNoPrefix(), opts.MetadataFilter) {
+			continue
+		}
+		tasksByNode[nodes[i].ID] = 0
+	}
+	if len(tasksByNode) == 0 {
+		fmt.Fprintf(opts.Event, "No nodes matching metadata filters\n")
+		return false, nil
+	}
+	var appSet set.Set
+	if len(opts.AppFilter) > 0 {
+		appSet = set.FromSlice(opts.AppFilter)
+	}
+	services, err := client.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	appServices := map[string]*swarm.Service{}
+	for i, srv := range services {
+		srvLabels := provision.LabelSet{Labels: srv.Spec.Annotations.Labels, Prefix: tsuruLabelPrefix}
+		if !srvLabels.IsService() {
+			continue
+		}
+		if appSet != nil && !appSet.Includes(srvLabels.AppName()) {
+			continue
+		}
+		appServices[srv.ID] = &services[i]
+	}
+	l := provision.LabelSet{Prefix: tsuruLabelPrefix}
+	l.SetIsService()
+	tasks, err := client.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{
+			"label": toLabelSelectors(l.ToIsServiceSelector()),
+		},
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	var toUpdate []*swarm.Service
+	total := 0
+	for _, t := range tasks {
+		if t.DesiredState == swarm.TaskStateShutdown {
+			continue
+		}
+		if _, ok := tasksByNode[t.NodeID]; !ok {
+			continue
+		}
+		srv, ok := appServices[t.ServiceID]
+		if !ok {
+			continue
+		}
+		tasksByNode[t.NodeID]++
+		total++
+		if srv != nil {
+			toUpdate = append(toUpdate, srv)
+			appServices[t.ServiceID] = nil
+		}
+	}
+	if total == 0 {
+		fmt.Fprintf(opts.Event, "No units found to rebalance\n")
+		return false, nil
+	}
+	isOnlyPool := len(opts.MetadataFilter) == 1 && opts.MetadataFilter[provision.PoolMetadataName] != ""
+	if !opts.Force && isOnlyPool && len(opts.AppFilter) == 0 {
+		minCount, maxCount := total, 0
+		for _, count := range tasksByNode {
+			if count < minCount {
+				minCount = count
+			}
+			if count > maxCount {
+				maxCount = count
+			}
+		}
+		gap := maxCount - minCount
+		gapAfter := 0
+		if total%len(tasksByNode) != 0 {
+			gapAfter = 1
+		}
+		if gap-gapAfter <= 2 {
+			return false, nil
+		}
+		fmt.Fprintf(opts.Event, "Rebalancing as gap is %d, after rebalance gap will be %d\n", gap, gapAfter)
+	}
+	fmt.Fprintf(opts.Event, "Rebalancing %d units in %d services...\n", total, len(toUpdate))
+	for _, srv := range toUpdate {
+		if opts.Dry {
+			fmt.Fprintf(opts.Event, " ---> Would force update of service %s\n", srv.Spec.Name)
+			continue
+		}
+		fmt.Fprintf(opts.Event, " ---> Forcing update of service %s\n", srv.Spec.Name)
+		srv.Spec.TaskTemplate.ForceUpdate++
+		err = client.UpdateService(srv.ID, docker.UpdateServiceOptions{
+			Version:     srv.Version.Index,
+			ServiceSpec: srv.Spec,
+		})
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+		_, err = waitForTasks(client, srv.ID, swarm.TaskStateRunning)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
 func (p *swarmProvisioner) InitializeCluster(c *cluster.Cluster) error {
 	client, err := newClusterClient(c)
 	if err != nil {
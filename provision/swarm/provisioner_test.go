@@ -1191,6 +1191,75 @@ func (s *S) TestDeployImageID(c *check.C) {
 	})
 }
 
+func (s *S) TestRollback(c *check.C) {
+	s.addCluster(c)
+	cli, err := docker.NewClient(s.clusterSrv.URL())
+	c.Assert(err, check.IsNil)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name}
+	err = app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": []string{"/bin/sh", "-c", "python test.py"},
+		},
+	}
+	err = image.SaveImageCustomData("registry.tsuru.io/tsuru/app-"+a.Name+":v1", customData)
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.tsuru.io/tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.Name, "registry.tsuru.io/tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	pullOpts := docker.PullImageOptions{
+		Repository: "tsuru/app-myapp",
+		Tag:        "v1",
+	}
+	err = cli.PullImage(pullOpts, docker.AuthConfiguration{})
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: a.GetName()},
+		Kind:    permission.PermAppDeploy,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermAppDeploy),
+	})
+	c.Assert(err, check.IsNil)
+	deployedImg, err := s.p.Rollback(a, "v1", evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(deployedImg, check.Equals, "registry.tsuru.io/tsuru/app-myapp:v1")
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+	c.Assert(units[0].ProcessName, check.Equals, "web")
+	srv, err := cli.InspectService(serviceNameForApp(a, "web"))
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.Spec.TaskTemplate.ContainerSpec.Image, check.Equals, "registry.tsuru.io/tsuru/app-myapp:v1")
+}
+
+func (s *S) TestRollbackNoDeployImage(c *check.C) {
+	a := provisiontest.NewFakeApp("otherapp", "python", 1)
+	_, err := s.p.Rollback(a, "inexist", nil)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*image.ImageNotFoundErr)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.App, check.Equals, "otherapp")
+	c.Assert(e.Image, check.Equals, "inexist")
+}
+
+func (s *S) TestRollbackDisabledImage(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	imgData := image.ImageMetadata{
+		Name:            "registry.tsuru.io/tsuru/app-myapp:v1",
+		Processes:       map[string][]string{"web": {"python myapp.py"}},
+		DisableRollback: true,
+		Reason:          "buggy version",
+	}
+	err := imgData.Save()
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), "registry.tsuru.io/tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.Rollback(a, "v1", nil)
+	c.Assert(err, check.ErrorMatches, `Can't Rollback image registry.tsuru.io/tsuru/app-myapp:v1, reason: buggy version`)
+}
+
 func (s *S) TestDestroy(c *check.C) {
 	s.addCluster(c)
 	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
@@ -1831,3 +1900,137 @@ func (s *S) TestInitializeCluster(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(nodes, check.HasLen, 1)
 }
+
+func (s *S) TestFilterAppsByUnitStatus(c *check.C) {
+	s.addCluster(c)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	apps, err := s.p.FilterAppsByUnitStatus([]provision.App{a}, []string{"starting"})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.DeepEquals, []provision.App{a})
+	apps, err = s.p.FilterAppsByUnitStatus([]provision.App{a}, []string{"error"})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.DeepEquals, []provision.App{})
+	_, err = s.p.FilterAppsByUnitStatus(nil, []string{"starting"})
+	c.Assert(err, check.ErrorMatches, "apps must be provided to FilterAppsByUnitStatus")
+}
+
+func (s *S) TestRebalanceNodes(c *check.C) {
+	s.addCluster(c)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "bonehunters"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.SetLogWriter(buf)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "bonehunters",
+		Force: true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, true)
+	c.Assert(buf.String(), check.Matches, `(?s)Rebalancing 2 units in 1 services.*Forcing update of service myapp-web.*`)
+	srv, err := s.clusterCli.InspectService("myapp-web")
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.Spec.TaskTemplate.ForceUpdate, check.Equals, uint64(1))
+}
+
+func (s *S) TestRebalanceNodesDry(c *check.C) {
+	s.addCluster(c)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "bonehunters"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.SetLogWriter(buf)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "bonehunters",
+		Force: true,
+		Dry:   true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, true)
+	c.Assert(buf.String(), check.Matches, `(?s)Rebalancing 2 units in 1 services.*Would force update of service myapp-web.*`)
+	srv, err := s.clusterCli.InspectService("myapp-web")
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.Spec.TaskTemplate.ForceUpdate, check.Equals, uint64(0))
+}
+
+func (s *S) TestRebalanceNodesNotNeeded(c *check.C) {
+	s.addCluster(c)
+	a := &app.App{Name: "myapp", TeamOwner: s.team.Name, Deploys: 1}
+	err := app.CreateApp(a, s.user)
+	c.Assert(err, check.IsNil)
+	imgName := "myapp:v1"
+	err = image.SaveImageCustomData(imgName, map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapp.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = image.AppendAppImageName(a.GetName(), imgName)
+	c.Assert(err, check.IsNil)
+	err = s.p.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypePool, Value: "bonehunters"},
+		Kind:    permission.PermNodeUpdateRebalance,
+		Owner:   s.token,
+		Allowed: event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	rebalanced, err := s.p.RebalanceNodes(provision.RebalanceNodesOptions{
+		Event: evt,
+		Pool:  "bonehunters",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rebalanced, check.Equals, false)
+}
@@ -26,3 +26,16 @@ type QuotaExceededError struct {
 func (err *QuotaExceededError) Error() string {
 	return fmt.Sprintf("Quota exceeded. Available: %d. Requested: %d.", err.Available, err.Requested)
 }
+
+// TeamQuotaExceededError is returned when an operation would make a team use
+// more of a resource than allowed by its quota.
+type TeamQuotaExceededError struct {
+	Team      string
+	Resource  string
+	Requested int64
+	Available int64
+}
+
+func (err *TeamQuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded for team %q %s. Available: %d. Requested: %d.", err.Team, err.Resource, err.Available, err.Requested)
+}
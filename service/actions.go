@@ -107,6 +107,25 @@ var createServiceInstance = action.Action{
 	MinParams: 2,
 }
 
+// checkServiceInstanceTeamQuota is an action that checks the team quota
+// again after the instance is inserted in the database, as concurrent
+// creations for the same team may all pass the check made before. When the
+// quota is exceeded the pipeline is rolled back, removing the instance.
+//
+// The second argument in the context must be a Service Instance.
+var checkServiceInstanceTeamQuota = action.Action{
+	Name: "check-service-instance-team-quota",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		instance, ok := ctx.Params[1].(ServiceInstance)
+		if !ok {
+			return nil, errors.New("Second parameter must be a ServiceInstance.")
+		}
+		return nil, checkTeamQuota(instance)
+	},
+	Backward:  func(ctx action.BWContext) {},
+	MinParams: 2,
+}
+
 // updateServiceInstance is an action that updates an instance in the database.
 //
 // The second argument in the context must be a Service Instance with the current attributes.
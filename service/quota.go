@@ -0,0 +1,89 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TeamServiceInstancesInUse returns the number of service instances owned by
+// the team for each service.
+func TeamServiceInstancesInUse(teamName string) (map[string]int, error) {
+	return teamServiceInstancesInUse(teamName, nil)
+}
+
+func teamServiceInstancesInUse(teamName string, except *ServiceInstance) (map[string]int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var instances []ServiceInstance
+	err = conn.ServiceInstances().Find(bson.M{"teamowner": teamName}).Select(bson.M{"name": 1, "service_name": 1}).All(&instances)
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]int{}
+	for _, instance := range instances {
+		if except != nil && instance.Name == except.Name && instance.ServiceName == except.ServiceName {
+			continue
+		}
+		inUse[instance.ServiceName]++
+	}
+	return inUse, nil
+}
+
+// checkTeamQuota returns an error if the instance would exceed the service
+// instances quota of its team owner, either for all services or for the
+// service of the instance. The instance itself is not counted, so the check
+// may be repeated after inserting it, see checkServiceInstanceTeamQuota.
+func checkTeamQuota(instance ServiceInstance) error {
+	team, err := auth.GetTeam(instance.TeamOwner)
+	if err != nil {
+		return err
+	}
+	limit := team.Quota.ServiceInstances
+	serviceLimit := team.Quota.Services[instance.ServiceName]
+	if limit <= 0 && serviceLimit <= 0 {
+		return nil
+	}
+	inUse, err := teamServiceInstancesInUse(instance.TeamOwner, &instance)
+	if err != nil {
+		return err
+	}
+	if limit > 0 {
+		var total int
+		for _, n := range inUse {
+			total += n
+		}
+		if total >= limit {
+			return &quota.TeamQuotaExceededError{
+				Team:      instance.TeamOwner,
+				Resource:  "serviceinstances",
+				Requested: 1,
+				Available: available(limit, total),
+			}
+		}
+	}
+	if serviceLimit > 0 && inUse[instance.ServiceName] >= serviceLimit {
+		return &quota.TeamQuotaExceededError{
+			Team:      instance.TeamOwner,
+			Resource:  "services/" + instance.ServiceName,
+			Requested: 1,
+			Available: available(serviceLimit, inUse[instance.ServiceName]),
+		}
+	}
+	return nil
+}
+
+func available(limit, inUse int) int64 {
+	if inUse >= limit {
+		return 0
+	}
+	return int64(limit - inUse)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/tsuru/tsuru/action"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/quota"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *InstanceSuite) TestCreateServiceInstanceTeamQuota(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	mongodb := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}, Password: "s3cr3t"}
+	err := s.conn.Services().Insert(&mongodb)
+	c.Assert(err, check.IsNil)
+	redis := Service{Name: "redis", Endpoint: map[string]string{"production": ts.URL}, Password: "s3cr3t"}
+	err = s.conn.Services().Insert(&redis)
+	c.Assert(err, check.IsNil)
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{ServiceInstances: 3, Services: map[string]int{"mongodb": 1}})
+	c.Assert(err, check.IsNil)
+	err = CreateServiceInstance(ServiceInstance{Name: "mongo1", TeamOwner: s.team.Name}, &mongodb, s.user, "")
+	c.Assert(err, check.IsNil)
+	err = CreateServiceInstance(ServiceInstance{Name: "mongo2", TeamOwner: s.team.Name}, &mongodb, s.user, "")
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{Team: s.team.Name, Resource: "services/mongodb", Requested: 1, Available: 0})
+	err = CreateServiceInstance(ServiceInstance{Name: "redis1", TeamOwner: s.team.Name}, &redis, s.user, "")
+	c.Assert(err, check.IsNil)
+	err = CreateServiceInstance(ServiceInstance{Name: "redis2", TeamOwner: s.team.Name}, &redis, s.user, "")
+	c.Assert(err, check.IsNil)
+	err = CreateServiceInstance(ServiceInstance{Name: "redis3", TeamOwner: s.team.Name}, &redis, s.user, "")
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{Team: s.team.Name, Resource: "serviceinstances", Requested: 1, Available: 0})
+	inUse, err := TeamServiceInstancesInUse(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(inUse, check.DeepEquals, map[string]int{"mongodb": 1, "redis": 2})
+}
+
+func (s *InstanceSuite) TestCheckServiceInstanceTeamQuotaRollsBack(c *check.C) {
+	var destroyed bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			destroyed = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	mongodb := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}, Password: "s3cr3t"}
+	err := s.conn.Services().Insert(&mongodb)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Insert(ServiceInstance{Name: "mongo1", ServiceName: "mongodb", TeamOwner: s.team.Name})
+	c.Assert(err, check.IsNil)
+	instance := ServiceInstance{Name: "mongo2", ServiceName: "mongodb", TeamOwner: s.team.Name}
+	err = auth.SetTeamQuota(s.team.Name, authTypes.TeamQuota{ServiceInstances: 1})
+	c.Assert(err, check.IsNil)
+	pipeline := action.NewPipeline(&notifyCreateServiceInstance, &createServiceInstance, &checkServiceInstanceTeamQuota)
+	err = pipeline.Execute(mongodb, instance, s.user.Email, "")
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{Team: s.team.Name, Resource: "serviceinstances", Requested: 1, Available: 0})
+	c.Assert(destroyed, check.Equals, true)
+	inUse, err := TeamServiceInstancesInUse(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(inUse, check.DeepEquals, map[string]int{"mongodb": 1})
+}
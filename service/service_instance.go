@@ -394,9 +394,13 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 		return err
 	}
 	instance.ServiceName = service.Name
+	err = checkTeamQuota(instance)
+	if err != nil {
+		return err
+	}
 	instance.Teams = []string{instance.TeamOwner}
 	instance.Tags = processTags(instance.Tags)
-	actions := []*action.Action{&notifyCreateServiceInstance, &createServiceInstance}
+	actions := []*action.Action{&notifyCreateServiceInstance, &createServiceInstance, &checkServiceInstanceTeamQuota}
 	pipeline := action.NewPipeline(actions...)
 	return pipeline.Execute(*service, instance, user.Email, requestID)
 }
@@ -16,11 +16,13 @@ import (
 type PlanService struct{}
 
 type plan struct {
-	Name     string `bson:"_id"`
-	Memory   int64
-	Swap     int64
-	CpuShare int
-	Default  bool
+	Name         string `bson:"_id"`
+	Memory       int64
+	Swap         int64
+	CpuShare     int
+	Default      bool
+	LogRateLimit int
+	Cost         float64
 }
 
 func plansCollection(conn *db.Storage) *dbStorage.Collection {
@@ -17,6 +17,7 @@ type TeamService struct{}
 type team struct {
 	Name         string `bson:"_id"`
 	CreatingUser string
+	Quota        auth.TeamQuota
 }
 
 func teamsCollection(conn *db.Storage) *dbStorage.Collection {
@@ -93,3 +94,16 @@ func (s *TeamService) Delete(t auth.Team) error {
 	}
 	return err
 }
+
+func (s *TeamService) SetQuota(name string, quota auth.TeamQuota) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = teamsCollection(conn).UpdateId(name, bson.M{"$set": bson.M{"quota": quota}})
+	if err == mgo.ErrNotFound {
+		return auth.ErrTeamNotFound
+	}
+	return err
+}
@@ -101,3 +101,20 @@ func (s *TeamSuite) TestDeleteTeamNotFound(c *check.C) {
 	err := s.TeamService.Delete(auth.Team{Name: "myteam"})
 	c.Assert(err, check.Equals, auth.ErrTeamNotFound)
 }
+
+func (s *TeamSuite) TestSetTeamQuota(c *check.C) {
+	team := auth.Team{Name: "atreides"}
+	err := s.TeamService.Insert(team)
+	c.Assert(err, check.IsNil)
+	quota := auth.TeamQuota{Memory: 1024, CpuShare: 100}
+	err = s.TeamService.SetQuota(team.Name, quota)
+	c.Assert(err, check.IsNil)
+	t, err := s.TeamService.FindByName(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Quota, check.DeepEquals, quota)
+}
+
+func (s *TeamSuite) TestSetTeamQuotaNotFound(c *check.C) {
+	err := s.TeamService.SetQuota("atreides", auth.TeamQuota{Memory: 1024})
+	c.Assert(err, check.Equals, auth.ErrTeamNotFound)
+}
@@ -10,11 +10,13 @@ import (
 )
 
 type Plan struct {
-	Name     string `json:"name"`
-	Memory   int64  `json:"memory"`
-	Swap     int64  `json:"swap"`
-	CpuShare int    `json:"cpushare"`
-	Default  bool   `json:"default,omitempty"`
+	Name         string  `json:"name"`
+	Memory       int64   `json:"memory"`
+	Swap         int64   `json:"swap"`
+	CpuShare     int     `json:"cpushare"`
+	Default      bool    `json:"default,omitempty"`
+	LogRateLimit int     `json:"logratelimit,omitempty"`
+	Cost         float64 `json:"cost,omitempty"`
 }
 
 type PlanService interface {
@@ -14,6 +14,21 @@ import (
 type Team struct {
 	Name         string `json:"name"`
 	CreatingUser string
+	Quota        TeamQuota `json:"quota"`
+}
+
+// TeamQuota limits the resources owned by a team. Memory and CpuShare limit
+// the resources reserved by the units of the apps owned by the team,
+// according to the apps plans. ServiceInstances limits the number of service
+// instances owned by the team and Services limits them for each service.
+// Volumes limits the number of volumes owned by the team. A zero limit means
+// the resource is not limited.
+type TeamQuota struct {
+	Memory           int64          `json:"memory"`
+	CpuShare         int            `json:"cpushare"`
+	ServiceInstances int            `json:"serviceinstances"`
+	Services         map[string]int `json:"services,omitempty"`
+	Volumes          int            `json:"volumes"`
 }
 
 type TeamService interface {
@@ -22,6 +37,7 @@ type TeamService interface {
 	FindByName(string) (*Team, error)
 	FindByNames([]string) ([]Team, error)
 	Delete(Team) error
+	SetQuota(string, TeamQuota) error
 }
 
 var (
@@ -0,0 +1,163 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	mgo "gopkg.in/mgo.v2"
+)
+
+var globalSampler *Sampler
+
+// Sampler periodically counts the units of each app process, storing them as
+// samples aggregated into hourly usage records. Samples are identified by
+// the interval they were taken in, so multiple tsuru API instances sampling
+// at the same time do not count units twice.
+type Sampler struct {
+	Interval time.Duration
+	done     chan bool
+	running  bool
+}
+
+// InitializeSampler starts the usage sampler worker. The worker is only
+// started when the usage:sample-interval config is set.
+func InitializeSampler() error {
+	interval, _ := config.GetInt("usage:sample-interval")
+	if interval <= 0 {
+		return nil
+	}
+	globalSampler = &Sampler{
+		Interval: time.Duration(interval) * time.Second,
+		done:     make(chan bool),
+	}
+	shutdown.Register(globalSampler)
+	globalSampler.running = true
+	go globalSampler.run()
+	return nil
+}
+
+// run samples once per interval slot. Samples are taken right after the slot
+// boundaries, sleeping a full interval after each sample would make the
+// sampling drift and periodically skip slots, under counting the usage.
+func (s *Sampler) run() {
+	s.runSample(time.Now())
+	now := time.Now()
+	select {
+	case <-s.done:
+		return
+	case <-time.After(now.Truncate(s.Interval).Add(s.Interval).Sub(now)):
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	s.runSample(time.Now())
+	for {
+		select {
+		case <-s.done:
+			return
+		case now = <-ticker.C:
+			s.runSample(now)
+		}
+	}
+}
+
+func (s *Sampler) runSample(now time.Time) {
+	err := s.sample(now)
+	if err != nil {
+		s.logError(err.Error())
+	}
+}
+
+func (s *Sampler) logError(msg string, params ...interface{}) {
+	msg = fmt.Sprintf("[usage sampler] %s", msg)
+	log.Errorf(msg, params...)
+}
+
+func (s *Sampler) Shutdown(ctx context.Context) error {
+	if !s.running {
+		return nil
+	}
+	s.done <- true
+	s.running = false
+	return nil
+}
+
+func (s *Sampler) String() string {
+	return "usage sampler"
+}
+
+func (s *Sampler) sample(now time.Time) (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	slot := now.UTC().Truncate(s.Interval)
+	apps, err := app.List(nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list apps")
+	}
+	// Apps hold a copy of their plan from when it was set, the cost is taken
+	// from the current plan with the same name.
+	plans, err := app.PlansList()
+	if err != nil {
+		return errors.Wrap(err, "unable to list plans")
+	}
+	costs := make(map[string]float64, len(plans))
+	for _, p := range plans {
+		costs[p.Name] = p.Cost
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, a := range apps {
+		units, err := a.Units()
+		if err != nil {
+			s.logError("unable to list units for app %q: %s", a.Name, err)
+			continue
+		}
+		processes := map[string]int{}
+		for _, u := range units {
+			if u.Status == provision.StatusStopped || u.Status == provision.StatusAsleep {
+				continue
+			}
+			processes[u.ProcessName]++
+		}
+		cost, ok := costs[a.Plan.Name]
+		if !ok {
+			cost = a.Plan.Cost
+		}
+		for process, count := range processes {
+			err = samplesCollection(conn).Insert(sample{
+				ID:       fmt.Sprintf("%d/%s/%s", slot.Unix(), a.Name, process),
+				Time:     slot,
+				App:      a.Name,
+				Process:  process,
+				Team:     a.TeamOwner,
+				Pool:     a.Pool,
+				Plan:     a.Plan.Name,
+				Memory:   a.Plan.Memory,
+				Cost:     cost,
+				Units:    count,
+				Duration: s.Interval.Seconds(),
+			})
+			if err != nil && !mgo.IsDup(err) {
+				return errors.Wrapf(err, "unable to store usage sample for app %q", a.Name)
+			}
+		}
+	}
+	return aggregate(slot)
+}
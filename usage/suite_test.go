@@ -0,0 +1,81 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/provision/pool"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	_ "github.com/tsuru/tsuru/storage/mongodb"
+	appTypes "github.com/tsuru/tsuru/types/app"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+var _ = check.Suite(&S{})
+
+type S struct {
+	p    *provisiontest.FakeProvisioner
+	conn *db.Storage
+	plan appTypes.Plan
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("log:disable-syslog", true)
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "usage_tests_s")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	routertest.FakeRouter.Reset()
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+	provisiontest.ProvisionerInstance.Reset()
+	s.p = provisiontest.ProvisionerInstance
+	err = pool.AddPool(pool.AddPoolOptions{Name: "pool1", Provisioner: "fake"})
+	c.Assert(err, check.IsNil)
+	s.plan = appTypes.Plan{Name: "small", Memory: 512 * 1024 * 1024, CpuShare: 10, Cost: 0.5}
+	err = app.SavePlan(s.plan)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *S) newApp(c *check.C, name, team string, units map[string]uint) *provisiontest.FakeApp {
+	fakeApp := provisiontest.NewFakeApp(name, "python", 0)
+	fakeApp.Pool = "pool1"
+	err := s.p.Provision(fakeApp)
+	c.Assert(err, check.IsNil)
+	for process, n := range units {
+		err = s.p.AddUnits(fakeApp, n, process, nil)
+		c.Assert(err, check.IsNil)
+	}
+	err = s.conn.Apps().Insert(&app.App{
+		Name:      name,
+		TeamOwner: team,
+		Pool:      "pool1",
+		Plan:      s.plan,
+	})
+	c.Assert(err, check.IsNil)
+	return fakeApp
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package usage samples the units of the apps running in tsuru and
+// aggregates them into hourly usage records per team, pool and plan, used to
+// report the resources consumed by each team and their cost.
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	dbStorage "github.com/tsuru/tsuru/db/storage"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const gigabyte = 1024 * 1024 * 1024
+
+// Usage is the amount of resources used by the apps of a team, running in a
+// pool with a plan. Cost is the number of unit-hours multiplied by the cost
+// configured in the plan.
+type Usage struct {
+	Team          string  `json:"team"`
+	Pool          string  `json:"pool"`
+	Plan          string  `json:"plan"`
+	UnitHours     float64 `json:"unithours"`
+	MemoryGBHours float64 `json:"memorygbhours"`
+	Cost          float64 `json:"cost"`
+}
+
+// Filter selects the usage records included in a report. Records are
+// included when their hour is in the [From, To) interval. A nil Teams means
+// records of all teams are included.
+type Filter struct {
+	Teams []string
+	Pool  string
+	From  time.Time
+	To    time.Time
+}
+
+// record is the usage of a team, pool and plan during one hour.
+type record struct {
+	ID    string `bson:"_id"`
+	Hour  time.Time
+	Usage `bson:",inline"`
+}
+
+// sample is the number of units of an app process running at a given time,
+// representing the usage for Duration seconds.
+type sample struct {
+	ID       string `bson:"_id"`
+	Time     time.Time
+	App      string
+	Process  string
+	Team     string
+	Pool     string
+	Plan     string
+	Memory   int64
+	Cost     float64
+	Units    int
+	Duration float64
+}
+
+func recordsCollection(conn *db.Storage) *dbStorage.Collection {
+	c := conn.Collection("usage")
+	c.EnsureIndex(mgo.Index{Key: []string{"team", "hour"}})
+	return c
+}
+
+func samplesCollection(conn *db.Storage) *dbStorage.Collection {
+	c := conn.Collection("usage_samples")
+	c.EnsureIndex(mgo.Index{Key: []string{"time"}})
+	return c
+}
+
+// Report returns the usage matching the filter summed per team, pool and
+// plan, sorted by team, pool and plan.
+func Report(filter Filter) ([]Usage, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{}
+	if filter.Teams != nil {
+		query["team"] = bson.M{"$in": filter.Teams}
+	}
+	if filter.Pool != "" {
+		query["pool"] = filter.Pool
+	}
+	hourQuery := bson.M{}
+	if !filter.From.IsZero() {
+		hourQuery["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		hourQuery["$lt"] = filter.To
+	}
+	if len(hourQuery) > 0 {
+		query["hour"] = hourQuery
+	}
+	var records []record
+	err = recordsCollection(conn).Find(query).All(&records)
+	if err != nil {
+		return nil, err
+	}
+	var result []Usage
+	indexes := map[[3]string]int{}
+	for _, r := range records {
+		key := [3]string{r.Team, r.Pool, r.Plan}
+		i, ok := indexes[key]
+		if !ok {
+			i = len(result)
+			indexes[key] = i
+			result = append(result, Usage{Team: r.Team, Pool: r.Pool, Plan: r.Plan})
+		}
+		result[i].UnitHours += r.UnitHours
+		result[i].MemoryGBHours += r.MemoryGBHours
+		result[i].Cost += r.Cost
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Team != result[j].Team {
+			return result[i].Team < result[j].Team
+		}
+		if result[i].Pool != result[j].Pool {
+			return result[i].Pool < result[j].Pool
+		}
+		return result[i].Plan < result[j].Plan
+	})
+	return result, nil
+}
+
+// aggregate updates the usage records of the hour of now and of the previous
+// hour with the samples taken during them, removing older samples, which were
+// already aggregated.
+func aggregate(now time.Time) error {
+	hour := now.UTC().Truncate(time.Hour)
+	for _, h := range []time.Time{hour.Add(-time.Hour), hour} {
+		err := aggregateHour(h)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = samplesCollection(conn).RemoveAll(bson.M{"time": bson.M{"$lt": hour.Add(-time.Hour)}})
+	return err
+}
+
+func aggregateHour(hour time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var samples []sample
+	err = samplesCollection(conn).Find(bson.M{
+		"time": bson.M{"$gte": hour, "$lt": hour.Add(time.Hour)},
+	}).All(&samples)
+	if err != nil {
+		return err
+	}
+	records := map[[3]string]*record{}
+	for _, s := range samples {
+		key := [3]string{s.Team, s.Pool, s.Plan}
+		r, ok := records[key]
+		if !ok {
+			r = &record{
+				ID:    fmt.Sprintf("%d/%s/%s/%s", hour.Unix(), s.Team, s.Pool, s.Plan),
+				Hour:  hour,
+				Usage: Usage{Team: s.Team, Pool: s.Pool, Plan: s.Plan},
+			}
+			records[key] = r
+		}
+		unitHours := float64(s.Units) * s.Duration / 3600
+		r.UnitHours += unitHours
+		r.MemoryGBHours += unitHours * float64(s.Memory) / gigabyte
+		r.Cost += unitHours * s.Cost
+	}
+	for _, r := range records {
+		_, err = recordsCollection(conn).UpsertId(r.ID, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
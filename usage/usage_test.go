@@ -0,0 +1,82 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSampleAndReport(c *check.C) {
+	s.newApp(c, "myapp", "team1", map[string]uint{"web": 2, "worker": 1})
+	s.newApp(c, "otherapp", "team2", map[string]uint{"web": 1})
+	stopped := s.newApp(c, "stoppedapp", "team2", map[string]uint{"web": 3})
+	err := s.p.Stop(stopped, "")
+	c.Assert(err, check.IsNil)
+	sampler := &Sampler{Interval: 15 * time.Minute}
+	now := time.Date(2018, 5, 10, 10, 5, 0, 0, time.UTC)
+	err = sampler.sample(now)
+	c.Assert(err, check.IsNil)
+	err = sampler.sample(now.Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	err = sampler.sample(now.Add(15 * time.Minute))
+	c.Assert(err, check.IsNil)
+	report, err := Report(Filter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, []Usage{
+		{Team: "team1", Pool: "pool1", Plan: "small", UnitHours: 1.5, MemoryGBHours: 0.75, Cost: 0.75},
+		{Team: "team2", Pool: "pool1", Plan: "small", UnitHours: 0.5, MemoryGBHours: 0.25, Cost: 0.25},
+	})
+	report, err = Report(Filter{Teams: []string{"team2"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, []Usage{
+		{Team: "team2", Pool: "pool1", Plan: "small", UnitHours: 0.5, MemoryGBHours: 0.25, Cost: 0.25},
+	})
+	report, err = Report(Filter{From: now.Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.HasLen, 0)
+	report, err = Report(Filter{Pool: "otherpool"})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.HasLen, 0)
+}
+
+func (s *S) TestSampleAggregatesHourly(c *check.C) {
+	s.newApp(c, "myapp", "team1", map[string]uint{"web": 1})
+	sampler := &Sampler{Interval: 30 * time.Minute}
+	start := time.Date(2018, 5, 10, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		err := sampler.sample(start.Add(time.Duration(i) * 30 * time.Minute))
+		c.Assert(err, check.IsNil)
+	}
+	conn := s.conn
+	n, err := recordsCollection(conn).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 3)
+	n, err = samplesCollection(conn).Find(bson.M{"time": bson.M{"$lt": start.Add(time.Hour)}}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	report, err := Report(Filter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, []Usage{
+		{Team: "team1", Pool: "pool1", Plan: "small", UnitHours: 2, MemoryGBHours: 1, Cost: 1},
+	})
+}
+
+func (s *S) TestSampleUsesCurrentPlanCost(c *check.C) {
+	s.newApp(c, "myapp", "team1", map[string]uint{"web": 2})
+	err := s.conn.Apps().Update(bson.M{"name": "myapp"}, bson.M{"$set": bson.M{"plan.cost": 0}})
+	c.Assert(err, check.IsNil)
+	sampler := &Sampler{Interval: 30 * time.Minute}
+	now := time.Date(2018, 5, 10, 10, 0, 0, 0, time.UTC)
+	err = sampler.sample(now)
+	c.Assert(err, check.IsNil)
+	report, err := Report(Filter{})
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, []Usage{
+		{Team: "team1", Pool: "pool1", Plan: "small", UnitHours: 1, MemoryGBHours: 0.5, Cost: 0.5},
+	})
+}
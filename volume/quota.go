@@ -0,0 +1,56 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package volume
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TeamVolumesInUse returns the number of volumes owned by the team.
+func TeamVolumesInUse(teamName string) (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer conn.Close()
+	n, err := conn.Volumes().Find(bson.M{"teamowner": teamName}).Count()
+	return n, errors.WithStack(err)
+}
+
+// checkTeamQuota returns an error if the volume would exceed the volumes
+// quota of its team owner. The volume itself is not counted, so the check may
+// be repeated after saving it, see Save.
+func (v *Volume) checkTeamQuota() error {
+	team, err := auth.GetTeam(v.TeamOwner)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	limit := team.Quota.Volumes
+	if limit <= 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+	inUse, err := conn.Volumes().Find(bson.M{"teamowner": v.TeamOwner, "_id": bson.M{"$ne": v.Name}}).Count()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if inUse >= limit {
+		return &quota.TeamQuotaExceededError{
+			Team:      v.TeamOwner,
+			Resource:  "volumes",
+			Requested: 1,
+			Available: 0,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package volume
+
+import (
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/quota"
+	authTypes "github.com/tsuru/tsuru/types/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestVolumeSaveTeamQuota(c *check.C) {
+	err := auth.SetTeamQuota("myteam", authTypes.TeamQuota{Volumes: 2})
+	c.Assert(err, check.IsNil)
+	v1 := Volume{Name: "v1", Plan: VolumePlan{Name: "p1"}, Pool: "mypool", TeamOwner: "myteam"}
+	err = v1.Save()
+	c.Assert(err, check.IsNil)
+	v2 := Volume{Name: "v2", Plan: VolumePlan{Name: "p1"}, Pool: "mypool", TeamOwner: "myteam"}
+	err = v2.Save()
+	c.Assert(err, check.IsNil)
+	v2.Opts = map[string]string{"opt1": "val1"}
+	err = v2.Save()
+	c.Assert(err, check.IsNil)
+	v3 := Volume{Name: "v3", Plan: VolumePlan{Name: "p1"}, Pool: "mypool", TeamOwner: "myteam"}
+	err = v3.Save()
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{Team: "myteam", Resource: "volumes", Requested: 1, Available: 0})
+	v3.TeamOwner = "otherteam"
+	err = v3.Save()
+	c.Assert(err, check.IsNil)
+	v3.TeamOwner = "myteam"
+	err = v3.Save()
+	c.Assert(err, check.DeepEquals, &quota.TeamQuotaExceededError{Team: "myteam", Resource: "volumes", Requested: 1, Available: 0})
+	n, err := TeamVolumesInUse("myteam")
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 2)
+}
@@ -14,6 +14,7 @@ import (
 	internalConfig "github.com/tsuru/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/pool"
 	"github.com/tsuru/tsuru/validation"
@@ -100,13 +101,41 @@ func (v *Volume) Save() error {
 	if err != nil {
 		return err
 	}
+	err = v.checkTeamQuota()
+	if err != nil {
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	defer conn.Close()
+	var previous *Volume
+	err = conn.Volumes().FindId(v.Name).One(&previous)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.WithStack(err)
+	}
 	_, err = conn.Volumes().UpsertId(v.Name, v)
-	return errors.WithStack(err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Concurrent saves for the same team may all pass the first check, so
+	// it's made again with the volume saved, restoring the previous one if
+	// the quota is exceeded.
+	err = v.checkTeamQuota()
+	if err != nil {
+		var rollbackErr error
+		if previous == nil {
+			rollbackErr = conn.Volumes().RemoveId(v.Name)
+		} else {
+			_, rollbackErr = conn.Volumes().UpsertId(v.Name, previous)
+		}
+		if rollbackErr != nil {
+			log.Errorf("unable to roll back volume %q exceeding the team quota: %s", v.Name, rollbackErr)
+		}
+		return err
+	}
+	return nil
 }
 
 func (v *Volume) BindApp(appName, mountPoint string, readOnly bool) error {